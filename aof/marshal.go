@@ -0,0 +1,160 @@
+package aof
+
+import (
+	"GoRedis/datastruct/hash"
+	"GoRedis/datastruct/jsondoc"
+	"GoRedis/datastruct/list"
+	"GoRedis/datastruct/set"
+	"GoRedis/datastruct/sortedset"
+	"GoRedis/datastruct/stream"
+	"GoRedis/interface/database"
+	"GoRedis/resp/reply"
+	"strconv"
+	"time"
+)
+
+var setCmd = []byte("SET")
+
+// EntityToCmd 将 DataEntity 序列化为可以重建它的指令
+func EntityToCmd(key string, entity *database.DataEntity) *reply.MultiBulkReply {
+	if entity == nil {
+		return nil
+	}
+	var cmd *reply.MultiBulkReply
+	switch val := entity.Data.(type) {
+	case []byte:
+		cmd = stringToCmd(key, val)
+	case list.List:
+		cmd = listToCmd(key, val)
+	case *set.Set:
+		cmd = setToCmd(key, val)
+	case *hash.Hash:
+		cmd = hashToCmd(key, val)
+	case *stream.Stream:
+		cmd = streamToCmd(key, val)
+	case *sortedset.SortedSet:
+		cmd = zSetToCmd(key, val)
+	case *jsondoc.Value:
+		cmd = jsonToCmd(key, val)
+	}
+	return cmd
+}
+
+func stringToCmd(key string, bytes []byte) *reply.MultiBulkReply {
+	args := make([][]byte, 3)
+	args[0] = setCmd
+	args[1] = []byte(key)
+	args[2] = bytes
+	return reply.MakeMultiBulkReply(args)
+}
+
+var rPushAllCmd = []byte("RPUSH")
+
+func listToCmd(key string, list list.List) *reply.MultiBulkReply {
+	args := make([][]byte, 2+list.Len())
+	args[0] = rPushAllCmd
+	args[1] = []byte(key)
+	list.ForEach(func(i int, val interface{}) bool {
+		bytes, _ := val.([]byte)
+		args[2+i] = bytes
+		return true
+	})
+	return reply.MakeMultiBulkReply(args)
+}
+
+var sAddCmd = []byte("SADD")
+
+func setToCmd(key string, s *set.Set) *reply.MultiBulkReply {
+	args := make([][]byte, 0, 2+s.Len())
+	args = append(args, sAddCmd, []byte(key))
+	s.ForEach(func(member string) bool {
+		args = append(args, []byte(member))
+		return true
+	})
+	return reply.MakeMultiBulkReply(args)
+}
+
+var hSetCmd = []byte("HSET")
+
+func hashToCmd(key string, h *hash.Hash) *reply.MultiBulkReply {
+	args := make([][]byte, 0, 2+h.Len()*2)
+	args = append(args, hSetCmd, []byte(key))
+	h.ForEach(func(field string, value []byte) bool {
+		args = append(args, []byte(field), value)
+		return true
+	})
+	return reply.MakeMultiBulkReply(args)
+}
+
+var zAddCmd = []byte("ZADD")
+
+func zSetToCmd(key string, zset *sortedset.SortedSet) *reply.MultiBulkReply {
+	args := make([][]byte, 0, 2+zset.Len()*2)
+	args = append(args, zAddCmd, []byte(key))
+	zset.ForEachByRank(0, int64(zset.Len()), false, func(element *sortedset.Element) bool {
+		args = append(args, []byte(sortedset.FormatScore(element.Score)), []byte(element.Member))
+		return true
+	})
+	return reply.MakeMultiBulkReply(args)
+}
+
+var jsonSetCmd = []byte("JSON.SET")
+
+func jsonToCmd(key string, doc *jsondoc.Value) *reply.MultiBulkReply {
+	args := [][]byte{jsonSetCmd, []byte(key), []byte("$"), doc.Marshal()}
+	return reply.MakeMultiBulkReply(args)
+}
+
+var xRestoreCmd = []byte("XRESTORE")
+
+// streamToCmd XRESTORE key last-id entries-added max-deleted-id count [id field-count field value ...]... [groups]
+func streamToCmd(key string, s *stream.Stream) *reply.MultiBulkReply {
+	args := make([][]byte, 0, 6+s.Len()*4)
+	args = append(args, xRestoreCmd, []byte(key),
+		[]byte(s.LastID().String()),
+		[]byte(strconv.FormatUint(s.EntriesAdded(), 10)),
+		[]byte(s.MaxDeletedID().String()),
+		[]byte(strconv.Itoa(s.Len())))
+	s.ForEach(func(entry *stream.Entry) bool {
+		args = append(args, []byte(entry.ID.String()), []byte(strconv.Itoa(len(entry.Fields))))
+		args = append(args, entry.Fields...)
+		return true
+	})
+	groups := s.Groups()
+	if len(groups) == 0 {
+		return reply.MakeMultiBulkReply(args)
+	}
+	// 消费者组: group-count [name last-id entries-read consumer-count [name seen-time active-time]...
+	// pending-count [id consumer delivery-time delivery-count]...]...
+	args = append(args, []byte(strconv.Itoa(len(groups))))
+	for _, g := range groups {
+		consumers := g.Consumers()
+		args = append(args, []byte(g.Name), []byte(g.LastID.String()),
+			[]byte(strconv.FormatInt(g.EntriesRead, 10)),
+			[]byte(strconv.Itoa(len(consumers))))
+		for _, c := range consumers {
+			args = append(args, []byte(c.Name),
+				[]byte(strconv.FormatInt(c.SeenTime, 10)),
+				[]byte(strconv.FormatInt(c.ActiveTime, 10)))
+		}
+		args = append(args, []byte(strconv.Itoa(g.PendingLen())))
+		g.ForEachPending(stream.MinID, func(p *stream.PendingEntry) bool {
+			args = append(args, []byte(p.ID.String()), []byte(p.Consumer.Name),
+				[]byte(strconv.FormatInt(p.DeliveryTime, 10)),
+				[]byte(strconv.FormatUint(p.DeliveryCount, 10)))
+			return true
+		})
+	}
+	return reply.MakeMultiBulkReply(args)
+}
+
+var pExpireAtCmd = []byte("PEXPIREAT")
+
+// MakeExpireCmd 生成设置过期时间的指令, 使用绝对时间以保证重放结果一致
+func MakeExpireCmd(key string, expireAt time.Time) *reply.MultiBulkReply {
+	args := make([][]byte, 3)
+	args[0] = pExpireAtCmd
+	args[1] = []byte(key)
+	args[2] = []byte(strconv.FormatInt(expireAt.UnixNano()/1e6, 10))
+	return reply.MakeMultiBulkReply(args)
+}
@@ -1,7 +1,10 @@
 package cluster
 
 import (
+	"GoRedis/config"
+	"GoRedis/lib/utils"
 	"GoRedis/resp/client"
+	"GoRedis/resp/reply"
 	"context"
 	"errors"
 	pool "github.com/jolestar/go-commons-pool/v2"
@@ -17,7 +20,14 @@ func (f *connectionFactory) MakeObject(ctx context.Context) (*pool.PooledObject,
 	if !errors.Is(err, nil) {
 		return nil, err
 	}
+	// 向对方证明自己是集群节点, 之后才能发送 Prepare 等内部指令; 重连后客户端会重新认证
+	handshake := utils.ToCmdLine("PeerAuth", config.Properties.ClusterSecret)
+	c.SetHandshake(handshake)
 	c.Start() //启动客户端
+	if r := c.Send(handshake); reply.IsErrorReply(r) {
+		c.Close()
+		return nil, errors.New("peer auth failed: " + toErrorReply(r).Error())
+	}
 	return pool.NewPooledObject(c), nil
 }
 
@@ -3,25 +3,36 @@ package cluster
 import (
 	"GoRedis/config"
 	"GoRedis/database"
+	"GoRedis/datastruct/dict"
 	databaseface "GoRedis/interface/database"
 	"GoRedis/interface/resp"
 	"GoRedis/lib/consistenthash"
+	"GoRedis/lib/idgenerator"
 	"GoRedis/lib/logger"
 	"GoRedis/resp/reply"
 	"context"
 	"fmt"
 	pool "github.com/jolestar/go-commons-pool/v2"
 	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
 )
 
+const transactionsDictSize = 1 << 6
+
 type ClusterDatabase struct {
 	self string //记录自己的名称地址
 
 	nodes          []string                    //整个集群的节点
 	peerPicker     *consistenthash.NodeMap     //节点选择器
 	peerConnection map[string]*pool.ObjectPool //节点的地址：连接池; 三个节点需要两个连接池
-	db             databaseface.Database       //下层：standalone_database
+	db             databaseface.DBEngine       //下层：standalone_database
+
+	transactions   *dict.ConcurrentDict     // 作为参与者的分布式事务, id -> *Transaction
+	participantLog *participantLog          // 作为参与者 Prepare 成功的事务及其结果
+	coordinator    *coordinator             // 作为协调者的分布式事务
+	idGenerator    *idgenerator.IDGenerator // 生成分布式事务 ID
 }
 
 func MakeClusterDatabase() *ClusterDatabase {
@@ -29,8 +40,10 @@ func MakeClusterDatabase() *ClusterDatabase {
 		self: config.Properties.Self,
 
 		db:             database.NewStandaloneDatabase(),
-		peerPicker:     consistenthash.NewNodeMap(nil),
+		peerPicker:     consistenthash.NewNodeMap(config.Properties.Replicas, nil),
 		peerConnection: make(map[string]*pool.ObjectPool),
+		transactions:   dict.MakeConcurrent(transactionsDictSize),
+		idGenerator:    idgenerator.MakeGenerator(config.Properties.Self),
 	}
 	nodes := make([]string, 0, len(config.Properties.Peers)+1)
 	for _, peer := range config.Properties.Peers {
@@ -38,22 +51,76 @@ func MakeClusterDatabase() *ClusterDatabase {
 	}
 	nodes = append(nodes, config.Properties.Self)
 	cluster.peerPicker.AddNode(nodes...)
+	for node, weight := range parseWeights(config.Properties.Weights) {
+		if node != cluster.self && !containsKey(config.Properties.Peers, node) {
+			logger.Warn("weight of unknown node: " + node)
+			continue
+		}
+		cluster.peerPicker.AddNodeWithWeight(node, weight)
+	}
 	ctx := context.Background()
 	for _, peer := range config.Properties.Peers {
 		cluster.peerConnection[peer] = pool.NewObjectPoolWithDefaultConfig(ctx, &connectionFactory{
 			Peer: peer,
 		})
 	}
+	sort.Strings(nodes) // 所有节点上的顺序一致, SCAN 的游标中记录了节点序号
 	cluster.nodes = nodes
+
+	txLogFilename := config.Properties.TxLogFilename
+	if txLogFilename == "" {
+		txLogFilename = defaultTxLogFilename
+	}
+	participantLogFilename := config.Properties.ParticipantLogFilename
+	if participantLogFilename == "" {
+		participantLogFilename = defaultParticipantLogFilename
+	}
+	pl, records, err := makeParticipantLog(participantLogFilename)
+	if err != nil {
+		panic(err)
+	}
+	cluster.participantLog = pl
+	// 先恢复作为参与者的事务, 自己作为协调者恢复事务时可能发给自己
+	cluster.restoreTransactions(records)
+	co, unfinished, err := makeCoordinator(txLogFilename)
+	if err != nil {
+		panic(err)
+	}
+	cluster.coordinator = co
+	// 恢复上次退出时未完成的分布式事务, 其它节点可能还没有启动, 所以在后台重试
+	for _, tx := range unfinished {
+		go cluster.recoverTx(tx, tx.peers)
+	}
 	return cluster
 }
 
+// parseWeights 解析配置中的节点权重: IP:Port=weight
+func parseWeights(items []string) map[string]int {
+	weights := make(map[string]int)
+	for _, item := range items {
+		pivot := strings.LastIndex(item, "=")
+		if pivot <= 0 {
+			logger.Warn("illegal node weight: " + item)
+			continue
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(item[pivot+1:]))
+		if err != nil || weight <= 0 {
+			logger.Warn("illegal node weight: " + item)
+			continue
+		}
+		weights[strings.TrimSpace(item[:pivot])] = weight
+	}
+	return weights
+}
+
 // CmdFunc 指令和执行模式之间的映射
 type CmdFunc func(cluster *ClusterDatabase, c resp.Connection, cmdAndArgs [][]byte) resp.Reply
 
 // Close 关闭集群层下面单机版的db
 func (cluster *ClusterDatabase) Close() {
 	cluster.db.Close()
+	cluster.participantLog.close()
+	cluster.coordinator.close()
 }
 
 // 启动路由表：指令和执行模式之间的关系
@@ -68,6 +135,37 @@ func (cluster *ClusterDatabase) Exec(c resp.Connection, cmdLine [][]byte) (resul
 	}()
 	// 1. 识别传入的指令名称
 	cmdName := strings.ToLower(string(cmdLine[0]))
+	if errReply := database.CheckSubscribeContext(c, cmdName); errReply != nil {
+		return errReply
+	}
+	// MULTI 事务在集群层排队, EXEC 时按节点分组执行
+	switch cmdName {
+	case "multi":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return database.StartMulti(c)
+	case "discard":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return database.DiscardMulti(c)
+	case "exec":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return execMulti(cluster, c)
+	}
+	// 节点之间的内部指令只接受通过 PeerAuth 认证的连接
+	if cmdName == "peerauth" {
+		return execPeerAuth(cluster, c, cmdLine)
+	}
+	if isInternalCommand(cmdName) && !c.IsPeer() {
+		return reply.MakeErrReply("ERR unknown command '" + cmdName + "', or not supported in cluster mode")
+	}
+	if c.InMultiState() {
+		return cluster.enqueueCmd(c, cmdLine)
+	}
 	// 2. router：指令名称和执行方式一一对应，根据指令名称找到执行方式
 	cmdFunc, ok := router[cmdName]
 	if !ok {
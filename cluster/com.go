@@ -3,15 +3,22 @@ package cluster
 /*负责节点间的通信*/
 
 import (
+	"GoRedis/config"
 	"GoRedis/interface/resp"
 	"GoRedis/lib/utils"
 	"GoRedis/resp/client"
 	"GoRedis/resp/reply"
 	"context"
+	"crypto/subtle"
 	"errors"
+	"net"
 	"strconv"
+	"time"
 )
 
+// nodeTimeout 等待单个节点回复的最长时间
+const nodeTimeout = 3 * time.Second
+
 // 在连接池里获取一个连接，进行转发指令使用
 func (cluster *ClusterDatabase) getPeerClient(peer string) (*client.Client, error) {
 	// 1. 根据传入的兄弟节点的地址拿到连接池
@@ -63,12 +70,96 @@ func (cluster *ClusterDatabase) relay(peer string, c resp.Connection, args [][]b
 	return peerClient.Send(args)
 }
 
-// broadcast 广播给所有节点
+// broadcast 并发地广播给所有节点; 各节点在本地执行, 避免再次广播
 func (cluster *ClusterDatabase) broadcast(c resp.Connection, args [][]byte) map[string]resp.Reply {
-	result := make(map[string]resp.Reply)
+	cmdLines := make(map[string]CmdLine, len(cluster.nodes))
 	for _, node := range cluster.nodes {
-		reply := cluster.relay(node, c, args)
-		result[node] = reply
+		cmdLines[node] = args
+	}
+	return cluster.relayAllLocal(c, cmdLines)
+}
+
+// relayAll 并发地向多个节点发送各自的指令; 每个节点单独计时, 超时的节点返回错误
+func (cluster *ClusterDatabase) relayAll(c resp.Connection, cmdLines map[string]CmdLine) map[string]resp.Reply {
+	return cluster.relayConcurrently(c, cmdLines, cluster.relay)
+}
+
+// relayAllLocal 与 relayAll 相同, 但各节点在本地执行指令, 不再次转发
+func (cluster *ClusterDatabase) relayAllLocal(c resp.Connection, cmdLines map[string]CmdLine) map[string]resp.Reply {
+	return cluster.relayConcurrently(c, cmdLines, cluster.relayLocal)
+}
+
+func (cluster *ClusterDatabase) relayConcurrently(c resp.Connection, cmdLines map[string]CmdLine,
+	relay func(node string, c resp.Connection, args [][]byte) resp.Reply) map[string]resp.Reply {
+	type nodeReply struct {
+		node  string
+		reply resp.Reply
+	}
+	ch := make(chan *nodeReply, len(cmdLines)) // 带缓冲, 超时后返回的协程不会阻塞
+	for node, args := range cmdLines {
+		go func(node string, args CmdLine) {
+			ch <- &nodeReply{
+				node:  node,
+				reply: relay(node, c, args),
+			}
+		}(node, args)
+	}
+
+	result := make(map[string]resp.Reply, len(cmdLines))
+	timer := time.NewTimer(nodeTimeout)
+	defer timer.Stop()
+	for len(result) < len(cmdLines) {
+		select {
+		case r := <-ch:
+			result[r.node] = r.reply
+		case <-timer.C:
+			for node := range cmdLines {
+				if _, ok := result[node]; !ok {
+					result[node] = reply.MakeErrReply("ERR node " + node + " time out")
+				}
+			}
+		}
 	}
 	return result
 }
+
+// execPeerAuth PeerAuth secret: 节点之间的连接建立后首先发送, 认证通过的连接才能执行 Prepare 等内部指令
+// 配置了 cluster-secret 时比较密钥, 否则要求对方的 IP 是 peers 中某个节点的 IP
+func execPeerAuth(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 2 {
+		return reply.MakeArgNumErrReply("peerauth")
+	}
+	if secret := config.Properties.ClusterSecret; secret != "" {
+		if subtle.ConstantTimeCompare(args[1], []byte(secret)) != 1 {
+			return reply.MakeErrReply("ERR invalid cluster secret")
+		}
+	} else if !cluster.isPeerAddr(c.RemoteAddr()) {
+		return reply.MakeErrReply("ERR connection is not from a cluster node")
+	}
+	c.SetPeer(true)
+	return reply.MakeOkReply()
+}
+
+// isPeerAddr 判断地址的 IP 是否属于集群中的其它节点
+func (cluster *ClusterDatabase) isPeerAddr(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for peer := range cluster.peerConnection {
+		host, _, err := net.SplitHostPort(peer)
+		if err != nil {
+			continue
+		}
+		ips, err := net.LookupIP(host)
+		if err != nil {
+			continue
+		}
+		for _, ip := range ips {
+			if ip.Equal(tcpAddr.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
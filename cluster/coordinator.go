@@ -0,0 +1,367 @@
+package cluster
+
+/*分布式事务的协调者: 两阶段提交, 并将事务状态记录在日志中, 重启后恢复未完成的事务*/
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/lib/logger"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/connection"
+	"GoRedis/resp/parser"
+	"GoRedis/resp/reply"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTxLogFilename = "transaction.log"
+	recoverRetryInterval = 3 * time.Second
+)
+
+// 协调者记录的事务状态, 也是 TxStatus 的回复
+const (
+	txPending  = "pending" // 已开始, 尚未决定
+	txCommit   = "commit"
+	txRollback = "rollback"
+	txUnknown  = "unknown" // 没有记录: 事务已结束或从未开始
+)
+
+// globalTx 协调者一侧的事务
+type globalTx struct {
+	id       string
+	dbIndex  int
+	peers    []string
+	decision string
+}
+
+// coordinator 管理本节点发起的分布式事务, 日志中依次记录 begin、commit/rollback、end
+type coordinator struct {
+	mu      sync.Mutex
+	logFile *os.File
+	txs     map[string]*globalTx // 未结束的事务
+}
+
+// makeCoordinator 读取事务日志, 返回协调者和需要恢复的事务
+func makeCoordinator(filename string) (*coordinator, []*globalTx, error) {
+	txs := loadTxLog(filename)
+	// 重写日志, 只保留未结束的事务
+	tmpFilename := filename + ".tmp"
+	tmpFile, err := os.OpenFile(tmpFilename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	co := &coordinator{
+		logFile: tmpFile,
+		txs:     txs,
+	}
+	unfinished := make([]*globalTx, 0, len(txs))
+	for _, tx := range txs {
+		// 没有做出决定的事务一律回滚
+		if tx.decision == txPending {
+			tx.decision = txRollback
+		}
+		co.writeLog(makeBeginLog(tx))
+		co.writeLog(utils.ToCmdLine(tx.decision, tx.id))
+		unfinished = append(unfinished, tx)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return nil, nil, err
+	}
+	_ = tmpFile.Close()
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		return nil, nil, err
+	}
+	co.logFile, err = os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return co, unfinished, nil
+}
+
+// loadTxLog 读取日志, 返回未结束的事务
+func loadTxLog(filename string) map[string]*globalTx {
+	txs := make(map[string]*globalTx)
+	file, err := os.Open(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn(err)
+		}
+		return txs
+	}
+	defer file.Close()
+	for p := range parser.ParseStream(file) {
+		if p.Err != nil {
+			if p.Err != io.EOF && p.Err != io.ErrUnexpectedEOF {
+				logger.Error("parse transaction log error: " + p.Err.Error())
+			}
+			continue
+		}
+		r, ok := p.Data.(*reply.MultiBulkReply)
+		if !ok || len(r.Args) < 2 {
+			continue
+		}
+		id := string(r.Args[1])
+		switch string(r.Args[0]) {
+		case "begin":
+			if len(r.Args) < 4 {
+				continue
+			}
+			dbIndex, _ := strconv.Atoi(string(r.Args[2]))
+			tx := &globalTx{
+				id:       id,
+				dbIndex:  dbIndex,
+				decision: txPending,
+			}
+			for _, peer := range r.Args[3:] {
+				tx.peers = append(tx.peers, string(peer))
+			}
+			txs[id] = tx
+		case txCommit, txRollback:
+			if tx, ok := txs[id]; ok {
+				tx.decision = string(r.Args[0])
+			}
+		case "end":
+			delete(txs, id)
+		}
+	}
+	return txs
+}
+
+func makeBeginLog(tx *globalTx) CmdLine {
+	args := []string{"begin", tx.id, strconv.Itoa(tx.dbIndex)}
+	args = append(args, tx.peers...)
+	return utils.ToCmdLine(args...)
+}
+
+// writeLog 调用方需持有 co.mu
+func (co *coordinator) writeLog(cmdLine CmdLine) {
+	_, err := co.logFile.Write(reply.MakeMultiBulkReply(cmdLine).ToBytes())
+	if err != nil {
+		logger.Error("write transaction log error: " + err.Error())
+	}
+}
+
+func (co *coordinator) begin(tx *globalTx) {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	co.txs[tx.id] = tx
+	co.writeLog(makeBeginLog(tx))
+}
+
+// decide 记录事务的决定, 落盘之后才能通知参与者
+func (co *coordinator) decide(tx *globalTx, decision string) error {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	tx.decision = decision
+	co.writeLog(utils.ToCmdLine(decision, tx.id))
+	return co.logFile.Sync()
+}
+
+func (co *coordinator) end(tx *globalTx) {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	delete(co.txs, tx.id)
+	co.writeLog(utils.ToCmdLine("end", tx.id))
+}
+
+func (co *coordinator) status(id string) string {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	tx, ok := co.txs[id]
+	if !ok {
+		return txUnknown
+	}
+	return tx.decision
+}
+
+func (co *coordinator) close() {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	_ = co.logFile.Close()
+}
+
+// coordinatedTx 一次正在执行的分布式事务
+type coordinatedTx struct {
+	cluster  *ClusterDatabase
+	conn     resp.Connection
+	tx       *globalTx
+	prepared []string // 已经 Prepare 成功的节点
+}
+
+// beginTx 开启分布式事务, peers 为所有可能参与的节点
+func (cluster *ClusterDatabase) beginTx(c resp.Connection, peers []string) *coordinatedTx {
+	tx := &globalTx{
+		id:       strconv.FormatInt(cluster.idGenerator.NextID(), 10),
+		dbIndex:  c.GetDBIndex(),
+		peers:    peers,
+		decision: txPending,
+	}
+	cluster.coordinator.begin(tx)
+	return &coordinatedTx{
+		cluster: cluster,
+		conn:    c,
+		tx:      tx,
+	}
+}
+
+// sendTx 向参与者发送事务指令; 参与者是自己时直接调用本地的处理函数
+func (cluster *ClusterDatabase) sendTx(peer string, c resp.Connection, cmdLine CmdLine) resp.Reply {
+	if peer == cluster.self {
+		switch strings.ToLower(string(cmdLine[0])) {
+		case "prepare":
+			return execPrepare(cluster, c, cmdLine)
+		case "commit":
+			return execCommit(cluster, c, cmdLine)
+		case "rollback":
+			return execRollback(cluster, c, cmdLine)
+		case "txdump":
+			return execTxDump(cluster, c, cmdLine)
+		case "txstatus":
+			return execTxStatus(cluster, c, cmdLine)
+		}
+		return reply.MakeErrReply("ERR unknown transaction command '" + string(cmdLine[0]) + "'")
+	}
+	return cluster.relay(peer, c, cmdLine)
+}
+
+// prepare 在 peer 上锁定 cmdLines 涉及的 key
+func (ct *coordinatedTx) prepare(peer string, cmdLines []CmdLine) reply.ErrorReply {
+	args := utils.ToCmdLine("Prepare", ct.tx.id, ct.cluster.self)
+	args = append(args, encodeCmdLines(cmdLines)...)
+	r := ct.cluster.sendTx(peer, ct.conn, args)
+	if reply.IsErrorReply(r) {
+		return toErrorReply(r)
+	}
+	ct.prepared = append(ct.prepared, peer)
+	return nil
+}
+
+// dump 读取 peer 上被事务锁定的 key, 返回重建该 key 及其过期时间的指令, key 不存在时返回 nil
+func (ct *coordinatedTx) dump(peer string, key string) ([]CmdLine, reply.ErrorReply) {
+	r := ct.cluster.sendTx(peer, ct.conn, utils.ToCmdLine("TxDump", ct.tx.id, key))
+	if reply.IsErrorReply(r) {
+		return nil, toErrorReply(r)
+	}
+	multiBulk, ok := r.(*reply.MultiBulkReply)
+	if !ok || len(multiBulk.Args) == 0 {
+		return nil, nil
+	}
+	cmdLines, err := decodeCmdLines(multiBulk.Args)
+	if err != nil {
+		return nil, reply.MakeErrReply(err.Error())
+	}
+	return cmdLines, nil
+}
+
+// commit 提交事务, 返回各节点 Commit 的结果
+// 决定落盘之后不再改变: 部分节点提交失败时由后台继续向这些节点重试 Commit
+func (ct *coordinatedTx) commit() (map[string]resp.Reply, reply.ErrorReply) {
+	if err := ct.cluster.coordinator.decide(ct.tx, txCommit); err != nil {
+		ct.rollback()
+		return nil, reply.MakeErrReply("ERR write transaction log failed: " + err.Error())
+	}
+	results := make(map[string]resp.Reply, len(ct.prepared))
+	var errReply reply.ErrorReply
+	unacked := make([]string, 0)
+	for _, peer := range ct.prepared {
+		r := ct.cluster.sendTx(peer, ct.conn, utils.ToCmdLine("Commit", ct.tx.id))
+		if reply.IsErrorReply(r) {
+			logger.Warn("commit transaction " + ct.tx.id + " on " + peer + " failed: " + string(r.ToBytes()))
+			if errReply == nil {
+				errReply = toErrorReply(r)
+			}
+			unacked = append(unacked, peer)
+			continue
+		}
+		results[peer] = r
+	}
+	if len(unacked) > 0 {
+		go ct.cluster.recoverTx(ct.tx, unacked)
+		return nil, reply.MakeErrReply("ERR transaction " + ct.tx.id + " is committed but not acknowledged by " +
+			strings.Join(unacked, ",") + ", retrying in background: " + errReply.Error())
+	}
+	ct.cluster.coordinator.end(ct.tx)
+	return results, nil
+}
+
+// rollback 回滚事务; 通知所有节点, 因为 Prepare 可能在超时之后才到达参与者
+func (ct *coordinatedTx) rollback() {
+	_ = ct.cluster.coordinator.decide(ct.tx, txRollback)
+	ct.sendRollback()
+}
+
+func (ct *coordinatedTx) sendRollback() {
+	failed := make([]string, 0)
+	for _, peer := range ct.tx.peers {
+		r := ct.cluster.sendTx(peer, ct.conn, utils.ToCmdLine("Rollback", ct.tx.id))
+		if reply.IsErrorReply(r) {
+			logger.Warn("rollback transaction " + ct.tx.id + " on " + peer + " failed: " + string(r.ToBytes()))
+			failed = append(failed, peer)
+		}
+	}
+	if len(failed) == 0 {
+		ct.cluster.coordinator.end(ct.tx)
+		return
+	}
+	// 交给后台继续重试
+	go ct.cluster.recoverTx(ct.tx, failed)
+}
+
+// recoverTx 反复向 peers 发送事务的决定, 直到它们都确认
+func (cluster *ClusterDatabase) recoverTx(tx *globalTx, peers []string) {
+	conn := &connection.Connection{}
+	conn.SelectDB(tx.dbIndex)
+	cmdName := "Rollback"
+	if tx.decision == txCommit {
+		cmdName = "Commit"
+	}
+	pending := peers
+	unknown := make([]string, 0)
+	for len(pending) > 0 {
+		failed := make([]string, 0)
+		for _, peer := range pending {
+			r := cluster.sendTx(peer, conn, utils.ToCmdLine(cmdName, tx.id))
+			if !reply.IsErrorReply(r) {
+				continue
+			}
+			// 参与者的日志中没有该事务: 无法确认是否已经提交, 不能当作成功
+			if toErrorReply(r).Error() == errTxNotFound {
+				unknown = append(unknown, peer)
+				continue
+			}
+			logger.Warn("recover transaction " + tx.id + " on " + peer + " failed: " + string(r.ToBytes()))
+			failed = append(failed, peer)
+		}
+		pending = failed
+		if len(pending) > 0 {
+			time.Sleep(recoverRetryInterval)
+		}
+	}
+	if len(unknown) > 0 {
+		// 保留在事务日志中, 重启后再次重试, 需要人工检查这些节点上的数据
+		logger.Error("transaction " + tx.id + " (" + tx.decision + ") is unknown to " + strings.Join(unknown, ",") +
+			", please check the data on these nodes")
+		return
+	}
+	cluster.coordinator.end(tx)
+	logger.Info("transaction " + tx.id + " recovered: " + tx.decision)
+}
+
+// execTxStatus TxStatus txID: 参与者询问事务的状态
+func execTxStatus(cluster *ClusterDatabase, c resp.Connection, cmdLine CmdLine) resp.Reply {
+	if len(cmdLine) != 2 {
+		return reply.MakeArgNumErrReply("txstatus")
+	}
+	return reply.MakeStatusReply(cluster.coordinator.status(string(cmdLine[1])))
+}
+
+func toErrorReply(r resp.Reply) reply.ErrorReply {
+	if errReply, ok := r.(reply.ErrorReply); ok {
+		return errReply
+	}
+	return reply.MakeErrReply(strings.TrimSuffix(string(r.ToBytes()), reply.CRLF))
+}
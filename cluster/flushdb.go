@@ -5,12 +5,23 @@ import (
 	"GoRedis/resp/reply"
 )
 
+// FlushDB 清空所有节点上当前选择的 DB
 func FlushDB(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	return broadcastAndCheck(cluster, c, args)
+}
+
+// FlushAll 清空所有节点上的所有 DB
+func FlushAll(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	return broadcastAndCheck(cluster, c, args)
+}
+
+// broadcastAndCheck 广播指令, 所有节点都执行成功时返回 OK
+func broadcastAndCheck(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
 	replies := cluster.broadcast(c, args)
 	var errReply reply.ErrorReply
 	for _, v := range replies {
 		if reply.IsErrorReply(v) {
-			errReply = v.(reply.ErrorReply)
+			errReply = toErrorReply(v)
 			break
 		}
 	}
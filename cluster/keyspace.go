@@ -0,0 +1,140 @@
+package cluster
+
+/*需要遍历所有节点的指令: KEYS、SCAN、DBSIZE、RANDOMKEY*/
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/reply"
+	"math/rand"
+	"strconv"
+)
+
+// Keys 合并所有节点上匹配的 key
+// keys pattern
+func Keys(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 2 {
+		return reply.MakeArgNumErrReply("keys")
+	}
+	replies := cluster.broadcast(c, args)
+	result := make([][]byte, 0)
+	for _, v := range replies {
+		if reply.IsErrorReply(v) {
+			return reply.MakeErrReply("error occurs: " + toErrorReply(v).Error())
+		}
+		if multiBulk, ok := v.(*reply.MultiBulkReply); ok {
+			result = append(result, multiBulk.Args...)
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// DBSize 所有节点上 key 的数量之和
+func DBSize(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 1 {
+		return reply.MakeArgNumErrReply("dbsize")
+	}
+	replies := cluster.broadcast(c, args)
+	var size int64 = 0
+	for _, v := range replies {
+		if reply.IsErrorReply(v) {
+			return reply.MakeErrReply("error occurs: " + toErrorReply(v).Error())
+		}
+		intReply, ok := v.(*reply.IntReply)
+		if !ok {
+			return reply.MakeErrReply("error occurs: illegal reply of dbsize")
+		}
+		size += intReply.Code
+	}
+	return reply.MakeIntReply(size)
+}
+
+// RandomKey 从各节点随机返回的 key 中再随机选择一个
+func RandomKey(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 1 {
+		return reply.MakeArgNumErrReply("randomkey")
+	}
+	replies := cluster.broadcast(c, args)
+	candidates := make([][]byte, 0, len(replies))
+	for _, v := range replies {
+		if reply.IsErrorReply(v) {
+			return reply.MakeErrReply("error occurs: " + toErrorReply(v).Error())
+		}
+		if bulk, ok := v.(*reply.BulkReply); ok && bulk.Arg != nil {
+			candidates = append(candidates, bulk.Arg)
+		}
+	}
+	if len(candidates) == 0 {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeBulkReply(candidates[rand.Intn(len(candidates))])
+}
+
+// Scan 依次遍历每个节点; 游标 = 节点内游标 * 节点数 + 节点序号
+// scan cursor [MATCH pattern] [COUNT count] [TYPE type]
+func Scan(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeArgNumErrReply("scan")
+	}
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR invalid cursor")
+	}
+	nodeCount := uint64(len(cluster.nodes))
+	nodeIndex := cursor % nodeCount
+	nodeCursor := cursor / nodeCount
+
+	nodeArgs := make([][]byte, len(args))
+	copy(nodeArgs, args)
+	nodeArgs[1] = []byte(strconv.FormatUint(nodeCursor, 10))
+	r := cluster.relayLocal(cluster.nodes[nodeIndex], c, nodeArgs)
+	if reply.IsErrorReply(r) {
+		return r
+	}
+	nextNodeCursor, keys, ok := parseScanReply(r)
+	if !ok {
+		return reply.MakeErrReply("error occurs: illegal reply of scan")
+	}
+
+	var next uint64
+	if nextNodeCursor != 0 {
+		next = nextNodeCursor*nodeCount + nodeIndex
+	} else if nodeIndex+1 < nodeCount { // 当前节点遍历完成, 从下一个节点的游标 0 开始
+		next = nodeIndex + 1
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(strconv.FormatUint(next, 10))),
+		reply.MakeMultiBulkReply(keys),
+	})
+}
+
+// parseScanReply 解析单个节点 SCAN 的回复: [cursor, [key...]]
+func parseScanReply(r resp.Reply) (uint64, [][]byte, bool) {
+	multiRaw, ok := r.(*reply.MultiRawReply)
+	if !ok || len(multiRaw.Replies) != 2 {
+		return 0, nil, false
+	}
+	cursorReply, ok := multiRaw.Replies[0].(*reply.BulkReply)
+	if !ok {
+		return 0, nil, false
+	}
+	cursor, err := strconv.ParseUint(string(cursorReply.Arg), 10, 64)
+	if err != nil {
+		return 0, nil, false
+	}
+	switch keys := multiRaw.Replies[1].(type) {
+	case *reply.MultiBulkReply:
+		return cursor, keys.Args, true
+	case *reply.EmptyMultiBulkReply:
+		return cursor, [][]byte{}, true
+	}
+	return 0, nil, false
+}
+
+// relayLocal 让指定节点在本地执行指令, 不再按 key 转发或广播
+func (cluster *ClusterDatabase) relayLocal(node string, c resp.Connection, args [][]byte) resp.Reply {
+	if node == cluster.self {
+		return cluster.db.Exec(c, args)
+	}
+	return cluster.relay(node, c, utils.ToCmdLine2("LocalExec", args...))
+}
@@ -0,0 +1,43 @@
+package cluster
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/reply"
+	"sort"
+)
+
+// MSet 原子地设置多个 key; key 分布在多个节点上时通过两阶段提交执行, 每个节点 Prepare 一条批量的 MSET
+// mset k1 v1 k2 v2...
+func MSet(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	argCount := len(args) - 1
+	if argCount%2 != 0 || argCount < 1 {
+		return reply.MakeArgNumErrReply("mset")
+	}
+
+	groupMap := cluster.groupByPeer(args[1:], 2)
+	if len(groupMap) == 1 { // 都在同一个节点上
+		for peer := range groupMap {
+			return cluster.relay(peer, c, args)
+		}
+	}
+
+	peers := make([]string, 0, len(groupMap))
+	for peer := range groupMap {
+		peers = append(peers, peer)
+	}
+	// 所有事务按照相同的节点顺序加锁, 避免跨节点死锁
+	sort.Strings(peers)
+	tx := cluster.beginTx(c, peers)
+	for _, peer := range peers {
+		cmdLine := utils.ToCmdLine2("MSet", groupMap[peer].args...)
+		if errReply := tx.prepare(peer, []CmdLine{cmdLine}); errReply != nil {
+			tx.rollback()
+			return errReply
+		}
+	}
+	if _, errReply := tx.commit(); errReply != nil {
+		return errReply
+	}
+	return reply.MakeOkReply()
+}
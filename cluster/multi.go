@@ -0,0 +1,101 @@
+package cluster
+
+import (
+	"GoRedis/database"
+	"GoRedis/interface/resp"
+	"GoRedis/resp/reply"
+	"sort"
+	"strings"
+)
+
+// rawReply 节点 Commit 返回的单条指令的原始回复
+type rawReply []byte
+
+func (r rawReply) ToBytes() []byte {
+	return r
+}
+
+// enqueueCmd MULTI 状态下指令入队; 单条指令涉及的 key 必须位于同一节点
+func (cluster *ClusterDatabase) enqueueCmd(c resp.Connection, cmdLine [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if _, ok := router[cmdName]; !ok || cmdName == "select" || isInternalCommand(cmdName) {
+		return reply.MakeErrReply("ERR command '" + cmdName + "' cannot be used in MULTI")
+	}
+	if _, err := cluster.pickPeerForMulti(cmdLine); err != nil {
+		return err
+	}
+	return database.EnqueueCmd(c, cmdLine)
+}
+
+// pickPeerForMulti 返回执行该指令的节点; 不涉及 key 的指令在本地执行
+func (cluster *ClusterDatabase) pickPeerForMulti(cmdLine [][]byte) (string, reply.ErrorReply) {
+	writeKeys, readKeys := database.GetRelatedKeys(cmdLine)
+	keys := append(writeKeys, readKeys...)
+	if len(keys) == 0 {
+		return cluster.self, nil
+	}
+	peer := cluster.peerPicker.PickNode(keys[0])
+	for _, key := range keys[1:] {
+		if cluster.peerPicker.PickNode(key) != peer {
+			return "", reply.MakeErrReply("ERR keys of '" + string(cmdLine[0]) + "' must be within one node in MULTI")
+		}
+	}
+	return peer, nil
+}
+
+// execMulti 执行 EXEC; 指令分布在多个节点时通过两阶段提交原子地执行
+func execMulti(cluster *ClusterDatabase, c resp.Connection) resp.Reply {
+	if !c.InMultiState() {
+		return reply.MakeErrReply("ERR EXEC without MULTI")
+	}
+	defer c.SetMultiState(false)
+	cmdLines := c.GetQueuedCmdLine()
+	if len(cmdLines) == 0 {
+		return reply.MakeEmptyMultiBulkBytes()
+	}
+
+	// 按节点分组, 记录每条指令在原队列中的位置
+	groupMap := make(map[string][]CmdLine)
+	indexMap := make(map[string][]int)
+	for i, cmdLine := range cmdLines {
+		peer, err := cluster.pickPeerForMulti(cmdLine)
+		if err != nil {
+			return err
+		}
+		groupMap[peer] = append(groupMap[peer], cmdLine)
+		indexMap[peer] = append(indexMap[peer], i)
+	}
+	if _, ok := groupMap[cluster.self]; ok && len(groupMap) == 1 {
+		return cluster.db.ExecMulti(c, cmdLines)
+	}
+
+	peers := make([]string, 0, len(groupMap))
+	for peer := range groupMap {
+		peers = append(peers, peer)
+	}
+	// 所有事务按照相同的节点顺序加锁, 避免跨节点死锁
+	sort.Strings(peers)
+	tx := cluster.beginTx(c, peers)
+	for _, peer := range peers {
+		if errReply := tx.prepare(peer, groupMap[peer]); errReply != nil {
+			tx.rollback()
+			return reply.MakeErrReply("EXECABORT Transaction discarded because of: " + errReply.Error())
+		}
+	}
+	commitResults, errReply := tx.commit()
+	if errReply != nil { // 决定已经落盘, 事务不会被丢弃
+		return errReply
+	}
+
+	results := make([]resp.Reply, len(cmdLines))
+	for peer, r := range commitResults {
+		multiBulk, ok := r.(*reply.MultiBulkReply)
+		if !ok || len(multiBulk.Args) != len(indexMap[peer]) {
+			return reply.MakeErrReply("ERR illegal commit reply from " + peer)
+		}
+		for i, raw := range multiBulk.Args {
+			results[indexMap[peer][i]] = rawReply(raw)
+		}
+	}
+	return reply.MakeMultiRawReply(results)
+}
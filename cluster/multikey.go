@@ -0,0 +1,53 @@
+package cluster
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/resp/reply"
+	"strings"
+)
+
+// countKeys 用于 DEL、UNLINK、EXISTS、TOUCH: key 可以分布在任何节点上, 返回各节点结果之和
+// del k1 k2 k3 k4 k5; return 成功删除的个数
+func countKeys(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(args[0]))
+	if len(args) < 2 {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	_, replies := cluster.scatterGather(c, cmdName, args[1:], 1)
+	var count int64 = 0
+	for _, v := range replies {
+		if reply.IsErrorReply(v) {
+			return reply.MakeErrReply("error occurs: " + toErrorReply(v).Error())
+		}
+		intReply, ok := v.(*reply.IntReply)
+		if !ok {
+			return reply.MakeErrReply("error occurs: illegal reply of " + cmdName)
+		}
+		count += intReply.Code
+	}
+	return reply.MakeIntReply(count)
+}
+
+// MGet 返回多个 key 的值, 每个节点只请求一次
+// mget k1 k2 k3
+func MGet(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeArgNumErrReply("mget")
+	}
+	groupMap, replies := cluster.scatterGather(c, "mget", args[1:], 1)
+	result := make([][]byte, len(args)-1)
+	for peer, v := range replies {
+		if reply.IsErrorReply(v) {
+			return reply.MakeErrReply("error occurs: " + toErrorReply(v).Error())
+		}
+		multiBulk, ok := v.(*reply.MultiBulkReply)
+		indices := groupMap[peer].indices
+		if !ok || len(multiBulk.Args) != len(indices) {
+			return reply.MakeErrReply("error occurs: illegal reply of mget")
+		}
+		for i, value := range multiBulk.Args {
+			result[indices[i]] = value
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
@@ -0,0 +1,182 @@
+package cluster
+
+/*参与者日志: Prepare 成功之前落盘, 重启后恢复仍在等待决定的事务;
+已结束的事务保留 finishedTxMaxAge, 使协调者重试 Commit 时能区分"已提交"和"没有记录"*/
+
+import (
+	"GoRedis/lib/logger"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/parser"
+	"GoRedis/resp/reply"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultParticipantLogFilename = "participant.log"
+
+// txRecord 日志中记录的参与者事务
+type txRecord struct {
+	id          string
+	coordinator string
+	dbIndex     int
+	cmdLines    []CmdLine
+	status      int8      // preparedStatus、committedStatus 或 rolledBackStatus
+	finishedAt  time.Time // 事务结束的时间
+}
+
+// participantLog 日志中依次记录 prepare、commit/rollback
+type participantLog struct {
+	mu      sync.Mutex
+	logFile *os.File
+}
+
+// makeParticipantLog 读取参与者日志, 返回日志和需要恢复的事务
+func makeParticipantLog(filename string) (*participantLog, []*txRecord, error) {
+	records := loadParticipantLog(filename)
+	// 重写日志, 只保留未结束和刚结束的事务
+	tmpFilename := filename + ".tmp"
+	tmpFile, err := os.OpenFile(tmpFilename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	pl := &participantLog{
+		logFile: tmpFile,
+	}
+	kept := make([]*txRecord, 0, len(records))
+	for _, record := range records {
+		if record.status != preparedStatus && time.Since(record.finishedAt) > finishedTxMaxAge {
+			continue
+		}
+		pl.writeLog(makePrepareLog(record))
+		if record.status != preparedStatus {
+			pl.writeLog(makeFinishLog(record))
+		}
+		kept = append(kept, record)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return nil, nil, err
+	}
+	_ = tmpFile.Close()
+	if err := os.Rename(tmpFilename, filename); err != nil {
+		return nil, nil, err
+	}
+	pl.logFile, err = os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pl, kept, nil
+}
+
+// loadParticipantLog 读取日志, 按 Prepare 的顺序返回事务的最终状态
+func loadParticipantLog(filename string) []*txRecord {
+	records := make([]*txRecord, 0)
+	file, err := os.Open(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn(err)
+		}
+		return records
+	}
+	defer file.Close()
+	recordMap := make(map[string]*txRecord)
+	for p := range parser.ParseStream(file) {
+		if p.Err != nil {
+			if p.Err != io.EOF && p.Err != io.ErrUnexpectedEOF {
+				logger.Error("parse participant log error: " + p.Err.Error())
+			}
+			continue
+		}
+		r, ok := p.Data.(*reply.MultiBulkReply)
+		if !ok || len(r.Args) < 3 {
+			continue
+		}
+		id := string(r.Args[1])
+		switch string(r.Args[0]) {
+		case "prepare": // prepare txID coordinator dbIndex argc1 args1...
+			if len(r.Args) < 5 {
+				continue
+			}
+			dbIndex, _ := strconv.Atoi(string(r.Args[3]))
+			cmdLines, err := decodeCmdLines(r.Args[4:])
+			if err != nil {
+				logger.Error("illegal participant log of transaction " + id + ": " + err.Error())
+				continue
+			}
+			record := &txRecord{
+				id:          id,
+				coordinator: string(r.Args[2]),
+				dbIndex:     dbIndex,
+				cmdLines:    cmdLines,
+				status:      preparedStatus,
+			}
+			recordMap[id] = record
+			records = append(records, record)
+		case txCommit, txRollback: // commit/rollback txID unixMilli
+			record, ok := recordMap[id]
+			if !ok {
+				continue
+			}
+			record.status = committedStatus
+			if string(r.Args[0]) == txRollback {
+				record.status = rolledBackStatus
+			}
+			finishedAt, _ := strconv.ParseInt(string(r.Args[2]), 10, 64)
+			record.finishedAt = time.UnixMilli(finishedAt)
+		}
+	}
+	return records
+}
+
+func makePrepareLog(record *txRecord) CmdLine {
+	args := utils.ToCmdLine("prepare", record.id, record.coordinator, strconv.Itoa(record.dbIndex))
+	return append(args, encodeCmdLines(record.cmdLines)...)
+}
+
+func makeFinishLog(record *txRecord) CmdLine {
+	decision := txCommit
+	if record.status == rolledBackStatus {
+		decision = txRollback
+	}
+	return utils.ToCmdLine(decision, record.id, strconv.FormatInt(record.finishedAt.UnixMilli(), 10))
+}
+
+// writeLog 调用方需持有 pl.mu
+func (pl *participantLog) writeLog(cmdLine CmdLine) {
+	_, err := pl.logFile.Write(reply.MakeMultiBulkReply(cmdLine).ToBytes())
+	if err != nil {
+		logger.Error("write participant log error: " + err.Error())
+	}
+}
+
+// prepare 记录 Prepare 成功的事务, 落盘之后才能回复协调者
+func (pl *participantLog) prepare(tx *Transaction) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.writeLog(makePrepareLog(&txRecord{
+		id:          tx.id,
+		coordinator: tx.coordinator,
+		dbIndex:     tx.dbIndex,
+		cmdLines:    tx.cmdLines,
+	}))
+	return pl.logFile.Sync()
+}
+
+// finish 记录已经 Prepare 的事务的结束状态
+func (pl *participantLog) finish(tx *Transaction) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.writeLog(makeFinishLog(&txRecord{
+		id:         tx.id,
+		status:     tx.status,
+		finishedAt: time.Now(),
+	}))
+}
+
+func (pl *participantLog) close() {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	_ = pl.logFile.Close()
+}
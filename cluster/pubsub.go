@@ -0,0 +1,23 @@
+package cluster
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/resp/reply"
+)
+
+// Publish 消息广播给所有节点, 由各节点推送给连接在本节点上的订阅者; 返回收到消息的订阅者总数
+func Publish(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 3 {
+		return reply.MakeArgNumErrReply("publish")
+	}
+	var count int64
+	for _, r := range cluster.broadcast(c, args) {
+		if reply.IsErrorReply(r) {
+			return r
+		}
+		if intReply, ok := r.(*reply.IntReply); ok {
+			count += intReply.Code
+		}
+	}
+	return reply.MakeIntReply(count)
+}
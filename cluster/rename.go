@@ -2,13 +2,17 @@ package cluster
 
 import (
 	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
 	"GoRedis/resp/reply"
+	"strings"
 )
 
-// Rename 重命名key，起始k v和目标k v必须在同一节点内, 否则返回错误
+// Rename 重命名key; 起始k v和目标k v不在同一节点时, 通过两阶段提交在两个节点上原子地完成
+// rename k1 k2; renamenx k1 k2
 func Rename(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(args[0]))
 	if len(args) != 3 { // rename k1 k2
-		return reply.MakeErrReply("ERR wrong number of arguments for 'rename' command")
+		return reply.MakeErrReply("ERR wrong number of arguments for '" + cmdName + "' command")
 	}
 	src := string(args[1])
 	dest := string(args[2])
@@ -16,8 +20,55 @@ func Rename(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Rep
 	srcPeer := cluster.peerPicker.PickNode(src)
 	destPeer := cluster.peerPicker.PickNode(dest)
 
-	if srcPeer != destPeer {
-		return reply.MakeErrReply("ERR rename must within one slot in cluster mode")
+	if srcPeer == destPeer {
+		return cluster.relay(srcPeer, c, args)
 	}
-	return cluster.relay(srcPeer, c, args)
+	return renameAcrossNodes(cluster, c, srcPeer, destPeer, src, dest, cmdName == "renamenx")
+}
+
+// renameAcrossNodes 1. 锁定 src 并读出它的值; 2. 锁定 dest 并写入该值; 3. 提交
+func renameAcrossNodes(cluster *ClusterDatabase, c resp.Connection,
+	srcPeer, destPeer, src, dest string, nx bool) resp.Reply {
+	tx := cluster.beginTx(c, []string{srcPeer, destPeer})
+	if errReply := tx.prepare(srcPeer, []CmdLine{utils.ToCmdLine("DEL", src)}); errReply != nil {
+		tx.rollback()
+		return errReply
+	}
+	restoreCmds, errReply := tx.dump(srcPeer, src)
+	if errReply != nil {
+		tx.rollback()
+		return errReply
+	}
+	if restoreCmds == nil {
+		tx.rollback()
+		return reply.MakeErrReply("no such key")
+	}
+	// 重建 src 及其过期时间的指令改为作用于 dest, 这些指令的第一个参数都是 key
+	destCmds := []CmdLine{utils.ToCmdLine("DEL", dest)}
+	for _, cmdLine := range restoreCmds {
+		cmdLine[1] = []byte(dest)
+		destCmds = append(destCmds, cmdLine)
+	}
+	if errReply := tx.prepare(destPeer, destCmds); errReply != nil {
+		tx.rollback()
+		return errReply
+	}
+	if nx {
+		existing, errReply := tx.dump(destPeer, dest)
+		if errReply != nil {
+			tx.rollback()
+			return errReply
+		}
+		if existing != nil { // dest 已存在
+			tx.rollback()
+			return reply.MakeIntReply(0)
+		}
+	}
+	if _, errReply := tx.commit(); errReply != nil {
+		return errReply
+	}
+	if nx {
+		return reply.MakeIntReply(1)
+	}
+	return reply.MakeOkReply()
 }
@@ -1,37 +1,178 @@
 // Package cluster 指令和执行模式之间做一个关系映射
 package cluster
 
-import "GoRedis/interface/resp"
+import (
+	"GoRedis/database"
+	"GoRedis/interface/resp"
+	"GoRedis/resp/reply"
+	"strings"
+)
 
 type CmdLine = [][]byte
 
 // 指令和执行方式(广播、转发、本地执行)之间的映射
+// 先根据单机版注册指令时记录的元信息生成默认的执行方式, 再覆盖需要跨节点处理的指令
 func makeRouter() map[string]CmdFunc {
 	routerMap := make(map[string]CmdFunc)
+	for _, info := range database.ListCommands() {
+		routerMap[info.Name] = makeCmdFunc(info)
+	}
 
-	routerMap["exists"] = defaultFunc //exits k
-	routerMap["type"] = defaultFunc
-	routerMap["set"] = defaultFunc
-	routerMap["setnx"] = defaultFunc
-	routerMap["get"] = defaultFunc
-	routerMap["getset"] = defaultFunc
-
-	routerMap["del"] = Del
+	routerMap["del"] = countKeys
+	routerMap["unlink"] = countKeys
+	routerMap["exists"] = countKeys
+	routerMap["touch"] = countKeys
+	routerMap["mget"] = MGet
 
 	routerMap["rename"] = Rename
 	routerMap["renamenx"] = Rename
 
-	routerMap["ping"] = ping
-
 	routerMap["flushdb"] = FlushDB
+	routerMap["flushall"] = FlushAll
+	routerMap["keys"] = Keys
+	routerMap["scan"] = Scan
+	routerMap["dbsize"] = DBSize
+	routerMap["randomkey"] = RandomKey
 	routerMap["select"] = execSelect
 
+	routerMap["mset"] = MSet
+
+	// 阻塞指令只能在本节点上等待
+	for _, name := range []string{"blpop", "brpop", "blmove", "brpoplpush"} {
+		info, _ := database.GetCommandInfo(name)
+		routerMap[name] = makeBlockingFunc(info)
+	}
+	routerMap["xread"] = XRead
+	routerMap["xreadgroup"] = XRead
+
+	routerMap["eval"] = Eval
+	routerMap["evalsha"] = Eval
+	routerMap["fcall"] = Eval
+	routerMap["fcall_ro"] = Eval
+	routerMap["script"] = makeBroadcastSubCmdFunc("load", "flush")
+	routerMap["function"] = makeBroadcastSubCmdFunc("load", "delete", "flush", "restore")
+
+	// 发布订阅: 订阅关系保存在客户端连接的节点上, 消息广播给所有节点
+	routerMap["subscribe"] = localFunc
+	routerMap["unsubscribe"] = localFunc
+	routerMap["psubscribe"] = localFunc
+	routerMap["punsubscribe"] = localFunc
+	routerMap["publish"] = Publish
+	// 配置保存在每个节点上: CONFIG SET 修改所有节点, CONFIG GET 返回本节点的配置
+	routerMap["config"] = makeBroadcastSubCmdFunc("set")
+	// CLIENT、HELLO 修改客户端连接的状态, 按元信息在本节点执行;
+	// 客户端缓存只能跟踪在本节点上执行的指令, 从其它节点转发回来的回复仍然是 RESP2 的结构
+
+	// 分布式事务
+	routerMap["prepare"] = execPrepare
+	routerMap["commit"] = execCommit
+	routerMap["rollback"] = execRollback
+	routerMap["txdump"] = execTxDump
+	routerMap["txstatus"] = execTxStatus
+
+	routerMap["localexec"] = execLocal
+
 	return routerMap
 }
 
-// relay 转发方法: GET Key、Set k1 v1
-func defaultFunc(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
-	key := string(args[1])
-	peer := cluster.peerPicker.PickNode(key) // 一致性哈希，返回节点哈希
+// makeCmdFunc 根据指令的元信息决定默认的执行方式:
+// 涉及 key 的指令转发到 key 所在的节点; 不涉及 key 的管理指令广播给所有节点; 其它不涉及 key 的指令在本地执行
+func makeCmdFunc(info *database.CommandInfo) CmdFunc {
+	if !info.IsKeyless() {
+		return func(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+			return defaultFunc(cluster, c, info, args)
+		}
+	}
+	if info.Flags&database.FlagAdmin != 0 {
+		return broadcastAndCheck
+	}
+	return localFunc
+}
+
+// defaultFunc 转发方法: GET Key、Set k1 v1; 涉及多个 key 时所有 key 必须位于同一节点
+func defaultFunc(cluster *ClusterDatabase, c resp.Connection, info *database.CommandInfo, args [][]byte) resp.Reply {
+	if !info.ValidateArity(args) {
+		return reply.MakeArgNumErrReply(info.Name)
+	}
+	keys := info.ExtractKeys(args)
+	peer := cluster.peerPicker.PickNode(keys[0]) // 一致性哈希，返回节点哈希
+	for _, key := range keys[1:] {
+		if cluster.peerPicker.PickNode(key) != peer {
+			return reply.MakeErrReply("ERR keys of '" + info.Name + "' must be within one node in cluster mode")
+		}
+	}
 	return cluster.relay(peer, c, args)
 }
+
+// makeBlockingFunc 阻塞指令: key 必须位于本节点
+// 节点间的连接来自连接池且有超时时间, 不能在其它节点上长时间阻塞
+func makeBlockingFunc(info *database.CommandInfo) CmdFunc {
+	return func(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+		if !info.ValidateArity(args) {
+			return reply.MakeArgNumErrReply(info.Name)
+		}
+		for _, key := range info.ExtractKeys(args) {
+			if peer := cluster.peerPicker.PickNode(key); peer != cluster.self {
+				return reply.MakeErrReply("ERR key '" + key + "' of blocking command '" + info.Name +
+					"' is on node " + peer + ", please connect to it directly")
+			}
+		}
+		return cluster.db.Exec(c, args)
+	}
+}
+
+// XRead XREAD/XREADGROUP [GROUP group consumer] [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+// key 的位置不固定, 所有 key 必须位于同一节点; 带有 BLOCK 时与其它阻塞指令一样必须位于本节点
+func XRead(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(args[0]))
+	writeKeys, readKeys := database.GetRelatedKeys(args)
+	keys := append(writeKeys, readKeys...)
+	if len(keys) == 0 {
+		// 参数不合法, 由本节点返回错误信息
+		return cluster.db.Exec(c, args)
+	}
+	block := false
+	for _, arg := range args[1:] {
+		option := strings.ToLower(string(arg))
+		if option == "streams" {
+			break
+		}
+		if option == "block" {
+			block = true
+		}
+	}
+	peer := cluster.peerPicker.PickNode(keys[0])
+	for _, key := range keys[1:] {
+		if cluster.peerPicker.PickNode(key) != peer {
+			return reply.MakeErrReply("ERR keys of '" + cmdName + "' must be within one node in cluster mode")
+		}
+	}
+	if block && peer != cluster.self {
+		return reply.MakeErrReply("ERR key '" + keys[0] + "' of blocking command '" + cmdName + "' is on node " + peer +
+			", please connect to it directly")
+	}
+	return cluster.relay(peer, c, args)
+}
+
+// localFunc 在本节点执行: PING
+func localFunc(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	return cluster.db.Exec(c, args)
+}
+
+// execLocal LocalExec cmd args...: 节点收到其它节点广播的指令时在本地执行, 不再次广播
+func execLocal(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeArgNumErrReply("localexec")
+	}
+	return cluster.db.Exec(c, args[1:])
+}
+
+// isInternalCommand 判断是否是节点之间使用的内部指令; 单机版的内部指令(如 XRESTORE)不生成路由
+func isInternalCommand(cmdName string) bool {
+	switch cmdName {
+	case "prepare", "commit", "rollback", "txdump", "txstatus", "localexec":
+		return true
+	}
+	info, ok := database.GetCommandInfo(cmdName)
+	return ok && info.Flags&database.FlagInternal != 0
+}
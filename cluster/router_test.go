@@ -0,0 +1,85 @@
+package cluster
+
+import (
+	"GoRedis/database"
+	"GoRedis/lib/consistenthash"
+	"GoRedis/lib/utils"
+	"testing"
+)
+
+func TestServerCommandInfo(t *testing.T) {
+	// 由 StandaloneDatabase 直接处理的指令也有元信息, 路由由元信息生成
+	tests := []struct {
+		name     string
+		firstKey int
+		lastKey  int
+		admin    bool
+	}{
+		{"move", 1, 1, false},
+		{"copy", 1, 2, false},
+		{"swapdb", 0, 0, true},
+		{"config", 0, 0, true},
+		{"client", 0, 0, false},
+		{"hello", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, ok := database.GetCommandInfo(tt.name)
+			if !ok {
+				t.Fatal("command info not found")
+			}
+			if info.FirstKey != tt.firstKey || info.LastKey != tt.lastKey {
+				t.Errorf("keys: got %d..%d, want %d..%d", info.FirstKey, info.LastKey, tt.firstKey, tt.lastKey)
+			}
+			if admin := info.Flags&database.FlagAdmin != 0; admin != tt.admin {
+				t.Errorf("admin: got %v", admin)
+			}
+			if _, ok := router[tt.name]; !ok {
+				t.Error("route not found")
+			}
+		})
+	}
+}
+
+func TestServerCommandRoutes(t *testing.T) {
+	cluster := makeTestCluster(t)
+	cluster.peerPicker = consistenthash.NewNodeMap(1, nil)
+	cluster.peerPicker.AddNode(testSelf)
+	conn := testConn()
+	run := func(args ...string) string {
+		return string(cluster.Exec(conn, utils.ToCmdLine(args...)).ToBytes())
+	}
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"set", "k", "v"}, "+OK\r\n"},
+		{[]string{"copy", "k", "k2"}, ":1\r\n"},
+		{[]string{"move", "k", "1"}, ":1\r\n"},
+		{[]string{"swapdb", "0", "1"}, "+OK\r\n"},
+		{[]string{"get", "k"}, "$1\r\nv\r\n"},
+		{[]string{"config", "set", "maxmemory-samples", "7"}, "+OK\r\n"},
+		{[]string{"config", "get", "maxmemory-samples"}, "*2\r\n$17\r\nmaxmemory-samples\r\n$1\r\n7\r\n"},
+		{[]string{"config", "set", "maxmemory-samples", "5"}, "+OK\r\n"},
+		// 连接状态只保存在本节点的连接上
+		{[]string{"client", "setname", "conn1"}, "+OK\r\n"},
+		{[]string{"client", "getname"}, "$5\r\nconn1\r\n"},
+	}
+	for _, tt := range tests {
+		if got := run(tt.args...); got != tt.want {
+			t.Errorf("%v: got %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestInternalCommandNotRouted(t *testing.T) {
+	// XRESTORE 只在回滚和事务提交时由参与者执行, 客户端不能直接调用
+	if _, ok := router["xrestore"]; ok {
+		t.Error("xrestore should not be routed")
+	}
+	cluster := makeTestCluster(t)
+	reply := cluster.Exec(testConn(), utils.ToCmdLine("xrestore", "s", "0-0", "0", "0-0", "0"))
+	if got := string(reply.ToBytes()); got[0] != '-' {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,41 @@
+package cluster
+
+/*多 key 指令的分发与汇总: 按节点对 key 分组, 每个节点只发送一条批量指令*/
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
+)
+
+// keyGroup 分配到同一节点的参数
+type keyGroup struct {
+	args    [][]byte // 发往该节点的参数, 不含指令名称
+	indices []int    // 每组参数在原指令中的序号, 用于按原顺序汇总结果
+}
+
+// groupByPeer 按 key 所在的节点对参数分组; 每 step 个参数为一组, 组内第一个参数是 key
+// DEL k1 k2: step = 1; MSET k1 v1 k2 v2: step = 2
+func (cluster *ClusterDatabase) groupByPeer(args [][]byte, step int) map[string]*keyGroup {
+	groupMap := make(map[string]*keyGroup)
+	for i := 0; i+step <= len(args); i += step {
+		peer := cluster.peerPicker.PickNode(string(args[i]))
+		group, ok := groupMap[peer]
+		if !ok {
+			group = &keyGroup{}
+			groupMap[peer] = group
+		}
+		group.args = append(group.args, args[i:i+step]...)
+		group.indices = append(group.indices, i/step)
+	}
+	return groupMap
+}
+
+// scatterGather 将多 key 指令按节点拆分, 并发地向每个节点发送一条批量指令, 返回分组和各节点的回复
+func (cluster *ClusterDatabase) scatterGather(c resp.Connection, cmdName string, args [][]byte, step int) (map[string]*keyGroup, map[string]resp.Reply) {
+	groupMap := cluster.groupByPeer(args, step)
+	cmdLines := make(map[string]CmdLine, len(groupMap))
+	for peer, group := range groupMap {
+		cmdLines[peer] = utils.ToCmdLine2(cmdName, group.args...)
+	}
+	return groupMap, cluster.relayAll(c, cmdLines)
+}
@@ -0,0 +1,63 @@
+package cluster
+
+import (
+	"GoRedis/database"
+	"GoRedis/interface/resp"
+	"GoRedis/resp/reply"
+	"strings"
+)
+
+// Eval EVAL/EVALSHA script numkeys [key ...] [arg ...], FCALL/FCALL_RO function numkeys [key ...] [arg ...]
+// 转发到 KEYS 所在的节点, KEYS 必须位于同一节点; 没有 KEYS 时在本地执行
+func Eval(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(args[0]))
+	writeKeys, readKeys := database.GetRelatedKeys(args)
+	keys := append(writeKeys, readKeys...)
+	if len(keys) == 0 {
+		return cluster.db.Exec(c, args)
+	}
+	peer := cluster.peerPicker.PickNode(keys[0])
+	for _, key := range keys[1:] {
+		if cluster.peerPicker.PickNode(key) != peer {
+			return reply.MakeErrReply("ERR keys of '" + cmdName + "' must be within one node in cluster mode")
+		}
+	}
+	return cluster.relay(peer, c, args)
+}
+
+// makeBroadcastSubCmdFunc 指定的子指令广播给所有节点, 其它子指令在本地执行
+// SCRIPT LOAD/FLUSH 广播后 EVALSHA 转发到任意节点都能找到脚本; FUNCTION LOAD/DELETE/FLUSH/RESTORE 广播后各节点的函数库保持一致
+func makeBroadcastSubCmdFunc(subCmds ...string) CmdFunc {
+	return func(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+		if len(args) < 2 {
+			return reply.MakeArgNumErrReply(strings.ToLower(string(args[0])))
+		}
+		subCmd := strings.ToLower(string(args[1]))
+		for _, name := range subCmds {
+			if subCmd == name {
+				return broadcastSubCmd(cluster, c, args)
+			}
+		}
+		return cluster.db.Exec(c, args)
+	}
+}
+
+func broadcastSubCmd(cluster *ClusterDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	// 先在本地执行以检查语法, 出错时不再广播
+	result := cluster.db.Exec(c, args)
+	if reply.IsErrorReply(result) {
+		return result
+	}
+	cmdLines := make(map[string]CmdLine, len(cluster.nodes))
+	for _, node := range cluster.nodes {
+		if node != cluster.self {
+			cmdLines[node] = args
+		}
+	}
+	for _, v := range cluster.relayAllLocal(c, cmdLines) {
+		if reply.IsErrorReply(v) {
+			return reply.MakeErrReply("error occurs: " + toErrorReply(v).Error())
+		}
+	}
+	return result
+}
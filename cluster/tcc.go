@@ -0,0 +1,391 @@
+package cluster
+
+/*分布式事务的参与者: 负责 Prepare、Commit、Rollback*/
+
+import (
+	"GoRedis/aof"
+	"GoRedis/database"
+	"GoRedis/interface/resp"
+	"GoRedis/lib/logger"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/connection"
+	"GoRedis/resp/reply"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	lockTimeout      = time.Second      // Prepare 阶段等待加锁的最长时间, 需要小于节点间请求的超时时间
+	decisionTimeout  = 5 * time.Second  // Prepare 之后等待协调者决定的时间, 超时后主动询问协调者
+	finishedTxMaxAge = 10 * time.Minute // 已结束的事务保留多久, 用于保证 Commit/Rollback 幂等
+)
+
+const errTxNotFound = "ERR no such transaction"
+
+const (
+	createdStatus    = iota // 正在加锁
+	preparedStatus          // 已加锁并记录了 undo log, 等待协调者决定
+	committedStatus         // 已提交
+	rolledBackStatus        // 已回滚
+)
+
+// Transaction 参与者一侧的事务
+type Transaction struct {
+	id          string    // 全局事务 ID
+	coordinator string    // 协调者地址, 等待决定超时后向它询问事务状态
+	cmdLines    []CmdLine // 需要执行的指令
+	dbIndex     int
+
+	writeKeys []string
+	readKeys  []string
+	locked    bool
+	undoLogs  [][]CmdLine // 每条指令的回滚指令, 按指令倒序执行
+	results   []resp.Reply
+
+	status int8
+	timer  *time.Timer
+	mu     sync.Mutex
+}
+
+// encodeCmdLines 将多条指令编码为一个参数列表: argc1 args1... argc2 args2...
+func encodeCmdLines(cmdLines []CmdLine) [][]byte {
+	args := make([][]byte, 0)
+	for _, cmdLine := range cmdLines {
+		args = append(args, []byte(strconv.Itoa(len(cmdLine))))
+		args = append(args, cmdLine...)
+	}
+	return args
+}
+
+// decodeCmdLines encodeCmdLines 的逆过程
+func decodeCmdLines(args [][]byte) ([]CmdLine, error) {
+	cmdLines := make([]CmdLine, 0)
+	for i := 0; i < len(args); {
+		argc, err := strconv.Atoi(string(args[i]))
+		if err != nil || argc <= 0 || i+1+argc > len(args) {
+			return nil, errors.New("ERR illegal transaction command lines")
+		}
+		cmdLines = append(cmdLines, args[i+1:i+1+argc])
+		i += 1 + argc
+	}
+	if len(cmdLines) == 0 {
+		return nil, errors.New("ERR empty transaction")
+	}
+	return cmdLines, nil
+}
+
+func (cluster *ClusterDatabase) getTransaction(id string) (*Transaction, bool) {
+	raw, ok := cluster.transactions.Get(id)
+	if !ok {
+		return nil, false
+	}
+	return raw.(*Transaction), true
+}
+
+func makeTransaction(id string, coordinator string, dbIndex int, cmdLines []CmdLine) *Transaction {
+	tx := &Transaction{
+		id:          id,
+		coordinator: coordinator,
+		cmdLines:    cmdLines,
+		dbIndex:     dbIndex,
+		status:      createdStatus,
+	}
+	for _, line := range cmdLines {
+		write, read := database.GetRelatedKeys(line)
+		tx.writeKeys = append(tx.writeKeys, write...)
+		tx.readKeys = append(tx.readKeys, read...)
+	}
+	return tx
+}
+
+// forgetLater 事务结束一段时间后删除记录
+func (cluster *ClusterDatabase) forgetLater(tx *Transaction) {
+	cluster.forgetAfter(tx, finishedTxMaxAge)
+}
+
+func (cluster *ClusterDatabase) forgetAfter(tx *Transaction, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		cluster.transactions.Remove(tx.id)
+	})
+}
+
+// fakeConn 用于在事务所属的 DB 上执行指令
+func (tx *Transaction) fakeConn() *connection.Connection {
+	conn := &connection.Connection{}
+	conn.SelectDB(tx.dbIndex)
+	return conn
+}
+
+// execPrepare Prepare txID coordinator argc1 args1... : 锁定相关的 key 并记录 undo log
+func execPrepare(cluster *ClusterDatabase, c resp.Connection, cmdLine CmdLine) resp.Reply {
+	if len(cmdLine) < 5 {
+		return reply.MakeArgNumErrReply("prepare")
+	}
+	txID := string(cmdLine[1])
+	cmdLines, err := decodeCmdLines(cmdLine[3:])
+	if err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+	tx := makeTransaction(txID, string(cmdLine[2]), c.GetDBIndex(), cmdLines)
+	// 协调者可能已经因为超时回滚了该事务, 此时留下的记录阻止迟到的 Prepare
+	if result := cluster.transactions.PutIfAbsent(txID, tx); result == 0 {
+		return reply.MakeErrReply("ERR transaction " + txID + " already exists or has been rolled back")
+	}
+
+	// 加锁可能因为其它事务持有锁而阻塞, 超时后放弃以避免跨节点的死锁
+	locked := make(chan struct{})
+	go func() {
+		cluster.db.RWLocks(tx.dbIndex, tx.writeKeys, tx.readKeys)
+		tx.mu.Lock()
+		defer tx.mu.Unlock()
+		if tx.status != createdStatus { // 等待期间已经被回滚
+			cluster.db.RWUnLocks(tx.dbIndex, tx.writeKeys, tx.readKeys)
+			return
+		}
+		tx.locked = true
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(lockTimeout):
+		tx.mu.Lock()
+		if !tx.locked {
+			tx.status = rolledBackStatus
+			tx.mu.Unlock()
+			cluster.forgetLater(tx)
+			return reply.MakeErrReply("ERR prepare timeout: keys are locked by other transactions")
+		}
+		tx.mu.Unlock()
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	// 加锁成功之后、记录 undo log 之前可能已经被回滚, 此时锁已经由 rollback 释放
+	if tx.status != createdStatus {
+		return reply.MakeErrReply("ERR transaction " + txID + " has been rolled back")
+	}
+	tx.undoLogs = make([][]CmdLine, 0, len(cmdLines))
+	for _, line := range cmdLines {
+		undoLog, err := cluster.db.GetUndoLogs(tx.dbIndex, line)
+		if err != nil { // 无法回滚的事务不能进入 prepared 状态
+			tx.rollback(cluster)
+			return reply.MakeErrReply(err.Error())
+		}
+		tx.undoLogs = append(tx.undoLogs, undoLog)
+	}
+	// 落盘之后才能回复协调者, 重启后仍然遵守协调者的决定
+	if err := cluster.participantLog.prepare(tx); err != nil {
+		tx.rollback(cluster)
+		return reply.MakeErrReply("ERR write participant log failed: " + err.Error())
+	}
+	tx.status = preparedStatus
+	tx.timer = time.AfterFunc(decisionTimeout, func() {
+		cluster.resolveInDoubt(tx)
+	})
+	return reply.MakeOkReply()
+}
+
+// execCommit Commit txID: 执行事务中的指令并释放锁, 返回各指令的执行结果
+func execCommit(cluster *ClusterDatabase, c resp.Connection, cmdLine CmdLine) resp.Reply {
+	if len(cmdLine) != 2 {
+		return reply.MakeArgNumErrReply("commit")
+	}
+	txID := string(cmdLine[1])
+	tx, ok := cluster.getTransaction(txID)
+	if !ok {
+		return reply.MakeErrReply(errTxNotFound)
+	}
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	switch tx.status {
+	case committedStatus: // 协调者恢复时可能重复提交
+		return makeResultsReply(tx.results)
+	case rolledBackStatus:
+		return reply.MakeErrReply("ERR transaction " + txID + " has been rolled back")
+	case createdStatus:
+		return reply.MakeErrReply("ERR transaction " + txID + " is not prepared")
+	}
+	tx.commit(cluster)
+	return makeResultsReply(tx.results)
+}
+
+// commit 调用方需持有 tx.mu 且事务处于 prepared 状态
+func (tx *Transaction) commit(cluster *ClusterDatabase) {
+	conn := tx.fakeConn()
+	tx.results = make([]resp.Reply, 0, len(tx.cmdLines))
+	for _, line := range tx.cmdLines {
+		tx.results = append(tx.results, cluster.db.ExecWithLock(conn, line))
+	}
+	tx.timer.Stop()
+	tx.status = committedStatus
+	cluster.participantLog.finish(tx)
+	cluster.db.RWUnLocks(tx.dbIndex, tx.writeKeys, tx.readKeys)
+	cluster.forgetLater(tx)
+}
+
+// execRollback Rollback txID: 释放锁; 已经提交的事务通过 undo log 撤销
+func execRollback(cluster *ClusterDatabase, c resp.Connection, cmdLine CmdLine) resp.Reply {
+	if len(cmdLine) != 2 {
+		return reply.MakeArgNumErrReply("rollback")
+	}
+	txID := string(cmdLine[1])
+	tx, ok := cluster.getTransaction(txID)
+	if !ok {
+		// Prepare 还没有到达, 留下已回滚的记录
+		tx = &Transaction{
+			id:     txID,
+			status: rolledBackStatus,
+		}
+		if cluster.transactions.PutIfAbsent(txID, tx) == 1 {
+			cluster.forgetLater(tx)
+			return reply.MakeOkReply()
+		}
+		tx, _ = cluster.getTransaction(txID)
+	}
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.rollback(cluster)
+	return reply.MakeOkReply()
+}
+
+// rollback 调用方需持有 tx.mu
+func (tx *Transaction) rollback(cluster *ClusterDatabase) {
+	switch tx.status {
+	case rolledBackStatus:
+		return
+	case createdStatus: // 还没有加锁时, 加锁的协程会发现状态变化并释放锁
+		tx.status = rolledBackStatus
+		if tx.locked {
+			cluster.db.RWUnLocks(tx.dbIndex, tx.writeKeys, tx.readKeys)
+		}
+		cluster.forgetLater(tx)
+		return
+	case preparedStatus:
+		tx.timer.Stop()
+	case committedStatus: // 重新加锁后执行 undo log
+		cluster.db.RWLocks(tx.dbIndex, tx.writeKeys, tx.readKeys)
+	}
+	conn := tx.fakeConn()
+	if tx.status == committedStatus {
+		for i := len(tx.undoLogs) - 1; i >= 0; i-- {
+			for _, line := range tx.undoLogs[i] {
+				cluster.db.ExecWithLock(conn, line)
+			}
+		}
+	}
+	tx.status = rolledBackStatus
+	cluster.participantLog.finish(tx)
+	cluster.db.RWUnLocks(tx.dbIndex, tx.writeKeys, tx.readKeys)
+	cluster.forgetLater(tx)
+}
+
+// restoreTransactions 根据参与者日志恢复事务: 等待决定的事务重新加锁并等待协调者的决定,
+// 已结束的事务保留记录, 使重复的 Commit/Rollback 仍然是幂等的
+func (cluster *ClusterDatabase) restoreTransactions(records []*txRecord) {
+	for _, record := range records {
+		tx := makeTransaction(record.id, record.coordinator, record.dbIndex, record.cmdLines)
+		tx.status = record.status
+		if record.status != preparedStatus {
+			cluster.transactions.Put(tx.id, tx)
+			cluster.forgetAfter(tx, finishedTxMaxAge-time.Since(record.finishedAt))
+			continue
+		}
+		// 启动时还没有其它指令, 加锁不会阻塞
+		cluster.db.RWLocks(tx.dbIndex, tx.writeKeys, tx.readKeys)
+		tx.locked = true
+		for _, line := range tx.cmdLines {
+			undoLog, err := cluster.db.GetUndoLogs(tx.dbIndex, line)
+			if err != nil {
+				logger.Error("restore undo log of transaction " + tx.id + " failed: " + err.Error())
+			}
+			tx.undoLogs = append(tx.undoLogs, undoLog)
+		}
+		tx.timer = time.AfterFunc(decisionTimeout, func() {
+			cluster.resolveInDoubt(tx)
+		})
+		cluster.transactions.Put(tx.id, tx)
+		logger.Info("transaction " + tx.id + " restored, waiting for the decision of " + tx.coordinator)
+	}
+}
+
+// resolveInDoubt 长时间没有收到协调者的决定时, 主动询问协调者事务的状态
+func (cluster *ClusterDatabase) resolveInDoubt(tx *Transaction) {
+	// 询问期间不持有 tx.mu, 避免阻塞协调者发来的 Commit/Rollback
+	r := cluster.sendTx(tx.coordinator, tx.fakeConn(), utils.ToCmdLine("TxStatus", tx.id))
+	var status string
+	if statusReply, ok := r.(*reply.StatusReply); ok {
+		status = statusReply.Status
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.status != preparedStatus {
+		return
+	}
+	switch status {
+	case txCommit:
+		tx.commit(cluster)
+	case txRollback, txUnknown: // 协调者没有记录说明事务已经结束或从未开始
+		tx.rollback(cluster)
+	default: // 协调者不可达或尚未决定, 继续等待; 协调者重启后会恢复该事务
+		logger.Warn("transaction " + tx.id + " is in doubt: " + string(r.ToBytes()))
+		tx.timer = time.AfterFunc(decisionTimeout, func() {
+			cluster.resolveInDoubt(tx)
+		})
+	}
+}
+
+// execTxDump TxDump txID key: 在事务持有锁的情况下读出 key 的值, 返回重建该 key 及其过期时间的指令
+// 多条指令按照 encodeCmdLines 的格式编码, key 不存在时返回空数组
+func execTxDump(cluster *ClusterDatabase, c resp.Connection, cmdLine CmdLine) resp.Reply {
+	if len(cmdLine) != 3 {
+		return reply.MakeArgNumErrReply("txdump")
+	}
+	txID := string(cmdLine[1])
+	key := string(cmdLine[2])
+	tx, ok := cluster.getTransaction(txID)
+	if !ok {
+		return reply.MakeErrReply(errTxNotFound)
+	}
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.status != preparedStatus {
+		return reply.MakeErrReply("ERR transaction " + txID + " is not prepared")
+	}
+	if !containsKey(tx.writeKeys, key) && !containsKey(tx.readKeys, key) {
+		return reply.MakeErrReply("ERR key " + key + " is not locked by transaction " + txID)
+	}
+	entity, exists := cluster.db.GetEntity(tx.dbIndex, key)
+	if !exists {
+		return reply.MakeEmptyMultiBulkBytes()
+	}
+	cmd := aof.EntityToCmd(key, entity)
+	if cmd == nil {
+		return reply.MakeErrReply("ERR cannot dump key " + key)
+	}
+	cmdLines := []CmdLine{cmd.Args}
+	if expireTime, ok := cluster.db.GetExpireTime(tx.dbIndex, key); ok {
+		cmdLines = append(cmdLines, aof.MakeExpireCmd(key, expireTime).Args)
+	}
+	return reply.MakeMultiBulkReply(encodeCmdLines(cmdLines))
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// makeResultsReply 每条指令的回复以原始字节的形式放入 bulk string, 因为节点间的客户端不支持嵌套数组
+func makeResultsReply(results []resp.Reply) resp.Reply {
+	args := make([][]byte, len(results))
+	for i, r := range results {
+		args[i] = r.ToBytes()
+	}
+	return reply.MakeMultiBulkReply(args)
+}
@@ -0,0 +1,374 @@
+package cluster
+
+import (
+	"GoRedis/database"
+	"GoRedis/datastruct/dict"
+	"GoRedis/lib/idgenerator"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/connection"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSelf = "127.0.0.1:6399"
+
+// makeTestCluster 只有自己一个节点的集群, 事务指令都直接在本地执行
+func makeTestCluster(t *testing.T) *ClusterDatabase {
+	t.Helper()
+	cluster := openTestCluster(t, t.TempDir())
+	t.Cleanup(func() { closeTestCluster(cluster) })
+	return cluster
+}
+
+// openTestCluster 使用 dir 中的事务日志创建集群, 模拟节点重启
+func openTestCluster(t *testing.T, dir string) *ClusterDatabase {
+	t.Helper()
+	pl, records, err := makeParticipantLog(filepath.Join(dir, "participant.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	co, _, err := makeCoordinator(filepath.Join(dir, "transaction.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster := &ClusterDatabase{
+		self:           testSelf,
+		nodes:          []string{testSelf},
+		db:             database.NewStandaloneDatabase(),
+		transactions:   dict.MakeConcurrent(transactionsDictSize),
+		participantLog: pl,
+		coordinator:    co,
+		idGenerator:    idgenerator.MakeGenerator(testSelf),
+	}
+	cluster.restoreTransactions(records)
+	return cluster
+}
+
+// closeTestCluster 停止等待决定的定时器后关闭集群
+func closeTestCluster(cluster *ClusterDatabase) {
+	cluster.transactions.ForEach(func(key string, val interface{}) bool {
+		tx := val.(*Transaction)
+		tx.mu.Lock()
+		if tx.timer != nil {
+			tx.timer.Stop()
+		}
+		tx.mu.Unlock()
+		return true
+	})
+	cluster.Close()
+}
+
+func testConn() *connection.Connection {
+	conn := &connection.Connection{}
+	conn.SelectDB(0)
+	return conn
+}
+
+func exec(cluster *ClusterDatabase, args ...string) string {
+	return string(cluster.db.Exec(testConn(), utils.ToCmdLine(args...)).ToBytes())
+}
+
+func sendPrepare(cluster *ClusterDatabase, id string, cmdLines ...CmdLine) string {
+	args := append(utils.ToCmdLine("Prepare", id, cluster.self), encodeCmdLines(cmdLines)...)
+	return string(cluster.sendTx(cluster.self, testConn(), args).ToBytes())
+}
+
+func sendTx(cluster *ClusterDatabase, args ...string) string {
+	return string(cluster.sendTx(cluster.self, testConn(), utils.ToCmdLine(args...)).ToBytes())
+}
+
+// assertUnlocked 检查 key 的锁已经被释放
+func assertUnlocked(t *testing.T, cluster *ClusterDatabase, keys ...string) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		cluster.db.RWLocks(0, keys, nil)
+		cluster.db.RWUnLocks(0, keys, nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("keys %v are still locked", keys)
+	}
+}
+
+func txStatus(t *testing.T, cluster *ClusterDatabase, id string) int8 {
+	t.Helper()
+	tx, ok := cluster.getTransaction(id)
+	if !ok {
+		t.Fatalf("transaction %s not found", id)
+	}
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	return tx.status
+}
+
+func TestTccParticipant(t *testing.T) {
+	setK2 := utils.ToCmdLine("set", "k", "v2")
+	tests := []struct {
+		name   string
+		steps  []string // 依次发送的事务指令, Prepare 之后
+		value  string   // 结束后 k 的值
+		status int8
+	}{
+		{"commit", []string{"Commit"}, "$2\r\nv2\r\n", committedStatus},
+		{"rollback prepared", []string{"Rollback"}, "$2\r\nv1\r\n", rolledBackStatus},
+		// 已提交的事务根据 undo log 撤销
+		{"rollback committed", []string{"Commit", "Rollback"}, "$2\r\nv1\r\n", rolledBackStatus},
+		// 重复的 Commit/Rollback 是幂等的
+		{"commit twice", []string{"Commit", "Commit"}, "$2\r\nv2\r\n", committedStatus},
+		{"rollback twice", []string{"Rollback", "Rollback"}, "$2\r\nv1\r\n", rolledBackStatus},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := makeTestCluster(t)
+			exec(cluster, "set", "k", "v1")
+			if r := sendPrepare(cluster, "1", setK2); r != "+OK\r\n" {
+				t.Fatalf("prepare: %q", r)
+			}
+			for _, step := range tt.steps {
+				if r := sendTx(cluster, step, "1"); strings.HasPrefix(r, "-") {
+					t.Fatalf("%s: %q", step, r)
+				}
+			}
+			assertUnlocked(t, cluster, "k")
+			if got := exec(cluster, "get", "k"); got != tt.value {
+				t.Errorf("value: got %q, want %q", got, tt.value)
+			}
+			if status := txStatus(t, cluster, "1"); status != tt.status {
+				t.Errorf("status: got %d, want %d", status, tt.status)
+			}
+		})
+	}
+}
+
+func TestTccCommitAfterRollback(t *testing.T) {
+	cluster := makeTestCluster(t)
+	sendPrepare(cluster, "1", utils.ToCmdLine("set", "k", "v"))
+	sendTx(cluster, "Rollback", "1")
+	if r := sendTx(cluster, "Commit", "1"); !strings.HasPrefix(r, "-ERR transaction 1 has been rolled back") {
+		t.Errorf("got %q", r)
+	}
+	if got := exec(cluster, "exists", "k"); got != ":0\r\n" {
+		t.Errorf("expected k not to be set, got %q", got)
+	}
+}
+
+func TestTccRollbackBeforePrepare(t *testing.T) {
+	// 协调者超时回滚之后迟到的 Prepare 不能再加锁
+	cluster := makeTestCluster(t)
+	if r := sendTx(cluster, "Rollback", "1"); r != "+OK\r\n" {
+		t.Fatalf("rollback: %q", r)
+	}
+	if r := sendPrepare(cluster, "1", utils.ToCmdLine("set", "k", "v")); !strings.HasPrefix(r, "-ERR transaction 1 already exists") {
+		t.Errorf("prepare: %q", r)
+	}
+	assertUnlocked(t, cluster, "k")
+}
+
+func TestTccPrepareTimeout(t *testing.T) {
+	cluster := makeTestCluster(t)
+	// 其它事务持有 k 的锁
+	cluster.db.RWLocks(0, []string{"k"}, nil)
+	start := time.Now()
+	r := sendPrepare(cluster, "1", utils.ToCmdLine("set", "k", "v"))
+	if !strings.HasPrefix(r, "-ERR prepare timeout") {
+		t.Fatalf("prepare: %q", r)
+	}
+	if elapsed := time.Since(start); elapsed < lockTimeout {
+		t.Errorf("prepare returned after %v", elapsed)
+	}
+	if status := txStatus(t, cluster, "1"); status != rolledBackStatus {
+		t.Errorf("status: got %d", status)
+	}
+	if r := sendTx(cluster, "Commit", "1"); !strings.HasPrefix(r, "-ERR transaction 1 has been rolled back") {
+		t.Errorf("commit: %q", r)
+	}
+	// 之前的锁释放之后, 等待加锁的协程拿到锁后发现事务已回滚, 立即释放
+	cluster.db.RWUnLocks(0, []string{"k"}, nil)
+	assertUnlocked(t, cluster, "k")
+}
+
+func TestTccRollbackWhileLocking(t *testing.T) {
+	cluster := makeTestCluster(t)
+	cluster.db.RWLocks(0, []string{"k"}, nil)
+	result := make(chan string, 1)
+	go func() {
+		result <- sendPrepare(cluster, "1", utils.ToCmdLine("set", "k", "v"))
+	}()
+	// 等待 Prepare 开始加锁
+	for {
+		if _, ok := cluster.getTransaction("1"); ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if r := sendTx(cluster, "Rollback", "1"); r != "+OK\r\n" {
+		t.Fatalf("rollback: %q", r)
+	}
+	cluster.db.RWUnLocks(0, []string{"k"}, nil)
+	if r := <-result; !strings.HasPrefix(r, "-ERR") {
+		t.Errorf("prepare: %q", r)
+	}
+	assertUnlocked(t, cluster, "k")
+	if got := exec(cluster, "exists", "k"); got != ":0\r\n" {
+		t.Errorf("expected k not to be set, got %q", got)
+	}
+}
+
+func TestTccResolveInDoubt(t *testing.T) {
+	tests := []struct {
+		name     string
+		decision string // 协调者记录的决定, 空表示没有记录
+		status   int8
+		value    string
+	}{
+		{"unknown", "", rolledBackStatus, "$-1\r\n"},
+		{"rollback", txRollback, rolledBackStatus, "$-1\r\n"},
+		{"commit", txCommit, committedStatus, "$1\r\nv\r\n"},
+		{"pending", txPending, preparedStatus, "$-1\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := makeTestCluster(t)
+			if tt.decision != "" {
+				cluster.coordinator.begin(&globalTx{id: "1", peers: []string{testSelf}, decision: tt.decision})
+			}
+			sendPrepare(cluster, "1", utils.ToCmdLine("set", "k", "v"))
+			tx, _ := cluster.getTransaction("1")
+			// 不等待 decisionTimeout, 直接询问协调者
+			cluster.resolveInDoubt(tx)
+			if status := txStatus(t, cluster, "1"); status != tt.status {
+				t.Errorf("status: got %d, want %d", status, tt.status)
+			}
+			if tt.status == preparedStatus {
+				sendTx(cluster, "Rollback", "1")
+			}
+			assertUnlocked(t, cluster, "k")
+			if got := exec(cluster, "get", "k"); got != tt.value {
+				t.Errorf("value: got %q, want %q", got, tt.value)
+			}
+		})
+	}
+}
+
+func TestParticipantRestart(t *testing.T) {
+	dir := t.TempDir()
+	cluster := openTestCluster(t, dir)
+	if r := sendPrepare(cluster, "1", utils.ToCmdLine("set", "k", "v")); r != "+OK\r\n" {
+		t.Fatalf("prepare: %q", r)
+	}
+	if r := sendPrepare(cluster, "2", utils.ToCmdLine("set", "k2", "v")); r != "+OK\r\n" {
+		t.Fatalf("prepare: %q", r)
+	}
+	sendTx(cluster, "Rollback", "2")
+	closeTestCluster(cluster)
+
+	// 重启后 Prepare 成功的事务仍然持有锁, 等待协调者的决定
+	cluster = openTestCluster(t, dir)
+	if status := txStatus(t, cluster, "1"); status != preparedStatus {
+		t.Fatalf("status: got %d", status)
+	}
+	locked := make(chan struct{})
+	go func() {
+		cluster.db.RWLocks(0, []string{"k"}, nil)
+		cluster.db.RWUnLocks(0, []string{"k"}, nil)
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("expected k to be locked by the restored transaction")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if r := sendTx(cluster, "Commit", "1"); r != "*1\r\n$5\r\n+OK\r\n\r\n" {
+		t.Fatalf("commit: %q", r)
+	}
+	<-locked
+	if got := exec(cluster, "get", "k"); got != "$1\r\nv\r\n" {
+		t.Errorf("value: got %q", got)
+	}
+	if status := txStatus(t, cluster, "2"); status != rolledBackStatus {
+		t.Errorf("status of 2: got %d", status)
+	}
+	closeTestCluster(cluster)
+
+	// 已结束的事务在重启后仍然有记录, 重复的 Commit 不会被当作未知的事务
+	cluster = openTestCluster(t, dir)
+	defer closeTestCluster(cluster)
+	if r := sendTx(cluster, "Commit", "1"); strings.HasPrefix(r, "-") {
+		t.Errorf("commit again: %q", r)
+	}
+	if r := sendTx(cluster, "Commit", "2"); !strings.HasPrefix(r, "-ERR transaction 2 has been rolled back") {
+		t.Errorf("commit rolled back: %q", r)
+	}
+	if r := sendTx(cluster, "Commit", "3"); r != "-"+errTxNotFound+"\r\n" {
+		t.Errorf("commit unknown: %q", r)
+	}
+}
+
+func TestRecoverUnknownTx(t *testing.T) {
+	// 参与者没有事务的记录时不能认为已经提交, 协调者保留事务等待人工检查
+	cluster := makeTestCluster(t)
+	tx := &globalTx{id: "1", peers: []string{testSelf}, decision: txPending}
+	cluster.coordinator.begin(tx)
+	_ = cluster.coordinator.decide(tx, txCommit)
+	cluster.recoverTx(tx, tx.peers)
+	if status := cluster.coordinator.status("1"); status != txCommit {
+		t.Errorf("status: got %s", status)
+	}
+}
+
+func TestCoordinatorRollback(t *testing.T) {
+	cluster := makeTestCluster(t)
+	exec(cluster, "set", "k", "v1")
+	ct := cluster.beginTx(testConn(), []string{testSelf})
+	if errReply := ct.prepare(testSelf, []CmdLine{utils.ToCmdLine("set", "k", "v2")}); errReply != nil {
+		t.Fatal(errReply.Error())
+	}
+	ct.rollback()
+	if status := cluster.coordinator.status(ct.tx.id); status != txUnknown {
+		t.Errorf("expected transaction to end, got %s", status)
+	}
+	assertUnlocked(t, cluster, "k")
+	if got := exec(cluster, "get", "k"); got != "$2\r\nv1\r\n" {
+		t.Errorf("value: got %q", got)
+	}
+}
+
+func TestCoordinatorRecovery(t *testing.T) {
+	// 重启后, 没有做出决定的事务被回滚, 已经决定的事务继续提交
+	filename := filepath.Join(t.TempDir(), "transaction.log")
+	co, _, err := makeCoordinator(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	co.begin(&globalTx{id: "1", peers: []string{testSelf}, decision: txPending})
+	co.begin(&globalTx{id: "2", peers: []string{testSelf}, decision: txPending})
+	_ = co.decide(&globalTx{id: "2"}, txCommit)
+	co.begin(&globalTx{id: "3", peers: []string{testSelf}, decision: txPending})
+	_ = co.decide(&globalTx{id: "3"}, txRollback)
+	co.begin(&globalTx{id: "4", peers: []string{testSelf}, decision: txPending})
+	co.end(&globalTx{id: "4"})
+	co.close()
+
+	co, unfinished, err := makeCoordinator(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer co.close()
+	want := map[string]string{"1": txRollback, "2": txCommit, "3": txRollback}
+	if len(unfinished) != len(want) {
+		t.Fatalf("expected %d unfinished transactions, got %d", len(want), len(unfinished))
+	}
+	for _, tx := range unfinished {
+		if tx.decision != want[tx.id] {
+			t.Errorf("transaction %s: got %s, want %s", tx.id, tx.decision, want[tx.id])
+		}
+		if len(tx.peers) != 1 || tx.peers[0] != testSelf {
+			t.Errorf("transaction %s: unexpected peers %v", tx.id, tx.peers)
+		}
+	}
+}
@@ -21,8 +21,33 @@ type ServerProperties struct {
 	RequirePass    string `cfg:"requirepass"`
 	Databases      int    `cfg:"databases"`
 
-	Peers []string `cfg:"peers"`
-	Self  string   `cfg:"self"`
+	// 带有 runtime 标签的配置项可以通过 CONFIG SET 在运行时修改
+	MaxMemory        int    `cfg:"maxmemory" runtime:"yes"`         // 内存上限(字节), 0 表示不限制
+	MaxMemoryPolicy  string `cfg:"maxmemory-policy" runtime:"yes"`  // 内存淘汰策略, 默认 noeviction
+	MaxMemorySamples int    `cfg:"maxmemory-samples" runtime:"yes"` // 每次淘汰时每个 DB 采样的 key 数, 默认 5
+
+	// lazy-free: 只为兼容 redis 的配置, 不影响行为; 被删除的 value 总是由 GC 在后台回收
+	LazyFreeLazyEviction  bool `cfg:"lazyfree-lazy-eviction" runtime:"yes"`   // 内存淘汰
+	LazyFreeLazyExpire    bool `cfg:"lazyfree-lazy-expire" runtime:"yes"`     // 过期删除
+	LazyFreeLazyServerDel bool `cfg:"lazyfree-lazy-server-del" runtime:"yes"` // 覆盖写入、RENAME 等隐式删除
+	LazyFreeLazyUserDel   bool `cfg:"lazyfree-lazy-user-del" runtime:"yes"`   // DEL 等同于 UNLINK
+	LazyFreeLazyUserFlush bool `cfg:"lazyfree-lazy-user-flush" runtime:"yes"` // 不带参数的 FLUSHDB/FLUSHALL 等同于 ASYNC
+
+	NotifyKeyspaceEvents string `cfg:"notify-keyspace-events" runtime:"yes"` // 键空间通知的事件类型, 空字符串表示关闭
+
+	HllSparseMaxBytes int `cfg:"hll-sparse-max-bytes" runtime:"yes"` // HyperLogLog sparse 编码的最大字节数, 超过后转为 dense, 默认 3000
+
+	LuaTimeLimit int `cfg:"lua-time-limit" runtime:"yes"` // Lua 脚本执行超过该时间(毫秒)后其它指令返回 BUSY, 可以用 SCRIPT KILL 终止, 默认 5000
+
+	ProtoMaxBulkLen int `cfg:"proto-max-bulk-len" runtime:"yes"` // 客户端请求中单个参数的最大长度(字节), 默认 512MB
+
+	Peers                  []string `cfg:"peers"`
+	Self                   string   `cfg:"self"`
+	TxLogFilename          string   `cfg:"txLogFilename"`          // 集群分布式事务协调者日志
+	ParticipantLogFilename string   `cfg:"participantLogFilename"` // 集群分布式事务参与者日志
+	Replicas               int      `cfg:"replicas"`               // 一致性哈希中每个节点的虚拟节点数
+	Weights                []string `cfg:"weights"`                // 节点权重, 格式为 IP:Port=weight
+	ClusterSecret          string   `cfg:"cluster-secret"`         // 节点间认证的密钥, 为空时只检查对方的 IP 是否属于 peers
 }
 
 // Properties holds global config properties
@@ -65,36 +90,119 @@ func parse(src io.Reader) *ServerProperties {
 	n := t.Elem().NumField()
 	for i := 0; i < n; i++ {
 		field := t.Elem().Field(i)
-		fieldVal := v.Elem().Field(i)
-		key, ok := field.Tag.Lookup("cfg")
-		if !ok {
-			key = field.Name
-		}
-		value, ok := rawMap[strings.ToLower(key)]
+		value, ok := rawMap[strings.ToLower(fieldKey(field))]
 		if ok {
 			// fill config
-			switch field.Type.Kind() {
-			case reflect.String:
-				fieldVal.SetString(value)
-			case reflect.Int:
-				intValue, err := strconv.ParseInt(value, 10, 64)
-				if err == nil {
-					fieldVal.SetInt(intValue)
-				}
-			case reflect.Bool:
-				boolValue := "yes" == value
-				fieldVal.SetBool(boolValue)
-			case reflect.Slice:
-				if field.Type.Elem().Kind() == reflect.String {
-					slice := strings.Split(value, ",")
-					fieldVal.Set(reflect.ValueOf(slice))
-				}
-			}
+			_ = setField(field, v.Elem().Field(i), value)
 		}
 	}
 	return config
 }
 
+// fieldKey 配置项的名称, 没有 cfg 标签时使用字段名
+func fieldKey(field reflect.StructField) string {
+	key, ok := field.Tag.Lookup("cfg")
+	if !ok {
+		key = field.Name
+	}
+	return key
+}
+
+// setField 把字符串形式的配置值写入字段
+func setField(field reflect.StructField, fieldVal reflect.Value, value string) error {
+	switch field.Type.Kind() {
+	case reflect.String:
+		fieldVal.SetString(value)
+	case reflect.Int:
+		intValue, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.New("argument couldn't be parsed into an integer")
+		}
+		fieldVal.SetInt(intValue)
+	case reflect.Bool:
+		if value != "yes" && value != "no" {
+			return errors.New("argument must be 'yes' or 'no'")
+		}
+		boolValue := "yes" == value
+		fieldVal.SetBool(boolValue)
+	case reflect.Slice:
+		if field.Type.Elem().Kind() == reflect.String {
+			slice := strings.Split(value, ",")
+			fieldVal.Set(reflect.ValueOf(slice))
+		}
+	}
+	return nil
+}
+
+// formatField 把字段的值转换为字符串, 格式与配置文件相同
+func formatField(fieldVal reflect.Value) string {
+	switch fieldVal.Kind() {
+	case reflect.String:
+		return fieldVal.String()
+	case reflect.Int:
+		return strconv.FormatInt(fieldVal.Int(), 10)
+	case reflect.Bool:
+		if fieldVal.Bool() {
+			return "yes"
+		}
+		return "no"
+	case reflect.Slice:
+		if slice, ok := fieldVal.Interface().([]string); ok {
+			return strings.Join(slice, ",")
+		}
+	}
+	return ""
+}
+
+// GetAll 返回所有配置项, key 为配置项的名称(小写)
+func GetAll() map[string]string {
+	result := make(map[string]string)
+	t := reflect.TypeOf(Properties).Elem()
+	v := reflect.ValueOf(Properties).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		result[strings.ToLower(fieldKey(t.Field(i)))] = formatField(v.Field(i))
+	}
+	return result
+}
+
+// lookupField 查找名称为 key 的配置项
+func lookupField(key string) (reflect.StructField, reflect.Value, bool) {
+	key = strings.ToLower(key)
+	t := reflect.TypeOf(Properties).Elem()
+	v := reflect.ValueOf(Properties).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if strings.ToLower(fieldKey(field)) == key {
+			return field, v.Field(i), true
+		}
+	}
+	return reflect.StructField{}, reflect.Value{}, false
+}
+
+// CheckSettable 检查配置项是否存在且可以在运行时修改, 只有带有 runtime 标签的配置项可以修改
+func CheckSettable(key string) error {
+	field, _, ok := lookupField(key)
+	if !ok {
+		return errors.New("ERR Unknown option or number of arguments for CONFIG SET - '" + key + "'")
+	}
+	if _, ok := field.Tag.Lookup("runtime"); !ok {
+		return errors.New("ERR CONFIG SET failed (possibly related to argument '" + key + "') - can't set immutable config")
+	}
+	return nil
+}
+
+// Set 在运行时修改配置项
+func Set(key string, value string) error {
+	if err := CheckSettable(key); err != nil {
+		return err
+	}
+	field, fieldVal, _ := lookupField(key)
+	if err := setField(field, fieldVal, value); err != nil {
+		return errors.New("ERR CONFIG SET failed (possibly related to argument '" + key + "') - " + err.Error())
+	}
+	return nil
+}
+
 // SetupConfig read config file and store properties into Properties
 func SetupConfig(configFilename string) {
 	file, err := os.Open(configFilename)
@@ -0,0 +1,530 @@
+package database
+
+import (
+	"GoRedis/datastruct/bitmap"
+	"GoRedis/interface/database"
+	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// maxStringLen string 的最大长度, 位操作不能超过这个范围
+const maxStringLen = 512 * 1024 * 1024
+
+const bitOffsetErr = "ERR bit offset is not an integer or out of range"
+
+// parseBitOffset 解析位偏移量; hashAllowed 时支持 #N 表示第 N 个 width 位宽的整数
+func parseBitOffset(arg []byte, hashAllowed bool, width uint) (int64, reply.ErrorReply) {
+	str := string(arg)
+	useHash := hashAllowed && strings.HasPrefix(str, "#")
+	if useHash {
+		str = str[1:]
+	}
+	offset, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, reply.MakeErrReply(bitOffsetErr)
+	}
+	if useHash {
+		if offset > (maxStringLen<<3)/int64(width) {
+			return 0, reply.MakeErrReply(bitOffsetErr)
+		}
+		offset *= int64(width)
+	}
+	if offset>>3 >= maxStringLen {
+		return 0, reply.MakeErrReply(bitOffsetErr)
+	}
+	return offset, nil
+}
+
+// growString 复制 value 并补零到至少 size 字节
+// 旧的 value 可能仍被 aof 或回复引用, 不能原地修改
+func growString(value []byte, size int64) []byte {
+	if size < int64(len(value)) {
+		size = int64(len(value))
+	}
+	result := make([]byte, size)
+	copy(result, value)
+	return result
+}
+
+// parseBitRange 解析 start end [BYTE|BIT], 返回以位为单位的闭区间; 区间为空时返回 false
+func parseBitRange(args [][]byte, size int64) (start int64, end int64, isBit bool, ok bool, errReply reply.ErrorReply) {
+	var err error
+	start, err = strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil {
+		return 0, 0, false, false, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	end = size - 1
+	if len(args) > 1 {
+		end, err = strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return 0, 0, false, false, reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+	}
+	if len(args) > 2 {
+		switch strings.ToUpper(string(args[2])) {
+		case "BYTE":
+		case "BIT":
+			isBit = true
+		default:
+			return 0, 0, false, false, reply.MakeSyntaxErrReply()
+		}
+	}
+	total := size
+	if isBit {
+		total = size << 3
+	}
+	if start < 0 {
+		start += total
+	}
+	if end < 0 {
+		end += total
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= total {
+		end = total - 1
+	}
+	if start > end || total == 0 {
+		return 0, 0, isBit, false, nil
+	}
+	if !isBit {
+		start, end = start<<3, end<<3+7
+	}
+	return start, end, isBit, true, nil
+}
+
+// execSetBit SETBIT key offset value: 设置第 offset 位, 返回原来的值
+func execSetBit(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	offset, errReply := parseBitOffset(args[1], false, 1)
+	if errReply != nil {
+		return errReply
+	}
+	var val byte
+	switch string(args[2]) {
+	case "0":
+	case "1":
+		val = 1
+	default:
+		return reply.MakeErrReply("ERR bit is not an integer or out of range")
+	}
+	value, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	old := bitmap.GetBit(value, offset)
+	value = growString(value, offset>>3+1)
+	bitmap.SetBit(value, offset, val)
+	db.PutEntity(key, &database.DataEntity{Data: value})
+	db.notify(notifyString, "setbit", key)
+	db.addAof(utils.ToCmdLine2("setbit", args...))
+	return reply.MakeIntReply(int64(old))
+}
+
+// execGetBit GETBIT key offset: 返回第 offset 位
+func execGetBit(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	offset, errReply := parseBitOffset(args[1], false, 1)
+	if errReply != nil {
+		return errReply
+	}
+	value, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	return reply.MakeIntReply(int64(bitmap.GetBit(value, offset)))
+}
+
+// execBitCount BITCOUNT key [start end [BYTE|BIT]]: 统计范围内 1 的数量
+func execBitCount(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	if len(args) == 2 || len(args) > 4 {
+		return reply.MakeSyntaxErrReply()
+	}
+	value, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	start, end := int64(0), int64(len(value))<<3-1
+	if len(args) > 1 {
+		var ok bool
+		start, end, _, ok, errReply = parseBitRange(args[1:], int64(len(value)))
+		if errReply != nil {
+			return errReply
+		}
+		if !ok {
+			return reply.MakeIntReply(0)
+		}
+	}
+	if len(value) == 0 {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(bitmap.Count(value, start, end))
+}
+
+// execBitPos BITPOS key bit [start [end [BYTE|BIT]]]: 返回范围内第一个值为 bit 的位置
+func execBitPos(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	if len(args) > 5 {
+		return reply.MakeSyntaxErrReply()
+	}
+	var bit byte
+	switch string(args[1]) {
+	case "0":
+	case "1":
+		bit = 1
+	default:
+		return reply.MakeErrReply("ERR The bit argument must be 1 or 0.")
+	}
+	value, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	if value == nil {
+		// 不存在的 key 视为全 0 的无限长字符串
+		if bit == 1 {
+			return reply.MakeIntReply(-1)
+		}
+		return reply.MakeIntReply(0)
+	}
+	start, end := int64(0), int64(len(value))<<3-1
+	endGiven := len(args) > 3
+	if len(args) > 2 {
+		var ok bool
+		start, end, _, ok, errReply = parseBitRange(args[2:], int64(len(value)))
+		if errReply != nil {
+			return errReply
+		}
+		if !ok {
+			return reply.MakeIntReply(-1)
+		}
+	}
+	if len(value) == 0 {
+		return reply.MakeIntReply(-1)
+	}
+	pos := bitmap.Pos(value, bit, start, end)
+	if pos < 0 && bit == 0 && !endGiven {
+		// 没有指定结束位置时, 字符串右侧视为补 0
+		return reply.MakeIntReply(int64(len(value)) << 3)
+	}
+	return reply.MakeIntReply(pos)
+}
+
+// execBitOp BITOP AND|OR|XOR|NOT destkey key [key...]: 对多个 key 做位运算, 结果保存到 destkey
+func execBitOp(db *DB, args [][]byte) resp.Reply {
+	var op bitmap.Op
+	switch strings.ToUpper(string(args[0])) {
+	case "AND":
+		op = bitmap.OpAnd
+	case "OR":
+		op = bitmap.OpOr
+	case "XOR":
+		op = bitmap.OpXor
+	case "NOT":
+		op = bitmap.OpNot
+	default:
+		return reply.MakeSyntaxErrReply()
+	}
+	if op == bitmap.OpNot && len(args) != 3 {
+		return reply.MakeErrReply("ERR BITOP NOT must be called with a single source key.")
+	}
+	dest := string(args[1])
+	srcs := make([][]byte, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		value, errReply := db.getAsString(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		srcs = append(srcs, value)
+	}
+	result := bitmap.Operate(op, srcs)
+	if len(result) == 0 {
+		db.Removes(dest)
+	} else {
+		db.PutEntity(dest, &database.DataEntity{Data: result})
+		db.Persist(dest)
+		db.notify(notifyString, "set", dest)
+	}
+	db.addAof(utils.ToCmdLine2("bitop", args...))
+	return reply.MakeIntReply(int64(len(result)))
+}
+
+func prepareBitOp(args [][]byte) ([]string, []string) {
+	readKeys := make([]string, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		readKeys = append(readKeys, string(arg))
+	}
+	return []string{string(args[1])}, readKeys
+}
+
+func undoBitOp(db *DB, args [][]byte) ([]CmdLine, error) {
+	return rollbackGivenKeys(db, string(args[1]))
+}
+
+/* ---- BITFIELD ---- */
+
+const (
+	overflowWrap = iota
+	overflowSat
+	overflowFail
+)
+
+const (
+	bitFieldGet = iota
+	bitFieldSet
+	bitFieldIncrBy
+)
+
+// bitFieldOp BITFIELD 的一个子命令
+type bitFieldOp struct {
+	kind     int
+	offset   int64
+	width    uint
+	signed   bool
+	value    int64 // SET 的新值或 INCRBY 的增量
+	overflow int
+}
+
+// parseBitFieldType 解析 i1~i64 或 u1~u63
+func parseBitFieldType(arg []byte) (width uint, signed bool, ok bool) {
+	str := strings.ToLower(string(arg))
+	if len(str) < 2 || (str[0] != 'i' && str[0] != 'u') {
+		return 0, false, false
+	}
+	signed = str[0] == 'i'
+	n, err := strconv.ParseUint(str[1:], 10, 8)
+	if err != nil || n < 1 || (signed && n > 64) || (!signed && n > 63) {
+		return 0, false, false
+	}
+	return uint(n), signed, true
+}
+
+// parseBitFieldOps 解析 BITFIELD 的子命令, readOnly 时只允许 GET
+func parseBitFieldOps(args [][]byte, readOnly bool) ([]*bitFieldOp, reply.ErrorReply) {
+	ops := make([]*bitFieldOp, 0)
+	overflow := overflowWrap
+	for i := 0; i < len(args); {
+		sub := strings.ToUpper(string(args[i]))
+		var kind, argCount int
+		switch sub {
+		case "GET":
+			kind, argCount = bitFieldGet, 2
+		case "SET":
+			kind, argCount = bitFieldSet, 3
+		case "INCRBY":
+			kind, argCount = bitFieldIncrBy, 3
+		case "OVERFLOW":
+			argCount = 1
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		if i+argCount >= len(args) {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		if sub == "OVERFLOW" {
+			switch strings.ToUpper(string(args[i+1])) {
+			case "WRAP":
+				overflow = overflowWrap
+			case "SAT":
+				overflow = overflowSat
+			case "FAIL":
+				overflow = overflowFail
+			default:
+				return nil, reply.MakeErrReply("ERR Invalid OVERFLOW type specified")
+			}
+			i += 2
+			continue
+		}
+		if readOnly && kind != bitFieldGet {
+			return nil, reply.MakeErrReply("ERR BITFIELD_RO only supports the GET subcommand")
+		}
+		width, signed, ok := parseBitFieldType(args[i+1])
+		if !ok {
+			return nil, reply.MakeErrReply("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+		}
+		offset, errReply := parseBitOffset(args[i+2], true, width)
+		if errReply != nil {
+			return nil, errReply
+		}
+		op := &bitFieldOp{
+			kind:     kind,
+			offset:   offset,
+			width:    width,
+			signed:   signed,
+			overflow: overflow,
+		}
+		if kind != bitFieldGet {
+			value, err := strconv.ParseInt(string(args[i+3]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			op.value = value
+		}
+		ops = append(ops, op)
+		i += argCount + 1
+	}
+	return ops, nil
+}
+
+// checkUnsignedOverflow 计算 value + incr, 溢出时按 overflow 处理; 第二个返回值表示是否溢出
+func checkUnsignedOverflow(value uint64, incr int64, width uint, overflow int) (uint64, bool) {
+	max := uint64(1)<<width - 1
+	if value > max || (incr > 0 && uint64(incr) > max-value) {
+		if overflow == overflowSat {
+			return max, true
+		}
+	} else if incr < 0 && uint64(-incr) > value {
+		if overflow == overflowSat {
+			return 0, true
+		}
+	} else {
+		return value + uint64(incr), false
+	}
+	// 回绕: 只保留低 width 位
+	return (value + uint64(incr)) & max, true
+}
+
+// checkSignedOverflow 计算 value + incr, 溢出时按 overflow 处理; 第二个返回值表示是否溢出
+func checkSignedOverflow(value int64, incr int64, width uint, overflow int) (int64, bool) {
+	max := int64(uint64(1)<<(width-1) - 1)
+	min := -max - 1
+	maxIncr, minIncr := max-value, min-value
+	var limit int64
+	if value > max || (width != 64 && incr > maxIncr) || (value >= 0 && incr > 0 && incr > maxIncr) {
+		limit = max
+	} else if value < min || (width != 64 && incr < minIncr) || (value < 0 && incr < 0 && incr < minIncr) {
+		limit = min
+	} else {
+		return value + incr, false
+	}
+	if overflow == overflowSat {
+		return limit, true
+	}
+	// 回绕: 截断到 width 位后做符号扩展
+	result := uint64(value) + uint64(incr)
+	if width < 64 {
+		mask := ^uint64(0) << width
+		if result&(uint64(1)<<(width-1)) != 0 {
+			result |= mask
+		} else {
+			result &^= mask
+		}
+	}
+	return int64(result), true
+}
+
+// execBitFieldOps 依次执行 BITFIELD 子命令, 返回修改后的 value 和是否修改过
+func execBitFieldOps(value []byte, ops []*bitFieldOp) ([]byte, bool, []resp.Reply) {
+	results := make([]resp.Reply, 0, len(ops))
+	size := int64(len(value))
+	for _, op := range ops {
+		if op.kind != bitFieldGet && (op.offset+int64(op.width)-1)>>3+1 > size {
+			size = (op.offset+int64(op.width)-1)>>3 + 1
+		}
+	}
+	changed := false
+	for _, op := range ops {
+		if op.kind == bitFieldGet {
+			if op.signed {
+				results = append(results, reply.MakeIntReply(bitmap.GetSigned(value, op.offset, op.width)))
+			} else {
+				results = append(results, reply.MakeIntReply(int64(bitmap.GetUnsigned(value, op.offset, op.width))))
+			}
+			continue
+		}
+		var oldVal, newVal int64
+		var overflowed bool
+		if op.signed {
+			oldVal = bitmap.GetSigned(value, op.offset, op.width)
+			if op.kind == bitFieldSet {
+				newVal, overflowed = checkSignedOverflow(op.value, 0, op.width, op.overflow)
+			} else {
+				newVal, overflowed = checkSignedOverflow(oldVal, op.value, op.width, op.overflow)
+			}
+		} else {
+			oldVal = int64(bitmap.GetUnsigned(value, op.offset, op.width))
+			var n uint64
+			if op.kind == bitFieldSet {
+				n, overflowed = checkUnsignedOverflow(uint64(op.value), 0, op.width, op.overflow)
+			} else {
+				n, overflowed = checkUnsignedOverflow(uint64(oldVal), op.value, op.width, op.overflow)
+			}
+			newVal = int64(n)
+		}
+		if overflowed && op.overflow == overflowFail {
+			results = append(results, reply.MakeNullBulkReply())
+			continue
+		}
+		if !changed {
+			// 第一次修改时复制一份, 不能修改原来的 value
+			value = growString(value, size)
+			changed = true
+		}
+		bitmap.SetUnsigned(value, op.offset, op.width, uint64(newVal))
+		if op.kind == bitFieldSet {
+			results = append(results, reply.MakeIntReply(oldVal))
+		} else {
+			results = append(results, reply.MakeIntReply(newVal))
+		}
+	}
+	return value, changed, results
+}
+
+// execBitField BITFIELD key [GET type offset] [SET type offset value] [INCRBY type offset increment] [OVERFLOW WRAP|SAT|FAIL]...
+func execBitField(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	ops, errReply := parseBitFieldOps(args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	value, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	value, changed, results := execBitFieldOps(value, ops)
+	if changed {
+		db.PutEntity(key, &database.DataEntity{Data: value})
+		db.notify(notifyString, "setbit", key)
+		db.addAof(utils.ToCmdLine2("bitfield", args...))
+	}
+	return reply.MakeMultiRawReply(results)
+}
+
+// execBitFieldRO BITFIELD_RO key [GET type offset]...: 只读的 BITFIELD
+func execBitFieldRO(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	ops, errReply := parseBitFieldOps(args[1:], true)
+	if errReply != nil {
+		return errReply
+	}
+	value, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	_, _, results := execBitFieldOps(value, ops)
+	return reply.MakeMultiRawReply(results)
+}
+
+func init() {
+	RegisterCommand("SetBit", execSetBit, writeFirstKey, rollbackFirstKey, 4).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("GetBit", execGetBit, readFirstKey, nil, 3).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("BitCount", execBitCount, readFirstKey, nil, -2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("BitPos", execBitPos, readFirstKey, nil, -3).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("BitOp", execBitOp, prepareBitOp, undoBitOp, -4).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 2, -1, 1)
+	RegisterCommand("BitField", execBitField, writeFirstKey, rollbackFirstKey, -2).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("BitField_RO", execBitFieldRO, readFirstKey, nil, -2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+}
@@ -0,0 +1,200 @@
+package database
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/resp/reply"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// bitField 在 value 上执行一条 BITFIELD 的子命令, 返回修改后的 value 和每个子命令的结果, nil 表示 FAIL
+func bitField(t *testing.T, value []byte, args string) ([]byte, []string) {
+	t.Helper()
+	ops, errReply := parseBitFieldOps(toArgs(args), false)
+	if errReply != nil {
+		t.Fatalf("parse %q: %s", args, errReply.Error())
+	}
+	value, _, results := execBitFieldOps(value, ops)
+	return value, formatResults(results)
+}
+
+func toArgs(line string) [][]byte {
+	fields := strings.Fields(line)
+	args := make([][]byte, len(fields))
+	for i, field := range fields {
+		args[i] = []byte(field)
+	}
+	return args
+}
+
+func formatResults(results []resp.Reply) []string {
+	strs := make([]string, len(results))
+	for i, r := range results {
+		switch r := r.(type) {
+		case *reply.IntReply:
+			strs[i] = strconv.FormatInt(r.Code, 10)
+		case *reply.BulkReply:
+			if r.Arg == nil {
+				strs[i] = "nil"
+			} else {
+				strs[i] = string(r.Arg)
+			}
+		default:
+			strs[i] = string(r.ToBytes())
+		}
+	}
+	return strs
+}
+
+func TestBitFieldOverflow(t *testing.T) {
+	tests := []struct {
+		name string
+		cmds []string
+		want [][]string // 每条命令的结果
+	}{
+		{
+			// redis 文档中的例子
+			name: "docs example",
+			cmds: []string{
+				"INCRBY u2 100 1 OVERFLOW SAT INCRBY u2 102 1",
+				"INCRBY u2 100 1 OVERFLOW SAT INCRBY u2 102 1",
+				"INCRBY u2 100 1 OVERFLOW SAT INCRBY u2 102 1",
+				"INCRBY u2 100 1 OVERFLOW SAT INCRBY u2 102 1",
+			},
+			want: [][]string{{"1", "1"}, {"2", "2"}, {"3", "3"}, {"0", "3"}},
+		},
+		{
+			name: "unsigned incr",
+			cmds: []string{
+				"SET u8 0 250",
+				"OVERFLOW WRAP INCRBY u8 0 10",
+				"SET u8 0 250 OVERFLOW SAT INCRBY u8 0 10",
+				"SET u8 0 250 OVERFLOW FAIL INCRBY u8 0 10 GET u8 0",
+			},
+			want: [][]string{{"0"}, {"4"}, {"4", "255"}, {"255", "nil", "250"}},
+		},
+		{
+			name: "unsigned decr",
+			cmds: []string{
+				"SET u8 0 5 INCRBY u8 0 -10",
+				"SET u8 0 5 OVERFLOW SAT INCRBY u8 0 -10",
+				"SET u8 0 5 OVERFLOW FAIL INCRBY u8 0 -10 GET u8 0",
+			},
+			want: [][]string{{"0", "251"}, {"251", "0"}, {"0", "nil", "5"}},
+		},
+		{
+			name: "unsigned set",
+			cmds: []string{
+				"SET u8 0 300 GET u8 0",
+				"OVERFLOW SAT SET u8 0 300 GET u8 0",
+				"OVERFLOW FAIL SET u8 0 1 SET u8 0 300 GET u8 0",
+				"OVERFLOW SAT SET u8 0 -1 GET u8 0",
+			},
+			want: [][]string{{"0", "44"}, {"44", "255"}, {"255", "nil", "1"}, {"1", "255"}},
+		},
+		{
+			name: "signed incr",
+			cmds: []string{
+				"SET i8 0 127 INCRBY i8 0 1",
+				"SET i8 0 127 OVERFLOW SAT INCRBY i8 0 1",
+				"SET i8 0 127 OVERFLOW FAIL INCRBY i8 0 1 GET i8 0",
+				"SET i8 0 -128 INCRBY i8 0 -1",
+				"SET i8 0 -128 OVERFLOW SAT INCRBY i8 0 -1",
+				"SET i8 0 -128 OVERFLOW FAIL INCRBY i8 0 -1 GET i8 0",
+			},
+			want: [][]string{
+				{"0", "-128"}, {"-128", "127"}, {"127", "nil", "127"},
+				{"127", "127"}, {"127", "-128"}, {"-128", "nil", "-128"},
+			},
+		},
+		{
+			name: "signed set",
+			cmds: []string{
+				"SET i8 0 200 GET i8 0 GET u8 0",
+				"OVERFLOW SAT SET i8 0 200 GET i8 0",
+				"OVERFLOW SAT SET i8 0 -200 GET i8 0",
+				"OVERFLOW FAIL SET i8 0 -200 GET i8 0",
+			},
+			want: [][]string{{"0", "-56", "200"}, {"-56", "127"}, {"127", "-128"}, {"nil", "-128"}},
+		},
+		{
+			name: "i64",
+			cmds: []string{
+				"SET i64 0 9223372036854775807 INCRBY i64 0 1",
+				"OVERFLOW SAT SET i64 0 9223372036854775807 INCRBY i64 0 1",
+				"OVERFLOW SAT INCRBY i64 0 -9223372036854775808 INCRBY i64 0 -9223372036854775808",
+				"OVERFLOW FAIL INCRBY i64 0 -1 GET i64 0",
+			},
+			want: [][]string{
+				{"0", "-9223372036854775808"}, {"-9223372036854775808", "9223372036854775807"},
+				{"-1", "-9223372036854775808"}, {"nil", "-9223372036854775808"},
+			},
+		},
+		{
+			name: "u63",
+			cmds: []string{
+				"SET u63 0 9223372036854775807 INCRBY u63 0 1",
+				"OVERFLOW SAT INCRBY u63 0 -1 INCRBY u63 0 9223372036854775807",
+			},
+			want: [][]string{{"0", "0"}, {"0", "9223372036854775807"}},
+		},
+		{
+			// 不对齐的位置和 # 形式的偏移量
+			name: "unaligned",
+			cmds: []string{
+				"SET u4 3 15 SET i5 #2 -3 GET u4 3 GET i5 #2 GET u8 0",
+			},
+			want: [][]string{{"0", "0", "15", "-3", "30"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value []byte
+			for i, cmd := range tt.cmds {
+				var got []string
+				value, got = bitField(t, value, cmd)
+				if strings.Join(got, " ") != strings.Join(tt.want[i], " ") {
+					t.Errorf("%q: got %v, want %v", cmd, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBitFieldFailKeepsValue(t *testing.T) {
+	// 所有修改都失败时不复制也不扩展 value
+	value := []byte{0xff}
+	ops, errReply := parseBitFieldOps(toArgs("OVERFLOW FAIL INCRBY u8 0 1 INCRBY u8 8 300"), false)
+	if errReply != nil {
+		t.Fatal(errReply.Error())
+	}
+	result, changed, _ := execBitFieldOps(value, ops)
+	if changed || len(result) != 1 || result[0] != 0xff {
+		t.Errorf("expected value unchanged, got %v %x", changed, result)
+	}
+}
+
+func TestBitFieldParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     string
+		readOnly bool
+	}{
+		{"unknown overflow", "OVERFLOW FOO GET u8 0", false},
+		{"u64", "GET u64 0", false},
+		{"i65", "GET i65 0", false},
+		{"width zero", "GET u0 0", false},
+		{"missing value", "SET u8 0", false},
+		{"bad value", "INCRBY u8 0 x", false},
+		{"negative offset", "GET u8 -1", false},
+		{"read only set", "SET u8 0 1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, errReply := parseBitFieldOps(toArgs(tt.args), tt.readOnly); errReply == nil {
+				t.Errorf("expected error for %q", tt.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package database
+
+/*阻塞指令: 连接挂起在 key 的等待队列上, 有数据写入时按阻塞的先后顺序唤醒*/
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tryFunc 尝试执行一次阻塞指令; 没有可用的数据时返回 false, 调用方挂起等待后重试
+type tryFunc func(db *DB, args [][]byte) (resp.Reply, bool)
+
+// timeoutFunc 解析阻塞的超时时间, block 为 false 时不阻塞
+type timeoutFunc func(args [][]byte) (timeout time.Duration, block bool, errReply reply.ErrorReply)
+
+// blockingCommand 阻塞指令
+type blockingCommand struct {
+	try          tryFunc
+	waitKeys     func(args [][]byte) []string // 需要等待的 key
+	timeout      timeoutFunc
+	timeoutReply resp.Reply // 超时后的回复
+	fifo         bool       // 列表指令按阻塞的先后顺序取走数据; XREAD/XREADGROUP 同时唤醒所有连接, 不需要排队
+}
+
+var blockingCommands = make(map[string]*blockingCommand)
+
+// registerBlockingCommand 注册阻塞指令
+// cmdTable 中的 executor 只尝试一次, 不会阻塞, 供 MULTI 和集群事务使用
+func registerBlockingCommand(name string, try tryFunc, waitKeys func(args [][]byte) []string, timeout timeoutFunc,
+	timeoutReply resp.Reply, fifo bool, prepare PreFunc, rollback UndoFunc, arity int) *command {
+	name = strings.ToLower(name)
+	blockingCommands[name] = &blockingCommand{
+		try:          try,
+		waitKeys:     waitKeys,
+		timeout:      timeout,
+		timeoutReply: timeoutReply,
+		fifo:         fifo,
+	}
+	executor := func(db *DB, args [][]byte) resp.Reply {
+		if _, _, errReply := timeout(args); errReply != nil {
+			return errReply
+		}
+		result, served := try(db, args)
+		if !served {
+			return timeoutReply
+		}
+		return result
+	}
+	return RegisterCommand(name, executor, prepare, rollback, arity)
+}
+
+// IsBlockingCommand 指令是否可能阻塞; 阻塞期间连接的读取方需要检测连接是否断开
+func IsBlockingCommand(cmdName string) bool {
+	_, ok := blockingCommands[strings.ToLower(cmdName)]
+	return ok
+}
+
+// lastArgTimeout 最后一个参数为超时时间: BLPOP key [key ...] timeout
+func lastArgTimeout(args [][]byte) (time.Duration, bool, reply.ErrorReply) {
+	timeout, errReply := parseBlockingTimeout(args[len(args)-1])
+	return timeout, errReply == nil, errReply
+}
+
+// parseBlockingTimeout 超时时间的单位为秒, 可以是小数; 0 表示一直等待
+func parseBlockingTimeout(arg []byte) (time.Duration, reply.ErrorReply) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, reply.MakeErrReply("ERR timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, reply.MakeErrReply("ERR timeout is negative")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// waiter 一个被阻塞的连接
+type waiter struct {
+	conn       resp.Connection
+	keys       []string
+	ready      chan struct{} // 等待的 key 上写入了数据, 缓冲为 1
+	canceled   chan struct{} // 连接关闭时关闭
+	cancelOnce sync.Once
+}
+
+// blockingQueues 每个 key 的等待队列
+type blockingQueues struct {
+	mu      sync.Mutex
+	queues  map[string][]*waiter        // key -> 按阻塞的先后顺序排列的连接
+	waiters map[resp.Connection]*waiter // 连接 -> 阻塞状态, 连接关闭时取消阻塞
+}
+
+func makeBlockingQueues() *blockingQueues {
+	return &blockingQueues{
+		queues:  make(map[string][]*waiter),
+		waiters: make(map[resp.Connection]*waiter),
+	}
+}
+
+// add 把连接加入它等待的所有 key 的队尾
+func (q *blockingQueues) add(w *waiter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, key := range w.keys {
+		q.queues[key] = append(q.queues[key], w)
+	}
+	q.waiters[w.conn] = w
+}
+
+// remove 把连接移出等待队列; 队列中的下一个连接可能可以取到数据, 因此唤醒它
+func (q *blockingQueues) remove(w *waiter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, key := range w.keys {
+		queue := q.queues[key]
+		for i, other := range queue {
+			if other == w {
+				queue = append(queue[:i], queue[i+1:]...)
+				break
+			}
+		}
+		if len(queue) == 0 {
+			delete(q.queues, key)
+			continue
+		}
+		q.queues[key] = queue
+		wakeUp(queue[0])
+	}
+	if q.waiters[w.conn] == w {
+		delete(q.waiters, w.conn)
+	}
+}
+
+// canServe 连接在某个 key 上没有更早阻塞的连接时才可以取数据; w 为 nil 表示还没有加入等待队列
+func (q *blockingQueues) canServe(w *waiter, keys []string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, key := range keys {
+		queue := q.queues[key]
+		if len(queue) == 0 || queue[0] == w {
+			return true
+		}
+	}
+	return false
+}
+
+// signal key 上写入了数据, 唤醒最早阻塞的连接; 它取走数据后会唤醒下一个连接
+func (q *blockingQueues) signal(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if queue, ok := q.queues[key]; ok {
+		wakeUp(queue[0])
+	}
+}
+
+// signalAll 唤醒 key 上所有阻塞的连接, 用于不会取走数据的指令, 如 XREAD
+func (q *blockingQueues) signalAll(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, w := range q.queues[key] {
+		wakeUp(w)
+	}
+}
+
+// wakeAll 唤醒所有阻塞的连接, 用于 SWAPDB 之后让它们切换到新的 DB
+func (q *blockingQueues) wakeAll() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, w := range q.waiters {
+		wakeUp(w)
+	}
+}
+
+// cancel 连接关闭时取消阻塞
+func (q *blockingQueues) cancel(conn resp.Connection) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if w, ok := q.waiters[conn]; ok {
+		w.cancelOnce.Do(func() {
+			close(w.canceled)
+		})
+	}
+}
+
+func wakeUp(w *waiter) {
+	select {
+	case w.ready <- struct{}{}:
+	default: // 已经有未处理的唤醒
+	}
+}
+
+// execBlocking 执行阻塞指令: 没有数据时挂起, 直到被唤醒、超时或连接关闭
+func (db *DB) execBlocking(c resp.Connection, cmdLine [][]byte, bc *blockingCommand) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd := cmdTable[cmdName]
+	if !validateArity(cmd.arity, cmdLine) {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	args := cmdLine[1:]
+	timeout, block, errReply := bc.timeout(args)
+	if errReply != nil {
+		return errReply
+	}
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	writeKeys, readKeys := cmd.prepare(args)
+	waitKeys := bc.waitKeys(args)
+	dbIndex := c.GetDBIndex()
+	var w *waiter
+	defer func() {
+		if w != nil {
+			db.blocking.remove(w)
+		}
+	}()
+	for {
+		// SWAPDB 之后连接选择的 DB 换成了另一个, 离开原来的等待队列, 在新的 DB 上重试
+		if current := db.selectDB(dbIndex); current != db {
+			if w != nil {
+				db.blocking.remove(w)
+				w = nil
+			}
+			db = current
+		}
+		db.RWLocks(writeKeys, readKeys)
+		var result resp.Reply
+		served := false
+		// 被唤醒的连接取数据之前, 新来的连接可能先拿到锁; 有更早阻塞的连接时直接排队, 不抢走数据
+		if !bc.fifo || !block || db.blocking.canServe(w, waitKeys) {
+			result, served = bc.try(db, args)
+		}
+		if !served && block && w == nil {
+			// 持有锁时加入等待队列, 之后写入的数据一定会唤醒队列中的连接
+			w = &waiter{
+				conn:     c,
+				keys:     waitKeys,
+				ready:    make(chan struct{}, 1),
+				canceled: make(chan struct{}),
+			}
+			db.blocking.add(w)
+		}
+		db.RWUnLocks(writeKeys, readKeys)
+		if served {
+			return result
+		}
+		if !block {
+			return bc.timeoutReply
+		}
+		// 连接可能在加入等待队列之前就已经关闭
+		if c.IsClosed() {
+			return bc.timeoutReply
+		}
+		// 加入等待队列之前发生的 SWAPDB 不会唤醒该连接
+		if db.selectDB(dbIndex) != db {
+			continue
+		}
+		select {
+		case <-w.ready:
+		case <-deadline:
+			return bc.timeoutReply
+		case <-w.canceled:
+			return bc.timeoutReply
+		}
+	}
+}
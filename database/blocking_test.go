@@ -0,0 +1,42 @@
+package database
+
+import (
+	"GoRedis/lib/utils"
+	"GoRedis/resp/connection"
+	"testing"
+	"time"
+)
+
+func TestBlockingFIFO(t *testing.T) {
+	mdb := NewStandaloneDatabase()
+	t.Cleanup(mdb.Close)
+	db := mdb.selectDB(0)
+	first := &connection.Connection{}
+	first.SelectDB(0)
+	second := &connection.Connection{}
+	second.SelectDB(0)
+
+	firstResult := blpop(mdb, first, "blpop l 0")
+	time.Sleep(50 * time.Millisecond)
+	// 写入数据并唤醒 first, 但在 first 取数据之前让新的连接也等待同一个 key 的锁
+	db.RWLocks([]string{"l"}, nil)
+	if _, errReply := db.pushList("l", utils.ToCmdLine("x"), false, true); errReply != nil {
+		t.Fatal(errReply.Error())
+	}
+	secondResult := blpop(mdb, second, "blpop l 0")
+	time.Sleep(50 * time.Millisecond)
+	db.RWUnLocks([]string{"l"}, nil)
+
+	if got := waitReply(t, firstResult); got != "*2\r\n$1\r\nl\r\n$1\r\nx\r\n" {
+		t.Errorf("first: got %q", got)
+	}
+	select {
+	case r := <-secondResult:
+		t.Fatalf("second served before pushing: %q", r.ToBytes())
+	case <-time.After(50 * time.Millisecond):
+	}
+	mdb.Exec(first, toArgs("rpush l y"))
+	if got := waitReply(t, secondResult); got != "*2\r\n$1\r\nl\r\n$1\r\ny\r\n" {
+		t.Errorf("second: got %q", got)
+	}
+}
@@ -1,22 +1,163 @@
 package database
 
 import (
+	"GoRedis/interface/resp"
 	"strings"
 )
 
 // 记录系统里所有指令与command之间的关系，比如每一个get、set指令对应一个command
 var cmdTable = make(map[string]*command)
 
+// serverCmdTable 由 StandaloneDatabase.Exec 直接处理的指令(跨 DB、连接状态、服务器配置等), 没有 executor,
+// 只记录元信息供集群生成路由
+var serverCmdTable = make(map[string]*command)
+
+// 指令的标志位
+const (
+	FlagWrite    = 1 << iota // 修改数据
+	FlagReadOnly             // 只读
+	FlagAdmin                // 作用于整个数据库, 如 flushdb
+	FlagDenyOOM              // 可能增加内存占用, 内存超过 maxmemory 时拒绝执行
+	FlagInternal             // 内部指令, 只在 AOF 重放、回滚和集群事务中执行, 不接受客户端调用
+)
+
 type command struct {
 	executor ExecFunc
-	arity    int // 参数数量
+	prepare  PreFunc  // 返回指令涉及的 key, 用于加锁
+	undo     UndoFunc // 生成回滚指令
+	arity    int      // 参数数量
+	flags    int
+	// key 在指令中的位置(指令名称为第 0 个参数); lastKey 为负数时从末尾倒数, firstKey 为 0 表示没有 key
+	firstKey int
+	lastKey  int
+	keyStep  int
+}
+
+// CommandInfo 指令的元信息, 集群根据它决定指令的执行方式
+type CommandInfo struct {
+	Name     string
+	Arity    int
+	Flags    int
+	FirstKey int
+	LastKey  int
+	KeyStep  int
 }
 
 // RegisterCommand 注册指令(记录指令与command之间的关系)
-func RegisterCommand(name string, executor ExecFunc, arity int) {
+func RegisterCommand(name string, executor ExecFunc, prepare PreFunc, rollback UndoFunc, arity int) *command {
 	name = strings.ToLower(name)
-	cmdTable[name] = &command{
+	cmd := &command{
 		executor: executor,
+		prepare:  prepare,
+		undo:     rollback,
 		arity:    arity,
 	}
+	cmdTable[name] = cmd
+	return cmd
+}
+
+// registerServerCommand 记录由 StandaloneDatabase.Exec 直接处理的指令的元信息
+func registerServerCommand(name string, arity int) *command {
+	name = strings.ToLower(name)
+	cmd := &command{
+		arity: arity,
+	}
+	serverCmdTable[name] = cmd
+	return cmd
+}
+
+// attachCommandExtra 记录指令的标志位和 key 的位置
+func (cmd *command) attachCommandExtra(flags int, firstKey int, lastKey int, keyStep int) {
+	cmd.flags = flags
+	cmd.firstKey = firstKey
+	cmd.lastKey = lastKey
+	cmd.keyStep = keyStep
+}
+
+func (cmd *command) toInfo(name string) *CommandInfo {
+	return &CommandInfo{
+		Name:     name,
+		Arity:    cmd.arity,
+		Flags:    cmd.flags,
+		FirstKey: cmd.firstKey,
+		LastKey:  cmd.lastKey,
+		KeyStep:  cmd.keyStep,
+	}
+}
+
+// GetCommandInfo 返回指令的元信息
+func GetCommandInfo(name string) (*CommandInfo, bool) {
+	name = strings.ToLower(name)
+	cmd, ok := cmdTable[name]
+	if !ok {
+		cmd, ok = serverCmdTable[name]
+	}
+	if !ok {
+		return nil, false
+	}
+	return cmd.toInfo(name), true
+}
+
+// ListCommands 返回所有已注册指令的元信息, 不包含内部指令
+func ListCommands() []*CommandInfo {
+	infos := make([]*CommandInfo, 0, len(cmdTable)+len(serverCmdTable))
+	for name, cmd := range cmdTable {
+		if cmd.flags&FlagInternal != 0 {
+			continue
+		}
+		infos = append(infos, cmd.toInfo(name))
+	}
+	for name, cmd := range serverCmdTable {
+		infos = append(infos, cmd.toInfo(name))
+	}
+	return infos
+}
+
+// IsKeyless 指令是否不涉及任何 key
+func (info *CommandInfo) IsKeyless() bool {
+	return info.FirstKey <= 0
+}
+
+// IsSingleKey 指令是否只涉及一个 key
+func (info *CommandInfo) IsSingleKey() bool {
+	return info.FirstKey > 0 && info.LastKey == info.FirstKey
+}
+
+// ValidateArity 检查参数个数
+func (info *CommandInfo) ValidateArity(cmdLine [][]byte) bool {
+	return validateArity(info.Arity, cmdLine)
+}
+
+// ExtractKeys 按元信息取出指令中的所有 key
+func (info *CommandInfo) ExtractKeys(cmdLine [][]byte) []string {
+	if info.IsKeyless() || info.FirstKey >= len(cmdLine) {
+		return nil
+	}
+	last := info.LastKey
+	if last < 0 {
+		last = len(cmdLine) + last
+	}
+	if last >= len(cmdLine) {
+		last = len(cmdLine) - 1
+	}
+	step := info.KeyStep
+	if step <= 0 {
+		step = 1
+	}
+	keys := make([]string, 0, (last-info.FirstKey)/step+1)
+	for i := info.FirstKey; i <= last; i += step {
+		keys = append(keys, string(cmdLine[i]))
+	}
+	return keys
+}
+
+// isInternalCommand 指令是否只能由内部连接执行
+func isInternalCommand(cmdName string) bool {
+	cmd, ok := cmdTable[cmdName]
+	return ok && cmd.flags&FlagInternal != 0
+}
+
+// isInternalConn AOF 重放等内部使用的连接没有远端地址, 集群节点通过 PeerAuth 认证
+func isInternalConn(c resp.Connection) bool {
+	return c == nil || c.RemoteAddr() == nil || c.IsPeer()
 }
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"GoRedis/aof"
+	"GoRedis/resp/connection"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestInternalCommand(t *testing.T) {
+	mdb := NewStandaloneDatabase()
+	t.Cleanup(mdb.Close)
+	internal := &connection.Connection{}
+	internal.SelectDB(0)
+	mdb.Exec(internal, toArgs("xadd s 1-1 f v"))
+	entity, _ := mdb.selectDB(0).GetEntity("s")
+	dump := aof.EntityToCmd("s2", entity).Args
+
+	// 客户端不能执行内部指令
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		_ = server.Close()
+		_ = client.Close()
+	})
+	conn := connection.NewConn(server)
+	if got := string(mdb.Exec(conn, dump).ToBytes()); !strings.HasPrefix(got, "-ERR unknown command") {
+		t.Errorf("client: got %q", got)
+	}
+	if got := eval(mdb, conn, "return redis.pcall('xrestore', KEYS[1], '0-0', '0', '0-0', '0')", "s3"); !strings.Contains(got, "Unknown Redis command") {
+		t.Errorf("script: got %q", got)
+	}
+	for _, info := range ListCommands() {
+		if info.Name == "xrestore" {
+			t.Error("internal command listed")
+		}
+	}
+
+	// AOF 重放等内部连接可以执行
+	if got := string(mdb.Exec(internal, dump).ToBytes()); got != "+OK\r\n" {
+		t.Errorf("internal: got %q", got)
+	}
+	if got := string(mdb.Exec(internal, toArgs("xlen s2")).ToBytes()); got != ":1\r\n" {
+		t.Errorf("xlen: got %q", got)
+	}
+}
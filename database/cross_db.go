@@ -0,0 +1,245 @@
+package database
+
+/*涉及多个 DB 的指令: MOVE、COPY、SWAPDB*/
+
+import (
+	"GoRedis/datastruct/hash"
+	"GoRedis/datastruct/jsondoc"
+	"GoRedis/datastruct/list"
+	"GoRedis/datastruct/set"
+	"GoRedis/datastruct/sortedset"
+	"GoRedis/datastruct/stream"
+	"GoRedis/interface/database"
+	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// execCrossDB 检查参数个数后执行 MOVE、COPY、SWAPDB
+func (mdb *StandaloneDatabase) execCrossDB(c resp.Connection, cmdName string, cmdLine [][]byte) resp.Reply {
+	switch cmdName {
+	case "move":
+		if len(cmdLine) != 3 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return execMove(c, mdb, cmdLine[1:])
+	case "copy":
+		if len(cmdLine) < 3 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return execCopy(c, mdb, cmdLine[1:])
+	case "swapdb":
+		if len(cmdLine) != 3 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return execSwapDB(c, mdb, cmdLine[1:])
+	}
+	return reply.MakeErrReply("ERR unknown command '" + cmdName + "'")
+}
+
+// parseDBIndex 解析 DB 序号
+func (mdb *StandaloneDatabase) parseDBIndex(arg []byte) (int, reply.ErrorReply) {
+	dbIndex, err := strconv.Atoi(string(arg))
+	if err != nil {
+		return 0, reply.MakeErrReply("ERR invalid DB index")
+	}
+	if dbIndex < 0 || dbIndex >= len(mdb.dbSet) {
+		return 0, reply.MakeErrReply("ERR DB index is out of range")
+	}
+	return dbIndex, nil
+}
+
+// lockAcrossDB 为两个 DB 中的 key 加写锁; 先锁序号小的 DB, 避免死锁
+func lockAcrossDB(srcDB *DB, srcKey string, destDB *DB, destKey string) func() {
+	first, firstKey, second, secondKey := srcDB, srcKey, destDB, destKey
+	if first.getIndex() > second.getIndex() {
+		first, firstKey, second, secondKey = second, secondKey, first, firstKey
+	}
+	first.RWLocks([]string{firstKey}, nil)
+	second.RWLocks([]string{secondKey}, nil)
+	return func() {
+		second.RWUnLocks([]string{secondKey}, nil)
+		first.RWUnLocks([]string{firstKey}, nil)
+	}
+}
+
+// execMove MOVE key db: 把 key 移动到另一个 DB, 目标 DB 中已存在该 key 时不移动
+func execMove(c resp.Connection, mdb *StandaloneDatabase, args [][]byte) resp.Reply {
+	key := string(args[0])
+	destIndex, errReply := mdb.parseDBIndex(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	srcDB := mdb.selectDB(c.GetDBIndex())
+	destDB := mdb.selectDB(destIndex)
+	if srcDB == destDB {
+		return reply.MakeErrReply("ERR source and destination objects are the same")
+	}
+	unlock := lockAcrossDB(srcDB, key, destDB, key)
+	defer unlock()
+
+	entity, exists := srcDB.GetEntity(key)
+	if !exists {
+		return reply.MakeIntReply(0)
+	}
+	if _, exists := destDB.GetEntity(key); exists {
+		return reply.MakeIntReply(0)
+	}
+	expireTime, hasTTL := srcDB.getExpireTime(key)
+	srcDB.Remove(key)
+	destDB.PutEntity(key, entity)
+	if hasTTL {
+		destDB.Expire(key, expireTime)
+	}
+	srcDB.notify(notifyGeneric, "move_from", key)
+	destDB.notify(notifyGeneric, "move_to", key)
+	srcDB.tracking.invalidate([]string{key}, c)
+	// 在源 DB 中记录原指令, 重放时同样会移动
+	srcDB.addAof(utils.ToCmdLine2("MOVE", args...))
+	return reply.MakeIntReply(1)
+}
+
+// execCopy COPY source destination [DB destination-db] [REPLACE]: 复制 key 及其过期时间
+func execCopy(c resp.Connection, mdb *StandaloneDatabase, args [][]byte) resp.Reply {
+	src := string(args[0])
+	dest := string(args[1])
+	srcDB := mdb.selectDB(c.GetDBIndex())
+	destDB := srcDB
+	replace := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "db":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			destIndex, errReply := mdb.parseDBIndex(args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			destDB = mdb.selectDB(destIndex)
+			i++
+		case "replace":
+			replace = true
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	if srcDB == destDB && src == dest {
+		return reply.MakeErrReply("ERR source and destination objects are the same")
+	}
+	if srcDB == destDB {
+		srcDB.RWLocks([]string{dest}, []string{src})
+		defer srcDB.RWUnLocks([]string{dest}, []string{src})
+	} else {
+		unlock := lockAcrossDB(srcDB, src, destDB, dest)
+		defer unlock()
+	}
+
+	entity, exists := srcDB.GetEntity(src)
+	if !exists {
+		return reply.MakeIntReply(0)
+	}
+	if _, exists := destDB.GetEntity(dest); exists {
+		if !replace {
+			return reply.MakeIntReply(0)
+		}
+		destDB.Remove(dest)
+	}
+	destDB.PutEntity(dest, deepCopyEntity(entity))
+	if expireTime, hasTTL := srcDB.getExpireTime(src); hasTTL {
+		destDB.Expire(dest, expireTime)
+	}
+	destDB.notify(notifyGeneric, "copy_to", dest)
+	destDB.tracking.invalidate([]string{dest}, c)
+	srcDB.addAof(utils.ToCmdLine2("COPY", args...))
+	return reply.MakeIntReply(1)
+}
+
+// deepCopyEntity 复制 value, 修改副本不会影响原来的 key
+func deepCopyEntity(entity *database.DataEntity) *database.DataEntity {
+	var data interface{}
+	switch val := entity.Data.(type) {
+	case []byte:
+		bytes := make([]byte, len(val))
+		copy(bytes, val)
+		data = bytes
+	case list.List:
+		copied := list.Make()
+		val.ForEach(func(i int, v interface{}) bool {
+			copied.Add(v)
+			return true
+		})
+		data = copied
+	case *stream.Stream:
+		data = copyStream(val)
+	case *set.Set:
+		data = set.Make(val.Members()...)
+	case *hash.Hash:
+		copied := hash.Make()
+		val.ForEach(func(field string, value []byte) bool {
+			bytes := make([]byte, len(value))
+			copy(bytes, value)
+			copied.Set(field, bytes)
+			return true
+		})
+		data = copied
+	case *sortedset.SortedSet:
+		copied := sortedset.Make()
+		val.ForEachByRank(0, int64(val.Len()), false, func(element *sortedset.Element) bool {
+			copied.Add(element.Member, element.Score)
+			return true
+		})
+		data = copied
+	case *jsondoc.Value:
+		data = val.Clone()
+	default:
+		data = val
+	}
+	return &database.DataEntity{
+		Data: data,
+	}
+}
+
+// execSwapDB SWAPDB index1 index2: 交换两个 DB, 所有连接都会立即看到交换后的数据
+func execSwapDB(c resp.Connection, mdb *StandaloneDatabase, args [][]byte) resp.Reply {
+	first, errReply := mdb.parseDBIndex(args[0])
+	if errReply != nil {
+		return errReply
+	}
+	second, errReply := mdb.parseDBIndex(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if first == second {
+		return reply.MakeOkReply()
+	}
+	// 同时只允许一个 SWAPDB, 保证两次 Store 之间不会有另一次交换
+	mdb.swapMu.Lock()
+	defer mdb.swapMu.Unlock()
+	firstDB := mdb.selectDB(first)
+	secondDB := mdb.selectDB(second)
+	firstDB.setIndex(second)
+	secondDB.setIndex(first)
+	mdb.dbSet[first].Store(secondDB)
+	mdb.dbSet[second].Store(firstDB)
+	// 阻塞的连接仍在原来的 DB 上等待, 唤醒它们在交换后的 DB 上重试
+	firstDB.blocking.wakeAll()
+	secondDB.blocking.wakeAll()
+	mdb.tracking.invalidateAll()
+	if mdb.aofHandler != nil {
+		mdb.aofHandler.AddAof(0, utils.ToCmdLine2("SWAPDB", args...))
+	}
+	return reply.MakeOkReply()
+}
+
+func init() {
+	// MOVE/COPY 的 key 在集群中按 key 转发, 其它参数是 DB 序号; SWAPDB 作用于整个数据库, 在集群中广播
+	registerServerCommand("Move", 3).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	registerServerCommand("Copy", -3).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 2, 1)
+	registerServerCommand("SwapDB", 3).
+		attachCommandExtra(FlagWrite|FlagAdmin, 0, 0, 0)
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/resp/connection"
+	"testing"
+	"time"
+)
+
+// blpop 在另一个协程中执行阻塞指令, 返回接收回复的通道
+func blpop(mdb *StandaloneDatabase, conn *connection.Connection, line string) <-chan resp.Reply {
+	result := make(chan resp.Reply, 1)
+	go func() {
+		result <- mdb.Exec(conn, toArgs(line))
+	}()
+	return result
+}
+
+func waitReply(t *testing.T, result <-chan resp.Reply) string {
+	t.Helper()
+	select {
+	case r := <-result:
+		return string(r.ToBytes())
+	case <-time.After(time.Second):
+		t.Fatal("still blocked")
+	}
+	return ""
+}
+
+func TestSwapDBWakesBlocked(t *testing.T) {
+	mdb := NewStandaloneDatabase()
+	t.Cleanup(mdb.Close)
+	blocked := &connection.Connection{}
+	blocked.SelectDB(0)
+	other := &connection.Connection{}
+	other.SelectDB(1)
+	mdb.Exec(other, toArgs("rpush l x"))
+
+	// 交换之后 DB 0 中已经有数据, 阻塞的连接立即取到
+	result := blpop(mdb, blocked, "blpop l 0")
+	time.Sleep(50 * time.Millisecond)
+	mdb.Exec(other, toArgs("swapdb 0 1"))
+	if got := waitReply(t, result); got != "*2\r\n$1\r\nl\r\n$1\r\nx\r\n" {
+		t.Errorf("got %q", got)
+	}
+
+	// 交换之后写入 DB 0 的数据唤醒阻塞在 DB 0 上的连接
+	result = blpop(mdb, blocked, "blpop l2 0")
+	time.Sleep(50 * time.Millisecond)
+	mdb.Exec(other, toArgs("swapdb 0 1"))
+	other.SelectDB(0)
+	mdb.Exec(other, toArgs("rpush l2 y"))
+	if got := waitReply(t, result); got != "*2\r\n$2\r\nl2\r\n$1\r\ny\r\n" {
+		t.Errorf("got %q", got)
+	}
+}
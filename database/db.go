@@ -3,17 +3,35 @@ package database
 
 import (
 	"GoRedis/datastruct/dict"
+	"GoRedis/datastruct/list"
 	"GoRedis/interface/database"
 	"GoRedis/interface/resp"
+	"GoRedis/pubsub"
 	"GoRedis/resp/reply"
 	"strings"
+	"sync/atomic"
+)
+
+const (
+	dataDictSize = 1 << 10
+	ttlDictSize  = 1 << 8
 )
 
 // DB 存储数据并执行用户命令
 type DB struct {
-	index  int // redis分库序号，默认16个分库
-	data   dict.Dict
+	index  int32                // redis分库序号，默认16个分库; SWAPDB 时会改变, 原子操作
+	data   *dict.ConcurrentDict // 同时提供按 key 加锁的能力
+	ttlMap dict.Dict            // key -> 过期时间(time.Time)
 	addAof func(CmdLine)
+	hub    *pubsub.Hub // 发布键空间通知, 为 nil 时不发布
+
+	scripts  *scriptEngine  // Lua 脚本, 所有 DB 共享
+	tracking *trackingTable // 客户端缓存, 所有 DB 共享
+
+	blocking *blockingQueues       // 阻塞在 key 上的连接
+	selectDB func(dbIndex int) *DB // 返回当前的第 dbIndex 个 DB, SWAPDB 之后阻塞的连接据此切换到新的 DB
+
+	usedMemory int64 // 估算的内存占用, 原子操作
 }
 
 // ExecFunc Exec的接口
@@ -25,15 +43,65 @@ type CmdLine = [][]byte
 // makeDB 创建DB数据库
 func makeDB() *DB {
 	db := &DB{
-		data:   dict.MakeSyncDict(),   //包级别的函数直接通过包名调用，不需要实例化某个类型的对象
+		data:   dict.MakeConcurrent(dataDictSize), //包级别的函数直接通过包名调用，不需要实例化某个类型的对象
+		ttlMap: dict.MakeConcurrent(ttlDictSize),
 		addAof: func(line CmdLine) {}, //防止回复数据的时候有错误
+
+		blocking: makeBlockingQueues(),
 	}
+	db.selectDB = func(int) *DB { return db }
 	return db
 }
 
+func (db *DB) getIndex() int {
+	return int(atomic.LoadInt32(&db.index))
+}
+
+func (db *DB) setIndex(index int) {
+	atomic.StoreInt32(&db.index, int32(index))
+}
+
 // Exec 在一个db内执行命令
 func (db *DB) Exec(c resp.Connection, cmdLine [][]byte) resp.Reply {
 	//PING SET SETNX
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	// MULTI 事务相关指令
+	switch cmdName {
+	case "multi":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return StartMulti(c)
+	case "discard":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return DiscardMulti(c)
+	case "exec":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return execMulti(db, c)
+	}
+	if c != nil && c.InMultiState() {
+		return EnqueueCmd(c, cmdLine)
+	}
+	db.trackCommand(c, cmdLine)
+	var result resp.Reply
+	// 阻塞指令在等待期间不能持有 key 的锁
+	if bc, ok := blockingCommands[cmdName]; ok && c != nil {
+		result = db.execBlocking(c, cmdLine, bc)
+	} else {
+		result = db.execNormalCommand(cmdLine)
+	}
+	if !reply.IsErrorReply(result) {
+		db.invalidateCommand(c, cmdLine)
+	}
+	return result
+}
+
+// execNormalCommand 执行 MULTI 事务以外的普通指令; 执行期间持有指令涉及的所有 key 的锁
+func (db *DB) execNormalCommand(cmdLine [][]byte) resp.Reply {
 	cmdName := strings.ToLower(string(cmdLine[0]))
 	cmd, ok := cmdTable[cmdName]
 	if !ok {
@@ -43,11 +111,30 @@ func (db *DB) Exec(c resp.Connection, cmdLine [][]byte) resp.Reply {
 	if !validateArity(cmd.arity, cmdLine) {
 		return reply.MakeArgNumErrReply(cmdName)
 	}
+	// 按固定顺序为所有相关的 key 加锁, 避免死锁
+	if cmd.prepare != nil {
+		writeKeys, readKeys := cmd.prepare(cmdLine[1:])
+		db.RWLocks(writeKeys, readKeys)
+		defer db.RWUnLocks(writeKeys, readKeys)
+	}
 	fun := cmd.executor // 获取当前指令的具体执行方法
 	//SET K V -> K V
 	return fun(db, cmdLine[1:]) //调用具体的实现方法
 }
 
+// execWithLock 执行指令但不加锁, 调用方需要提前为相关 key 加锁
+func (db *DB) execWithLock(cmdLine [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		return reply.MakeErrReply("ERR unknown command '" + cmdName + "'")
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	return cmd.executor(db, cmdLine[1:])
+}
+
 //validateArity 校验参数个数是否合法
 // SET K V -> 参数长度arity = 3
 // EXISTS k1 k2 k3 k4... -> 参数长度-arity = -2; -2是负数最小SET K：2
@@ -63,43 +150,98 @@ func validateArity(arity int, cmdArgs [][]byte) bool {
 /* ---- data Access ----- */
 
 // GetEntity 在DB的层面根据 KEY 获取到 value; GET指令的内部调用该方法
+// 已过期的 key 在这里被删除; 同时更新 key 的访问信息, 供内存淘汰使用
 func (db *DB) GetEntity(key string) (*database.DataEntity, bool) {
-
+	if db.IsExpired(key) {
+		return nil, false
+	}
 	raw, ok := db.data.Get(key)
 	if !ok {
 		return nil, false
 	}
 	entity, _ := raw.(*database.DataEntity)
+	touchEntity(entity)
 	return entity, true
 }
 
 // PutEntity 把DataEntity 存入到 DB
 func (db *DB) PutEntity(key string, entity *database.DataEntity) int {
-	return db.data.Put(key, entity)
+	old, exists := db.data.Get(key)
+	db.prepareEntity(key, entity, old)
+	result := db.data.Put(key, entity)
+	if exists {
+		db.replaceEntity(old.(*database.DataEntity), entity)
+	}
+	atomic.AddInt64(&db.usedMemory, entity.Size)
+	if result > 0 {
+		db.notify(notifyNew, "new", key)
+	}
+	// RENAME、MOVE 等写入列表时唤醒阻塞在该 key 上的连接
+	if _, ok := entity.Data.(list.List); ok {
+		db.blocking.signal(key)
+	}
+	return result
 }
 
 // PutIfExists  如果存在当前的Key, Put 现有的 DataEntity
 func (db *DB) PutIfExists(key string, entity *database.DataEntity) int {
-	return db.data.PutIfExists(key, entity)
+	if db.IsExpired(key) {
+		return 0
+	}
+	old, exists := db.data.Get(key)
+	if !exists {
+		return 0
+	}
+	db.prepareEntity(key, entity, old)
+	result := db.data.PutIfExists(key, entity)
+	if result > 0 {
+		db.replaceEntity(old.(*database.DataEntity), entity)
+		atomic.AddInt64(&db.usedMemory, entity.Size)
+	}
+	return result
 }
 
 // PutIfAbsent 仅在 key 不存在时插入 DataEntity
 func (db *DB) PutIfAbsent(key string, entity *database.DataEntity) int {
-	return db.data.PutIfAbsent(key, entity)
+	db.IsExpired(key) // 已过期的 key 视为不存在
+	db.prepareEntity(key, entity, nil)
+	result := db.data.PutIfAbsent(key, entity)
+	if result > 0 {
+		atomic.AddInt64(&db.usedMemory, entity.Size)
+		db.notify(notifyNew, "new", key)
+	}
+	return result
 }
 
 // Remove 从数据库中移除指定 key
 func (db *DB) Remove(key string) {
-	db.data.Remove(key)
+	db.remove(key)
+}
+
+// remove 返回 key 是否由本次调用删除; 持有读锁的协程(如惰性过期)可能同时删除同一个 key
+// 删除只是把 value 从 dict 中摘下, 不可达的 value 由 GC 在后台并发回收, 不会阻塞处理请求的协程,
+// 因此不需要 redis 的 lazy-free 后台线程, UNLINK、FLUSHDB ASYNC 与同步删除相同
+func (db *DB) remove(key string) bool {
+	raw, exists := db.data.RemoveAndGet(key)
+	db.ttlMap.Remove(key)
+	if !exists {
+		return false
+	}
+	db.releaseEntity(raw.(*database.DataEntity))
+	return true
 }
 
 // Removes 从数据库中移除指定的多个 key
 func (db *DB) Removes(keys ...string) (deleted int) {
 	deleted = 0
 	for _, key := range keys {
+		if db.IsExpired(key) {
+			continue
+		}
 		_, exists := db.data.Get(key)
 		if exists {
-			db.Remove(key)
+			db.remove(key)
+			db.notify(notifyGeneric, "del", key)
 			deleted++
 		}
 	}
@@ -109,4 +251,18 @@ func (db *DB) Removes(keys ...string) (deleted int) {
 // Flush 清空数据库
 func (db *DB) Flush() {
 	db.data.Clear()
+	db.ttlMap.Clear()
+	atomic.StoreInt64(&db.usedMemory, 0)
+}
+
+/* ---- Lock Function ----- */
+
+// RWLocks 为 writeKeys 加写锁, 为 readKeys 加读锁
+func (db *DB) RWLocks(writeKeys []string, readKeys []string) {
+	db.data.RWLocks(writeKeys, readKeys)
+}
+
+// RWUnLocks 释放 RWLocks 加上的锁
+func (db *DB) RWUnLocks(writeKeys []string, readKeys []string) {
+	db.data.RWUnLocks(writeKeys, readKeys)
 }
@@ -0,0 +1,677 @@
+package database
+
+/*函数: FUNCTION LOAD/LIST/DELETE/FLUSH/DUMP/RESTORE/KILL、FCALL、FCALL_RO
+函数库的代码以 "#!lua name=<库名>" 开头, 通过 redis.register_function 注册函数
+函数库由所有 DB 共享, 修改函数库的指令写入 aof, 重启后重新加载
+每个虚拟机在第一次调用某个函数库时执行一次库代码, 之后复用注册的函数, 函数库变化后丢弃*/
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
+	"GoRedis/lib/wildcard"
+	"GoRedis/resp/reply"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc64"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+const libraryLoadTimeout = 500 * time.Millisecond // 执行函数库代码的时间限制
+
+var (
+	errFunctionNotFound = reply.MakeErrReply("ERR Function not found")
+	errLibraryNotFound  = reply.MakeErrReply("ERR Library not found")
+	errReadOnlyFunction = reply.MakeErrReply("ERR Can not execute a script with write flag using *_ro command.")
+	errBadFunctionDump  = reply.MakeErrReply("ERR payload version or checksum are wrong")
+)
+
+// 函数支持的标志
+var functionFlags = map[string]struct{}{
+	"no-writes":             {},
+	"allow-oom":             {},
+	"allow-stale":           {},
+	"no-cluster":            {},
+	"allow-cross-slot-keys": {},
+}
+
+// library 函数库
+type library struct {
+	name      string
+	code      []byte
+	proto     *lua.FunctionProto // 去掉首行元数据后编译的库代码
+	functions []*function        // 按注册顺序
+}
+
+// function 函数库中注册的函数
+type function struct {
+	name        string
+	lib         *library
+	description string
+	flags       []string
+	noWrites    bool
+}
+
+// registeredFunction 执行库代码时注册的函数及其回调
+type registeredFunction struct {
+	info     *function
+	callback *lua.LFunction
+}
+
+// functionRegistry 所有函数库
+type functionRegistry struct {
+	mu        sync.RWMutex
+	libraries map[string]*library  // 库名 -> 函数库
+	functions map[string]*function // 函数名 -> 函数, 函数名在所有库中唯一
+	version   uint64               // 每次修改时加一
+}
+
+func makeFunctionRegistry() functionRegistry {
+	return functionRegistry{
+		libraries: make(map[string]*library),
+		functions: make(map[string]*function),
+	}
+}
+
+// 加入函数库时的处理方式, 与 FUNCTION RESTORE 的选项对应
+const (
+	libraryAppend  = iota // 库已经存在时报错
+	libraryReplace        // 替换同名的库
+	libraryFlush          // 先删除所有的库
+)
+
+// get 返回函数以及当前的函数库版本
+func (registry *functionRegistry) get(name string) (*function, uint64) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return registry.functions[name], registry.version
+}
+
+// add 加入函数库; 库名或函数名冲突时不做任何修改
+func (registry *functionRegistry) add(libs []*library, policy int) reply.ErrorReply {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	existing := registry.libraries
+	if policy == libraryFlush {
+		existing = nil
+	}
+	incoming := make(map[string]struct{}, len(libs))
+	for _, lib := range libs {
+		if _, ok := incoming[lib.name]; ok {
+			return reply.MakeErrReply("ERR Library '" + lib.name + "' already exists")
+		}
+		incoming[lib.name] = struct{}{}
+		if _, ok := existing[lib.name]; ok && policy == libraryAppend {
+			return reply.MakeErrReply("ERR Library '" + lib.name + "' already exists")
+		}
+	}
+	// 修改之后每个函数所属的库
+	owners := make(map[string]string)
+	for _, lib := range existing {
+		if _, ok := incoming[lib.name]; ok {
+			continue
+		}
+		for _, fn := range lib.functions {
+			owners[fn.name] = lib.name
+		}
+	}
+	for _, lib := range libs {
+		for _, fn := range lib.functions {
+			if _, ok := owners[fn.name]; ok {
+				return reply.MakeErrReply("ERR Function " + fn.name + " already exists")
+			}
+			owners[fn.name] = lib.name
+		}
+	}
+
+	if policy == libraryFlush {
+		registry.libraries = make(map[string]*library)
+		registry.functions = make(map[string]*function)
+	}
+	for _, lib := range libs {
+		registry.removeLocked(lib.name)
+		registry.libraries[lib.name] = lib
+		for _, fn := range lib.functions {
+			registry.functions[fn.name] = fn
+		}
+	}
+	registry.version++
+	return nil
+}
+
+func (registry *functionRegistry) removeLocked(name string) bool {
+	lib, ok := registry.libraries[name]
+	if !ok {
+		return false
+	}
+	for _, fn := range lib.functions {
+		delete(registry.functions, fn.name)
+	}
+	delete(registry.libraries, name)
+	return true
+}
+
+func (registry *functionRegistry) remove(name string) bool {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if !registry.removeLocked(name) {
+		return false
+	}
+	registry.version++
+	return true
+}
+
+func (registry *functionRegistry) flush() {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.libraries = make(map[string]*library)
+	registry.functions = make(map[string]*function)
+	registry.version++
+}
+
+// list 返回所有函数库, 按库名排序
+func (registry *functionRegistry) list() []*library {
+	registry.mu.RLock()
+	libs := make([]*library, 0, len(registry.libraries))
+	for _, lib := range registry.libraries {
+		libs = append(libs, lib)
+	}
+	registry.mu.RUnlock()
+	sort.Slice(libs, func(i, j int) bool {
+		return libs[i].name < libs[j].name
+	})
+	return libs
+}
+
+/* ---- 加载函数库 ---- */
+
+// isValidFunctionName 库名和函数名只能包含字母、数字和下划线
+func isValidFunctionName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseLibraryMetadata 解析首行的 "#!<engine> name=<库名>", 返回库名以及首行之后的代码
+func parseLibraryMetadata(code []byte) (string, []byte, reply.ErrorReply) {
+	if !bytes.HasPrefix(code, []byte("#!")) {
+		return "", nil, reply.MakeErrReply("ERR Missing library metadata")
+	}
+	firstLine, body := code[2:], []byte(nil)
+	if i := bytes.IndexByte(firstLine, '\n'); i >= 0 {
+		firstLine, body = firstLine[:i], firstLine[i+1:]
+	}
+	fields := strings.Fields(string(firstLine))
+	if len(fields) == 0 {
+		return "", nil, reply.MakeErrReply("ERR Missing library metadata")
+	}
+	if !strings.EqualFold(fields[0], "lua") {
+		return "", nil, reply.MakeErrReply("ERR Engine '" + fields[0] + "' not found")
+	}
+	name := ""
+	for _, field := range fields[1:] {
+		if !strings.HasPrefix(field, "name=") {
+			return "", nil, reply.MakeErrReply("ERR Invalid metadata value given: " + field)
+		}
+		name = field[len("name="):]
+	}
+	if name == "" {
+		return "", nil, reply.MakeErrReply("ERR Library name was not given")
+	}
+	if !isValidFunctionName(name) {
+		return "", nil, reply.MakeErrReply("ERR Library names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+	}
+	return name, body, nil
+}
+
+// compileLibrary 编译函数库并执行库代码, 得到注册的函数
+func (engine *scriptEngine) compileLibrary(code []byte) (*library, reply.ErrorReply) {
+	name, body, errReply := parseLibraryMetadata(code)
+	if errReply != nil {
+		return nil, errReply
+	}
+	// 首行替换为空行, 保持错误信息中的行号不变
+	chunk, err := parse.Parse(bytes.NewReader(append([]byte{'\n'}, body...)), "user_function")
+	if err != nil {
+		return nil, reply.MakeErrReply("ERR Error compiling function: " + singleLine(err.Error()))
+	}
+	proto, err := lua.Compile(chunk, "user_function")
+	if err != nil {
+		return nil, reply.MakeErrReply("ERR Error compiling function: " + singleLine(err.Error()))
+	}
+	lib := &library{
+		name:  name,
+		code:  code,
+		proto: proto,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), libraryLoadTimeout)
+	defer cancel()
+	vm := engine.vms.Get().(*luaVM)
+	vm.L.SetContext(ctx)
+	registered, err := vm.loadLibrary(lib)
+	vm.L.RemoveContext()
+	if ctx.Err() != nil {
+		// 超时中断的虚拟机不再复用
+		vm.L.Close()
+		return nil, reply.MakeErrReply("ERR FUNCTION LOAD timeout")
+	}
+	engine.vms.Put(vm)
+	if err != nil {
+		return nil, reply.MakeErrReply("ERR Error registering functions: " + singleLine(luaErrorMessage(err)))
+	}
+	if len(registered) == 0 {
+		return nil, reply.MakeErrReply("ERR No functions registered")
+	}
+	for _, r := range registered {
+		r.info.lib = lib
+		lib.functions = append(lib.functions, r.info)
+	}
+	return lib, nil
+}
+
+// luaErrorMessage 返回 Lua 错误的内容, 错误是 {err=...} 时返回其中的信息
+func luaErrorMessage(err error) string {
+	apiErr, ok := err.(*lua.ApiError)
+	if !ok {
+		return err.Error()
+	}
+	if table, ok := apiErr.Object.(*lua.LTable); ok {
+		if msg, ok := table.RawGetString("err").(lua.LString); ok {
+			return string(msg)
+		}
+	}
+	return apiErr.Object.String()
+}
+
+// loadLibrary 在虚拟机中执行库代码, 返回注册的函数; 调用方负责设置 context
+func (vm *luaVM) loadLibrary(lib *library) ([]*registeredFunction, error) {
+	L := vm.L
+	var registered []*registeredFunction
+	vm.registering = &registered
+	defer func() {
+		vm.registering = nil
+		vm.resetProxies()
+		L.SetTop(0)
+	}()
+	L.Push(L.NewFunctionFromProto(lib.proto))
+	if err := L.PCall(0, 0, nil); err != nil {
+		return nil, err
+	}
+	return registered, nil
+}
+
+// registerFunction redis.register_function(name, callback) 或
+// redis.register_function{function_name=name, callback=callback, flags={...}, description=description}
+func (vm *luaVM) registerFunction(L *lua.LState) int {
+	if vm.registering == nil {
+		L.RaiseError("redis.register_function can only be called on FUNCTION LOAD command")
+		return 0
+	}
+	fn := &function{}
+	var callback *lua.LFunction
+	switch arg := L.Get(1).(type) {
+	case lua.LString:
+		if L.GetTop() != 2 {
+			L.RaiseError("wrong number of arguments to redis.register_function")
+		}
+		fn.name = string(arg)
+		callback = L.CheckFunction(2)
+	case *lua.LTable:
+		if L.GetTop() != 1 {
+			L.RaiseError("wrong number of arguments to redis.register_function")
+		}
+		arg.ForEach(func(k lua.LValue, v lua.LValue) {
+			switch k.String() {
+			case "function_name":
+				if s, ok := v.(lua.LString); ok {
+					fn.name = string(s)
+					return
+				}
+				L.RaiseError("function_name argument given to redis.register_function must be a string")
+			case "callback":
+				if f, ok := v.(*lua.LFunction); ok {
+					callback = f
+					return
+				}
+				L.RaiseError("callback argument given to redis.register_function must be a function")
+			case "description":
+				if s, ok := v.(lua.LString); ok {
+					fn.description = string(s)
+					return
+				}
+				L.RaiseError("description argument given to redis.register_function must be a string")
+			case "flags":
+				flags, ok := v.(*lua.LTable)
+				if !ok {
+					L.RaiseError("flags argument to redis.register_function must be a table representing function flags")
+				}
+				for i := 1; i <= flags.Len(); i++ {
+					flag, ok := flags.RawGetInt(i).(lua.LString)
+					if !ok {
+						L.RaiseError("unknown flag given")
+					}
+					if _, ok := functionFlags[string(flag)]; !ok {
+						L.RaiseError("unknown flag given")
+					}
+					fn.flags = append(fn.flags, string(flag))
+					if flag == "no-writes" {
+						fn.noWrites = true
+					}
+				}
+			default:
+				L.RaiseError("unknown argument given to redis.register_function")
+			}
+		})
+		if fn.name == "" {
+			L.RaiseError("redis.register_function must get a function name argument")
+		}
+		if callback == nil {
+			L.RaiseError("redis.register_function must get a callback argument")
+		}
+	default:
+		L.RaiseError("calling redis.register_function with a single argument is only applicable to Lua table (representing named arguments).")
+	}
+	if !isValidFunctionName(fn.name) {
+		L.RaiseError("Function names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+	}
+	for _, r := range *vm.registering {
+		if r.info.name == fn.name {
+			L.RaiseError("Function already exists in the library")
+		}
+	}
+	*vm.registering = append(*vm.registering, &registeredFunction{info: fn, callback: callback})
+	return 0
+}
+
+// callFunction 执行函数, version 是获取函数时的函数库版本
+func (vm *luaVM) callFunction(run *scriptRun, ctx context.Context, fn *function, version uint64,
+	keys [][]byte, argv [][]byte) (resp.Reply, error) {
+	L := vm.L
+	L.SetContext(ctx)
+	defer func() {
+		vm.run = nil
+		vm.resetProxies()
+		L.RemoveContext()
+		L.SetTop(0)
+	}()
+	if vm.libs == nil || vm.libVersion != version {
+		vm.libs = make(map[*library]map[string]*lua.LFunction)
+		vm.libVersion = version
+	}
+	callbacks, ok := vm.libs[fn.lib]
+	if !ok {
+		registered, err := vm.loadLibrary(fn.lib)
+		if err != nil {
+			return nil, err
+		}
+		callbacks = make(map[string]*lua.LFunction, len(registered))
+		for _, r := range registered {
+			callbacks[r.info.name] = r.callback
+		}
+		vm.libs[fn.lib] = callbacks
+	}
+	callback, ok := callbacks[fn.name]
+	if !ok {
+		return errFunctionNotFound, nil
+	}
+	vm.run = run
+	L.Push(callback)
+	L.Push(makeLuaArray(L, keys))
+	L.Push(makeLuaArray(L, argv))
+	if err := L.PCall(2, 1, nil); err != nil {
+		return nil, err
+	}
+	return luaToReply(L.Get(-1)), nil
+}
+
+/* ---- DUMP/RESTORE ---- */
+
+const functionDumpVersion = 1
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// dumpLibraries 序列化函数库的代码: 每个库为 uvarint 长度 + 代码, 最后是 1 字节版本号和 8 字节 CRC64
+func dumpLibraries(libs []*library) []byte {
+	var buf []byte
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	for _, lib := range libs {
+		n := binary.PutUvarint(lenBuf, uint64(len(lib.code)))
+		buf = append(buf, lenBuf[:n]...)
+		buf = append(buf, lib.code...)
+	}
+	buf = append(buf, functionDumpVersion)
+	checksum := make([]byte, 8)
+	binary.LittleEndian.PutUint64(checksum, crc64.Checksum(buf, crc64Table))
+	return append(buf, checksum...)
+}
+
+// parseLibrariesDump 解析 dumpLibraries 的结果, 返回每个库的代码
+func parseLibrariesDump(payload []byte) ([][]byte, error) {
+	if len(payload) < 9 {
+		return nil, errors.New("payload too short")
+	}
+	body, checksum := payload[:len(payload)-8], payload[len(payload)-8:]
+	if crc64.Checksum(body, crc64Table) != binary.LittleEndian.Uint64(checksum) ||
+		body[len(body)-1] != functionDumpVersion {
+		return nil, errors.New("bad checksum or version")
+	}
+	body = body[:len(body)-1]
+	var codes [][]byte
+	for len(body) > 0 {
+		size, n := binary.Uvarint(body)
+		if n <= 0 || size > uint64(len(body)-n) {
+			return nil, errors.New("bad library length")
+		}
+		codes = append(codes, body[n:n+int(size)])
+		body = body[n+int(size):]
+	}
+	return codes, nil
+}
+
+/* ---- 指令 ---- */
+
+// fcall FCALL/FCALL_RO function numkeys [key ...] [arg ...]
+func (engine *scriptEngine) fcall(db *DB, args [][]byte, readOnly bool) resp.Reply {
+	fn, version := engine.functions.get(string(args[0]))
+	if fn == nil {
+		return errFunctionNotFound
+	}
+	keys, argv, errReply := parseScriptKeys(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	if readOnly && !fn.noWrites {
+		return errReadOnlyFunction
+	}
+	return engine.run(db, fn.name, keys, fn.noWrites, func(vm *luaVM, run *scriptRun, ctx context.Context) (resp.Reply, error) {
+		return vm.callFunction(run, ctx, fn, version, keys, argv)
+	})
+}
+
+func execFCall(db *DB, args [][]byte) resp.Reply {
+	return db.scripts.fcall(db, args, false)
+}
+
+func execFCallRO(db *DB, args [][]byte) resp.Reply {
+	return db.scripts.fcall(db, args, true)
+}
+
+// prepareFCallRO FCALL_RO 为 KEYS 中的所有 key 加读锁
+func prepareFCallRO(args [][]byte) ([]string, []string) {
+	keys, _, errReply := parseScriptKeys(args[1:])
+	if errReply != nil {
+		return nil, nil
+	}
+	return readAllKeys(keys)
+}
+
+// execFunction FUNCTION LOAD|LIST|DELETE|FLUSH|DUMP|RESTORE|KILL
+func execFunction(db *DB, args [][]byte) resp.Reply {
+	engine := db.scripts
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "load":
+		// FUNCTION LOAD [REPLACE] code
+		policy := libraryAppend
+		if len(args) == 3 && strings.EqualFold(string(args[1]), "replace") {
+			policy = libraryReplace
+		} else if len(args) != 2 {
+			return reply.MakeSyntaxErrReply()
+		}
+		lib, errReply := engine.compileLibrary(args[len(args)-1])
+		if errReply != nil {
+			return errReply
+		}
+		if errReply := engine.functions.add([]*library{lib}, policy); errReply != nil {
+			return errReply
+		}
+		db.addAof(utils.ToCmdLine2("function", args...))
+		return reply.MakeBulkReply([]byte(lib.name))
+	case "delete":
+		if len(args) != 2 {
+			return reply.MakeArgNumErrReply("function|delete")
+		}
+		if !engine.functions.remove(string(args[1])) {
+			return errLibraryNotFound
+		}
+		db.addAof(utils.ToCmdLine2("function", args...))
+		return reply.MakeOkReply()
+	case "flush":
+		if len(args) > 2 {
+			return reply.MakeArgNumErrReply("function|flush")
+		}
+		if errReply := checkFlushMode(args[1:]); errReply != nil {
+			return errReply
+		}
+		engine.functions.flush()
+		db.addAof(utils.ToCmdLine2("function", args...))
+		return reply.MakeOkReply()
+	case "list":
+		return execFunctionList(engine, args[1:])
+	case "dump":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("function|dump")
+		}
+		return reply.MakeBulkReply(dumpLibraries(engine.functions.list()))
+	case "restore":
+		return execFunctionRestore(db, args)
+	case "kill":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("function|kill")
+		}
+		return engine.kill()
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try FUNCTION HELP.")
+}
+
+// execFunctionList FUNCTION LIST [LIBRARYNAME pattern] [WITHCODE]
+func execFunctionList(engine *scriptEngine, args [][]byte) resp.Reply {
+	var pattern *wildcard.Pattern
+	withCode := false
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "withcode":
+			withCode = true
+		case "libraryname":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			i++
+			pattern = wildcard.CompilePattern(string(args[i]))
+		default:
+			return reply.MakeErrReply("ERR Unknown argument " + string(args[i]))
+		}
+	}
+	var result []resp.Reply
+	for _, lib := range engine.functions.list() {
+		if pattern != nil && !pattern.IsMatch(lib.name) {
+			continue
+		}
+		functions := make([]resp.Reply, len(lib.functions))
+		for i, fn := range lib.functions {
+			var description resp.Reply = reply.MakeNullBulkReply()
+			if fn.description != "" {
+				description = reply.MakeBulkReply([]byte(fn.description))
+			}
+			flags := make([][]byte, len(fn.flags))
+			for j, flag := range fn.flags {
+				flags[j] = []byte(flag)
+			}
+			functions[i] = reply.MakeMapReply([]resp.Reply{
+				reply.MakeBulkReply([]byte("name")), reply.MakeBulkReply([]byte(fn.name)),
+				reply.MakeBulkReply([]byte("description")), description,
+				reply.MakeBulkReply([]byte("flags")), reply.MakeBulkSetReply(flags),
+			})
+		}
+		info := []resp.Reply{
+			reply.MakeBulkReply([]byte("library_name")), reply.MakeBulkReply([]byte(lib.name)),
+			reply.MakeBulkReply([]byte("engine")), reply.MakeBulkReply([]byte("LUA")),
+			reply.MakeBulkReply([]byte("functions")), reply.MakeMultiRawReply(functions),
+		}
+		if withCode {
+			info = append(info, reply.MakeBulkReply([]byte("library_code")), reply.MakeBulkReply(lib.code))
+		}
+		result = append(result, reply.MakeMapReply(info))
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// execFunctionRestore FUNCTION RESTORE payload [FLUSH|APPEND|REPLACE]
+func execFunctionRestore(db *DB, args [][]byte) resp.Reply {
+	if len(args) < 2 || len(args) > 3 {
+		return reply.MakeArgNumErrReply("function|restore")
+	}
+	policy := libraryAppend
+	if len(args) == 3 {
+		switch strings.ToLower(string(args[2])) {
+		case "append":
+		case "replace":
+			policy = libraryReplace
+		case "flush":
+			policy = libraryFlush
+		default:
+			return reply.MakeErrReply("ERR Wrong restore policy given, value should be either FLUSH, APPEND or REPLACE.")
+		}
+	}
+	codes, err := parseLibrariesDump(args[1])
+	if err != nil {
+		return errBadFunctionDump
+	}
+	libs := make([]*library, len(codes))
+	for i, code := range codes {
+		lib, errReply := db.scripts.compileLibrary(code)
+		if errReply != nil {
+			return errReply
+		}
+		libs[i] = lib
+	}
+	if errReply := db.scripts.functions.add(libs, policy); errReply != nil {
+		return errReply
+	}
+	db.addAof(utils.ToCmdLine2("function", args...))
+	return reply.MakeOkReply()
+}
+
+func init() {
+	RegisterCommand("FCall", execFCall, prepareEval, undoEval, -3).
+		attachCommandExtra(FlagWrite, 0, 0, 0)
+	RegisterCommand("FCall_RO", execFCallRO, prepareFCallRO, nil, -3).
+		attachCommandExtra(FlagReadOnly, 0, 0, 0)
+	RegisterCommand("Function", execFunction, noPrepare, nil, -2).
+		attachCommandExtra(0, 0, 0, 0)
+}
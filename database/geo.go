@@ -0,0 +1,482 @@
+package database
+
+import (
+	"GoRedis/datastruct/sortedset"
+	"GoRedis/interface/database"
+	"GoRedis/interface/resp"
+	"GoRedis/lib/geohash"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/reply"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/* 地理位置: 以 52 位 geohash 作为 score 保存在有序集合中 */
+
+// parseLongLat 解析经纬度
+func parseLongLat(longArg []byte, latArg []byte) (float64, float64, reply.ErrorReply) {
+	longitude, err1 := strconv.ParseFloat(string(longArg), 64)
+	latitude, err2 := strconv.ParseFloat(string(latArg), 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, reply.MakeErrReply("ERR value is not a valid float")
+	}
+	if !geohash.ValidCoord(longitude, latitude) {
+		return 0, 0, reply.MakeErrReply(fmt.Sprintf("ERR invalid longitude,latitude pair %f,%f", longitude, latitude))
+	}
+	return longitude, latitude, nil
+}
+
+// parseUnit 返回距离单位对应的米数
+func parseUnit(arg []byte) (float64, reply.ErrorReply) {
+	switch strings.ToLower(string(arg)) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, reply.MakeErrReply("ERR unsupported unit provided. please use M, KM, FT, MI")
+}
+
+// formatDistance 距离保留 4 位小数
+func formatDistance(meters float64, unit float64) []byte {
+	return []byte(strconv.FormatFloat(meters/unit, 'f', 4, 64))
+}
+
+// formatCoord 与 Redis 相同, 最多保留 17 位小数并去掉末尾的 0
+func formatCoord(value float64) []byte {
+	str := strconv.FormatFloat(value, 'f', 17, 64)
+	str = strings.TrimRight(str, "0")
+	str = strings.TrimSuffix(str, ".")
+	return []byte(str)
+}
+
+func makeCoordReply(longitude float64, latitude float64) resp.Reply {
+	return reply.MakeMultiBulkReply([][]byte{formatCoord(longitude), formatCoord(latitude)})
+}
+
+// memberCoord 返回元素的经纬度
+func memberCoord(set *sortedset.SortedSet, member string) (float64, float64, bool) {
+	element, ok := set.Get(member)
+	if !ok {
+		return 0, 0, false
+	}
+	longitude, latitude := geohash.DecodeToLongLat(uint64(element.Score))
+	return longitude, latitude, true
+}
+
+// execGeoAdd GEOADD key [NX|XX] [CH] longitude latitude member [longitude latitude member ...]
+// 与 Redis 相同, 计算出 geohash 之后作为 ZADD 执行
+func execGeoAdd(db *DB, args [][]byte) resp.Reply {
+	zaddArgs := [][]byte{args[0]}
+	i := 1
+	nx, xx := false, false
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "CH":
+		default:
+			break options
+		}
+		zaddArgs = append(zaddArgs, args[i])
+	}
+	items := args[i:]
+	if len(items) == 0 || len(items)%3 != 0 {
+		return reply.MakeErrReply("ERR syntax error. Try GEOADD key [x1] [y1] [name1] [x2] [y2] [name2] ... ")
+	}
+	if nx && xx {
+		return reply.MakeErrReply("ERR XX and NX options at the same time are not compatible")
+	}
+	for j := 0; j < len(items); j += 3 {
+		longitude, latitude, errReply := parseLongLat(items[j], items[j+1])
+		if errReply != nil {
+			return errReply
+		}
+		hash := geohash.Encode(longitude, latitude, geohash.MaxStep)
+		zaddArgs = append(zaddArgs, []byte(strconv.FormatUint(hash.Bits, 10)), items[j+2])
+	}
+	return execZAdd(db, zaddArgs)
+}
+
+// execGeoDist GEODIST key member1 member2 [M|KM|FT|MI]
+func execGeoDist(db *DB, args [][]byte) resp.Reply {
+	if len(args) > 4 {
+		return reply.MakeSyntaxErrReply()
+	}
+	unit := 1.0
+	if len(args) == 4 {
+		var errReply reply.ErrorReply
+		unit, errReply = parseUnit(args[3])
+		if errReply != nil {
+			return errReply
+		}
+	}
+	_, set, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeNullBulkReply()
+	}
+	long1, lat1, ok1 := memberCoord(set, string(args[1]))
+	long2, lat2, ok2 := memberCoord(set, string(args[2]))
+	if !ok1 || !ok2 {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeBulkReply(formatDistance(geohash.Distance(long1, lat1, long2, lat2), unit))
+}
+
+// execGeoPos GEOPOS key [member ...]: 返回经纬度, 不存在的元素返回 nil
+func execGeoPos(db *DB, args [][]byte) resp.Reply {
+	_, set, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]resp.Reply, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		if set == nil {
+			result = append(result, reply.MakeNullMultiBulkBytes())
+			continue
+		}
+		longitude, latitude, ok := memberCoord(set, string(arg))
+		if !ok {
+			result = append(result, reply.MakeNullMultiBulkBytes())
+			continue
+		}
+		result = append(result, makeCoordReply(longitude, latitude))
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// execGeoHash GEOHASH key [member ...]: 返回标准的 11 位 geohash 字符串
+func execGeoHash(db *DB, args [][]byte) resp.Reply {
+	_, set, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]resp.Reply, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		if set == nil {
+			result = append(result, reply.MakeNullBulkReply())
+			continue
+		}
+		longitude, latitude, ok := memberCoord(set, string(arg))
+		if !ok {
+			result = append(result, reply.MakeNullBulkReply())
+			continue
+		}
+		result = append(result, reply.MakeBulkReply([]byte(geohash.ToString(longitude, latitude))))
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+/* ---- GEOSEARCH ---- */
+
+const (
+	geoSortNone = iota
+	geoSortAsc
+	geoSortDesc
+)
+
+// geoSearchArgs GEOSEARCH 和 GEOSEARCHSTORE 的参数
+type geoSearchArgs struct {
+	fromMember []byte // FROMMEMBER, 为 nil 时使用 FROMLONLAT
+	fromLonLat bool
+	shape      geohash.Shape // 单位为米
+	hasShape   bool
+	unit       float64
+	sort       int
+	count      int
+	any        bool
+	withCoord  bool
+	withDist   bool
+	withHash   bool
+	storeDist  bool
+}
+
+// parseGeoSearchArgs 解析 key 之后的参数, store 为 true 时解析 GEOSEARCHSTORE
+func parseGeoSearchArgs(cmdName string, args [][]byte, store bool) (*geoSearchArgs, reply.ErrorReply) {
+	opts := &geoSearchArgs{}
+	for i := 0; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		switch strings.ToUpper(string(args[i])) {
+		case "FROMMEMBER":
+			if remaining < 1 || opts.fromMember != nil || opts.fromLonLat {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.fromMember = args[i+1]
+			i++
+		case "FROMLONLAT":
+			if remaining < 2 || opts.fromMember != nil || opts.fromLonLat {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			longitude, latitude, errReply := parseLongLat(args[i+1], args[i+2])
+			if errReply != nil {
+				return nil, errReply
+			}
+			opts.fromLonLat = true
+			opts.shape.Longitude, opts.shape.Latitude = longitude, latitude
+			i += 2
+		case "BYRADIUS":
+			if remaining < 2 || opts.hasShape {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			radius, err := strconv.ParseFloat(string(args[i+1]), 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR need numeric radius")
+			}
+			if radius < 0 {
+				return nil, reply.MakeErrReply("ERR radius cannot be negative")
+			}
+			unit, errReply := parseUnit(args[i+2])
+			if errReply != nil {
+				return nil, errReply
+			}
+			opts.hasShape, opts.unit = true, unit
+			opts.shape.Radius = radius * unit
+			i += 2
+		case "BYBOX":
+			if remaining < 3 || opts.hasShape {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			width, err := strconv.ParseFloat(string(args[i+1]), 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR need numeric width")
+			}
+			height, err := strconv.ParseFloat(string(args[i+2]), 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR need numeric height")
+			}
+			if width < 0 || height < 0 {
+				return nil, reply.MakeErrReply("ERR height or width cannot be negative")
+			}
+			unit, errReply := parseUnit(args[i+3])
+			if errReply != nil {
+				return nil, errReply
+			}
+			opts.hasShape, opts.unit = true, unit
+			opts.shape.IsBox = true
+			opts.shape.Width, opts.shape.Height = width*unit, height*unit
+			i += 3
+		case "ASC":
+			opts.sort = geoSortAsc
+		case "DESC":
+			opts.sort = geoSortDesc
+		case "COUNT":
+			if remaining < 1 {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			count, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if count <= 0 {
+				return nil, reply.MakeErrReply("ERR COUNT must be > 0")
+			}
+			opts.count = int(count)
+			i++
+			if remaining > 1 && strings.ToUpper(string(args[i+1])) == "ANY" {
+				opts.any = true
+				i++
+			}
+		case "WITHCOORD":
+			opts.withCoord = true
+		case "WITHDIST":
+			opts.withDist = true
+		case "WITHHASH":
+			opts.withHash = true
+		case "STOREDIST":
+			if !store {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.storeDist = true
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	if opts.fromMember == nil && !opts.fromLonLat {
+		return nil, reply.MakeErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for " + cmdName)
+	}
+	if !opts.hasShape {
+		return nil, reply.MakeErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for " + cmdName)
+	}
+	if store && (opts.withCoord || opts.withDist || opts.withHash) {
+		return nil, reply.MakeErrReply("ERR " + cmdName + " is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+	}
+	// 指定了 COUNT 但没有 ANY 时, 需要排序后取最近的元素
+	if opts.count > 0 && !opts.any && opts.sort == geoSortNone {
+		opts.sort = geoSortAsc
+	}
+	return opts, nil
+}
+
+// geoPoint 搜索结果
+type geoPoint struct {
+	member    string
+	score     float64
+	dist      float64 // 到中心的距离(米)
+	longitude float64
+	latitude  float64
+}
+
+// geoSearch 在有序集合中查找范围内的元素; 找不到 FROMMEMBER 指定的元素时返回错误
+func geoSearch(set *sortedset.SortedSet, opts *geoSearchArgs) ([]*geoPoint, reply.ErrorReply) {
+	shape := opts.shape
+	if opts.fromMember != nil {
+		longitude, latitude, ok := memberCoord(set, string(opts.fromMember))
+		if !ok {
+			return nil, reply.MakeErrReply("ERR could not decode requested zset member")
+		}
+		shape.Longitude, shape.Latitude = longitude, latitude
+	}
+	// ANY 时找到足够的元素即可停止
+	limit := 0
+	if opts.any {
+		limit = opts.count
+	}
+	points := make([]*geoPoint, 0)
+	for _, r := range shape.SearchRanges() {
+		min := &sortedset.ScoreBorder{Value: float64(r.Min)}
+		max := &sortedset.ScoreBorder{Value: float64(r.Max), Exclude: true}
+		set.ForEachByScore(min, max, 0, false, func(element *sortedset.Element) bool {
+			longitude, latitude := geohash.DecodeToLongLat(uint64(element.Score))
+			if dist, ok := shape.Contains(longitude, latitude); ok {
+				points = append(points, &geoPoint{
+					member:    element.Member,
+					score:     element.Score,
+					dist:      dist,
+					longitude: longitude,
+					latitude:  latitude,
+				})
+			}
+			return limit == 0 || len(points) < limit
+		})
+		if limit > 0 && len(points) >= limit {
+			break
+		}
+	}
+	switch opts.sort {
+	case geoSortAsc:
+		sort.SliceStable(points, func(i, j int) bool {
+			return points[i].dist < points[j].dist
+		})
+	case geoSortDesc:
+		sort.SliceStable(points, func(i, j int) bool {
+			return points[i].dist > points[j].dist
+		})
+	}
+	if opts.count > 0 && len(points) > opts.count {
+		points = points[:opts.count]
+	}
+	return points, nil
+}
+
+// execGeoSearch GEOSEARCH key FROMMEMBER member|FROMLONLAT longitude latitude
+// BYRADIUS radius unit|BYBOX width height unit [ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+func execGeoSearch(db *DB, args [][]byte) resp.Reply {
+	opts, errReply := parseGeoSearchArgs("GEOSEARCH", args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	_, set, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeEmptyMultiBulkBytes()
+	}
+	points, errReply := geoSearch(set, opts)
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]resp.Reply, 0, len(points))
+	for _, p := range points {
+		if !opts.withDist && !opts.withHash && !opts.withCoord {
+			result = append(result, reply.MakeBulkReply([]byte(p.member)))
+			continue
+		}
+		item := []resp.Reply{reply.MakeBulkReply([]byte(p.member))}
+		if opts.withDist {
+			item = append(item, reply.MakeBulkReply(formatDistance(p.dist, opts.unit)))
+		}
+		if opts.withHash {
+			item = append(item, reply.MakeIntReply(int64(p.score)))
+		}
+		if opts.withCoord {
+			item = append(item, makeCoordReply(p.longitude, p.latitude))
+		}
+		result = append(result, reply.MakeMultiRawReply(item))
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// execGeoSearchStore GEOSEARCHSTORE destination source ... [STOREDIST]: 把结果保存到 destination
+// STOREDIST 时 score 为到中心的距离, 否则为 geohash
+func execGeoSearchStore(db *DB, args [][]byte) resp.Reply {
+	dest := string(args[0])
+	opts, errReply := parseGeoSearchArgs("GEOSEARCHSTORE", args[2:], true)
+	if errReply != nil {
+		return errReply
+	}
+	_, set, errReply := db.getAsSortedSet(string(args[1]))
+	if errReply != nil {
+		return errReply
+	}
+	var points []*geoPoint
+	if set != nil {
+		points, errReply = geoSearch(set, opts)
+		if errReply != nil {
+			return errReply
+		}
+	}
+	if len(points) == 0 {
+		db.Removes(dest)
+		db.addAof(utils.ToCmdLine2("geosearchstore", args...))
+		return reply.MakeIntReply(0)
+	}
+	result := sortedset.Make()
+	for _, p := range points {
+		score := p.score
+		if opts.storeDist {
+			score = p.dist / opts.unit
+		}
+		result.Add(p.member, score)
+	}
+	db.PutEntity(dest, &database.DataEntity{Data: result})
+	db.Persist(dest)
+	db.notify(notifyZSet, "geosearchstore", dest)
+	db.addAof(utils.ToCmdLine2("geosearchstore", args...))
+	return reply.MakeIntReply(int64(len(points)))
+}
+
+func prepareGeoSearchStore(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, []string{string(args[1])}
+}
+
+func undoGeoSearchStore(db *DB, args [][]byte) ([]CmdLine, error) {
+	return rollbackGivenKeys(db, string(args[0]))
+}
+
+func init() {
+	RegisterCommand("GeoAdd", execGeoAdd, writeFirstKey, rollbackFirstKey, -5).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("GeoDist", execGeoDist, readFirstKey, nil, -4).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("GeoPos", execGeoPos, readFirstKey, nil, -2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("GeoHash", execGeoHash, readFirstKey, nil, -2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("GeoSearch", execGeoSearch, readFirstKey, nil, -7).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("GeoSearchStore", execGeoSearchStore, prepareGeoSearchStore, undoGeoSearchStore, -8).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 2, 1)
+}
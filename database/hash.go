@@ -0,0 +1,202 @@
+package database
+
+import (
+	"GoRedis/datastruct/hash"
+	"GoRedis/interface/database"
+	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/reply"
+	"math"
+	"strconv"
+)
+
+// getAsHash 返回 key 对应的哈希, key 不存在时返回 nil
+func (db *DB) getAsHash(key string) (*database.DataEntity, *hash.Hash, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil, nil
+	}
+	h, ok := entity.Data.(*hash.Hash)
+	if !ok {
+		return nil, nil, &reply.WrongTypeErrReply{}
+	}
+	return entity, h, nil
+}
+
+// fieldSize 估算哈希中一个 field 的内存占用
+func fieldSize(field string, value []byte) int64 {
+	return int64(len(field)+len(value)) + elementOverhead
+}
+
+// execHSet HSET key field value [field value ...]
+func execHSet(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 1 {
+		return reply.MakeArgNumErrReply("hset")
+	}
+	key := string(args[0])
+	entity, h, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	created := h == nil
+	if created {
+		h = hash.Make()
+	}
+	var added int64
+	for i := 1; i < len(args); i += 2 {
+		field, value := string(args[i]), args[i+1]
+		old, exists := h.Get(field)
+		if h.Set(field, value) {
+			added++
+		}
+		if entity == nil {
+			continue
+		}
+		if exists {
+			db.growEntity(entity, int64(len(value)-len(old)))
+		} else {
+			db.growEntity(entity, fieldSize(field, value))
+		}
+	}
+	if created {
+		db.PutEntity(key, &database.DataEntity{Data: h})
+	}
+	db.notify(notifyHash, "hset", key)
+	db.addAof(utils.ToCmdLine2("hset", args...))
+	return reply.MakeIntReply(added)
+}
+
+// execHGet HGET key field
+func execHGet(db *DB, args [][]byte) resp.Reply {
+	_, h, errReply := db.getAsHash(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if h == nil {
+		return reply.MakeNullBulkReply()
+	}
+	value, ok := h.Get(string(args[1]))
+	if !ok {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeBulkReply(value)
+}
+
+// execHDel HDEL key field [field ...]
+func execHDel(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	entity, h, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if h == nil {
+		return reply.MakeIntReply(0)
+	}
+	var deleted int64
+	for _, arg := range args[1:] {
+		field := string(arg)
+		if value, ok := h.Get(field); ok {
+			h.Remove(field)
+			deleted++
+			db.growEntity(entity, -fieldSize(field, value))
+		}
+	}
+	if deleted > 0 {
+		db.notify(notifyHash, "hdel", key)
+		if h.Len() == 0 {
+			db.Remove(key)
+			db.notify(notifyGeneric, "del", key)
+		}
+		db.addAof(utils.ToCmdLine2("hdel", args...))
+	}
+	return reply.MakeIntReply(deleted)
+}
+
+// execHExists HEXISTS key field
+func execHExists(db *DB, args [][]byte) resp.Reply {
+	_, h, errReply := db.getAsHash(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if h == nil {
+		return reply.MakeIntReply(0)
+	}
+	if _, ok := h.Get(string(args[1])); !ok {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(1)
+}
+
+// execHLen HLEN key
+func execHLen(db *DB, args [][]byte) resp.Reply {
+	_, h, errReply := db.getAsHash(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if h == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(h.Len()))
+}
+
+// execHGetAll HGETALL key, RESP3 客户端收到 map
+func execHGetAll(db *DB, args [][]byte) resp.Reply {
+	_, h, errReply := db.getAsHash(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if h == nil {
+		return reply.MakeBulkMapReply(nil)
+	}
+	result := make([][]byte, 0, 2*h.Len())
+	h.ForEach(func(field string, value []byte) bool {
+		result = append(result, []byte(field), value)
+		return true
+	})
+	return reply.MakeBulkMapReply(result)
+}
+
+// execHScan HSCAN key cursor [MATCH pattern] [COUNT count]
+// 游标的含义与 SCAN 相同, 见 Hash.Scan; 返回的 field 后跟随 value
+func execHScan(db *DB, args [][]byte) resp.Reply {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR invalid cursor")
+	}
+	options, errReply := parseScanArgs(args[2:], false)
+	if errReply != nil {
+		return errReply
+	}
+	_, h, errReply := db.getAsHash(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if h == nil || cursor > math.MaxInt32 {
+		return makeScanReply(0, nil)
+	}
+	fields, values, next := h.Scan(int(cursor), options.count, func(field string) bool {
+		return options.pattern == nil || options.pattern.IsMatch(field)
+	})
+	result := make([][]byte, 0, 2*len(fields))
+	for i, field := range fields {
+		result = append(result, []byte(field), values[i])
+	}
+	return makeScanReply(uint64(next), result)
+}
+
+func init() {
+	RegisterCommand("HSet", execHSet, writeFirstKey, rollbackFirstKey, -4).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("HGet", execHGet, readFirstKey, nil, 3).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("HDel", execHDel, writeFirstKey, rollbackFirstKey, -3).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("HExists", execHExists, readFirstKey, nil, 3).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("HLen", execHLen, readFirstKey, nil, 2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("HGetAll", execHGetAll, readFirstKey, nil, 2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("HScan", execHScan, readFirstKey, nil, -3).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+}
@@ -0,0 +1,82 @@
+package database
+
+/*HELLO 协商协议版本, 以及客户端名称*/
+
+import (
+	"GoRedis/config"
+	"GoRedis/interface/resp"
+	"GoRedis/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// serverVersion HELLO 返回的版本号, 客户端据此判断服务端支持的特性
+const serverVersion = "7.0.0"
+
+// execHello HELLO [protover [SETNAME clientname]]
+// 服务端没有实现认证(不检查 requirepass, 也没有 AUTH 指令), 因此不接受 AUTH 选项, 避免客户端误以为认证已经生效
+func execHello(c resp.Connection, args [][]byte) resp.Reply {
+	protocol := c.GetProtocol()
+	if len(args) > 0 {
+		version, err := strconv.ParseInt(string(args[0]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR Protocol version is not an integer or out of range")
+		}
+		if version != reply.Resp2 && version != reply.Resp3 {
+			return reply.MakeErrReply("NOPROTO unsupported protocol version")
+		}
+		protocol = int(version)
+	}
+	var name []byte
+	for i := 1; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "auth":
+			return reply.MakeErrReply("ERR HELLO AUTH is not supported: authentication is not implemented")
+		case "setname":
+			if i+1 >= len(args) {
+				return reply.MakeErrReply("ERR Syntax error in HELLO option 'setname'")
+			}
+			if errReply := validateClientName(args[i+1]); errReply != nil {
+				return errReply
+			}
+			name = args[i+1]
+			i++
+		default:
+			return reply.MakeErrReply("ERR Syntax error in HELLO option '" + string(args[i]) + "'")
+		}
+	}
+	// 所有参数检查通过后才修改连接的状态
+	c.SetProtocol(protocol)
+	if name != nil {
+		c.SetName(string(name))
+	}
+	mode := "standalone"
+	if config.Properties.Self != "" && len(config.Properties.Peers) > 0 {
+		mode = "cluster"
+	}
+	return reply.MakeMapReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("server")), reply.MakeBulkReply([]byte("redis")),
+		reply.MakeBulkReply([]byte("version")), reply.MakeBulkReply([]byte(serverVersion)),
+		reply.MakeBulkReply([]byte("proto")), reply.MakeIntReply(int64(protocol)),
+		reply.MakeBulkReply([]byte("id")), reply.MakeIntReply(c.GetID()),
+		reply.MakeBulkReply([]byte("mode")), reply.MakeBulkReply([]byte(mode)),
+		reply.MakeBulkReply([]byte("role")), reply.MakeBulkReply([]byte("master")),
+		reply.MakeBulkReply([]byte("modules")), reply.MakeEmptyMultiBulkBytes(),
+	})
+}
+
+// validateClientName 客户端名称不能包含空格、换行等特殊字符
+func validateClientName(name []byte) reply.ErrorReply {
+	for _, ch := range name {
+		if ch < '!' || ch > '~' {
+			return reply.MakeErrReply("ERR Client names cannot contain spaces, newlines or special characters.")
+		}
+	}
+	return nil
+}
+
+func init() {
+	// 协议版本保存在客户端连接上, 只能在客户端连接的节点上执行
+	registerServerCommand("Hello", -1).
+		attachCommandExtra(0, 0, 0, 0)
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"GoRedis/config"
+	"GoRedis/datastruct/hll"
+	"GoRedis/interface/database"
+	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/reply"
+)
+
+const defaultHllSparseMaxBytes = 3000
+
+func hllSparseMaxBytes() int {
+	if config.Properties.HllSparseMaxBytes > 0 {
+		return config.Properties.HllSparseMaxBytes
+	}
+	return defaultHllSparseMaxBytes
+}
+
+func makeInvalidHllErr() reply.ErrorReply {
+	return reply.MakeErrReply("WRONGTYPE Key is not a valid HyperLogLog string value.")
+}
+
+func makeCorruptedHllErr() reply.ErrorReply {
+	return reply.MakeErrReply("INVALIDOBJ Corrupted HLL object detected")
+}
+
+// getAsHLL 返回 key 对应的 HyperLogLog, key 不存在时返回 nil
+func (db *DB) getAsHLL(key string) ([]byte, reply.ErrorReply) {
+	value, errReply := db.getAsString(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if value != nil && !hll.IsValid(value) {
+		return nil, makeInvalidHllErr()
+	}
+	return value, nil
+}
+
+// execPFAdd PFADD key [element...]: 添加元素, 有寄存器被修改或新建了 key 时返回 1
+func execPFAdd(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	value, errReply := db.getAsHLL(key)
+	if errReply != nil {
+		return errReply
+	}
+	created := value == nil
+	if created {
+		value = hll.New()
+	}
+	value, changed, ok := hll.Add(value, args[1:], hllSparseMaxBytes())
+	if !ok {
+		return makeCorruptedHllErr()
+	}
+	if !created && !changed {
+		return reply.MakeIntReply(0)
+	}
+	db.PutEntity(key, &database.DataEntity{Data: value})
+	db.notify(notifyString, "pfadd", key)
+	db.addAof(utils.ToCmdLine2("pfadd", args...))
+	return reply.MakeIntReply(1)
+}
+
+// execPFCount PFCOUNT key [key...]: 估算基数, 多个 key 时返回并集的基数
+// 持有的是读锁, 因此不回写缓存的基数
+func execPFCount(db *DB, args [][]byte) resp.Reply {
+	if len(args) == 1 {
+		value, errReply := db.getAsHLL(string(args[0]))
+		if errReply != nil {
+			return errReply
+		}
+		if value == nil {
+			return reply.MakeIntReply(0)
+		}
+		count, ok := hll.Count(value)
+		if !ok {
+			return makeCorruptedHllErr()
+		}
+		return reply.MakeIntReply(int64(count))
+	}
+	regs := make([]uint8, hll.Registers)
+	for _, arg := range args {
+		value, errReply := db.getAsHLL(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if value != nil && !hll.Merge(regs, value) {
+			return makeCorruptedHllErr()
+		}
+	}
+	return reply.MakeIntReply(int64(hll.CountRegisters(regs)))
+}
+
+// execPFMerge PFMERGE destkey [sourcekey...]: 把 destkey 和所有 sourcekey 合并到 destkey
+func execPFMerge(db *DB, args [][]byte) resp.Reply {
+	dest := string(args[0])
+	regs := make([]uint8, hll.Registers)
+	useDense := false
+	for _, arg := range args {
+		value, errReply := db.getAsHLL(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if value == nil {
+			continue
+		}
+		if hll.IsDense(value) {
+			useDense = true
+		}
+		if !hll.Merge(regs, value) {
+			return makeCorruptedHllErr()
+		}
+	}
+	// 任意一个输入是 dense 编码时结果也使用 dense 编码
+	value := hll.FromRegisters(regs, !useDense, hllSparseMaxBytes())
+	db.PutEntity(dest, &database.DataEntity{Data: value})
+	db.notify(notifyString, "pfadd", dest)
+	db.addAof(utils.ToCmdLine2("pfmerge", args...))
+	return &reply.OkReply{}
+}
+
+func preparePFMerge(args [][]byte) ([]string, []string) {
+	readKeys := make([]string, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		readKeys = append(readKeys, string(arg))
+	}
+	return []string{string(args[0])}, readKeys
+}
+
+func init() {
+	RegisterCommand("PFAdd", execPFAdd, writeFirstKey, rollbackFirstKey, -2).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("PFCount", execPFCount, readAllKeys, nil, -2).
+		attachCommandExtra(FlagReadOnly, 1, -1, 1)
+	RegisterCommand("PFMerge", execPFMerge, preparePFMerge, rollbackFirstKey, -2).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, -1, 1)
+}
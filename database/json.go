@@ -0,0 +1,776 @@
+package database
+
+import (
+	"GoRedis/datastruct/jsondoc"
+	"GoRedis/interface/database"
+	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/reply"
+	"strconv"
+	"strings"
+)
+
+/*JSON 文档: 路径语法见 datastruct/jsondoc, 旧语法的路径只返回一个结果, JSONPath 返回所有匹配的结果*/
+
+var errJSONKeyNotExist = reply.MakeErrReply("ERR could not perform this operation on a key that doesn't exist")
+
+// getAsJSON 返回 key 对应的 JSON 文档, key 不存在时返回 nil
+func (db *DB) getAsJSON(key string) (*database.DataEntity, *jsondoc.Value, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil, nil
+	}
+	doc, ok := entity.Data.(*jsondoc.Value)
+	if !ok {
+		return nil, nil, &reply.WrongTypeErrReply{}
+	}
+	return entity, doc, nil
+}
+
+func parseJSONPath(arg []byte) (*jsondoc.Path, reply.ErrorReply) {
+	path, err := jsondoc.ParsePath(string(arg))
+	if err != nil {
+		return nil, reply.MakeErrReply("ERR " + err.Error())
+	}
+	return path, nil
+}
+
+func parseJSONValue(arg []byte) (*jsondoc.Value, reply.ErrorReply) {
+	value, err := jsondoc.Parse(arg)
+	if err != nil {
+		return nil, reply.MakeErrReply("ERR " + err.Error())
+	}
+	return value, nil
+}
+
+// optionalJSONPath 可选的路径参数 args[i], 省略时使用 defaultPath; 路径之后不能有其它参数
+func optionalJSONPath(args [][]byte, i int, defaultPath string) (*jsondoc.Path, reply.ErrorReply) {
+	if len(args) > i+1 {
+		return nil, reply.MakeSyntaxErrReply()
+	}
+	if i < len(args) {
+		return parseJSONPath(args[i])
+	}
+	return parseJSONPath([]byte(defaultPath))
+}
+
+func makeJSONPathErr(path *jsondoc.Path) reply.ErrorReply {
+	return reply.MakeErrReply("ERR Path '" + path.String() + "' does not exist")
+}
+
+func makeJSONTypeErr(expected string, found jsondoc.Kind) reply.ErrorReply {
+	return reply.MakeErrReply("WRONGTYPE wrong type of path value - expected " + expected + " but found " + found.String())
+}
+
+// jsonPathReply 对路径匹配到的每个节点执行 fn, fn 返回 nil 表示节点的类型不是 expected, 返回错误时立即停止
+// JSONPath 返回所有结果组成的数组, 类型不符的节点对应 nil; 旧语法返回第一个结果, 没有匹配或类型不符时返回错误
+func jsonPathReply(path *jsondoc.Path, matches []*jsondoc.Match, expected string, fn func(v *jsondoc.Value) resp.Reply) resp.Reply {
+	if path.IsLegacy() {
+		if len(matches) == 0 {
+			return makeJSONPathErr(path)
+		}
+		var first resp.Reply
+		for _, m := range matches {
+			result := fn(m.Value)
+			if result == nil {
+				return makeJSONTypeErr(expected, m.Value.Kind())
+			}
+			if reply.IsErrorReply(result) {
+				return result
+			}
+			if first == nil {
+				first = result
+			}
+		}
+		return first
+	}
+	results := make([]resp.Reply, len(matches))
+	for i, m := range matches {
+		result := fn(m.Value)
+		if result == nil {
+			result = reply.MakeNullBulkReply()
+		} else if reply.IsErrorReply(result) {
+			return result
+		}
+		results[i] = result
+	}
+	return reply.MakeMultiRawReply(results)
+}
+
+// jsonUpdated 原地修改文档之后重新计算内存占用, 并写入 aof、发送通知
+func (db *DB) jsonUpdated(key string, entity *database.DataEntity, event string, args [][]byte) {
+	db.PutEntity(key, entity)
+	db.notify(notifyModule, event, key)
+	db.addAof(utils.ToCmdLine2(event, args...))
+}
+
+// selectJSON 旧语法返回第一个匹配的节点, JSONPath 返回所有匹配的节点组成的数组
+func selectJSON(doc *jsondoc.Value, path *jsondoc.Path) (*jsondoc.Value, reply.ErrorReply) {
+	matches := path.Find(doc)
+	if path.IsLegacy() {
+		if len(matches) == 0 {
+			return nil, makeJSONPathErr(path)
+		}
+		return matches[0].Value, nil
+	}
+	values := make([]*jsondoc.Value, len(matches))
+	for i, m := range matches {
+		values[i] = m.Value
+	}
+	return jsondoc.NewArray(values...), nil
+}
+
+// execJSONSet JSON.SET key path value [NX|XX]
+func execJSONSet(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	path, errReply := parseJSONPath(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	value, errReply := parseJSONValue(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	nx, xx := false, false
+	for _, arg := range args[3:] {
+		switch strings.ToUpper(string(arg)) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	if nx && xx {
+		return reply.MakeSyntaxErrReply()
+	}
+
+	entity, doc, errReply := db.getAsJSON(key)
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		if xx {
+			return reply.MakeNullBulkReply()
+		}
+		if !path.IsRoot() {
+			return reply.MakeErrReply("ERR new objects must be created at the root")
+		}
+		db.PutEntity(key, &database.DataEntity{Data: value})
+		db.notify(notifyModule, "json.set", key)
+		db.addAof(utils.ToCmdLine2("json.set", args...))
+		return reply.MakeOkReply()
+	}
+
+	updated := false
+	for _, m := range path.FindOrCreate(doc) {
+		if (nx && m.Value != nil) || (xx && m.Value == nil) {
+			continue
+		}
+		m.Set(value.Clone())
+		updated = true
+	}
+	if !updated {
+		return reply.MakeNullBulkReply()
+	}
+	db.jsonUpdated(key, entity, "json.set", args)
+	return reply.MakeOkReply()
+}
+
+// execJSONGet JSON.GET key [INDENT indent] [NEWLINE newline] [SPACE space] [path ...]
+func execJSONGet(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	format := &jsondoc.Format{}
+	i := 1
+options:
+	for ; i < len(args); i += 2 {
+		var target *string
+		switch strings.ToUpper(string(args[i])) {
+		case "INDENT":
+			target = &format.Indent
+		case "NEWLINE":
+			target = &format.Newline
+		case "SPACE":
+			target = &format.Space
+		default:
+			break options
+		}
+		if i+1 >= len(args) {
+			return reply.MakeSyntaxErrReply()
+		}
+		*target = string(args[i+1])
+	}
+	rawPaths := args[i:]
+	if len(rawPaths) == 0 {
+		rawPaths = [][]byte{[]byte(".")}
+	}
+	paths := make([]*jsondoc.Path, len(rawPaths))
+	legacy := true
+	for j, raw := range rawPaths {
+		path, errReply := parseJSONPath(raw)
+		if errReply != nil {
+			return errReply
+		}
+		paths[j] = path
+		legacy = legacy && path.IsLegacy()
+	}
+
+	_, doc, errReply := db.getAsJSON(key)
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return reply.MakeNullBulkReply()
+	}
+	if len(paths) == 1 {
+		value, errReply := selectJSON(doc, paths[0])
+		if errReply != nil {
+			return errReply
+		}
+		return reply.MakeBulkReply(value.AppendTo(nil, format))
+	}
+	// 多个路径时返回以路径为 key 的对象; 只要有一个路径是 JSONPath, 所有路径都按 JSONPath 返回数组
+	result := jsondoc.NewObject()
+	for _, path := range paths {
+		var value *jsondoc.Value
+		if legacy {
+			value, errReply = selectJSON(doc, path)
+			if errReply != nil {
+				return errReply
+			}
+		} else {
+			matches := path.Find(doc)
+			values := make([]*jsondoc.Value, len(matches))
+			for j, m := range matches {
+				values[j] = m.Value
+			}
+			value = jsondoc.NewArray(values...)
+		}
+		result.Set(path.String(), value)
+	}
+	return reply.MakeBulkReply(result.AppendTo(nil, format))
+}
+
+// execJSONMGet JSON.MGET key [key ...] path
+func execJSONMGet(db *DB, args [][]byte) resp.Reply {
+	path, errReply := parseJSONPath(args[len(args)-1])
+	if errReply != nil {
+		return errReply
+	}
+	keys := args[:len(args)-1]
+	results := make([]resp.Reply, len(keys))
+	for i, key := range keys {
+		results[i] = reply.MakeNullBulkReply()
+		_, doc, _ := db.getAsJSON(string(key))
+		if doc == nil {
+			continue
+		}
+		value, errReply := selectJSON(doc, path)
+		if errReply == nil {
+			results[i] = reply.MakeBulkReply(value.Marshal())
+		}
+	}
+	return reply.MakeMultiRawReply(results)
+}
+
+// prepareJSONMGet JSON.MGET 除最后一个参数外都是 key
+func prepareJSONMGet(args [][]byte) ([]string, []string) {
+	return readAllKeys(args[:len(args)-1])
+}
+
+// execJSONDel JSON.DEL key [path], 删除根节点时删除整个 key
+func execJSONDel(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	path, errReply := optionalJSONPath(args, 1, "$")
+	if errReply != nil {
+		return errReply
+	}
+	entity, doc, errReply := db.getAsJSON(key)
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return reply.MakeIntReply(0)
+	}
+	if path.IsRoot() {
+		db.Remove(key)
+		db.notify(notifyModule, "json.del", key)
+		db.addAof(utils.ToCmdLine2("json.del", args...))
+		return reply.MakeIntReply(1)
+	}
+	deleted := path.Delete(doc)
+	if deleted > 0 {
+		db.jsonUpdated(key, entity, "json.del", args)
+	}
+	return reply.MakeIntReply(int64(deleted))
+}
+
+// execJSONType JSON.TYPE key [path]
+func execJSONType(db *DB, args [][]byte) resp.Reply {
+	path, errReply := optionalJSONPath(args, 1, ".")
+	if errReply != nil {
+		return errReply
+	}
+	_, doc, errReply := db.getAsJSON(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return reply.MakeNullBulkReply()
+	}
+	matches := path.Find(doc)
+	if path.IsLegacy() {
+		if len(matches) == 0 {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeStatusReply(matches[0].Value.Kind().String())
+	}
+	result := make([][]byte, len(matches))
+	for i, m := range matches {
+		result[i] = []byte(m.Value.Kind().String())
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+/* ---- 数字 ---- */
+
+// execJSONNumIncrBy JSON.NUMINCRBY key path value
+func execJSONNumIncrBy(db *DB, args [][]byte) resp.Reply {
+	return db.jsonNumOp(args, "json.numincrby", (*jsondoc.Value).IncrBy)
+}
+
+// execJSONNumMultBy JSON.NUMMULTBY key path value
+func execJSONNumMultBy(db *DB, args [][]byte) resp.Reply {
+	return db.jsonNumOp(args, "json.nummultby", (*jsondoc.Value).MultBy)
+}
+
+// jsonNumOp 对所有匹配的数字执行 op, 返回运算结果序列化后的 JSON
+func (db *DB) jsonNumOp(args [][]byte, event string, op func(v *jsondoc.Value, operand *jsondoc.Value) error) resp.Reply {
+	key := string(args[0])
+	path, errReply := parseJSONPath(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	operand, errReply := parseJSONValue(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	if !operand.IsNumber() {
+		return makeJSONTypeErr("a number", operand.Kind())
+	}
+	entity, doc, errReply := db.getAsJSON(key)
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return errJSONKeyNotExist
+	}
+
+	matches := path.Find(doc)
+	results := make([]*jsondoc.Value, len(matches))
+	modified := false
+	for i, m := range matches {
+		if !m.Value.IsNumber() {
+			if path.IsLegacy() {
+				errReply = makeJSONTypeErr("a number", m.Value.Kind())
+				break
+			}
+			results[i] = jsondoc.NewNull()
+			continue
+		}
+		if err := op(m.Value, operand); err != nil {
+			errReply = reply.MakeErrReply("ERR " + err.Error())
+			break
+		}
+		results[i] = m.Value
+		modified = true
+	}
+	if modified {
+		db.jsonUpdated(key, entity, event, args)
+	}
+	if errReply != nil {
+		return errReply
+	}
+	if path.IsLegacy() {
+		if len(matches) == 0 {
+			return makeJSONPathErr(path)
+		}
+		return reply.MakeBulkReply(results[len(results)-1].Marshal())
+	}
+	return reply.MakeBulkReply(jsondoc.NewArray(results...).Marshal())
+}
+
+/* ---- 字符串与布尔值 ---- */
+
+// execJSONStrAppend JSON.STRAPPEND key [path] value
+func execJSONStrAppend(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	path, errReply := optionalJSONPath(args[:len(args)-1], 1, ".")
+	if errReply != nil {
+		return errReply
+	}
+	value, errReply := parseJSONValue(args[len(args)-1])
+	if errReply != nil {
+		return errReply
+	}
+	if value.Kind() != jsondoc.String {
+		return makeJSONTypeErr("string", value.Kind())
+	}
+	entity, doc, errReply := db.getAsJSON(key)
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return errJSONKeyNotExist
+	}
+	modified := false
+	result := jsonPathReply(path, path.Find(doc), "string", func(v *jsondoc.Value) resp.Reply {
+		if v.Kind() != jsondoc.String {
+			return nil
+		}
+		modified = true
+		return reply.MakeIntReply(int64(v.StrAppend(value.Str())))
+	})
+	if modified {
+		db.jsonUpdated(key, entity, "json.strappend", args)
+	}
+	return result
+}
+
+// execJSONStrLen JSON.STRLEN key [path]
+func execJSONStrLen(db *DB, args [][]byte) resp.Reply {
+	return db.jsonLen(args, jsondoc.String)
+}
+
+// execJSONToggle JSON.TOGGLE key path
+func execJSONToggle(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	path, errReply := parseJSONPath(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	entity, doc, errReply := db.getAsJSON(key)
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return errJSONKeyNotExist
+	}
+	modified := false
+	result := jsonPathReply(path, path.Find(doc), "bool", func(v *jsondoc.Value) resp.Reply {
+		if v.Kind() != jsondoc.Boolean {
+			return nil
+		}
+		modified = true
+		b := v.Toggle()
+		if path.IsLegacy() {
+			return reply.MakeBulkReply([]byte(strconv.FormatBool(b)))
+		}
+		if b {
+			return reply.MakeIntReply(1)
+		}
+		return reply.MakeIntReply(0)
+	})
+	if modified {
+		db.jsonUpdated(key, entity, "json.toggle", args)
+	}
+	return result
+}
+
+// execJSONClear JSON.CLEAR key [path], 清空数组和对象, 数字置为 0; 返回修改的节点数量
+func execJSONClear(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	path, errReply := optionalJSONPath(args, 1, "$")
+	if errReply != nil {
+		return errReply
+	}
+	entity, doc, errReply := db.getAsJSON(key)
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return errJSONKeyNotExist
+	}
+	cleared := 0
+	for _, m := range path.Find(doc) {
+		if m.Value.Clear() {
+			cleared++
+		}
+	}
+	if cleared > 0 {
+		db.jsonUpdated(key, entity, "json.clear", args)
+	}
+	return reply.MakeIntReply(int64(cleared))
+}
+
+// jsonLen JSON.STRLEN、JSON.ARRLEN、JSON.OBJLEN key [path]
+func (db *DB) jsonLen(args [][]byte, kind jsondoc.Kind) resp.Reply {
+	path, errReply := optionalJSONPath(args, 1, ".")
+	if errReply != nil {
+		return errReply
+	}
+	_, doc, errReply := db.getAsJSON(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return reply.MakeNullBulkReply()
+	}
+	return jsonPathReply(path, path.Find(doc), kind.String(), func(v *jsondoc.Value) resp.Reply {
+		if v.Kind() != kind {
+			return nil
+		}
+		return reply.MakeIntReply(int64(v.Len()))
+	})
+}
+
+/* ---- 数组 ---- */
+
+// parseJSONValues 解析多个 JSON 值
+func parseJSONValues(args [][]byte) ([]*jsondoc.Value, reply.ErrorReply) {
+	values := make([]*jsondoc.Value, len(args))
+	for i, arg := range args {
+		value, errReply := parseJSONValue(arg)
+		if errReply != nil {
+			return nil, errReply
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func cloneJSONValues(values []*jsondoc.Value) []*jsondoc.Value {
+	cloned := make([]*jsondoc.Value, len(values))
+	for i, v := range values {
+		cloned[i] = v.Clone()
+	}
+	return cloned
+}
+
+// jsonArrayWrite 对所有匹配的数组执行 fn, 修改过时写入 aof
+func (db *DB) jsonArrayWrite(args [][]byte, path *jsondoc.Path, event string, fn func(arr *jsondoc.Value) resp.Reply) resp.Reply {
+	key := string(args[0])
+	entity, doc, errReply := db.getAsJSON(key)
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return errJSONKeyNotExist
+	}
+	modified := false
+	result := jsonPathReply(path, path.Find(doc), "array", func(v *jsondoc.Value) resp.Reply {
+		if v.Kind() != jsondoc.Array {
+			return nil
+		}
+		r := fn(v)
+		if !reply.IsErrorReply(r) {
+			modified = true
+		}
+		return r
+	})
+	if modified {
+		db.jsonUpdated(key, entity, event, args)
+	}
+	return result
+}
+
+// execJSONArrAppend JSON.ARRAPPEND key path value [value ...]
+func execJSONArrAppend(db *DB, args [][]byte) resp.Reply {
+	path, errReply := parseJSONPath(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	values, errReply := parseJSONValues(args[2:])
+	if errReply != nil {
+		return errReply
+	}
+	return db.jsonArrayWrite(args, path, "json.arrappend", func(arr *jsondoc.Value) resp.Reply {
+		return reply.MakeIntReply(int64(arr.ArrAppend(cloneJSONValues(values)...)))
+	})
+}
+
+// execJSONArrInsert JSON.ARRINSERT key path index value [value ...]
+func execJSONArrInsert(db *DB, args [][]byte) resp.Reply {
+	path, errReply := parseJSONPath(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	index, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	values, errReply := parseJSONValues(args[3:])
+	if errReply != nil {
+		return errReply
+	}
+	return db.jsonArrayWrite(args, path, "json.arrinsert", func(arr *jsondoc.Value) resp.Reply {
+		size, err := arr.ArrInsert(index, cloneJSONValues(values)...)
+		if err != nil {
+			return reply.MakeErrReply("ERR " + err.Error())
+		}
+		return reply.MakeIntReply(int64(size))
+	})
+}
+
+// execJSONArrPop JSON.ARRPOP key [path [index]], 默认弹出最后一个元素
+func execJSONArrPop(db *DB, args [][]byte) resp.Reply {
+	if len(args) > 3 {
+		return reply.MakeSyntaxErrReply()
+	}
+	pathArgs := args
+	if len(args) == 3 {
+		pathArgs = args[:2]
+	}
+	path, errReply := optionalJSONPath(pathArgs, 1, ".")
+	if errReply != nil {
+		return errReply
+	}
+	index := -1
+	if len(args) > 2 {
+		var err error
+		if index, err = strconv.Atoi(string(args[2])); err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+	}
+	return db.jsonArrayWrite(args, path, "json.arrpop", func(arr *jsondoc.Value) resp.Reply {
+		popped := arr.ArrPop(index)
+		if popped == nil {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeBulkReply(popped.Marshal())
+	})
+}
+
+// execJSONArrTrim JSON.ARRTRIM key path start stop
+func execJSONArrTrim(db *DB, args [][]byte) resp.Reply {
+	path, errReply := parseJSONPath(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	start, err1 := strconv.Atoi(string(args[2]))
+	stop, err2 := strconv.Atoi(string(args[3]))
+	if err1 != nil || err2 != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	return db.jsonArrayWrite(args, path, "json.arrtrim", func(arr *jsondoc.Value) resp.Reply {
+		return reply.MakeIntReply(int64(arr.ArrTrim(start, stop)))
+	})
+}
+
+// execJSONArrLen JSON.ARRLEN key [path]
+func execJSONArrLen(db *DB, args [][]byte) resp.Reply {
+	return db.jsonLen(args, jsondoc.Array)
+}
+
+// execJSONArrIndex JSON.ARRINDEX key path value [start [stop]]
+func execJSONArrIndex(db *DB, args [][]byte) resp.Reply {
+	path, errReply := parseJSONPath(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	target, errReply := parseJSONValue(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	var bounds [2]int
+	for i, arg := range args[3:] {
+		if i >= len(bounds) {
+			return reply.MakeSyntaxErrReply()
+		}
+		n, err := strconv.Atoi(string(arg))
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		bounds[i] = n
+	}
+	_, doc, errReply := db.getAsJSON(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return errJSONKeyNotExist
+	}
+	return jsonPathReply(path, path.Find(doc), "array", func(v *jsondoc.Value) resp.Reply {
+		if v.Kind() != jsondoc.Array {
+			return nil
+		}
+		return reply.MakeIntReply(int64(v.ArrIndex(target, bounds[0], bounds[1])))
+	})
+}
+
+/* ---- 对象 ---- */
+
+// execJSONObjKeys JSON.OBJKEYS key [path]
+func execJSONObjKeys(db *DB, args [][]byte) resp.Reply {
+	path, errReply := optionalJSONPath(args, 1, ".")
+	if errReply != nil {
+		return errReply
+	}
+	_, doc, errReply := db.getAsJSON(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if doc == nil {
+		return reply.MakeNullBulkReply()
+	}
+	return jsonPathReply(path, path.Find(doc), "object", func(v *jsondoc.Value) resp.Reply {
+		if v.Kind() != jsondoc.Object {
+			return nil
+		}
+		keys := v.Keys()
+		result := make([][]byte, len(keys))
+		for i, k := range keys {
+			result[i] = []byte(k)
+		}
+		return reply.MakeMultiBulkReply(result)
+	})
+}
+
+// execJSONObjLen JSON.OBJLEN key [path]
+func execJSONObjLen(db *DB, args [][]byte) resp.Reply {
+	return db.jsonLen(args, jsondoc.Object)
+}
+
+func init() {
+	RegisterCommand("JSON.Set", execJSONSet, writeFirstKey, rollbackFirstKey, -4).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("JSON.Get", execJSONGet, readFirstKey, nil, -2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("JSON.MGet", execJSONMGet, prepareJSONMGet, nil, -3).
+		attachCommandExtra(FlagReadOnly, 1, -2, 1)
+	RegisterCommand("JSON.Del", execJSONDel, writeFirstKey, rollbackFirstKey, -2).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("JSON.Forget", execJSONDel, writeFirstKey, rollbackFirstKey, -2).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("JSON.Type", execJSONType, readFirstKey, nil, -2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("JSON.NumIncrBy", execJSONNumIncrBy, writeFirstKey, rollbackFirstKey, 4).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("JSON.NumMultBy", execJSONNumMultBy, writeFirstKey, rollbackFirstKey, 4).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("JSON.StrAppend", execJSONStrAppend, writeFirstKey, rollbackFirstKey, -3).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("JSON.StrLen", execJSONStrLen, readFirstKey, nil, -2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("JSON.Toggle", execJSONToggle, writeFirstKey, rollbackFirstKey, 3).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("JSON.Clear", execJSONClear, writeFirstKey, rollbackFirstKey, -2).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("JSON.ArrAppend", execJSONArrAppend, writeFirstKey, rollbackFirstKey, -4).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("JSON.ArrInsert", execJSONArrInsert, writeFirstKey, rollbackFirstKey, -5).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("JSON.ArrPop", execJSONArrPop, writeFirstKey, rollbackFirstKey, -2).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("JSON.ArrTrim", execJSONArrTrim, writeFirstKey, rollbackFirstKey, 5).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("JSON.ArrLen", execJSONArrLen, readFirstKey, nil, -2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("JSON.ArrIndex", execJSONArrIndex, readFirstKey, nil, -4).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("JSON.ObjKeys", execJSONObjKeys, readFirstKey, nil, -2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("JSON.ObjLen", execJSONObjLen, readFirstKey, nil, -2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+}
@@ -1,10 +1,20 @@
 package database
 
 import (
+	"GoRedis/datastruct/hash"
+	"GoRedis/datastruct/jsondoc"
+	"GoRedis/datastruct/list"
+	"GoRedis/datastruct/set"
+	"GoRedis/datastruct/sortedset"
+	"GoRedis/datastruct/stream"
+	"GoRedis/interface/database"
 	"GoRedis/interface/resp"
 	"GoRedis/lib/utils"
 	"GoRedis/lib/wildcard"
 	"GoRedis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
 )
 
 // execDel 执行Del, 从db中移除一个key
@@ -22,6 +32,20 @@ func execDel(db *DB, args [][]byte) resp.Reply {
 	return reply.MakeIntReply(int64(deleted))
 }
 
+// execUnlink 同DEL, 从db中移除key; value 由 GC 在后台回收, 见 DB.remove
+func execUnlink(db *DB, args [][]byte) resp.Reply {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+
+	deleted := db.Removes(keys...)
+	if deleted > 0 {
+		db.addAof(utils.ToCmdLine2("unlink", args...))
+	}
+	return reply.MakeIntReply(int64(deleted))
+}
+
 // execExists 检查K1 K2 K3...有几个K是存在的
 func execExists(db *DB, args [][]byte) resp.Reply {
 	result := int64(0)
@@ -35,13 +59,44 @@ func execExists(db *DB, args [][]byte) resp.Reply {
 	return reply.MakeIntReply(result)
 }
 
-// execFlushDB 移除当前 DB 中的所有数据
+// execTouch 更新 K1 K2 K3...的访问时间, 返回其中存在的 key 的个数
+func execTouch(db *DB, args [][]byte) resp.Reply {
+	count := int64(0)
+	for _, arg := range args {
+		_, exists := db.GetEntity(string(arg))
+		if exists {
+			count++
+		}
+	}
+	return reply.MakeIntReply(count)
+}
+
+// execFlushDB FLUSHDB [ASYNC|SYNC]: 移除当前 DB 中的所有数据
 func execFlushDB(db *DB, args [][]byte) resp.Reply {
+	if errReply := checkFlushMode(args); errReply != nil {
+		return errReply
+	}
 	db.Flush()
+	db.tracking.invalidateAll()
 	db.addAof(utils.ToCmdLine2("flushdb", args...))
 	return &reply.OkReply{}
 }
 
+// checkFlushMode 校验 FLUSHDB/FLUSHALL 的 ASYNC|SYNC 参数; 清空只是替换 dict, 两种方式相同
+func checkFlushMode(args [][]byte) reply.ErrorReply {
+	if len(args) == 0 {
+		return nil
+	}
+	if len(args) > 1 {
+		return reply.MakeSyntaxErrReply()
+	}
+	switch strings.ToLower(string(args[0])) {
+	case "async", "sync":
+		return nil
+	}
+	return reply.MakeSyntaxErrReply()
+}
+
 // execType 查询key的类型，string，set，hash
 func execType(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
@@ -49,11 +104,32 @@ func execType(db *DB, args [][]byte) resp.Reply {
 	if !exists {
 		return reply.MakeStatusReply("none")
 	}
+	typeName := getTypeName(entity)
+	if typeName == "" {
+		return &reply.UnknownErrReply{}
+	}
+	return reply.MakeStatusReply(typeName)
+}
+
+// getTypeName 返回 TYPE 指令使用的类型名称, 未知类型返回空字符串
+func getTypeName(entity *database.DataEntity) string {
 	switch entity.Data.(type) {
 	case []byte:
-		return reply.MakeStatusReply("string")
+		return "string"
+	case list.List:
+		return "list"
+	case *set.Set:
+		return "set"
+	case *hash.Hash:
+		return "hash"
+	case *stream.Stream:
+		return "stream"
+	case *sortedset.SortedSet:
+		return "zset"
+	case *jsondoc.Value:
+		return "ReJSON-RL"
 	}
-	return &reply.UnknownErrReply{}
+	return ""
 }
 
 // execRename k1:v -> k2:v, k1不存在则放回err
@@ -68,9 +144,14 @@ func execRename(db *DB, args [][]byte) resp.Reply {
 	if !ok {
 		return reply.MakeErrReply("no such key")
 	}
-	// 删除k1, 新建k2
+	expireTime, hasTTL := db.getExpireTime(src)
+	// 删除k1, 新建k2; 过期时间随 key 一起移动
+	db.removeForRename(src, dest)
 	db.PutEntity(dest, entity)
-	db.Remove(src)
+	if hasTTL {
+		db.Expire(dest, expireTime)
+	}
+	db.notifyRename(src, dest)
 	db.addAof(utils.ToCmdLine2("rename", args...))
 	return &reply.OkReply{}
 }
@@ -89,18 +170,37 @@ func execRenameNx(db *DB, args [][]byte) resp.Reply {
 	if !ok {
 		return reply.MakeErrReply("no such key")
 	}
-	db.Removes(src, dest) // clean src and dest with their ttl
+	expireTime, hasTTL := db.getExpireTime(src)
+	db.removeForRename(src, dest) // clean src and dest with their ttl
 	db.PutEntity(dest, entity)
+	if hasTTL {
+		db.Expire(dest, expireTime)
+	}
+	db.notifyRename(src, dest)
 	db.addAof(utils.ToCmdLine2("renamenx", args...))
 	return reply.MakeIntReply(1)
 }
 
+// removeForRename 删除 src 和被覆盖的 dest
+func (db *DB) removeForRename(src string, dest string) {
+	db.Remove(src)
+	if dest != src {
+		db.Remove(dest)
+	}
+}
+
+// notifyRename 发布 rename_from 和 rename_to 事件
+func (db *DB) notifyRename(src string, dest string) {
+	db.notify(notifyGeneric, "rename_from", src)
+	db.notify(notifyGeneric, "rename_to", dest)
+}
+
 // execKeys KEYS *列出所有的key
 func execKeys(db *DB, args [][]byte) resp.Reply {
 	pattern := wildcard.CompilePattern(string(args[0]))
 	result := make([][]byte, 0)
 	db.data.ForEach(func(key string, val interface{}) bool {
-		if pattern.IsMatch(key) {
+		if pattern.IsMatch(key) && !db.IsExpired(key) {
 			result = append(result, []byte(key))
 		}
 		return true
@@ -108,12 +208,149 @@ func execKeys(db *DB, args [][]byte) resp.Reply {
 	return reply.MakeMultiBulkReply(result)
 }
 
+// undoDel 恢复被删除的 key
+func undoDel(db *DB, args [][]byte) ([]CmdLine, error) {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return rollbackGivenKeys(db, keys...)
+}
+
+// prepareRename src 会被删除, dest 会被覆盖, 都需要加写锁
+func prepareRename(args [][]byte) ([]string, []string) {
+	src := string(args[0])
+	dest := string(args[1])
+	return []string{src, dest}, nil
+}
+
+func undoRename(db *DB, args [][]byte) ([]CmdLine, error) {
+	src := string(args[0])
+	dest := string(args[1])
+	return rollbackGivenKeys(db, src, dest)
+}
+
+// execDBSize 返回当前 DB 中 key 的数量
+func execDBSize(db *DB, args [][]byte) resp.Reply {
+	return reply.MakeIntReply(int64(db.data.Len()))
+}
+
+// randomKeyMaxTries RANDOMKEY 选中过期 key 时重新选择的次数上限
+const randomKeyMaxTries = 100
+
+// execRandomKey 随机返回一个未过期的 key, 选中的过期 key 会被删除; DB 为空时返回 nil
+func execRandomKey(db *DB, args [][]byte) resp.Reply {
+	for i := 0; i < randomKeyMaxTries && db.data.Len() > 0; i++ {
+		keys := db.data.RandomKeys(1)
+		if len(keys) == 0 {
+			break
+		}
+		if !db.IsExpired(keys[0]) {
+			return reply.MakeBulkReply([]byte(keys[0]))
+		}
+	}
+	return reply.MakeNullBulkReply()
+}
+
+// scanArgs SCAN 系列指令的可选参数
+type scanArgs struct {
+	pattern  *wildcard.Pattern
+	count    int
+	typeName string
+}
+
+const defaultScanCount = 10
+
+// parseScanArgs 解析 [MATCH pattern] [COUNT count] [TYPE type], allowType 表示是否支持 TYPE
+func parseScanArgs(args [][]byte, allowType bool) (*scanArgs, reply.ErrorReply) {
+	result := &scanArgs{
+		count: defaultScanCount,
+	}
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		option := strings.ToLower(string(args[i]))
+		value := string(args[i+1])
+		switch {
+		case option == "match":
+			result.pattern = wildcard.CompilePattern(value)
+		case option == "count":
+			count, err := strconv.Atoi(value)
+			if err != nil || count <= 0 {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			result.count = count
+		case option == "type" && allowType:
+			result.typeName = strings.ToLower(value)
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	return result, nil
+}
+
+// execScan SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+// 游标为 dict 的分段序号, 每次遍历若干个完整的分段; COUNT 只是期望返回的数量
+func execScan(db *DB, args [][]byte) resp.Reply {
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR invalid cursor")
+	}
+	options, errReply := parseScanArgs(args[1:], true)
+	if errReply != nil {
+		return errReply
+	}
+	if cursor > math.MaxInt32 { // 超出分段范围, 视为遍历结束
+		return makeScanReply(0, nil)
+	}
+	keys, next := db.data.Scan(int(cursor), options.count, func(key string, val interface{}) bool {
+		if options.pattern != nil && !options.pattern.IsMatch(key) {
+			return false
+		}
+		if options.typeName != "" && getTypeName(val.(*database.DataEntity)) != options.typeName {
+			return false
+		}
+		return !db.IsExpired(key)
+	})
+	result := make([][]byte, len(keys))
+	for i, key := range keys {
+		result[i] = []byte(key)
+	}
+	return makeScanReply(uint64(next), result)
+}
+
+// makeScanReply SCAN 系列指令的回复: [cursor, [element...]]
+func makeScanReply(cursor uint64, elements [][]byte) resp.Reply {
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(strconv.FormatUint(cursor, 10))),
+		reply.MakeMultiBulkReply(elements),
+	})
+}
+
 func init() {
-	RegisterCommand("Del", execDel, -2)
-	RegisterCommand("Exists", execExists, -2)
-	RegisterCommand("Keys", execKeys, 2)
-	RegisterCommand("FlushDB", execFlushDB, -1)
-	RegisterCommand("Type", execType, 2)
-	RegisterCommand("Rename", execRename, 3)
-	RegisterCommand("RenameNx", execRenameNx, 3)
+	RegisterCommand("Del", execDel, writeAllKeys, undoDel, -2).
+		attachCommandExtra(FlagWrite, 1, -1, 1)
+	RegisterCommand("Unlink", execUnlink, writeAllKeys, undoDel, -2).
+		attachCommandExtra(FlagWrite, 1, -1, 1)
+	RegisterCommand("Exists", execExists, readAllKeys, nil, -2).
+		attachCommandExtra(FlagReadOnly, 1, -1, 1)
+	RegisterCommand("Touch", execTouch, readAllKeys, nil, -2).
+		attachCommandExtra(FlagReadOnly, 1, -1, 1)
+	RegisterCommand("Keys", execKeys, noPrepare, nil, 2).
+		attachCommandExtra(FlagReadOnly, 0, 0, 0)
+	RegisterCommand("FlushDB", execFlushDB, noPrepare, nil, -1).
+		attachCommandExtra(FlagWrite|FlagAdmin, 0, 0, 0)
+	RegisterCommand("Type", execType, readFirstKey, nil, 2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("Rename", execRename, prepareRename, undoRename, 3).
+		attachCommandExtra(FlagWrite, 1, 2, 1)
+	RegisterCommand("RenameNx", execRenameNx, prepareRename, undoRename, 3).
+		attachCommandExtra(FlagWrite, 1, 2, 1)
+	RegisterCommand("DBSize", execDBSize, noPrepare, nil, 1).
+		attachCommandExtra(FlagReadOnly, 0, 0, 0)
+	RegisterCommand("RandomKey", execRandomKey, noPrepare, nil, 1).
+		attachCommandExtra(FlagReadOnly, 0, 0, 0)
+	RegisterCommand("Scan", execScan, noPrepare, nil, -2).
+		attachCommandExtra(FlagReadOnly, 0, 0, 0)
 }
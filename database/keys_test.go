@@ -0,0 +1,30 @@
+package database
+
+import (
+	"GoRedis/interface/database"
+	"GoRedis/resp/reply"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRandomKeySkipsExpired(t *testing.T) {
+	mdb := NewStandaloneDatabase()
+	t.Cleanup(mdb.Close)
+	db := mdb.selectDB(0)
+	for i := 0; i < 20; i++ {
+		key := "expired" + strconv.Itoa(i)
+		db.PutEntity(key, &database.DataEntity{Data: []byte("v")})
+		db.Expire(key, time.Now().Add(-time.Second))
+	}
+	db.PutEntity("k", &database.DataEntity{Data: []byte("v")})
+	for i := 0; i < 10; i++ {
+		if got := string(execRandomKey(db, nil).ToBytes()); got != "$1\r\nk\r\n" {
+			t.Fatalf("got %q", got)
+		}
+	}
+	db.Remove("k")
+	if got := execRandomKey(db, nil).(*reply.BulkReply); got.Arg != nil {
+		t.Errorf("only expired keys: got %q", got.Arg)
+	}
+}
@@ -0,0 +1,621 @@
+package database
+
+import (
+	"GoRedis/datastruct/list"
+	"GoRedis/interface/database"
+	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/reply"
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// getAsList 返回 key 对应的列表, key 不存在时返回 nil
+func (db *DB) getAsList(key string) (*database.DataEntity, list.List, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil, nil
+	}
+	l, ok := entity.Data.(list.List)
+	if !ok {
+		return nil, nil, &reply.WrongTypeErrReply{}
+	}
+	return entity, l, nil
+}
+
+// pushList 把元素依次插入到列表的头部(left)或尾部, 返回插入后的长度
+// key 不存在时, createIfAbsent 为 true 则新建列表, 否则不插入并返回 0
+func (db *DB) pushList(key string, values [][]byte, left bool, createIfAbsent bool) (int, reply.ErrorReply) {
+	entity, l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return 0, errReply
+	}
+	if l == nil && !createIfAbsent {
+		return 0, nil
+	}
+	created := l == nil
+	if created {
+		l = list.Make()
+	}
+	var delta int64
+	for _, value := range values {
+		if left {
+			l.Insert(0, value)
+		} else {
+			l.Add(value)
+		}
+		delta += elementSize(value)
+	}
+	if created {
+		db.PutEntity(key, &database.DataEntity{Data: l})
+	} else {
+		db.growEntity(entity, delta)
+	}
+	// 唤醒阻塞在该 key 上的连接
+	db.blocking.signal(key)
+	return l.Len(), nil
+}
+
+// popList 从列表的头部(left)或尾部弹出一个元素, 列表为空后删除 key; key 不存在时返回 nil
+func (db *DB) popList(key string, left bool) ([]byte, reply.ErrorReply) {
+	entity, l, errReply := db.getAsList(key)
+	if errReply != nil || l == nil {
+		return nil, errReply
+	}
+	var val interface{}
+	if left {
+		val = l.Remove(0)
+	} else {
+		val = l.RemoveLast()
+	}
+	value := val.([]byte)
+	db.growEntity(entity, -elementSize(value))
+	if l.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	return value, nil
+}
+
+func pushEvent(left bool) string {
+	if left {
+		return "lpush"
+	}
+	return "rpush"
+}
+
+func popEvent(left bool) string {
+	if left {
+		return "lpop"
+	}
+	return "rpop"
+}
+
+// normalizeIndex 把负数下标转换为从头开始的下标
+func normalizeIndex(index int64, size int) int64 {
+	if index < 0 {
+		index += int64(size)
+	}
+	return index
+}
+
+/* ---- push ---- */
+
+func execPushGeneric(db *DB, args [][]byte, cmdName string, left bool, createIfAbsent bool) resp.Reply {
+	key := string(args[0])
+	size, errReply := db.pushList(key, args[1:], left, createIfAbsent)
+	if errReply != nil {
+		return errReply
+	}
+	if size > 0 {
+		db.notify(notifyList, pushEvent(left), key)
+		db.addAof(utils.ToCmdLine2(cmdName, args...))
+	}
+	return reply.MakeIntReply(int64(size))
+}
+
+// execLPush LPUSH key element [element ...]
+func execLPush(db *DB, args [][]byte) resp.Reply {
+	return execPushGeneric(db, args, "lpush", true, true)
+}
+
+// execRPush RPUSH key element [element ...]
+func execRPush(db *DB, args [][]byte) resp.Reply {
+	return execPushGeneric(db, args, "rpush", false, true)
+}
+
+// execLPushX LPUSHX key element [element ...]: 仅在 key 存在时插入
+func execLPushX(db *DB, args [][]byte) resp.Reply {
+	return execPushGeneric(db, args, "lpushx", true, false)
+}
+
+// execRPushX RPUSHX key element [element ...]: 仅在 key 存在时插入
+func execRPushX(db *DB, args [][]byte) resp.Reply {
+	return execPushGeneric(db, args, "rpushx", false, false)
+}
+
+/* ---- pop ---- */
+
+// execPopGeneric LPOP/RPOP key [count]
+func execPopGeneric(db *DB, args [][]byte, cmdName string, left bool) resp.Reply {
+	if len(args) > 2 {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	key := string(args[0])
+	if len(args) == 1 {
+		value, errReply := db.popList(key, left)
+		if errReply != nil {
+			return errReply
+		}
+		if value == nil {
+			return reply.MakeNullBulkReply()
+		}
+		db.notify(notifyList, popEvent(left), key)
+		db.addAof(utils.ToCmdLine2(cmdName, args...))
+		return reply.MakeBulkReply(value)
+	}
+
+	count, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || count < 0 {
+		return reply.MakeErrReply("ERR value is out of range, must be positive")
+	}
+	_, l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeNullMultiBulkBytes()
+	}
+	result := make([][]byte, 0)
+	for i := int64(0); i < count; i++ {
+		value, _ := db.popList(key, left)
+		if value == nil {
+			break
+		}
+		result = append(result, value)
+	}
+	if len(result) > 0 {
+		db.notify(notifyList, popEvent(left), key)
+		db.addAof(utils.ToCmdLine2(cmdName, args...))
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execLPop LPOP key [count]
+func execLPop(db *DB, args [][]byte) resp.Reply {
+	return execPopGeneric(db, args, "lpop", true)
+}
+
+// execRPop RPOP key [count]
+func execRPop(db *DB, args [][]byte) resp.Reply {
+	return execPopGeneric(db, args, "rpop", false)
+}
+
+/* ---- 读取 ---- */
+
+// execLLen LLEN key
+func execLLen(db *DB, args [][]byte) resp.Reply {
+	_, l, errReply := db.getAsList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(l.Len()))
+}
+
+// execLIndex LINDEX key index
+func execLIndex(db *DB, args [][]byte) resp.Reply {
+	index, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	_, l, errReply := db.getAsList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeNullBulkReply()
+	}
+	index = normalizeIndex(index, l.Len())
+	if index < 0 || index >= int64(l.Len()) {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeBulkReply(l.Get(int(index)).([]byte))
+}
+
+// execLRange LRANGE key start stop
+func execLRange(db *DB, args [][]byte) resp.Reply {
+	start, err1 := strconv.ParseInt(string(args[1]), 10, 64)
+	stop, err2 := strconv.ParseInt(string(args[2]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	_, l, errReply := db.getAsList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeEmptyMultiBulkBytes()
+	}
+	size := l.Len()
+	start = normalizeIndex(start, size)
+	stop = normalizeIndex(stop, size)
+	if start < 0 {
+		start = 0
+	}
+	if stop >= int64(size) {
+		stop = int64(size) - 1
+	}
+	if start > stop {
+		return reply.MakeEmptyMultiBulkBytes()
+	}
+	values := l.Range(int(start), int(stop)+1)
+	result := make([][]byte, len(values))
+	for i, v := range values {
+		result[i] = v.([]byte)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+/* ---- 修改 ---- */
+
+// execLSet LSET key index element
+func execLSet(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	index, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	entity, l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeErrReply("ERR no such key")
+	}
+	index = normalizeIndex(index, l.Len())
+	if index < 0 || index >= int64(l.Len()) {
+		return reply.MakeErrReply("ERR index out of range")
+	}
+	old := l.Get(int(index)).([]byte)
+	l.Set(int(index), args[2])
+	db.growEntity(entity, elementSize(args[2])-elementSize(old))
+	db.notify(notifyList, "lset", key)
+	db.addAof(utils.ToCmdLine2("lset", args...))
+	return reply.MakeOkReply()
+}
+
+// execLRem LREM key count element: count > 0 从头开始删除, count < 0 从尾开始删除, count = 0 删除全部
+func execLRem(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	count, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	value := args[2]
+	entity, l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeIntReply(0)
+	}
+	expected := func(a interface{}) bool {
+		return bytes.Equal(a.([]byte), value)
+	}
+	var removed int
+	switch {
+	case count == 0:
+		removed = l.RemoveAllByVal(expected)
+	case count > 0:
+		removed = l.RemoveByVal(expected, int(count))
+	default:
+		removed = l.ReverseRemoveByVal(expected, int(-count))
+	}
+	if removed == 0 {
+		return reply.MakeIntReply(0)
+	}
+	db.growEntity(entity, -int64(removed)*elementSize(value))
+	db.notify(notifyList, "lrem", key)
+	if l.Len() == 0 {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	db.addAof(utils.ToCmdLine2("lrem", args...))
+	return reply.MakeIntReply(int64(removed))
+}
+
+// execLTrim LTRIM key start stop: 只保留 [start, stop] 之间的元素
+func execLTrim(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	start, err1 := strconv.ParseInt(string(args[1]), 10, 64)
+	stop, err2 := strconv.ParseInt(string(args[2]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	entity, l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeOkReply()
+	}
+	size := l.Len()
+	start = normalizeIndex(start, size)
+	stop = normalizeIndex(stop, size)
+	if start < 0 {
+		start = 0
+	}
+	if stop >= int64(size) {
+		stop = int64(size) - 1
+	}
+	var delta int64
+	if start > stop {
+		db.Remove(key)
+		db.notify(notifyList, "ltrim", key)
+		db.notify(notifyGeneric, "del", key)
+	} else {
+		for i := int64(0); i < start; i++ {
+			delta -= elementSize(l.Remove(0).([]byte))
+		}
+		for i := stop + 1; i < int64(size); i++ {
+			delta -= elementSize(l.RemoveLast().([]byte))
+		}
+		db.growEntity(entity, delta)
+		db.notify(notifyList, "ltrim", key)
+	}
+	db.addAof(utils.ToCmdLine2("ltrim", args...))
+	return reply.MakeOkReply()
+}
+
+// execLInsert LINSERT key BEFORE|AFTER pivot element
+func execLInsert(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	var before bool
+	switch strings.ToLower(string(args[1])) {
+	case "before":
+		before = true
+	case "after":
+		before = false
+	default:
+		return reply.MakeSyntaxErrReply()
+	}
+	pivot := args[2]
+	value := args[3]
+	entity, l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeIntReply(0)
+	}
+	index := -1
+	l.ForEach(func(i int, v interface{}) bool {
+		if bytes.Equal(v.([]byte), pivot) {
+			index = i
+			return false
+		}
+		return true
+	})
+	if index < 0 {
+		return reply.MakeIntReply(-1)
+	}
+	if !before {
+		index++
+	}
+	l.Insert(index, value)
+	db.growEntity(entity, elementSize(value))
+	db.blocking.signal(key)
+	db.notify(notifyList, "linsert", key)
+	db.addAof(utils.ToCmdLine2("linsert", args...))
+	return reply.MakeIntReply(int64(l.Len()))
+}
+
+/* ---- 在两个列表之间移动 ---- */
+
+func parseListDirection(arg []byte) (left bool, errReply reply.ErrorReply) {
+	switch strings.ToLower(string(arg)) {
+	case "left":
+		return true, nil
+	case "right":
+		return false, nil
+	}
+	return false, reply.MakeSyntaxErrReply()
+}
+
+// moveList 从 src 的一端弹出元素并插入到 dest 的一端; src 不存在时返回 nil
+func (db *DB) moveList(src string, dest string, fromLeft bool, toLeft bool) ([]byte, reply.ErrorReply) {
+	// dest 的类型不对时不能弹出 src 中的元素
+	if _, _, errReply := db.getAsList(dest); errReply != nil {
+		return nil, errReply
+	}
+	value, errReply := db.popList(src, fromLeft)
+	if errReply != nil || value == nil {
+		return nil, errReply
+	}
+	db.notify(notifyList, popEvent(fromLeft), src)
+	if _, errReply := db.pushList(dest, [][]byte{value}, toLeft, true); errReply != nil {
+		return nil, errReply
+	}
+	db.notify(notifyList, pushEvent(toLeft), dest)
+	return value, nil
+}
+
+// execLMove LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func execLMove(db *DB, args [][]byte) resp.Reply {
+	fromLeft, errReply := parseListDirection(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	toLeft, errReply := parseListDirection(args[3])
+	if errReply != nil {
+		return errReply
+	}
+	value, errReply := db.moveList(string(args[0]), string(args[1]), fromLeft, toLeft)
+	if errReply != nil {
+		return errReply
+	}
+	if value == nil {
+		return reply.MakeNullBulkReply()
+	}
+	db.addAof(utils.ToCmdLine2("lmove", args...))
+	return reply.MakeBulkReply(value)
+}
+
+// execRPopLPush RPOPLPUSH source destination: 等同于 LMOVE source destination RIGHT LEFT
+func execRPopLPush(db *DB, args [][]byte) resp.Reply {
+	value, errReply := db.moveList(string(args[0]), string(args[1]), false, true)
+	if errReply != nil {
+		return errReply
+	}
+	if value == nil {
+		return reply.MakeNullBulkReply()
+	}
+	db.addAof(utils.ToCmdLine2("rpoplpush", args...))
+	return reply.MakeBulkReply(value)
+}
+
+/* ---- 阻塞指令 ---- */
+
+// tryBlockingPop BLPOP/BRPOP 的一次尝试: 从第一个非空的列表中弹出元素
+func tryBlockingPop(db *DB, args [][]byte, left bool) (resp.Reply, bool) {
+	keys := args[:len(args)-1]
+	for _, arg := range keys {
+		key := string(arg)
+		value, errReply := db.popList(key, left)
+		if errReply != nil {
+			return errReply, true
+		}
+		if value == nil {
+			continue
+		}
+		db.notify(notifyList, popEvent(left), key)
+		db.addAof(utils.ToCmdLine(popEvent(left), key))
+		return reply.MakeMultiBulkReply([][]byte{arg, value}), true
+	}
+	return nil, false
+}
+
+// tryBLPop BLPOP key [key ...] timeout
+func tryBLPop(db *DB, args [][]byte) (resp.Reply, bool) {
+	return tryBlockingPop(db, args, true)
+}
+
+// tryBRPop BRPOP key [key ...] timeout
+func tryBRPop(db *DB, args [][]byte) (resp.Reply, bool) {
+	return tryBlockingPop(db, args, false)
+}
+
+// tryBLMove BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+func tryBLMove(db *DB, args [][]byte) (resp.Reply, bool) {
+	fromLeft, errReply := parseListDirection(args[2])
+	if errReply != nil {
+		return errReply, true
+	}
+	toLeft, errReply := parseListDirection(args[3])
+	if errReply != nil {
+		return errReply, true
+	}
+	value, errReply := db.moveList(string(args[0]), string(args[1]), fromLeft, toLeft)
+	if errReply != nil {
+		return errReply, true
+	}
+	if value == nil {
+		return nil, false
+	}
+	db.addAof(utils.ToCmdLine2("lmove", args[:4]...))
+	return reply.MakeBulkReply(value), true
+}
+
+// tryBRPopLPush BRPOPLPUSH source destination timeout
+func tryBRPopLPush(db *DB, args [][]byte) (resp.Reply, bool) {
+	value, errReply := db.moveList(string(args[0]), string(args[1]), false, true)
+	if errReply != nil {
+		return errReply, true
+	}
+	if value == nil {
+		return nil, false
+	}
+	db.addAof(utils.ToCmdLine2("rpoplpush", args[:2]...))
+	return reply.MakeBulkReply(value), true
+}
+
+// 阻塞等待的 key
+func waitAllKeys(args [][]byte) []string {
+	keys := make([]string, len(args)-1)
+	for i, arg := range args[:len(args)-1] {
+		keys[i] = string(arg)
+	}
+	return keys
+}
+
+func waitFirstKey(args [][]byte) []string {
+	return []string{string(args[0])}
+}
+
+// prepareBlockingPop BLPOP/BRPOP 的最后一个参数是超时时间
+func prepareBlockingPop(args [][]byte) ([]string, []string) {
+	return waitAllKeys(args), nil
+}
+
+func undoBlockingPop(db *DB, args [][]byte) ([]CmdLine, error) {
+	return rollbackGivenKeys(db, waitAllKeys(args)...)
+}
+
+// prepareMoveList source 和 destination 都会被修改
+func prepareMoveList(args [][]byte) ([]string, []string) {
+	return []string{string(args[0]), string(args[1])}, nil
+}
+
+func undoMoveList(db *DB, args [][]byte) ([]CmdLine, error) {
+	return rollbackGivenKeys(db, string(args[0]), string(args[1]))
+}
+
+func init() {
+	RegisterCommand("LPush", execLPush, writeFirstKey, rollbackFirstKey, -3).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("RPush", execRPush, writeFirstKey, rollbackFirstKey, -3).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("LPushX", execLPushX, writeFirstKey, rollbackFirstKey, -3).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("RPushX", execRPushX, writeFirstKey, rollbackFirstKey, -3).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("LPop", execLPop, writeFirstKey, rollbackFirstKey, -2).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("RPop", execRPop, writeFirstKey, rollbackFirstKey, -2).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("LLen", execLLen, readFirstKey, nil, 2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("LIndex", execLIndex, readFirstKey, nil, 3).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("LRange", execLRange, readFirstKey, nil, 4).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("LSet", execLSet, writeFirstKey, rollbackFirstKey, 4).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("LRem", execLRem, writeFirstKey, rollbackFirstKey, 4).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("LTrim", execLTrim, writeFirstKey, rollbackFirstKey, 4).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("LInsert", execLInsert, writeFirstKey, rollbackFirstKey, 5).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("LMove", execLMove, prepareMoveList, undoMoveList, 5).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 2, 1)
+	RegisterCommand("RPopLPush", execRPopLPush, prepareMoveList, undoMoveList, 3).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 2, 1)
+
+	registerBlockingCommand("BLPop", tryBLPop, waitAllKeys, lastArgTimeout, reply.MakeNullMultiBulkBytes(), true,
+		prepareBlockingPop, undoBlockingPop, -3).
+		attachCommandExtra(FlagWrite, 1, -2, 1)
+	registerBlockingCommand("BRPop", tryBRPop, waitAllKeys, lastArgTimeout, reply.MakeNullMultiBulkBytes(), true,
+		prepareBlockingPop, undoBlockingPop, -3).
+		attachCommandExtra(FlagWrite, 1, -2, 1)
+	registerBlockingCommand("BLMove", tryBLMove, waitFirstKey, lastArgTimeout, reply.MakeNullBulkReply(), true,
+		prepareMoveList, undoMoveList, 6).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 2, 1)
+	registerBlockingCommand("BRPopLPush", tryBRPopLPush, waitFirstKey, lastArgTimeout, reply.MakeNullBulkReply(), true,
+		prepareMoveList, undoMoveList, 4).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 2, 1)
+}
@@ -0,0 +1,321 @@
+package database
+
+/*内存统计与 maxmemory 淘汰策略*/
+
+import (
+	"GoRedis/config"
+	"GoRedis/datastruct/hash"
+	"GoRedis/datastruct/jsondoc"
+	"GoRedis/datastruct/list"
+	"GoRedis/datastruct/set"
+	"GoRedis/datastruct/sortedset"
+	"GoRedis/datastruct/stream"
+	"GoRedis/interface/database"
+	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/reply"
+	"math"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 内存淘汰策略
+const (
+	policyNoEviction     = "noeviction"
+	policyAllKeysLRU     = "allkeys-lru"
+	policyAllKeysLFU     = "allkeys-lfu"
+	policyAllKeysRandom  = "allkeys-random"
+	policyVolatileLRU    = "volatile-lru"
+	policyVolatileLFU    = "volatile-lfu"
+	policyVolatileRandom = "volatile-random"
+	policyVolatileTTL    = "volatile-ttl"
+)
+
+const (
+	defaultMaxMemorySamples = 5
+	entityOverhead          = 64 // 每个 key 额外占用内存的估算值: dict 节点、DataEntity 等
+	elementOverhead         = 32 // 集合类型中每个元素额外占用内存的估算值: 链表节点等
+
+	lfuInitVal   = 5 // 新写入的 key 的访问计数, 避免刚写入就被淘汰
+	lfuLogFactor = 10
+	lfuDecayTime = time.Minute // 每空闲一个周期访问计数减一
+)
+
+var errOOM = reply.MakeErrReply("OOM command not allowed when used memory > 'maxmemory'")
+
+/* ---- 内存统计 ---- */
+
+// estimateSize 估算 key 的内存占用
+func estimateSize(key string, entity *database.DataEntity) int64 {
+	size := int64(len(key)) + entityOverhead
+	switch val := entity.Data.(type) {
+	case []byte:
+		size += int64(len(val))
+	case list.List:
+		val.ForEach(func(i int, v interface{}) bool {
+			size += elementSize(v.([]byte))
+			return true
+		})
+	case *stream.Stream:
+		val.ForEach(func(entry *stream.Entry) bool {
+			size += entrySize(entry)
+			return true
+		})
+		for _, g := range val.Groups() {
+			size += groupSize(g)
+		}
+	case *set.Set:
+		val.ForEach(func(member string) bool {
+			size += memberSize(member)
+			return true
+		})
+	case *hash.Hash:
+		val.ForEach(func(field string, value []byte) bool {
+			size += fieldSize(field, value)
+			return true
+		})
+	case *sortedset.SortedSet:
+		val.ForEachByRank(0, int64(val.Len()), false, func(element *sortedset.Element) bool {
+			size += memberSize(element.Member)
+			return true
+		})
+	case *jsondoc.Value:
+		val.Walk(func(key string, node *jsondoc.Value) {
+			size += int64(len(key)) + elementOverhead
+			if node.Kind() == jsondoc.String {
+				size += int64(node.Len())
+			}
+		})
+	default:
+		size += entityOverhead
+	}
+	return size
+}
+
+// elementSize 估算集合类型中一个元素的内存占用
+func elementSize(element []byte) int64 {
+	return int64(len(element)) + elementOverhead
+}
+
+// growEntity 原地修改 value 之后调整内存占用, delta 为负数时表示减少
+func (db *DB) growEntity(entity *database.DataEntity, delta int64) {
+	atomic.AddInt64(&entity.Size, delta)
+	atomic.AddInt64(&db.usedMemory, delta)
+}
+
+// prepareEntity 写入前计算内存占用并初始化访问信息; old 为 key 原来的 value
+func (db *DB) prepareEntity(key string, entity *database.DataEntity, old interface{}) {
+	if old == entity { // 原地修改后重新写入, 先扣除修改前的内存占用
+		atomic.AddInt64(&db.usedMemory, -entity.Size)
+	}
+	entity.Size = estimateSize(key, entity)
+	atomic.StoreInt64(&entity.AccessTime, nowMillis())
+	if atomic.LoadUint32(&entity.Freq) == 0 {
+		atomic.StoreUint32(&entity.Freq, lfuInitVal)
+	}
+}
+
+// releaseEntity entity 被删除后扣除其内存占用
+func (db *DB) releaseEntity(entity *database.DataEntity) {
+	atomic.AddInt64(&db.usedMemory, -entity.Size)
+}
+
+// replaceEntity old 被新的 entity 覆盖
+func (db *DB) replaceEntity(old *database.DataEntity, entity *database.DataEntity) {
+	if old == entity {
+		return
+	}
+	db.releaseEntity(old)
+}
+
+// UsedMemory 返回 DB 估算的内存占用
+func (db *DB) UsedMemory() int64 {
+	return atomic.LoadInt64(&db.usedMemory)
+}
+
+/* ---- 访问信息 ---- */
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// touchEntity 更新 key 的访问时间和 LFU 计数
+func touchEntity(entity *database.DataEntity) {
+	now := nowMillis()
+	counter := lfuDecr(entity, now)
+	atomic.StoreUint32(&entity.Freq, lfuLogIncr(counter))
+	atomic.StoreInt64(&entity.AccessTime, now)
+}
+
+// lfuDecr 根据空闲时间衰减后的访问计数
+func lfuDecr(entity *database.DataEntity, now int64) uint32 {
+	counter := atomic.LoadUint32(&entity.Freq)
+	periods := uint32((now - atomic.LoadInt64(&entity.AccessTime)) / int64(lfuDecayTime/time.Millisecond))
+	if periods >= counter {
+		return 0
+	}
+	return counter - periods
+}
+
+// lfuLogIncr 与 redis 相同的对数计数器: 计数越大, 递增的概率越小
+func lfuLogIncr(counter uint32) uint32 {
+	if counter >= math.MaxUint8 {
+		return math.MaxUint8
+	}
+	base := float64(0)
+	if counter > lfuInitVal {
+		base = float64(counter - lfuInitVal)
+	}
+	p := 1.0 / (base*lfuLogFactor + 1)
+	if rand.Float64() < p {
+		counter++
+	}
+	return counter
+}
+
+/* ---- 淘汰 ---- */
+
+// UsedMemory 返回所有 DB 估算的内存占用之和
+func (mdb *StandaloneDatabase) UsedMemory() int64 {
+	var used int64
+	for i := range mdb.dbSet {
+		used += mdb.selectDB(i).UsedMemory()
+	}
+	return used
+}
+
+func getMaxMemoryPolicy() string {
+	policy := strings.ToLower(config.Properties.MaxMemoryPolicy)
+	if policy == "" {
+		return policyNoEviction
+	}
+	return policy
+}
+
+// checkMemory 内存超过上限时先按策略淘汰 key; 仍然超过上限时拒绝可能增加内存占用的指令
+func (mdb *StandaloneDatabase) checkMemory(c resp.Connection, cmdName string) resp.Reply {
+	if config.Properties.MaxMemory <= 0 {
+		return nil
+	}
+	if mdb.freeMemoryIfNeeded() {
+		return nil
+	}
+	denyOOM := false
+	switch {
+	case cmdName == "exec" && c.InMultiState(): // 事务中有任何一条指令会增加内存都拒绝整个事务
+		for _, cmdLine := range c.GetQueuedCmdLine() {
+			if isDenyOOMCommand(strings.ToLower(string(cmdLine[0]))) {
+				denyOOM = true
+				break
+			}
+		}
+	case c.InMultiState(): // 入队时不检查
+	default:
+		denyOOM = isDenyOOMCommand(cmdName)
+	}
+	if denyOOM {
+		return errOOM
+	}
+	return nil
+}
+
+func isDenyOOMCommand(cmdName string) bool {
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		cmd, ok = serverCmdTable[cmdName]
+	}
+	return ok && cmd.flags&FlagDenyOOM != 0
+}
+
+// freeMemoryIfNeeded 淘汰 key 直到内存低于上限, 返回是否低于上限
+func (mdb *StandaloneDatabase) freeMemoryIfNeeded() bool {
+	maxMemory := int64(config.Properties.MaxMemory)
+	if mdb.UsedMemory() <= maxMemory {
+		return true
+	}
+	policy := getMaxMemoryPolicy()
+	if policy == policyNoEviction {
+		return false
+	}
+	// 避免多个连接同时淘汰, 淘汰掉超出预期的 key
+	mdb.evictionMu.Lock()
+	defer mdb.evictionMu.Unlock()
+	for mdb.UsedMemory() > maxMemory {
+		db, key, ok := mdb.pickEvictionKey(policy)
+		if !ok { // 没有可以淘汰的 key, 如 volatile 策略下没有设置过期时间的 key
+			return false
+		}
+		db.evict(key)
+	}
+	return true
+}
+
+// pickEvictionKey 从每个 DB 中采样若干 key, 按策略选出最应该被淘汰的 key
+func (mdb *StandaloneDatabase) pickEvictionKey(policy string) (*DB, string, bool) {
+	samples := config.Properties.MaxMemorySamples
+	if samples <= 0 {
+		samples = defaultMaxMemorySamples
+	}
+	volatile := strings.HasPrefix(policy, "volatile-")
+	now := nowMillis()
+
+	var bestDB *DB
+	var bestKey string
+	var bestScore float64
+	// 随机策略从随机的 DB 开始, 选中第一个采样到的 key
+	offset := 0
+	if policy == policyAllKeysRandom || policy == policyVolatileRandom {
+		offset = rand.Intn(len(mdb.dbSet))
+	}
+	for i := range mdb.dbSet {
+		db := mdb.selectDB((i + offset) % len(mdb.dbSet))
+		var keys []string
+		if volatile {
+			keys = db.ttlMap.RandomDistinctKeys(samples)
+		} else {
+			keys = db.data.RandomDistinctKeys(samples)
+		}
+		for _, key := range keys {
+			raw, ok := db.data.Get(key)
+			if !ok {
+				continue
+			}
+			entity := raw.(*database.DataEntity)
+			var score float64 // 越大越应该被淘汰
+			switch policy {
+			case policyAllKeysLRU, policyVolatileLRU:
+				score = float64(now - atomic.LoadInt64(&entity.AccessTime))
+			case policyAllKeysLFU, policyVolatileLFU:
+				score = float64(math.MaxUint8 - lfuDecr(entity, now))
+			case policyVolatileTTL:
+				expireTime, ok := db.getExpireTime(key)
+				if !ok {
+					continue
+				}
+				score = -float64(expireTime.UnixNano())
+			default: // random
+				return db, key, true
+			}
+			if bestDB == nil || score > bestScore {
+				bestDB, bestKey, bestScore = db, key, score
+			}
+		}
+	}
+	return bestDB, bestKey, bestDB != nil
+}
+
+// evict 持有 key 的写锁淘汰 key, 并以 DEL 的形式记录到 aof
+// 调用方(checkMemory)在执行指令之前调用, 不持有任何 key 的锁
+func (db *DB) evict(key string) {
+	db.RWLocks([]string{key}, nil)
+	defer db.RWUnLocks([]string{key}, nil)
+	// 采样之后 key 可能已经被其他协程删除
+	if !db.remove(key) {
+		return
+	}
+	db.notify(notifyEvicted, "evicted", key)
+	db.tracking.invalidate([]string{key}, nil)
+	db.addAof(utils.ToCmdLine("DEL", key))
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"GoRedis/interface/database"
+	"testing"
+	"time"
+)
+
+func TestEvictWaitsForKeyLock(t *testing.T) {
+	mdb := NewStandaloneDatabase()
+	t.Cleanup(mdb.Close)
+	db := mdb.selectDB(0)
+	db.PutEntity("k", &database.DataEntity{Data: []byte("v")})
+	// 执行中的指令持有 key 的锁时, 淘汰需要等待指令结束
+	db.RWLocks([]string{"k"}, nil)
+	done := make(chan struct{})
+	go func() {
+		db.evict("k")
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("evicted a locked key")
+	case <-time.After(50 * time.Millisecond):
+	}
+	db.RWUnLocks([]string{"k"}, nil)
+	<-done
+	if _, ok := db.GetEntity("k"); ok {
+		t.Error("key not evicted")
+	}
+	// 已经被删除的 key 不再重复淘汰
+	db.evict("k")
+}
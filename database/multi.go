@@ -0,0 +1,104 @@
+package database
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/resp/reply"
+	"strings"
+)
+
+// StartMulti 开启 MULTI 事务
+func StartMulti(conn resp.Connection) resp.Reply {
+	if conn.InMultiState() {
+		return reply.MakeErrReply("ERR MULTI calls can not be nested")
+	}
+	conn.SetMultiState(true)
+	return reply.MakeOkReply()
+}
+
+// EnqueueCmd MULTI 状态下指令入队, 入队前检查指令是否合法
+func EnqueueCmd(conn resp.Connection, cmdLine [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		return reply.MakeErrReply("ERR unknown command '" + cmdName + "'")
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	conn.EnqueueCmd(cmdLine)
+	return reply.MakeQueuedReply()
+}
+
+// DiscardMulti 放弃 MULTI 事务
+func DiscardMulti(conn resp.Connection) resp.Reply {
+	if !conn.InMultiState() {
+		return reply.MakeErrReply("ERR DISCARD without MULTI")
+	}
+	conn.ClearQueuedCmds()
+	conn.SetMultiState(false)
+	return reply.MakeOkReply()
+}
+
+// execMulti 执行 EXEC, 依次执行队列中的指令
+func execMulti(db *DB, conn resp.Connection) resp.Reply {
+	if !conn.InMultiState() {
+		return reply.MakeErrReply("ERR EXEC without MULTI")
+	}
+	defer conn.SetMultiState(false)
+	cmdLines := conn.GetQueuedCmdLine()
+	for _, cmdLine := range cmdLines {
+		db.trackCommand(conn, cmdLine)
+	}
+	result := db.ExecMulti(cmdLines)
+	for _, cmdLine := range cmdLines {
+		db.invalidateCommand(conn, cmdLine)
+	}
+	return result
+}
+
+// ExecMulti 在持有所有相关 key 的锁的情况下依次执行指令, 执行期间其它事务无法读写这些 key
+func (db *DB) ExecMulti(cmdLines []CmdLine) resp.Reply {
+	writeKeys := make([]string, 0) // 可能包含重复的 key
+	readKeys := make([]string, 0)
+	for _, cmdLine := range cmdLines {
+		write, read := GetRelatedKeys(cmdLine)
+		writeKeys = append(writeKeys, write...)
+		readKeys = append(readKeys, read...)
+	}
+	db.RWLocks(writeKeys, readKeys)
+	defer db.RWUnLocks(writeKeys, readKeys)
+
+	results := make([]resp.Reply, 0, len(cmdLines))
+	for _, cmdLine := range cmdLines {
+		results = append(results, db.execWithLock(cmdLine))
+	}
+	return reply.MakeMultiRawReply(results)
+}
+
+// GetRelatedKeys 返回指令需要加写锁和读锁的 key; 指令不存在或参数个数错误时返回 nil
+func GetRelatedKeys(cmdLine [][]byte) ([]string, []string) {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok || !validateArity(cmd.arity, cmdLine) {
+		return nil, nil
+	}
+	prepare := cmd.prepare
+	if prepare == nil {
+		return nil, nil
+	}
+	return prepare(cmdLine[1:])
+}
+
+// GetUndoLogs 返回撤销指令所需的回滚指令, 必须在指令执行前调用
+func (db *DB) GetUndoLogs(cmdLine [][]byte) ([]CmdLine, error) {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		return nil, nil
+	}
+	undo := cmd.undo
+	if undo == nil {
+		return nil, nil
+	}
+	return undo(db, cmdLine[1:])
+}
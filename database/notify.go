@@ -0,0 +1,106 @@
+package database
+
+/*键空间通知: notify-keyspace-events*/
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+)
+
+// 键空间通知的事件类型, 与 redis 的 notify-keyspace-events 相同
+const (
+	notifyKeyspace = 1 << iota // K: 发布到 __keyspace@<db>__:<key>
+	notifyKeyevent             // E: 发布到 __keyevent@<db>__:<event>
+	notifyGeneric              // g: DEL、EXPIRE、RENAME 等通用指令
+	notifyString               // $: 字符串指令
+	notifyList                 // l
+	notifySet                  // s
+	notifyHash                 // h
+	notifyZSet                 // z
+	notifyExpired              // x: key 过期
+	notifyEvicted              // e: key 被内存淘汰
+	notifyStream               // t
+	notifyKeyMiss              // m: 读取不存在的 key
+	notifyNew                  // n: 新增 key
+	notifyModule               // d: 模块类型的指令, 如 JSON
+
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash |
+		notifyZSet | notifyExpired | notifyEvicted | notifyStream | notifyModule // A
+)
+
+var errInvalidNotifyFlags = errors.New("ERR Invalid argument")
+
+// notifyFlags 当前生效的事件类型, 原子操作; CONFIG SET 时更新
+var notifyFlags int32
+
+// parseNotifyFlags 把 notify-keyspace-events 的字符串解析为事件类型
+func parseNotifyFlags(str string) (int, error) {
+	flags := 0
+	for _, c := range str {
+		switch c {
+		case 'A':
+			flags |= notifyAll
+		case 'g':
+			flags |= notifyGeneric
+		case '$':
+			flags |= notifyString
+		case 'l':
+			flags |= notifyList
+		case 's':
+			flags |= notifySet
+		case 'h':
+			flags |= notifyHash
+		case 'z':
+			flags |= notifyZSet
+		case 'x':
+			flags |= notifyExpired
+		case 'e':
+			flags |= notifyEvicted
+		case 't':
+			flags |= notifyStream
+		case 'm':
+			flags |= notifyKeyMiss
+		case 'd':
+			flags |= notifyModule
+		case 'n':
+			flags |= notifyNew
+		case 'K':
+			flags |= notifyKeyspace
+		case 'E':
+			flags |= notifyKeyevent
+		default:
+			return 0, errInvalidNotifyFlags
+		}
+	}
+	return flags, nil
+}
+
+// setNotifyFlags 解析并应用 notify-keyspace-events
+func setNotifyFlags(str string) error {
+	flags, err := parseNotifyFlags(str)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&notifyFlags, int32(flags))
+	return nil
+}
+
+// notify 发布键空间通知; 没有开启该类型的事件或没有订阅者时直接返回
+func (db *DB) notify(class int, event string, key string) {
+	flags := int(atomic.LoadInt32(&notifyFlags))
+	if flags&class == 0 || flags&(notifyKeyspace|notifyKeyevent) == 0 {
+		return
+	}
+	hub := db.hub
+	if hub == nil || !hub.HasSubscribers() {
+		return
+	}
+	dbIndex := strconv.Itoa(db.getIndex())
+	if flags&notifyKeyspace != 0 {
+		hub.Publish("__keyspace@"+dbIndex+"__:"+key, []byte(event))
+	}
+	if flags&notifyKeyevent != 0 {
+		hub.Publish("__keyevent@"+dbIndex+"__:"+event, []byte(key))
+	}
+}
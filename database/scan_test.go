@@ -0,0 +1,90 @@
+package database
+
+import (
+	"GoRedis/resp/connection"
+	"GoRedis/resp/reply"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scanAll 按游标遍历直到返回 0, 返回所有元素; pairs 为 true 时元素后跟随 value
+func scanAll(t *testing.T, mdb *StandaloneDatabase, conn *connection.Connection, cmd string, pairs bool) map[string]string {
+	t.Helper()
+	result := make(map[string]string)
+	cursor := "0"
+	for calls := 0; ; calls++ {
+		if calls > 100 {
+			t.Fatal("scan did not finish")
+		}
+		r, ok := mdb.Exec(conn, toArgs(strings.Replace(cmd, "CURSOR", cursor, 1))).(*reply.MultiRawReply)
+		if !ok {
+			t.Fatalf("%s: unexpected reply", cmd)
+		}
+		cursor = string(r.Replies[0].(*reply.BulkReply).Arg)
+		elements := r.Replies[1].(*reply.MultiBulkReply).Args
+		step := 1
+		if pairs {
+			step = 2
+		}
+		for i := 0; i < len(elements); i += step {
+			if _, ok := result[string(elements[i])]; ok {
+				t.Errorf("%s returned %s twice", cmd, elements[i])
+			}
+			result[string(elements[i])] = ""
+			if pairs {
+				result[string(elements[i])] = string(elements[i+1])
+			}
+		}
+		if cursor == "0" {
+			return result
+		}
+	}
+}
+
+func TestCollectionScan(t *testing.T) {
+	mdb := NewStandaloneDatabase()
+	t.Cleanup(mdb.Close)
+	conn := &connection.Connection{}
+	conn.SelectDB(0)
+	for i := 0; i < 200; i++ {
+		n := strconv.Itoa(i)
+		mdb.Exec(conn, toArgs("sadd s m"+n))
+		mdb.Exec(conn, toArgs("hset h m"+n+" v"+n))
+		mdb.Exec(conn, toArgs("zadd z "+n+" m"+n))
+	}
+	tests := []struct {
+		cmd   string
+		pairs bool
+		value func(n string) string
+	}{
+		{"sscan s CURSOR match m1* count 5", false, func(string) string { return "" }},
+		{"hscan h CURSOR match m1* count 5", true, func(n string) string { return "v" + n }},
+		{"zscan z CURSOR match m1* count 5", true, func(n string) string { return n }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			got := scanAll(t, mdb, conn, tt.cmd, tt.pairs)
+			// m1, m10..m19, m100..m199
+			if len(got) != 111 {
+				t.Errorf("got %d elements, want 111", len(got))
+			}
+			for member, value := range got {
+				n := strings.TrimPrefix(member, "m")
+				if !strings.HasPrefix(n, "1") || value != tt.value(n) {
+					t.Errorf("unexpected element %s %s", member, value)
+				}
+			}
+		})
+	}
+	// 不存在的 key 直接结束遍历, 类型错误时返回 WRONGTYPE
+	if got := string(mdb.Exec(conn, toArgs("sscan missing 0")).ToBytes()); got != "*2\r\n$1\r\n0\r\n*0\r\n" {
+		t.Errorf("missing key: got %q", got)
+	}
+	if got := string(mdb.Exec(conn, toArgs("hscan s 0")).ToBytes()); !strings.HasPrefix(got, "-WRONGTYPE") {
+		t.Errorf("wrong type: got %q", got)
+	}
+	if got := string(mdb.Exec(conn, toArgs("sscan s 0 type set")).ToBytes()); !strings.HasPrefix(got, "-") {
+		t.Errorf("type option: got %q", got)
+	}
+}
@@ -0,0 +1,363 @@
+package database
+
+/*Lua 脚本: EVAL、EVALSHA、SCRIPT, 函数见 function.go
+脚本执行期间持有 KEYS 中所有 key 的写锁, 其它连接无法读写这些 key, 因此脚本只能访问 KEYS 中声明的 key
+脚本中执行的写指令各自写入 aof, 重放时不会再次执行脚本*/
+
+import (
+	"GoRedis/config"
+	"GoRedis/interface/resp"
+	"GoRedis/resp/reply"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+const defaultLuaTimeLimit = 5000 // 毫秒
+
+func luaTimeLimit() time.Duration {
+	if config.Properties.LuaTimeLimit > 0 {
+		return time.Duration(config.Properties.LuaTimeLimit) * time.Millisecond
+	}
+	return defaultLuaTimeLimit * time.Millisecond
+}
+
+var (
+	errNoScript      = reply.MakeErrReply("NOSCRIPT No matching script. Please use EVAL.")
+	errScriptBusy    = reply.MakeErrReply("BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE.")
+	errScriptKilled  = reply.MakeErrReply("ERR Script killed by user with SCRIPT KILL...")
+	errNotBusy       = reply.MakeErrReply("NOTBUSY No scripts in execution right now.")
+	errReadOnlyWrite = reply.MakeErrReply("ERR Write commands are not allowed from read-only scripts.")
+	errUnkillable    = reply.MakeErrReply("UNKILLABLE Sorry the script already executed write commands against the dataset. " +
+		"You can either wait the script termination or kill the server in a hard way using the SHUTDOWN NOSAVE command.")
+)
+
+// scriptEngine 脚本缓存与正在执行的脚本, 由所有 DB 共享
+type scriptEngine struct {
+	mu      sync.RWMutex
+	scripts map[string]*lua.FunctionProto // sha1 -> 编译后的脚本
+
+	runningMu    sync.Mutex
+	running      map[*scriptRun]struct{}
+	runningCount int32 // 正在执行的脚本数量, 原子操作; 为 0 时无需检查是否超时
+
+	vms        sync.Pool    // *luaVM, 复用 Lua 虚拟机
+	usedMemory func() int64 // 返回所有 DB 的内存占用, 用于脚本中的 OOM 检查
+
+	functions functionRegistry // FUNCTION LOAD 加载的函数库
+}
+
+func makeScriptEngine(usedMemory func() int64) *scriptEngine {
+	engine := &scriptEngine{
+		scripts:    make(map[string]*lua.FunctionProto),
+		running:    make(map[*scriptRun]struct{}),
+		usedMemory: usedMemory,
+		functions:  makeFunctionRegistry(),
+	}
+	engine.vms.New = func() interface{} {
+		return newLuaVM()
+	}
+	return engine
+}
+
+// scriptRun 一次脚本执行
+type scriptRun struct {
+	engine   *scriptEngine
+	db       *DB
+	keys     map[string]struct{} // KEYS 中声明的 key
+	readOnly bool                // 只读脚本不能执行写指令
+	start    time.Time
+	cancel   context.CancelFunc
+	// 以下字段由 engine.runningMu 保护
+	written bool // 执行过写指令之后不能被 SCRIPT KILL 终止
+	killed  bool
+}
+
+func sha1Hex(body []byte) string {
+	sum := sha1.Sum(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// get 返回缓存中的脚本, 不存在时返回 nil
+func (engine *scriptEngine) get(sha string) *lua.FunctionProto {
+	engine.mu.RLock()
+	defer engine.mu.RUnlock()
+	return engine.scripts[sha]
+}
+
+// load 编译脚本并加入缓存, 已经缓存的脚本不会重复编译
+func (engine *scriptEngine) load(sha string, body []byte) (*lua.FunctionProto, reply.ErrorReply) {
+	if proto := engine.get(sha); proto != nil {
+		return proto, nil
+	}
+	chunk, err := parse.Parse(bytes.NewReader(body), "user_script")
+	if err != nil {
+		return nil, reply.MakeErrReply("ERR Error compiling script (new function): " + singleLine(err.Error()))
+	}
+	proto, err := lua.Compile(chunk, "user_script")
+	if err != nil {
+		return nil, reply.MakeErrReply("ERR Error compiling script (new function): " + singleLine(err.Error()))
+	}
+	engine.mu.Lock()
+	engine.scripts[sha] = proto
+	engine.mu.Unlock()
+	return proto, nil
+}
+
+func (engine *scriptEngine) flush() {
+	engine.mu.Lock()
+	engine.scripts = make(map[string]*lua.FunctionProto)
+	engine.mu.Unlock()
+}
+
+// checkBusy 有脚本的执行时间超过 lua-time-limit 时, 除 SCRIPT KILL、FUNCTION KILL 以外的指令都返回 BUSY
+func (engine *scriptEngine) checkBusy(cmdLine [][]byte) reply.ErrorReply {
+	if atomic.LoadInt32(&engine.runningCount) == 0 {
+		return nil
+	}
+	if len(cmdLine) == 2 && strings.EqualFold(string(cmdLine[1]), "kill") {
+		cmdName := strings.ToLower(string(cmdLine[0]))
+		if cmdName == "script" || cmdName == "function" {
+			return nil
+		}
+	}
+	limit := luaTimeLimit()
+	engine.runningMu.Lock()
+	defer engine.runningMu.Unlock()
+	for run := range engine.running {
+		if time.Since(run.start) > limit {
+			return errScriptBusy
+		}
+	}
+	return nil
+}
+
+// kill 终止所有没有执行过写指令的脚本
+func (engine *scriptEngine) kill() resp.Reply {
+	engine.runningMu.Lock()
+	defer engine.runningMu.Unlock()
+	if len(engine.running) == 0 {
+		return errNotBusy
+	}
+	killed := 0
+	for run := range engine.running {
+		if run.written {
+			continue
+		}
+		run.killed = true
+		run.cancel()
+		killed++
+	}
+	if killed == 0 {
+		return errUnkillable
+	}
+	return reply.MakeOkReply()
+}
+
+// scriptCall 在虚拟机中执行脚本或函数
+type scriptCall func(vm *luaVM, run *scriptRun, ctx context.Context) (resp.Reply, error)
+
+// run 执行脚本或函数, name 用于错误信息; 调用方已经持有 KEYS 的锁
+func (engine *scriptEngine) run(db *DB, name string, keys [][]byte, readOnly bool, call scriptCall) resp.Reply {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	run := &scriptRun{
+		engine:   engine,
+		db:       db,
+		keys:     make(map[string]struct{}, len(keys)),
+		readOnly: readOnly,
+		start:    time.Now(),
+		cancel:   cancel,
+	}
+	for _, key := range keys {
+		run.keys[string(key)] = struct{}{}
+	}
+	engine.runningMu.Lock()
+	engine.running[run] = struct{}{}
+	atomic.AddInt32(&engine.runningCount, 1)
+	engine.runningMu.Unlock()
+	defer func() {
+		engine.runningMu.Lock()
+		delete(engine.running, run)
+		atomic.AddInt32(&engine.runningCount, -1)
+		engine.runningMu.Unlock()
+	}()
+
+	vm := engine.vms.Get().(*luaVM)
+	result, err := call(vm, run, ctx)
+	engine.runningMu.Lock()
+	killed := run.killed
+	engine.runningMu.Unlock()
+	if killed {
+		// 被中断的虚拟机状态不确定, 不再复用
+		vm.L.Close()
+		return errScriptKilled
+	}
+	engine.vms.Put(vm)
+	if err != nil {
+		return makeScriptErrReply(err, name)
+	}
+	return result
+}
+
+// exec 在脚本中执行一条指令, 调用方已经持有 KEYS 的锁
+func (run *scriptRun) exec(cmdLine [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok || cmd.flags&FlagInternal != 0 {
+		return reply.MakeErrReply("ERR Unknown Redis command called from script")
+	}
+	switch cmdName {
+	case "eval", "evalsha", "script", "function", "fcall", "fcall_ro":
+		return reply.MakeErrReply("ERR This Redis command is not allowed from script")
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		return reply.MakeErrReply("ERR Wrong number of args calling Redis command from script")
+	}
+	writeKeys, readKeys := GetRelatedKeys(cmdLine)
+	for _, keys := range [][]string{writeKeys, readKeys} {
+		for _, key := range keys {
+			if _, ok := run.keys[key]; !ok {
+				return reply.MakeErrReply("ERR Script attempted to access key '" + key + "' which is not declared in KEYS")
+			}
+		}
+	}
+	if run.readOnly && cmd.flags&FlagWrite != 0 {
+		return errReadOnlyWrite
+	}
+	engine := run.engine
+	engine.runningMu.Lock()
+	written := run.written
+	if cmd.flags&FlagWrite != 0 {
+		run.written = true
+	}
+	engine.runningMu.Unlock()
+	// 与 redis 相同, 只在脚本第一次写入之前检查内存, 避免脚本只执行了一部分写指令
+	if cmd.flags&FlagDenyOOM != 0 && !written && config.Properties.MaxMemory > 0 &&
+		engine.usedMemory() > int64(config.Properties.MaxMemory) {
+		return errOOM
+	}
+	return run.db.execWithLock(cmdLine)
+}
+
+// parseScriptKeys 解析 numkeys 以及之后的 KEYS 和 ARGV
+func parseScriptKeys(args [][]byte) (keys [][]byte, argv [][]byte, errReply reply.ErrorReply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if numKeys < 0 {
+		return nil, nil, reply.MakeErrReply("ERR Number of keys can't be negative")
+	}
+	if numKeys > len(args)-1 {
+		return nil, nil, reply.MakeErrReply("ERR Number of keys can't be greater than number of args")
+	}
+	return args[1 : 1+numKeys], args[1+numKeys:], nil
+}
+
+// execEval EVAL script numkeys [key ...] [arg ...]
+func execEval(db *DB, args [][]byte) resp.Reply {
+	sha := sha1Hex(args[0])
+	proto, errReply := db.scripts.load(sha, args[0])
+	if errReply != nil {
+		return errReply
+	}
+	return db.scripts.runScript(db, sha, proto, args[1:])
+}
+
+// execEvalSha EVALSHA sha1 numkeys [key ...] [arg ...]
+func execEvalSha(db *DB, args [][]byte) resp.Reply {
+	sha := strings.ToLower(string(args[0]))
+	proto := db.scripts.get(sha)
+	if proto == nil {
+		return errNoScript
+	}
+	return db.scripts.runScript(db, sha, proto, args[1:])
+}
+
+// runScript 执行 EVAL/EVALSHA 的脚本, args 从 numkeys 开始
+func (engine *scriptEngine) runScript(db *DB, sha string, proto *lua.FunctionProto, args [][]byte) resp.Reply {
+	keys, argv, errReply := parseScriptKeys(args)
+	if errReply != nil {
+		return errReply
+	}
+	return engine.run(db, "f_"+sha, keys, false, func(vm *luaVM, run *scriptRun, ctx context.Context) (resp.Reply, error) {
+		return vm.call(run, ctx, proto, keys, argv)
+	})
+}
+
+// prepareEval EVAL/EVALSHA 为 KEYS 中的所有 key 加写锁
+func prepareEval(args [][]byte) ([]string, []string) {
+	keys, _, errReply := parseScriptKeys(args[1:])
+	if errReply != nil {
+		return nil, nil
+	}
+	return writeAllKeys(keys)
+}
+
+func undoEval(db *DB, args [][]byte) ([]CmdLine, error) {
+	keys, _ := prepareEval(args)
+	return rollbackGivenKeys(db, keys...)
+}
+
+// execScript SCRIPT LOAD|EXISTS|FLUSH|KILL
+func execScript(db *DB, args [][]byte) resp.Reply {
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "load":
+		if len(args) != 2 {
+			return reply.MakeArgNumErrReply("script|load")
+		}
+		sha := sha1Hex(args[1])
+		if _, errReply := db.scripts.load(sha, args[1]); errReply != nil {
+			return errReply
+		}
+		return reply.MakeBulkReply([]byte(sha))
+	case "exists":
+		if len(args) < 2 {
+			return reply.MakeArgNumErrReply("script|exists")
+		}
+		result := make([]resp.Reply, len(args)-1)
+		for i, sha := range args[1:] {
+			if db.scripts.get(strings.ToLower(string(sha))) != nil {
+				result[i] = reply.MakeIntReply(1)
+			} else {
+				result[i] = reply.MakeIntReply(0)
+			}
+		}
+		return reply.MakeMultiRawReply(result)
+	case "flush":
+		if len(args) > 2 {
+			return reply.MakeArgNumErrReply("script|flush")
+		}
+		if errReply := checkFlushMode(args[1:]); errReply != nil {
+			return errReply
+		}
+		db.scripts.flush()
+		return reply.MakeOkReply()
+	case "kill":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("script|kill")
+		}
+		return db.scripts.kill()
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try SCRIPT HELP.")
+}
+
+func init() {
+	RegisterCommand("Eval", execEval, prepareEval, undoEval, -3).
+		attachCommandExtra(FlagWrite, 0, 0, 0)
+	RegisterCommand("EvalSha", execEvalSha, prepareEval, undoEval, -3).
+		attachCommandExtra(FlagWrite, 0, 0, 0)
+	RegisterCommand("Script", execScript, noPrepare, nil, -2).
+		attachCommandExtra(0, 0, 0, 0)
+}
@@ -0,0 +1,367 @@
+package database
+
+/*Lua 虚拟机: redis 库, 以及 Lua 值与 Reply 之间的转换, 转换规则与 redis 相同*/
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/lib/logger"
+	"GoRedis/resp/parser"
+	"GoRedis/resp/reply"
+	"context"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// redis.log 的日志级别
+const (
+	luaLogDebug = iota
+	luaLogVerbose
+	luaLogNotice
+	luaLogWarning
+)
+
+// luaVM 加载了 redis 库的 Lua 虚拟机, 执行脚本时绑定到一个 scriptRun
+type luaVM struct {
+	L   *lua.LState
+	run *scriptRun
+
+	globals *lua.LTable   // 全局变量实际保存的位置, L.G.Global 是它的只读代理
+	proxies []*lua.LTable // 只读代理, 每次执行结束后清除通过 rawset 写入代理的值
+
+	registering *[]*registeredFunction // 执行函数库代码期间不为 nil, 收集 redis.register_function 注册的函数
+	libVersion  uint64                 // libs 对应的函数库版本
+	libs        map[*library]map[string]*lua.LFunction
+}
+
+func newLuaVM() *luaVM {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	vm := &luaVM{L: L}
+	// 只加载不涉及文件系统和操作系统的库
+	libs := []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	}
+	for _, lib := range libs {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "module", "require"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	redisLib := L.NewTable()
+	L.SetFuncs(redisLib, map[string]lua.LGFunction{
+		"call":               vm.redisCall,
+		"pcall":              vm.redisPCall,
+		"error_reply":        luaErrorReply,
+		"status_reply":       luaStatusReply,
+		"sha1hex":            luaSha1Hex,
+		"log":                luaLog,
+		"replicate_commands": luaReplicateCommands,
+		"register_function":  vm.registerFunction,
+	})
+	redisLib.RawSetString("LOG_DEBUG", lua.LNumber(luaLogDebug))
+	redisLib.RawSetString("LOG_VERBOSE", lua.LNumber(luaLogVerbose))
+	redisLib.RawSetString("LOG_NOTICE", lua.LNumber(luaLogNotice))
+	redisLib.RawSetString("LOG_WARNING", lua.LNumber(luaLogWarning))
+	L.SetGlobal("redis", redisLib)
+
+	// 与 redis 7 相同, redis、string、table、math 库和全局变量表都是只读的, 避免脚本的修改影响之后在同一个虚拟机上执行的脚本
+	for _, name := range []string{"redis", lua.StringLibName, lua.TabLibName, lua.MathLibName} {
+		L.SetGlobal(name, vm.makeReadonly(L.GetGlobal(name).(*lua.LTable), luaReadonlyError))
+	}
+	// 字符串的方法(如 s:len())通过字符串的元表访问 string 库
+	stringMeta := L.GetMetatable(lua.LString("")).(*lua.LTable)
+	stringMeta.RawSetString("__index", L.GetGlobal(lua.StringLibName))
+	stringMeta.RawSetString("__metatable", lua.LFalse)
+
+	// 全局变量移到 vm.globals 中, 禁止读写不存在的全局变量, 避免脚本之间通过全局变量相互影响
+	vm.globals = L.NewTable()
+	var names []lua.LValue
+	L.G.Global.ForEach(func(name lua.LValue, value lua.LValue) {
+		vm.globals.RawSet(name, value)
+		names = append(names, name)
+	})
+	for _, name := range names {
+		L.G.Global.RawSet(name, lua.LNil)
+	}
+	globalsMeta := L.NewTable()
+	globalsMeta.RawSetString("__index", L.NewFunction(func(L *lua.LState) int {
+		L.RaiseError("Script attempted to access nonexistent global variable '%s'", L.Get(2).String())
+		return 0
+	}))
+	L.SetMetatable(vm.globals, globalsMeta)
+	vm.makeReadonlyProxy(L.G.Global, vm.globals, func(L *lua.LState) int {
+		if vm.globals.RawGet(L.Get(2)) != lua.LNil {
+			return luaReadonlyError(L)
+		}
+		L.RaiseError("Script attempted to create global variable '%s'", L.Get(2).String())
+		return 0
+	})
+	return vm
+}
+
+// makeReadonly 返回 table 的只读代理: 读取时访问 table, 写入时调用 onWrite 抛出错误
+func (vm *luaVM) makeReadonly(table *lua.LTable, onWrite lua.LGFunction) *lua.LTable {
+	proxy := vm.L.NewTable()
+	vm.makeReadonlyProxy(proxy, table, onWrite)
+	return proxy
+}
+
+func (vm *luaVM) makeReadonlyProxy(proxy *lua.LTable, table *lua.LTable, onWrite lua.LGFunction) {
+	meta := vm.L.NewTable()
+	meta.RawSetString("__index", table)
+	meta.RawSetString("__newindex", vm.L.NewFunction(onWrite))
+	meta.RawSetString("__metatable", lua.LFalse) // 禁止 getmetatable/setmetatable 访问或替换元表
+	vm.L.SetMetatable(proxy, meta)
+	vm.proxies = append(vm.proxies, proxy)
+}
+
+// resetProxies 代理本身应当是空表, 清除脚本通过 rawset 绕过只读限制写入的值
+func (vm *luaVM) resetProxies() {
+	for _, proxy := range vm.proxies {
+		var keys []lua.LValue
+		proxy.ForEach(func(key lua.LValue, _ lua.LValue) {
+			keys = append(keys, key)
+		})
+		for _, key := range keys {
+			proxy.RawSet(key, lua.LNil)
+		}
+	}
+}
+
+func luaReadonlyError(L *lua.LState) int {
+	L.RaiseError("Attempt to modify a readonly table")
+	return 0
+}
+
+// call 执行编译好的脚本, ctx 被取消时脚本中断
+func (vm *luaVM) call(run *scriptRun, ctx context.Context, proto *lua.FunctionProto, keys [][]byte, argv [][]byte) (resp.Reply, error) {
+	L := vm.L
+	vm.run = run
+	defer func() {
+		vm.run = nil
+		vm.globals.RawSetString("KEYS", lua.LNil)
+		vm.globals.RawSetString("ARGV", lua.LNil)
+		vm.resetProxies()
+		L.RemoveContext()
+		L.SetTop(0)
+	}()
+	vm.globals.RawSetString("KEYS", makeLuaArray(L, keys))
+	vm.globals.RawSetString("ARGV", makeLuaArray(L, argv))
+	L.SetContext(ctx)
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := L.PCall(0, 1, nil); err != nil {
+		return nil, err
+	}
+	return luaToReply(L.Get(-1)), nil
+}
+
+func makeLuaArray(L *lua.LState, args [][]byte) *lua.LTable {
+	table := L.CreateTable(len(args), 0)
+	for _, arg := range args {
+		table.Append(lua.LString(arg))
+	}
+	return table
+}
+
+// makeScriptErrReply 脚本执行出错: redis.call 抛出的错误原样返回, 其它错误附带脚本的名称(f_<sha1> 或函数名)
+func makeScriptErrReply(err error, name string) reply.ErrorReply {
+	apiErr, ok := err.(*lua.ApiError)
+	if !ok {
+		return reply.MakeErrReply("ERR Error running script (call to " + name + "): " + singleLine(err.Error()))
+	}
+	if table, ok := apiErr.Object.(*lua.LTable); ok {
+		if msg, ok := table.RawGetString("err").(lua.LString); ok {
+			return reply.MakeErrReply(singleLine(string(msg)))
+		}
+	}
+	return reply.MakeErrReply("ERR Error running script (call to " + name + "): " + singleLine(apiErr.Object.String()))
+}
+
+// singleLine 错误和状态回复中不能包含换行
+func singleLine(msg string) string {
+	return strings.Join(strings.Fields(msg), " ")
+}
+
+/* ---- redis 库 ---- */
+
+// redisCall redis.call: 指令返回错误时抛出 Lua 错误
+func (vm *luaVM) redisCall(L *lua.LState) int {
+	result := vm.execCommand(L)
+	if errReply, ok := result.(reply.ErrorReply); ok {
+		L.Error(makeLuaStatusTable(L, "err", errReply.Error()), 1)
+		return 0
+	}
+	L.Push(replyToLua(L, result))
+	return 1
+}
+
+// redisPCall redis.pcall: 指令返回的错误转换为 {err=...} 返回给脚本
+func (vm *luaVM) redisPCall(L *lua.LState) int {
+	L.Push(replyToLua(L, vm.execCommand(L)))
+	return 1
+}
+
+func (vm *luaVM) execCommand(L *lua.LState) resp.Reply {
+	if vm.run == nil {
+		// 加载函数库时不能访问数据
+		L.RaiseError("redis.call and redis.pcall are not allowed while loading a library")
+	}
+	argc := L.GetTop()
+	if argc == 0 {
+		return reply.MakeErrReply("ERR Please specify at least one argument for this redis lib call")
+	}
+	cmdLine := make([][]byte, argc)
+	for i := 1; i <= argc; i++ {
+		switch arg := L.Get(i).(type) {
+		case lua.LString:
+			cmdLine[i-1] = []byte(arg)
+		case lua.LNumber:
+			cmdLine[i-1] = []byte(arg.String())
+		default:
+			return reply.MakeErrReply("ERR Lua redis lib command arguments must be strings or integers")
+		}
+	}
+	return vm.run.exec(cmdLine)
+}
+
+func makeLuaStatusTable(L *lua.LState, field string, msg string) *lua.LTable {
+	table := L.NewTable()
+	table.RawSetString(field, lua.LString(msg))
+	return table
+}
+
+func luaErrorReply(L *lua.LState) int {
+	L.Push(makeLuaStatusTable(L, "err", L.CheckString(1)))
+	return 1
+}
+
+func luaStatusReply(L *lua.LState) int {
+	L.Push(makeLuaStatusTable(L, "ok", L.CheckString(1)))
+	return 1
+}
+
+func luaSha1Hex(L *lua.LState) int {
+	L.Push(lua.LString(sha1Hex([]byte(L.CheckString(1)))))
+	return 1
+}
+
+// luaLog redis.log(level, message ...)
+func luaLog(L *lua.LState) int {
+	level := L.CheckInt(1)
+	msg := ""
+	for i := 2; i <= L.GetTop(); i++ {
+		if i > 2 {
+			msg += " "
+		}
+		msg += L.Get(i).String()
+	}
+	switch level {
+	case luaLogDebug, luaLogVerbose:
+		logger.Debug(msg)
+	case luaLogNotice:
+		logger.Info(msg)
+	case luaLogWarning:
+		logger.Warn(msg)
+	default:
+		L.RaiseError("Invalid debug level.")
+	}
+	return 0
+}
+
+// luaReplicateCommands 脚本总是按照执行的写指令写入 aof, 保留该函数只为兼容
+func luaReplicateCommands(L *lua.LState) int {
+	L.Push(lua.LTrue)
+	return 1
+}
+
+/* ---- 类型转换 ---- */
+
+// replyToLua 指令的回复转换为 Lua 值:
+// 整数 -> number, 字符串 -> string, 数组 -> table, 状态 -> {ok=...}, 错误 -> {err=...}, nil -> false
+func replyToLua(L *lua.LState, r resp.Reply) lua.LValue {
+	if errReply, ok := r.(reply.ErrorReply); ok {
+		return makeLuaStatusTable(L, "err", errReply.Error())
+	}
+	switch r := r.(type) {
+	case *reply.IntReply:
+		return lua.LNumber(r.Code)
+	case *reply.BulkReply:
+		if r.Arg == nil {
+			return lua.LFalse
+		}
+		return lua.LString(r.Arg)
+	case *reply.StatusReply:
+		return makeLuaStatusTable(L, "ok", r.Status)
+	case *reply.OkReply:
+		return makeLuaStatusTable(L, "ok", "OK")
+	case *reply.NullBulkReply, *reply.NullMultiBulkReply:
+		return lua.LFalse
+	case *reply.EmptyMultiBulkReply:
+		return L.NewTable()
+	case *reply.MultiBulkReply:
+		table := L.CreateTable(len(r.Args), 0)
+		for _, arg := range r.Args {
+			if arg == nil {
+				table.Append(lua.LFalse)
+			} else {
+				table.Append(lua.LString(arg))
+			}
+		}
+		return table
+	case *reply.MultiRawReply:
+		table := L.CreateTable(len(r.Replies), 0)
+		for _, element := range r.Replies {
+			table.Append(replyToLua(L, element))
+		}
+		return table
+	}
+	// 其它类型的回复先序列化再解析为上面的类型
+	parsed, err := parser.ParseOne(r.ToBytes())
+	if err != nil {
+		return lua.LFalse
+	}
+	return replyToLua(L, parsed)
+}
+
+// luaToReply 脚本的返回值转换为回复:
+// number -> 整数(截断小数部分), string -> 字符串, true -> 1, false/nil -> nil,
+// {ok=...} -> 状态, {err=...} -> 错误, 数组 -> 数组(遇到 nil 时截止)
+func luaToReply(value lua.LValue) resp.Reply {
+	switch value := value.(type) {
+	case lua.LNumber:
+		return reply.MakeIntReply(int64(value))
+	case lua.LString:
+		return reply.MakeBulkReply([]byte(value))
+	case lua.LBool:
+		if value {
+			return reply.MakeIntReply(1)
+		}
+		return reply.MakeNullBulkReply()
+	case *lua.LTable:
+		if msg, ok := value.RawGetString("ok").(lua.LString); ok {
+			return reply.MakeStatusReply(singleLine(string(msg)))
+		}
+		if msg, ok := value.RawGetString("err").(lua.LString); ok {
+			return reply.MakeErrReply(singleLine(string(msg)))
+		}
+		replies := make([]resp.Reply, 0, value.Len())
+		for i := 1; ; i++ {
+			element := value.RawGetInt(i)
+			if element == lua.LNil {
+				break
+			}
+			replies = append(replies, luaToReply(element))
+		}
+		return reply.MakeMultiRawReply(replies)
+	}
+	return reply.MakeNullBulkReply()
+}
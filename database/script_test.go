@@ -0,0 +1,131 @@
+package database
+
+import (
+	"GoRedis/lib/utils"
+	"GoRedis/resp/connection"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func makeScriptTestDB(t *testing.T) (*StandaloneDatabase, *connection.Connection) {
+	t.Helper()
+	mdb := NewStandaloneDatabase()
+	t.Cleanup(mdb.Close)
+	conn := &connection.Connection{}
+	conn.SelectDB(0)
+	for _, line := range []string{"set s v", "rpush l a b"} {
+		mdb.Exec(conn, toArgs(line))
+	}
+	return mdb, conn
+}
+
+func eval(mdb *StandaloneDatabase, conn *connection.Connection, script string, keys ...string) string {
+	args := append(utils.ToCmdLine("eval", script, strconv.Itoa(len(keys))), utils.ToCmdLine(keys...)...)
+	return string(mdb.Exec(conn, args).ToBytes())
+}
+
+func TestLuaToReply(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"integer", "return 1", ":1\r\n"},
+		{"float truncated", "return 3.99", ":3\r\n"},
+		{"negative float truncated", "return -3.99", ":-3\r\n"},
+		{"string", "return 'hello'", "$5\r\nhello\r\n"},
+		{"true", "return true", ":1\r\n"},
+		{"false", "return false", "$-1\r\n"},
+		{"nil", "return nil", "$-1\r\n"},
+		{"empty table", "return {}", "*0\r\n"},
+		{"nested array", "return {1, 'a', {2, 'b'}}", "*3\r\n:1\r\n$1\r\na\r\n*2\r\n:2\r\n$1\r\nb\r\n"},
+		{"array stops at nil", "return {1, nil, 3}", "*1\r\n:1\r\n"},
+		{"false in array", "return {1, false, 3}", "*3\r\n:1\r\n$-1\r\n:3\r\n"},
+		{"hash part ignored", "return {1, 2, x = 3}", "*2\r\n:1\r\n:2\r\n"},
+		{"status table", "return {ok = 'fine'}", "+fine\r\n"},
+		{"error table", "return {err = 'ERR bad'}", "-ERR bad\r\n"},
+		{"status_reply", "return redis.status_reply('PONG')", "+PONG\r\n"},
+		{"error_reply", "return redis.error_reply('ERR custom')", "-ERR custom\r\n"},
+		{"multi-line status", "return {ok = 'a\\r\\nb'}", "+a b\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mdb, conn := makeScriptTestDB(t)
+			if got := eval(mdb, conn, tt.script); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplyToLua(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		keys   []string
+		want   string
+	}{
+		{"bulk", "return redis.call('get', KEYS[1])", []string{"s"}, "$1\r\nv\r\n"},
+		{"null bulk is false", "return type(redis.call('get', KEYS[1]))", []string{"missing"}, "$7\r\nboolean\r\n"},
+		{"integer", "return redis.call('llen', KEYS[1]) + 1", []string{"l"}, ":3\r\n"},
+		{"integer type", "return type(redis.call('llen', KEYS[1]))", []string{"l"}, "$6\r\nnumber\r\n"},
+		{"ok status", "return redis.call('set', KEYS[1], 'x')", []string{"s"}, "+OK\r\n"},
+		{"ok field", "return redis.call('set', KEYS[1], 'x')['ok']", []string{"s"}, "$2\r\nOK\r\n"},
+		{"status", "return redis.call('ping')", nil, "+PONG\r\n"},
+		{"array", "return redis.call('lrange', KEYS[1], 0, -1)", []string{"l"}, "*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{"empty array", "return #redis.call('lrange', KEYS[1], 0, -1)", []string{"missing"}, ":0\r\n"},
+		{"null in array", "return redis.call('mget', KEYS[1], KEYS[2])", []string{"s", "missing"}, "*2\r\n$1\r\nv\r\n$-1\r\n"},
+		{"pcall error", "return redis.pcall('llen', KEYS[1])", []string{"s"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"pcall err field", "return redis.pcall('llen', KEYS[1])['err']", []string{"s"}, "$65\r\nWRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		// 与 redis 7 相同, redis.call 抛出的指令错误原样返回
+		{"call error raised", "return redis.call('llen', KEYS[1])", []string{"s"}, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mdb, conn := makeScriptTestDB(t)
+			if got := eval(mdb, conn, tt.script, tt.keys...); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLuaReadonlyGlobals(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"redis field", "redis.call = nil", "Attempt to modify a readonly table"},
+		{"redis global", "redis = nil", "Attempt to modify a readonly table"},
+		{"string library", "string.len = nil", "Attempt to modify a readonly table"},
+		{"math library", "math.pi = 3", "Attempt to modify a readonly table"},
+		{"table library", "table.x = 1", "Attempt to modify a readonly table"},
+		{"new global", "x = 1", "Script attempted to create global variable"},
+		{"undefined global", "return y", "Script attempted to access nonexistent global variable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mdb, conn := makeScriptTestDB(t)
+			if got := eval(mdb, conn, tt.script); !strings.HasPrefix(got, "-") || !strings.Contains(got, tt.want) {
+				t.Errorf("got %q, want error containing %q", got, tt.want)
+			}
+			// 复用的虚拟机不受之前脚本的影响
+			if got := eval(mdb, conn, "return redis.call('get', KEYS[1])", "s"); got != "$1\r\nv\r\n" {
+				t.Errorf("after %q: got %q", tt.script, got)
+			}
+		})
+	}
+}
+
+func TestLuaRawsetReset(t *testing.T) {
+	mdb, conn := makeScriptTestDB(t)
+	// rawset 可以绕过只读保护, 脚本结束后被清除
+	if got := eval(mdb, conn, "rawset(redis, 'x', 1) return redis.x"); got != ":1\r\n" {
+		t.Fatalf("got %q", got)
+	}
+	if got := eval(mdb, conn, "return type(redis.x)"); got != "$3\r\nnil\r\n" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,139 @@
+package database
+
+/*CONFIG GET / CONFIG SET*/
+
+import (
+	"GoRedis/config"
+	"GoRedis/interface/resp"
+	"GoRedis/lib/wildcard"
+	"GoRedis/resp/reply"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configValidators 在写入配置之前校验取值
+var configValidators = map[string]func(value string) error{
+	"maxmemory":              validateNonNegative,
+	"maxmemory-samples":      validateNonNegative,
+	"maxmemory-policy":       validateMaxMemoryPolicy,
+	"notify-keyspace-events": validateNotifyFlags,
+	"proto-max-bulk-len":     validateProtoMaxBulkLen,
+}
+
+// configAppliers 配置写入之后更新依赖该配置的状态
+var configAppliers = map[string]func(value string) error{
+	"notify-keyspace-events": setNotifyFlags,
+}
+
+var errInvalidConfigArg = errors.New("ERR Invalid argument")
+
+func validateNonNegative(value string) error {
+	val, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || val < 0 {
+		return errInvalidConfigArg
+	}
+	return nil
+}
+
+func validateMaxMemoryPolicy(value string) error {
+	switch strings.ToLower(value) {
+	case policyNoEviction, policyAllKeysLRU, policyAllKeysLFU, policyAllKeysRandom,
+		policyVolatileLRU, policyVolatileLFU, policyVolatileRandom, policyVolatileTTL:
+		return nil
+	}
+	return errInvalidConfigArg
+}
+
+// validateProtoMaxBulkLen 与 redis 相同, 不能小于 1MB, 避免连 CONFIG SET 本身都无法发送
+func validateProtoMaxBulkLen(value string) error {
+	val, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || val < 1024*1024 {
+		return errors.New("argument must be at least 1048576")
+	}
+	return nil
+}
+
+func validateNotifyFlags(value string) error {
+	_, err := parseNotifyFlags(value)
+	return err
+}
+
+// execConfig CONFIG GET pattern [pattern ...] | CONFIG SET parameter value [parameter value ...]
+func execConfig(args [][]byte) resp.Reply {
+	if len(args) < 1 {
+		return reply.MakeArgNumErrReply("config")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "get":
+		if len(args) < 2 {
+			return reply.MakeArgNumErrReply("config|get")
+		}
+		return execConfigGet(args[1:])
+	case "set":
+		if len(args) < 3 || len(args)%2 != 1 {
+			return reply.MakeArgNumErrReply("config|set")
+		}
+		return execConfigSet(args[1:])
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try CONFIG HELP.")
+}
+
+// execConfigGet 返回与任意一个模式匹配的配置项: [name1, value1, name2, value2...]
+func execConfigGet(args [][]byte) resp.Reply {
+	patterns := make([]*wildcard.Pattern, len(args))
+	for i, arg := range args {
+		patterns[i] = wildcard.CompilePattern(strings.ToLower(string(arg)))
+	}
+	all := config.GetAll()
+	names := make([]string, 0, len(all))
+	for name := range all {
+		for _, pattern := range patterns {
+			if pattern.IsMatch(name) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	result := make([][]byte, 0, 2*len(names))
+	for _, name := range names {
+		result = append(result, []byte(name), []byte(all[name]))
+	}
+	return reply.MakeBulkMapReply(result)
+}
+
+// execConfigSet 先校验所有参数, 全部合法后再写入
+func execConfigSet(args [][]byte) resp.Reply {
+	for i := 0; i < len(args); i += 2 {
+		name := strings.ToLower(string(args[i]))
+		if err := config.CheckSettable(name); err != nil {
+			return reply.MakeErrReply(err.Error())
+		}
+		if validate, ok := configValidators[name]; ok {
+			if err := validate(string(args[i+1])); err != nil {
+				return reply.MakeErrReply("ERR CONFIG SET failed (possibly related to argument '" + name + "') - " +
+					strings.TrimPrefix(err.Error(), "ERR "))
+			}
+		}
+	}
+	for i := 0; i < len(args); i += 2 {
+		name := strings.ToLower(string(args[i]))
+		value := string(args[i+1])
+		if err := config.Set(name, value); err != nil {
+			return reply.MakeErrReply(err.Error())
+		}
+		if apply, ok := configAppliers[name]; ok {
+			_ = apply(value)
+		}
+	}
+	return reply.MakeOkReply()
+}
+
+func init() {
+	// 配置保存在每个节点上, 集群中 CONFIG SET 需要广播, CONFIG GET 返回本节点的配置
+	registerServerCommand("Config", -2).
+		attachCommandExtra(FlagAdmin, 0, 0, 0)
+}
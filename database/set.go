@@ -0,0 +1,166 @@
+package database
+
+import (
+	"GoRedis/datastruct/set"
+	"GoRedis/interface/database"
+	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/reply"
+	"math"
+	"strconv"
+)
+
+// getAsSet 返回 key 对应的集合, key 不存在时返回 nil
+func (db *DB) getAsSet(key string) (*database.DataEntity, *set.Set, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil, nil
+	}
+	s, ok := entity.Data.(*set.Set)
+	if !ok {
+		return nil, nil, &reply.WrongTypeErrReply{}
+	}
+	return entity, s, nil
+}
+
+// execSAdd SADD key member [member ...]
+func execSAdd(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	entity, s, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	created := s == nil
+	if created {
+		s = set.Make()
+	}
+	var added int64
+	for _, arg := range args[1:] {
+		if s.Add(string(arg)) {
+			added++
+			if entity != nil {
+				db.growEntity(entity, elementSize(arg))
+			}
+		}
+	}
+	if created {
+		db.PutEntity(key, &database.DataEntity{Data: s})
+	}
+	if added > 0 {
+		db.notify(notifySet, "sadd", key)
+		db.addAof(utils.ToCmdLine2("sadd", args...))
+	}
+	return reply.MakeIntReply(added)
+}
+
+// execSRem SREM key member [member ...]
+func execSRem(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	entity, s, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeIntReply(0)
+	}
+	var deleted int64
+	for _, arg := range args[1:] {
+		if s.Remove(string(arg)) {
+			deleted++
+			db.growEntity(entity, -elementSize(arg))
+		}
+	}
+	if deleted > 0 {
+		db.notify(notifySet, "srem", key)
+		if s.Len() == 0 {
+			db.Remove(key)
+			db.notify(notifyGeneric, "del", key)
+		}
+		db.addAof(utils.ToCmdLine2("srem", args...))
+	}
+	return reply.MakeIntReply(deleted)
+}
+
+// execSIsMember SISMEMBER key member
+func execSIsMember(db *DB, args [][]byte) resp.Reply {
+	_, s, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil || !s.Has(string(args[1])) {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(1)
+}
+
+// execSCard SCARD key
+func execSCard(db *DB, args [][]byte) resp.Reply {
+	_, s, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(s.Len()))
+}
+
+// execSMembers SMEMBERS key, RESP3 客户端收到 set
+func execSMembers(db *DB, args [][]byte) resp.Reply {
+	_, s, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeBulkSetReply(nil)
+	}
+	members := s.Members()
+	result := make([][]byte, len(members))
+	for i, member := range members {
+		result[i] = []byte(member)
+	}
+	return reply.MakeBulkSetReply(result)
+}
+
+// execSScan SSCAN key cursor [MATCH pattern] [COUNT count]
+// 游标的含义与 SCAN 相同, 见 Set.Scan
+func execSScan(db *DB, args [][]byte) resp.Reply {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR invalid cursor")
+	}
+	options, errReply := parseScanArgs(args[2:], false)
+	if errReply != nil {
+		return errReply
+	}
+	_, s, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil || cursor > math.MaxInt32 {
+		return makeScanReply(0, nil)
+	}
+	members, next := s.Scan(int(cursor), options.count, func(member string) bool {
+		return options.pattern == nil || options.pattern.IsMatch(member)
+	})
+	result := make([][]byte, len(members))
+	for i, member := range members {
+		result[i] = []byte(member)
+	}
+	return makeScanReply(uint64(next), result)
+}
+
+func init() {
+	RegisterCommand("SAdd", execSAdd, writeFirstKey, rollbackFirstKey, -3).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("SRem", execSRem, writeFirstKey, rollbackFirstKey, -3).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("SIsMember", execSIsMember, readFirstKey, nil, 3).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("SCard", execSCard, readFirstKey, nil, 2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("SMembers", execSMembers, readFirstKey, nil, 2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("SScan", execSScan, readFirstKey, nil, -3).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+}
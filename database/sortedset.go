@@ -0,0 +1,519 @@
+package database
+
+import (
+	"GoRedis/datastruct/sortedset"
+	"GoRedis/interface/database"
+	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// getAsSortedSet 返回 key 对应的有序集合, key 不存在时返回 nil
+func (db *DB) getAsSortedSet(key string) (*database.DataEntity, *sortedset.SortedSet, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil, nil
+	}
+	set, ok := entity.Data.(*sortedset.SortedSet)
+	if !ok {
+		return nil, nil, &reply.WrongTypeErrReply{}
+	}
+	return entity, set, nil
+}
+
+// memberSize 估算有序集合中一个元素的内存占用
+func memberSize(member string) int64 {
+	return int64(len(member)) + elementOverhead
+}
+
+// addToSortedSet 向有序集合添加元素, 并调整内存占用; 新增元素时返回 true
+func (db *DB) addToSortedSet(entity *database.DataEntity, set *sortedset.SortedSet, member string, score float64) bool {
+	added := set.Add(member, score)
+	if added && entity != nil {
+		db.growEntity(entity, memberSize(member))
+	}
+	return added
+}
+
+// makeScoreReply RESP2 客户端收到字符串, RESP3 客户端收到 double
+func makeScoreReply(score float64) *reply.DoubleReply {
+	return reply.MakeDoubleReply(score)
+}
+
+// makeElementsReply 返回元素列表, withScores 为 true 时每个元素后跟随 score
+func makeElementsReply(elements []*sortedset.Element, withScores bool) resp.Reply {
+	size := len(elements)
+	if withScores {
+		size *= 2
+	}
+	result := make([][]byte, 0, size)
+	for _, element := range elements {
+		result = append(result, []byte(element.Member))
+		if withScores {
+			result = append(result, []byte(sortedset.FormatScore(element.Score)))
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+const (
+	zaddNX = 1 << iota
+	zaddXX
+	zaddGT
+	zaddLT
+	zaddCH
+	zaddIncr
+)
+
+// zaddMember 按照 ZADD 的选项添加或修改一个元素, 返回新的 score 以及是否新增、是否修改
+// 选项不允许修改时 ok 为 false
+func zaddMember(set *sortedset.SortedSet, member string, score float64, flags int) (newScore float64, added bool, updated bool, ok bool, errReply reply.ErrorReply) {
+	element, exists := set.Get(member)
+	if !exists {
+		if flags&zaddXX != 0 {
+			return 0, false, false, false, nil
+		}
+		return score, true, false, true, nil
+	}
+	if flags&zaddNX != 0 {
+		return 0, false, false, false, nil
+	}
+	newScore = score
+	if flags&zaddIncr != 0 {
+		newScore = element.Score + score
+		if math.IsNaN(newScore) {
+			return 0, false, false, false, reply.MakeErrReply("ERR resulting score is not a number (NaN)")
+		}
+	}
+	if (flags&zaddGT != 0 && newScore <= element.Score) || (flags&zaddLT != 0 && newScore >= element.Score) {
+		return 0, false, false, false, nil
+	}
+	return newScore, false, newScore != element.Score, true, nil
+}
+
+// execZAdd ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func execZAdd(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	flags := 0
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			flags |= zaddNX
+		case "XX":
+			flags |= zaddXX
+		case "GT":
+			flags |= zaddGT
+		case "LT":
+			flags |= zaddLT
+		case "CH":
+			flags |= zaddCH
+		case "INCR":
+			flags |= zaddIncr
+		default:
+			break options
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return reply.MakeSyntaxErrReply()
+	}
+	if flags&zaddNX != 0 && flags&zaddXX != 0 {
+		return reply.MakeErrReply("ERR XX and NX options at the same time are not compatible")
+	}
+	if (flags&zaddGT != 0 && flags&(zaddNX|zaddLT) != 0) || (flags&zaddLT != 0 && flags&zaddNX != 0) {
+		return reply.MakeErrReply("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if flags&zaddIncr != 0 && len(pairs) > 2 {
+		return reply.MakeErrReply("ERR INCR option supports a single increment-element pair")
+	}
+	scores := make([]float64, len(pairs)/2)
+	for j := range scores {
+		score, err := sortedset.ParseScore(string(pairs[2*j]))
+		if err != nil {
+			return reply.MakeErrReply(err.Error())
+		}
+		scores[j] = score
+	}
+
+	entity, set, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	created := set == nil
+	if created {
+		set = sortedset.Make()
+	}
+	var added, changed int64
+	var lastScore float64
+	lastOk := false
+	for j, score := range scores {
+		member := string(pairs[2*j+1])
+		newScore, isNew, isUpdated, ok, errReply := zaddMember(set, member, score, flags)
+		if errReply != nil {
+			return errReply
+		}
+		lastScore, lastOk = newScore, ok
+		if !ok {
+			continue
+		}
+		if isNew {
+			added++
+		}
+		if isNew || isUpdated {
+			changed++
+			db.addToSortedSet(entity, set, member, newScore)
+		}
+	}
+	if created && set.Len() > 0 {
+		db.PutEntity(key, &database.DataEntity{Data: set})
+	}
+	if changed > 0 {
+		if flags&zaddIncr != 0 {
+			db.notify(notifyZSet, "zincr", key)
+		} else {
+			db.notify(notifyZSet, "zadd", key)
+		}
+		db.addAof(utils.ToCmdLine2("zadd", args...))
+	}
+	if flags&zaddIncr != 0 {
+		if !lastOk {
+			return reply.MakeNullBulkReply()
+		}
+		return makeScoreReply(lastScore)
+	}
+	if flags&zaddCH != 0 {
+		return reply.MakeIntReply(changed)
+	}
+	return reply.MakeIntReply(added)
+}
+
+// execZIncrBy ZINCRBY key increment member
+func execZIncrBy(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	increment, err := sortedset.ParseScore(string(args[1]))
+	if err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+	member := string(args[2])
+	entity, set, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	created := set == nil
+	if created {
+		set = sortedset.Make()
+	}
+	newScore, _, _, _, errReply := zaddMember(set, member, increment, zaddIncr)
+	if errReply != nil {
+		return errReply
+	}
+	db.addToSortedSet(entity, set, member, newScore)
+	if created {
+		db.PutEntity(key, &database.DataEntity{Data: set})
+	}
+	db.notify(notifyZSet, "zincr", key)
+	db.addAof(utils.ToCmdLine2("zincrby", args...))
+	return makeScoreReply(newScore)
+}
+
+// execZScore ZSCORE key member
+func execZScore(db *DB, args [][]byte) resp.Reply {
+	_, set, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeNullBulkReply()
+	}
+	element, ok := set.Get(string(args[1]))
+	if !ok {
+		return reply.MakeNullBulkReply()
+	}
+	return makeScoreReply(element.Score)
+}
+
+// execZCard ZCARD key
+func execZCard(db *DB, args [][]byte) resp.Reply {
+	_, set, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(set.Len()))
+}
+
+// execZRem ZREM key member [member ...]
+func execZRem(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	entity, set, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeIntReply(0)
+	}
+	var deleted int64
+	for _, arg := range args[1:] {
+		member := string(arg)
+		if set.Remove(member) {
+			deleted++
+			db.growEntity(entity, -memberSize(member))
+		}
+	}
+	if deleted > 0 {
+		db.notify(notifyZSet, "zrem", key)
+		if set.Len() == 0 {
+			db.Remove(key)
+			db.notify(notifyGeneric, "del", key)
+		}
+		db.addAof(utils.ToCmdLine2("zrem", args...))
+	}
+	return reply.MakeIntReply(deleted)
+}
+
+func execZRankGeneric(db *DB, args [][]byte, desc bool) resp.Reply {
+	_, set, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeNullBulkReply()
+	}
+	rank := set.GetRank(string(args[1]), desc)
+	if rank < 0 {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeIntReply(rank)
+}
+
+// execZRank ZRANK key member: 按 score 从小到大的排名, 从 0 开始
+func execZRank(db *DB, args [][]byte) resp.Reply {
+	return execZRankGeneric(db, args, false)
+}
+
+// execZRevRank ZREVRANK key member: 按 score 从大到小的排名
+func execZRevRank(db *DB, args [][]byte) resp.Reply {
+	return execZRankGeneric(db, args, true)
+}
+
+// execZCount ZCOUNT key min max
+func execZCount(db *DB, args [][]byte) resp.Reply {
+	min, err := sortedset.ParseScoreBorder(string(args[1]))
+	if err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+	max, err := sortedset.ParseScoreBorder(string(args[2]))
+	if err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+	_, set, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(set.Count(min, max))
+}
+
+// zrangeArgs ZRANGE 系列指令的参数
+type zrangeArgs struct {
+	byScore    bool
+	desc       bool
+	withScores bool
+	hasLimit   bool
+	offset     int64
+	count      int64
+}
+
+// parseZRangeOptions 解析 [BYSCORE] [REV] [LIMIT offset count] [WITHSCORES]
+// limitOnly 为 true 时只允许 WITHSCORES 和 LIMIT, 用于 ZRANGEBYSCORE
+func parseZRangeOptions(args [][]byte, opts *zrangeArgs, limitOnly bool) reply.ErrorReply {
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		if limitOnly && (option == "BYSCORE" || option == "REV") {
+			return reply.MakeSyntaxErrReply()
+		}
+		switch option {
+		case "BYSCORE":
+			opts.byScore = true
+		case "REV":
+			opts.desc = true
+		case "WITHSCORES":
+			opts.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			offset, err1 := strconv.ParseInt(string(args[i+1]), 10, 64)
+			count, err2 := strconv.ParseInt(string(args[i+2]), 10, 64)
+			if err1 != nil || err2 != nil {
+				return reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			opts.hasLimit, opts.offset, opts.count = true, offset, count
+			i += 2
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	if opts.hasLimit && !opts.byScore {
+		return reply.MakeErrReply("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	return nil
+}
+
+// zrange 按排名或 score 返回元素; 按 score 且 desc 时 start 为上界, stop 为下界
+func (db *DB) zrange(key string, start []byte, stop []byte, opts *zrangeArgs) resp.Reply {
+	if opts.byScore {
+		min, err := sortedset.ParseScoreBorder(string(start))
+		if err != nil {
+			return reply.MakeErrReply(err.Error())
+		}
+		max, err := sortedset.ParseScoreBorder(string(stop))
+		if err != nil {
+			return reply.MakeErrReply(err.Error())
+		}
+		if opts.desc {
+			min, max = max, min
+		}
+		_, set, errReply := db.getAsSortedSet(key)
+		if errReply != nil {
+			return errReply
+		}
+		if set == nil {
+			return reply.MakeEmptyMultiBulkBytes()
+		}
+		offset, limit := int64(0), int64(-1)
+		if opts.hasLimit {
+			offset, limit = opts.offset, opts.count
+		}
+		return makeElementsReply(set.RangeByScore(min, max, offset, limit, opts.desc), opts.withScores)
+	}
+
+	startIdx, err1 := strconv.ParseInt(string(start), 10, 64)
+	stopIdx, err2 := strconv.ParseInt(string(stop), 10, 64)
+	if err1 != nil || err2 != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	_, set, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeEmptyMultiBulkBytes()
+	}
+	size := set.Len()
+	startIdx = normalizeIndex(startIdx, size)
+	stopIdx = normalizeIndex(stopIdx, size)
+	if startIdx < 0 {
+		startIdx = 0
+	}
+	if stopIdx >= int64(size) {
+		stopIdx = int64(size) - 1
+	}
+	if startIdx > stopIdx {
+		return reply.MakeEmptyMultiBulkBytes()
+	}
+	return makeElementsReply(set.RangeByRank(startIdx, stopIdx+1, opts.desc), opts.withScores)
+}
+
+// execZRange ZRANGE key start stop [BYSCORE] [REV] [LIMIT offset count] [WITHSCORES]
+func execZRange(db *DB, args [][]byte) resp.Reply {
+	opts := &zrangeArgs{}
+	if errReply := parseZRangeOptions(args[3:], opts, false); errReply != nil {
+		return errReply
+	}
+	return db.zrange(string(args[0]), args[1], args[2], opts)
+}
+
+// execZRevRange ZREVRANGE key start stop [WITHSCORES]
+func execZRevRange(db *DB, args [][]byte) resp.Reply {
+	opts := &zrangeArgs{desc: true}
+	if len(args) > 4 || (len(args) == 4 && strings.ToUpper(string(args[3])) != "WITHSCORES") {
+		return reply.MakeSyntaxErrReply()
+	}
+	opts.withScores = len(args) == 4
+	return db.zrange(string(args[0]), args[1], args[2], opts)
+}
+
+func execZRangeByScoreGeneric(db *DB, args [][]byte, desc bool) resp.Reply {
+	opts := &zrangeArgs{byScore: true, desc: desc}
+	if errReply := parseZRangeOptions(args[3:], opts, true); errReply != nil {
+		return errReply
+	}
+	return db.zrange(string(args[0]), args[1], args[2], opts)
+}
+
+// execZRangeByScore ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func execZRangeByScore(db *DB, args [][]byte) resp.Reply {
+	return execZRangeByScoreGeneric(db, args, false)
+}
+
+// execZRevRangeByScore ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]
+func execZRevRangeByScore(db *DB, args [][]byte) resp.Reply {
+	return execZRangeByScoreGeneric(db, args, true)
+}
+
+// execZScan ZSCAN key cursor [MATCH pattern] [COUNT count]
+// 游标的含义与 SCAN 相同, 见 SortedSet.Scan; 返回的元素后跟随 score
+func execZScan(db *DB, args [][]byte) resp.Reply {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR invalid cursor")
+	}
+	options, errReply := parseScanArgs(args[2:], false)
+	if errReply != nil {
+		return errReply
+	}
+	_, set, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil || cursor > math.MaxInt32 {
+		return makeScanReply(0, nil)
+	}
+	elements, next := set.Scan(int(cursor), options.count, func(member string) bool {
+		return options.pattern == nil || options.pattern.IsMatch(member)
+	})
+	result := make([][]byte, 0, 2*len(elements))
+	for _, element := range elements {
+		result = append(result, []byte(element.Member), []byte(sortedset.FormatScore(element.Score)))
+	}
+	return makeScanReply(uint64(next), result)
+}
+
+func init() {
+	RegisterCommand("ZAdd", execZAdd, writeFirstKey, rollbackFirstKey, -4).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("ZIncrBy", execZIncrBy, writeFirstKey, rollbackFirstKey, 4).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("ZScore", execZScore, readFirstKey, nil, 3).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("ZCard", execZCard, readFirstKey, nil, 2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("ZRem", execZRem, writeFirstKey, rollbackFirstKey, -3).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("ZRank", execZRank, readFirstKey, nil, 3).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("ZRevRank", execZRevRank, readFirstKey, nil, 3).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("ZCount", execZCount, readFirstKey, nil, 4).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("ZRange", execZRange, readFirstKey, nil, -4).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("ZRevRange", execZRevRange, readFirstKey, nil, -4).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("ZRangeByScore", execZRangeByScore, readFirstKey, nil, -4).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("ZRevRangeByScore", execZRevRangeByScore, readFirstKey, nil, -4).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("ZScan", execZScan, readFirstKey, nil, -3).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+}
@@ -4,33 +4,56 @@ package database
 import (
 	"GoRedis/aof"
 	"GoRedis/config"
+	"GoRedis/interface/database"
 	"GoRedis/interface/resp"
 	"GoRedis/lib/logger"
+	"GoRedis/pubsub"
 	"GoRedis/resp/reply"
 	"errors"
 	"fmt"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // StandaloneDatabase 一组分数据库
 type StandaloneDatabase struct {
-	dbSet      []*DB
+	dbSet      []*atomic.Value // *DB; SWAPDB 会交换其中的 DB
 	aofHandler *aof.AofHandler
+	hub        *pubsub.Hub    // 发布订阅, 同时用于发布键空间通知
+	scripts    *scriptEngine  // Lua 脚本
+	tracking   *trackingTable // 客户端缓存
+	evictionMu sync.Mutex     // 内存淘汰时持有
+	swapMu     sync.Mutex     // SWAPDB 时持有
 }
 
 // NewStandaloneDatabase 新建一个 redis 内核
 func NewStandaloneDatabase() *StandaloneDatabase {
-	mdb := &StandaloneDatabase{}
+	mdb := &StandaloneDatabase{
+		hub: pubsub.MakeHub(),
+	}
 	if config.Properties.Databases == 0 { //读取配置文件
 		config.Properties.Databases = 16
 	}
-	mdb.dbSet = make([]*DB, config.Properties.Databases)
-	for i := range mdb.dbSet { // 填充 StandaloneDatabase 结构体中的DB数组，每一个DB的底层都是Sync.map
+	if err := setNotifyFlags(config.Properties.NotifyKeyspaceEvents); err != nil {
+		logger.Warn("invalid notify-keyspace-events: " + config.Properties.NotifyKeyspaceEvents)
+	}
+	mdb.scripts = makeScriptEngine(mdb.UsedMemory)
+	mdb.tracking = makeTrackingTable()
+	mdb.dbSet = make([]*atomic.Value, config.Properties.Databases)
+	for i := range mdb.dbSet { // 填充 StandaloneDatabase 结构体中的DB数组，每一个DB的底层都是ConcurrentDict
 		singleDB := makeDB()
-		singleDB.index = i
-		mdb.dbSet[i] = singleDB
+		singleDB.setIndex(i)
+		singleDB.hub = mdb.hub
+		singleDB.scripts = mdb.scripts
+		singleDB.tracking = mdb.tracking
+		singleDB.selectDB = mdb.selectDB
+		holder := &atomic.Value{}
+		holder.Store(singleDB)
+		mdb.dbSet[i] = holder
 	}
 	if config.Properties.AppendOnly {
 		aofHandler, err := aof.NewAOFHandler(mdb)
@@ -38,12 +61,12 @@ func NewStandaloneDatabase() *StandaloneDatabase {
 			panic(err)
 		}
 		mdb.aofHandler = aofHandler
-		for _, db := range mdb.dbSet {
-			//dp是指针数组, 会发生内存逃逸; 防止传入mdb.aofHandler.AddAof的db因为后序遍历更改
-			singleDB := db
-			//初始化addAof方法
+		for i := range mdb.dbSet {
+			//防止传入mdb.aofHandler.AddAof的db因为后序遍历更改
+			singleDB := mdb.selectDB(i)
+			//初始化addAof方法; SWAPDB 之后 index 会改变, 所以在调用时读取
 			singleDB.addAof = func(line CmdLine) {
-				mdb.aofHandler.AddAof(singleDB.index, line)
+				mdb.aofHandler.AddAof(singleDB.getIndex(), line)
 			}
 		}
 	}
@@ -60,24 +83,190 @@ func (mdb *StandaloneDatabase) Exec(c resp.Connection, cmdLine [][]byte) (result
 	}()
 
 	cmdName := strings.ToLower(string(cmdLine[0]))
-	if cmdName == "select" { // 选择db的指令，select 1：选择第一个分db
+	mdb.tracking.register(c)
+	// CLIENT CACHING 只对下一条指令生效, MULTI 中则对整个事务生效
+	if !(cmdName == "client" && len(cmdLine) > 1 && strings.EqualFold(string(cmdLine[1]), "caching")) {
+		defer func() {
+			if c != nil && !c.InMultiState() {
+				mdb.tracking.resetCaching(c)
+			}
+		}()
+	}
+	// 订阅了频道的连接只能执行订阅相关的指令
+	if errReply := CheckSubscribeContext(c, cmdName); errReply != nil {
+		return errReply
+	}
+	// 脚本执行超时后只允许 SCRIPT KILL
+	if errReply := mdb.scripts.checkBusy(cmdLine); errReply != nil {
+		return errReply
+	}
+	if isInternalCommand(cmdName) && !isInternalConn(c) {
+		return reply.MakeErrReply("ERR unknown command '" + cmdName + "'")
+	}
+	// 内存超过 maxmemory 时淘汰 key 或拒绝写入
+	if errReply := mdb.checkMemory(c, cmdName); errReply != nil {
+		return errReply
+	}
+	switch cmdName {
+	case "select": // 选择db的指令，select 1：选择第一个分db
+		if c.InMultiState() {
+			return reply.MakeErrReply("ERR command 'select' cannot be used in MULTI")
+		}
 		if len(cmdLine) != 2 {
 			return reply.MakeArgNumErrReply("select")
 		}
 		return execSelect(c, mdb, cmdLine[1:])
+	case "flushall": // 清空所有db
+		if c.InMultiState() {
+			return reply.MakeErrReply("ERR command 'flushall' cannot be used in MULTI")
+		}
+		return mdb.flushAll(cmdLine)
+	case "move", "copy", "swapdb": // 涉及多个db的指令
+		if c.InMultiState() {
+			return reply.MakeErrReply("ERR command '" + cmdName + "' cannot be used in MULTI")
+		}
+		return mdb.execCrossDB(c, cmdName, cmdLine)
+	case "subscribe", "unsubscribe", "psubscribe", "punsubscribe", "publish":
+		if c.InMultiState() && cmdName != "publish" {
+			return reply.MakeErrReply("ERR command '" + cmdName + "' cannot be used in MULTI")
+		}
+		return mdb.execPubSub(c, cmdName, cmdLine)
+	case "config":
+		if c.InMultiState() {
+			return reply.MakeErrReply("ERR command 'config' cannot be used in MULTI")
+		}
+		return execConfig(cmdLine[1:])
+	case "client":
+		if c.InMultiState() {
+			return reply.MakeErrReply("ERR command 'client' cannot be used in MULTI")
+		}
+		return mdb.execClient(c, cmdLine[1:])
+	case "hello":
+		if c.InMultiState() {
+			return reply.MakeErrReply("ERR command 'hello' cannot be used in MULTI")
+		}
+		return execHello(c, cmdLine[1:])
 	}
 	// 操作db的指令：set k v; get k
 	dbIndex := c.GetDBIndex()
-	selectedDB := mdb.dbSet[dbIndex]
+	selectedDB := mdb.selectDB(dbIndex)
 	return selectedDB.Exec(c, cmdLine)
 }
 
+// selectDB 返回第 dbIndex 个 DB
+func (mdb *StandaloneDatabase) selectDB(dbIndex int) *DB {
+	return mdb.dbSet[dbIndex].Load().(*DB)
+}
+
+// ExecWithLock 执行指令但不加锁, 调用方需要通过 RWLocks 提前为相关 key 加锁
+func (mdb *StandaloneDatabase) ExecWithLock(c resp.Connection, cmdLine [][]byte) resp.Reply {
+	selectedDB := mdb.selectDB(c.GetDBIndex())
+	result := selectedDB.execWithLock(cmdLine)
+	if !reply.IsErrorReply(result) {
+		selectedDB.invalidateCommand(c, cmdLine)
+	}
+	return result
+}
+
+// ExecMulti 在当前选择的 DB 中原子地执行一组指令
+func (mdb *StandaloneDatabase) ExecMulti(c resp.Connection, cmdLines []CmdLine) resp.Reply {
+	selectedDB := mdb.selectDB(c.GetDBIndex())
+	return selectedDB.ExecMulti(cmdLines)
+}
+
+// GetUndoLogs 返回指令在给定 DB 上的回滚指令
+func (mdb *StandaloneDatabase) GetUndoLogs(dbIndex int, cmdLine [][]byte) ([]CmdLine, error) {
+	return mdb.selectDB(dbIndex).GetUndoLogs(cmdLine)
+}
+
+// RWLocks 为给定 DB 中的 key 加锁
+func (mdb *StandaloneDatabase) RWLocks(dbIndex int, writeKeys []string, readKeys []string) {
+	mdb.selectDB(dbIndex).RWLocks(writeKeys, readKeys)
+}
+
+// RWUnLocks 释放给定 DB 中 key 的锁
+func (mdb *StandaloneDatabase) RWUnLocks(dbIndex int, writeKeys []string, readKeys []string) {
+	mdb.selectDB(dbIndex).RWUnLocks(writeKeys, readKeys)
+}
+
+// GetEntity 读取给定 DB 中的 key
+func (mdb *StandaloneDatabase) GetEntity(dbIndex int, key string) (*database.DataEntity, bool) {
+	return mdb.selectDB(dbIndex).GetEntity(key)
+}
+
+// GetExpireTime 读取给定 DB 中 key 的过期时间
+func (mdb *StandaloneDatabase) GetExpireTime(dbIndex int, key string) (time.Time, bool) {
+	return mdb.selectDB(dbIndex).getExpireTime(key)
+}
+
 // Close 关闭数据库
 func (mdb *StandaloneDatabase) Close() {
 
 }
 
+// AfterClientClose 连接关闭后取消它的所有订阅, 并唤醒阻塞中的指令
 func (mdb *StandaloneDatabase) AfterClientClose(c resp.Connection) {
+	mdb.hub.UnsubscribeAll(c)
+	mdb.tracking.unregister(c)
+	for i := range mdb.dbSet {
+		mdb.selectDB(i).blocking.cancel(c)
+	}
+}
+
+// CheckSubscribeContext 订阅了频道的连接只能执行订阅相关的指令, 其它指令返回错误;
+// RESP3 的消息以 push 发送, 可以与普通回复区分, 因此不受限制
+func CheckSubscribeContext(c resp.Connection, cmdName string) reply.ErrorReply {
+	if c.SubsCount() == 0 || c.GetProtocol() >= reply.Resp3 {
+		return nil
+	}
+	switch cmdName {
+	case "subscribe", "unsubscribe", "psubscribe", "punsubscribe", "ping", "quit":
+		return nil
+	}
+	return reply.MakeErrReply("ERR Can't execute '" + cmdName +
+		"': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context")
+}
+
+// execPubSub 执行发布订阅指令
+func (mdb *StandaloneDatabase) execPubSub(c resp.Connection, cmdName string, cmdLine [][]byte) resp.Reply {
+	args := cmdLine[1:]
+	switch cmdName {
+	case "subscribe":
+		if len(args) < 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return mdb.hub.Subscribe(c, args)
+	case "unsubscribe":
+		return mdb.hub.UnSubscribe(c, args)
+	case "psubscribe":
+		if len(args) < 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return mdb.hub.PSubscribe(c, args)
+	case "punsubscribe":
+		return mdb.hub.PUnSubscribe(c, args)
+	case "publish":
+		if len(args) != 2 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return reply.MakeIntReply(int64(mdb.hub.Publish(string(args[0]), args[1])))
+	}
+	return reply.MakeErrReply("ERR unknown command '" + cmdName + "'")
+}
+
+// flushAll FLUSHALL [ASYNC|SYNC]: 清空所有db, 并记录到aof
+func (mdb *StandaloneDatabase) flushAll(cmdLine [][]byte) resp.Reply {
+	if errReply := checkFlushMode(cmdLine[1:]); errReply != nil {
+		return errReply
+	}
+	for i := range mdb.dbSet {
+		mdb.selectDB(i).Flush()
+	}
+	mdb.tracking.invalidateAll()
+	if mdb.aofHandler != nil {
+		mdb.aofHandler.AddAof(0, cmdLine)
+	}
+	return reply.MakeOkReply()
 }
 
 // 提供用户选择DB的功能
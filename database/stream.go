@@ -0,0 +1,752 @@
+package database
+
+import (
+	"GoRedis/datastruct/stream"
+	"GoRedis/interface/database"
+	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errStreamIDTooSmall = reply.MakeErrReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	errStreamIDZero     = reply.MakeErrReply("ERR The ID specified in XADD must be greater than 0-0")
+	errStreamExhausted  = reply.MakeErrReply("ERR The stream has exhausted the last possible ID, unable to add more items")
+)
+
+// getAsStream 返回 key 对应的 Stream, key 不存在时返回 nil
+func (db *DB) getAsStream(key string) (*database.DataEntity, *stream.Stream, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil, nil
+	}
+	s, ok := entity.Data.(*stream.Stream)
+	if !ok {
+		return nil, nil, &reply.WrongTypeErrReply{}
+	}
+	return entity, s, nil
+}
+
+// entrySize 估算一条消息的内存占用
+func entrySize(entry *stream.Entry) int64 {
+	size := int64(16) + elementOverhead // ID
+	for _, field := range entry.Fields {
+		size += int64(len(field))
+	}
+	return size
+}
+
+func entriesSize(entries []*stream.Entry) int64 {
+	var size int64
+	for _, entry := range entries {
+		size += entrySize(entry)
+	}
+	return size
+}
+
+// makeEntryReply 一条消息: [id, [field, value, ...]]
+func makeEntryReply(entry *stream.Entry) resp.Reply {
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(entry.ID.String())),
+		reply.MakeMultiBulkReply(entry.Fields),
+	})
+}
+
+func makeEntriesReply(entries []*stream.Entry) resp.Reply {
+	replies := make([]resp.Reply, len(entries))
+	for i, entry := range entries {
+		replies[i] = makeEntryReply(entry)
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+func parseStreamID(arg []byte, defaultSeq uint64) (stream.ID, reply.ErrorReply) {
+	id, _, err := stream.ParseID(string(arg), defaultSeq)
+	if err != nil {
+		return stream.ID{}, reply.MakeErrReply(err.Error())
+	}
+	return id, nil
+}
+
+/* ---- 裁剪 ---- */
+
+// parseTrimArgs 解析 MAXLEN|MINID [=|~] threshold [LIMIT count], 返回下一个参数的位置
+func parseTrimArgs(args [][]byte, i int) (*stream.TrimOptions, int, reply.ErrorReply) {
+	opts := &stream.TrimOptions{
+		ByMinID: strings.ToLower(string(args[i])) == "minid",
+	}
+	i++
+	if i < len(args) {
+		switch string(args[i]) {
+		case "~":
+			opts.Approx = true
+			i++
+		case "=":
+			i++
+		}
+	}
+	if i >= len(args) {
+		return nil, 0, reply.MakeSyntaxErrReply()
+	}
+	if opts.ByMinID {
+		minID, errReply := parseStreamID(args[i], 0)
+		if errReply != nil {
+			return nil, 0, errReply
+		}
+		opts.MinID = minID
+	} else {
+		maxLen, err := strconv.ParseInt(string(args[i]), 10, 64)
+		if err != nil {
+			return nil, 0, reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		if maxLen < 0 {
+			return nil, 0, reply.MakeErrReply("ERR The MAXLEN argument must be >= 0.")
+		}
+		opts.MaxLen = int(maxLen)
+	}
+	i++
+	if i < len(args) && strings.ToLower(string(args[i])) == "limit" {
+		if i+1 >= len(args) {
+			return nil, 0, reply.MakeSyntaxErrReply()
+		}
+		limit, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil || limit < 0 || limit > math.MaxInt32 {
+			return nil, 0, reply.MakeErrReply("ERR The LIMIT argument must be >= 0.")
+		}
+		if !opts.Approx {
+			return nil, 0, reply.MakeErrReply("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		opts.Limit = int(limit)
+		i += 2
+	}
+	return opts, i, nil
+}
+
+// trimStream 裁剪后调整内存占用并写入 aof
+// aof 中记录裁剪后剩余的第一条消息的 ID, 近似裁剪在重放时的结果与此时相同
+func (db *DB) trimStream(key string, entity *database.DataEntity, s *stream.Stream, opts *stream.TrimOptions) int {
+	deleted := s.Trim(opts)
+	if len(deleted) == 0 {
+		return 0
+	}
+	db.growEntity(entity, -entriesSize(deleted))
+	if first, ok := s.First(); ok {
+		db.addAof(utils.ToCmdLine("xtrim", key, "minid", first.ID.String()))
+	} else {
+		db.addAof(utils.ToCmdLine("xtrim", key, "maxlen", "0"))
+	}
+	return len(deleted)
+}
+
+/* ---- 写入 ---- */
+
+// nextStreamID 解析 XADD 的 ID: *、ms-* 或 ms-seq, 返回的 ID 一定大于 Stream 的 lastID
+func nextStreamID(s *stream.Stream, arg []byte) (stream.ID, reply.ErrorReply) {
+	str := string(arg)
+	lastID := s.LastID()
+	if str == "*" {
+		id, ok := s.NextID(uint64(nowMillis()))
+		if !ok {
+			return stream.ID{}, errStreamExhausted
+		}
+		return id, nil
+	}
+	if strings.HasSuffix(str, "-*") {
+		ms, err := strconv.ParseUint(strings.TrimSuffix(str, "-*"), 10, 64)
+		if err != nil {
+			return stream.ID{}, reply.MakeErrReply("ERR Invalid stream ID specified as stream command argument")
+		}
+		if ms < lastID.Ms {
+			return stream.ID{}, errStreamIDTooSmall
+		}
+		if ms > lastID.Ms {
+			return stream.ID{Ms: ms}, nil
+		}
+		if lastID.Seq == math.MaxUint64 {
+			return stream.ID{}, errStreamIDTooSmall
+		}
+		return stream.ID{Ms: ms, Seq: lastID.Seq + 1}, nil
+	}
+	id, errReply := parseStreamID(arg, 0)
+	if errReply != nil {
+		return stream.ID{}, errReply
+	}
+	if id.IsZero() {
+		return stream.ID{}, errStreamIDZero
+	}
+	if !lastID.Less(id) {
+		return stream.ID{}, errStreamIDTooSmall
+	}
+	return id, nil
+}
+
+// execXAdd XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+func execXAdd(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	noMkStream := false
+	var trimOpts *stream.TrimOptions
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "nomkstream":
+			noMkStream = true
+			continue
+		case "maxlen", "minid":
+			opts, next, errReply := parseTrimArgs(args, i)
+			if errReply != nil {
+				return errReply
+			}
+			trimOpts = opts
+			i = next - 1
+			continue
+		}
+		break
+	}
+	// ID 之后至少有一对 field value
+	if i+1 >= len(args) || (len(args)-i-1)%2 != 0 {
+		return reply.MakeArgNumErrReply("xadd")
+	}
+	fields := args[i+1:]
+
+	entity, s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil && noMkStream {
+		return reply.MakeNullBulkReply()
+	}
+	created := s == nil
+	if created {
+		s = stream.Make()
+	}
+	id, errReply := nextStreamID(s, args[i])
+	if errReply != nil {
+		return errReply
+	}
+	values := make([][]byte, len(fields))
+	copy(values, fields)
+	entry := s.Add(id, values)
+	if created {
+		entity = &database.DataEntity{Data: s}
+		db.PutEntity(key, entity)
+	} else {
+		db.growEntity(entity, entrySize(entry))
+	}
+	// aof 中记录生成的 ID, 重放时结果相同
+	db.addAof(utils.ToCmdLine2("xadd", append([][]byte{args[0], []byte(id.String())}, values...)...))
+	db.notify(notifyStream, "xadd", key)
+	if trimOpts != nil && db.trimStream(key, entity, s, trimOpts) > 0 {
+		db.notify(notifyStream, "xtrim", key)
+	}
+	// XREAD 不会取走消息, 唤醒所有等待的连接
+	db.blocking.signalAll(key)
+	return reply.MakeBulkReply([]byte(id.String()))
+}
+
+// execXTrim XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func execXTrim(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	strategy := strings.ToLower(string(args[1]))
+	if strategy != "maxlen" && strategy != "minid" {
+		return reply.MakeSyntaxErrReply()
+	}
+	opts, next, errReply := parseTrimArgs(args, 1)
+	if errReply != nil {
+		return errReply
+	}
+	if next != len(args) {
+		return reply.MakeSyntaxErrReply()
+	}
+	entity, s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeIntReply(0)
+	}
+	deleted := db.trimStream(key, entity, s, opts)
+	if deleted > 0 {
+		db.notify(notifyStream, "xtrim", key)
+	}
+	return reply.MakeIntReply(int64(deleted))
+}
+
+// execXDel XDEL key id [id ...]
+func execXDel(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	ids := make([]stream.ID, len(args)-1)
+	for i, arg := range args[1:] {
+		id, errReply := parseStreamID(arg, 0)
+		if errReply != nil {
+			return errReply
+		}
+		ids[i] = id
+	}
+	entity, s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeIntReply(0)
+	}
+	deleted := s.Delete(ids...)
+	if len(deleted) > 0 {
+		db.growEntity(entity, -entriesSize(deleted))
+		db.notify(notifyStream, "xdel", key)
+		db.addAof(utils.ToCmdLine2("xdel", args...))
+	}
+	return reply.MakeIntReply(int64(len(deleted)))
+}
+
+/* ---- 读取 ---- */
+
+// execXLen XLEN key
+func execXLen(db *DB, args [][]byte) resp.Reply {
+	_, s, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(s.Len()))
+}
+
+// parseRangeID 解析范围查询的边界: -、+、ms、ms-seq, 以 ( 开头时不包含边界本身
+// 省略序号时, 起点的序号为 0, 终点的序号为最大值
+func parseRangeID(arg []byte, isStart bool) (stream.ID, reply.ErrorReply) {
+	str := string(arg)
+	switch str {
+	case "-":
+		return stream.MinID, nil
+	case "+":
+		return stream.MaxID, nil
+	}
+	exclusive := strings.HasPrefix(str, "(")
+	if exclusive {
+		str = str[1:]
+	}
+	var defaultSeq uint64
+	if !isStart {
+		defaultSeq = math.MaxUint64
+	}
+	id, errReply := parseStreamID([]byte(str), defaultSeq)
+	if errReply != nil {
+		return stream.ID{}, errReply
+	}
+	if !exclusive {
+		return id, nil
+	}
+	var ok bool
+	if isStart {
+		id, ok = id.Next()
+		if !ok {
+			return stream.ID{}, reply.MakeErrReply("ERR invalid start ID for the interval")
+		}
+	} else {
+		id, ok = id.Prev()
+		if !ok {
+			return stream.ID{}, reply.MakeErrReply("ERR invalid end ID for the interval")
+		}
+	}
+	return id, nil
+}
+
+// execRangeGeneric XRANGE key start end [COUNT count] / XREVRANGE key end start [COUNT count]
+func execRangeGeneric(db *DB, args [][]byte, reverse bool) resp.Reply {
+	startArg, endArg := args[1], args[2]
+	if reverse {
+		startArg, endArg = args[2], args[1]
+	}
+	start, errReply := parseRangeID(startArg, true)
+	if errReply != nil {
+		return errReply
+	}
+	end, errReply := parseRangeID(endArg, false)
+	if errReply != nil {
+		return errReply
+	}
+	count := 0
+	if len(args) > 3 {
+		if len(args) != 5 || strings.ToLower(string(args[3])) != "count" {
+			return reply.MakeSyntaxErrReply()
+		}
+		n, err := strconv.ParseInt(string(args[4]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		if n <= 0 {
+			return reply.MakeEmptyMultiBulkBytes()
+		}
+		if n > math.MaxInt32 {
+			n = math.MaxInt32
+		}
+		count = int(n)
+	}
+	_, s, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil || end.Less(start) {
+		return reply.MakeEmptyMultiBulkBytes()
+	}
+	if reverse {
+		return makeEntriesReply(s.RevRange(end, start, count))
+	}
+	return makeEntriesReply(s.Range(start, end, count))
+}
+
+// execXRange XRANGE key start end [COUNT count]
+func execXRange(db *DB, args [][]byte) resp.Reply {
+	return execRangeGeneric(db, args, false)
+}
+
+// execXRevRange XREVRANGE key end start [COUNT count]
+func execXRevRange(db *DB, args [][]byte) resp.Reply {
+	return execRangeGeneric(db, args, true)
+}
+
+/* ---- XREAD ---- */
+
+// xreadArgs XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+type xreadArgs struct {
+	group    string
+	consumer string
+	count    int
+	block    bool
+	timeout  time.Duration
+	noAck    bool
+	streams  int // STREAMS 之后第一个 key 的位置
+	keyCount int
+}
+
+func parseXReadArgs(args [][]byte, isGroup bool) (*xreadArgs, reply.ErrorReply) {
+	cmdName := "xread"
+	if isGroup {
+		cmdName = "xreadgroup"
+	}
+	result := &xreadArgs{}
+	hasGroup := false
+	i := 0
+	for ; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		if option == "streams" {
+			break
+		}
+		if option == "noack" && isGroup {
+			result.noAck = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		switch option {
+		case "count":
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if n > math.MaxInt32 {
+				n = math.MaxInt32
+			}
+			result.count = int(n)
+		case "block":
+			ms, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return nil, reply.MakeErrReply("ERR timeout is negative")
+			}
+			result.block = true
+			result.timeout = time.Duration(ms) * time.Millisecond
+		case "group":
+			if !isGroup {
+				return nil, reply.MakeErrReply("ERR The GROUP option is only supported by XREADGROUP. You called XREAD instead.")
+			}
+			if i+2 >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			result.group = string(args[i+1])
+			result.consumer = string(args[i+2])
+			hasGroup = true
+			i++
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		i++
+	}
+	result.streams = i + 1
+	remaining := len(args) - result.streams
+	if i >= len(args) || remaining == 0 {
+		return nil, reply.MakeSyntaxErrReply()
+	}
+	if remaining%2 != 0 {
+		return nil, reply.MakeErrReply("ERR Unbalanced '" + cmdName + "' list of streams: " +
+			"for each stream key an ID or '$' must be specified.")
+	}
+	if isGroup && !hasGroup {
+		return nil, reply.MakeErrReply("ERR Missing GROUP option for XREADGROUP")
+	}
+	result.keyCount = remaining / 2
+	return result, nil
+}
+
+func (xargs *xreadArgs) keys(args [][]byte) []string {
+	keys := make([]string, xargs.keyCount)
+	for i := range keys {
+		keys[i] = string(args[xargs.streams+i])
+	}
+	return keys
+}
+
+// idIndex 返回第 i 个 key 对应的 ID 在参数中的位置
+func (xargs *xreadArgs) idIndex(i int) int {
+	return xargs.streams + xargs.keyCount + i
+}
+
+// xreadKeys 返回 XREAD 读取的 key, 参数不合法时返回 nil
+func xreadKeys(args [][]byte) []string {
+	xargs, errReply := parseXReadArgs(args, false)
+	if errReply != nil {
+		return nil
+	}
+	return xargs.keys(args)
+}
+
+func xreadTimeout(args [][]byte) (time.Duration, bool, reply.ErrorReply) {
+	xargs, errReply := parseXReadArgs(args, false)
+	if errReply != nil {
+		return 0, false, errReply
+	}
+	return xargs.timeout, xargs.block, nil
+}
+
+// tryXRead 返回每个 key 中 ID 大于指定 ID 的消息, 没有任何消息时返回 false
+// $ 表示 Stream 当前的 lastID, 第一次尝试时替换为具体的 ID, 阻塞期间只等待之后写入的消息
+func tryXRead(db *DB, args [][]byte) (resp.Reply, bool) {
+	xargs, errReply := parseXReadArgs(args, false)
+	if errReply != nil {
+		return errReply, true
+	}
+	n := xargs.keyCount
+	streams := make([]*stream.Stream, n)
+	starts := make([]stream.ID, n)
+	for i := 0; i < n; i++ {
+		_, s, errReply := db.getAsStream(string(args[xargs.streams+i]))
+		if errReply != nil {
+			return errReply, true
+		}
+		streams[i] = s
+		idIndex := xargs.idIndex(i)
+		var id stream.ID
+		switch string(args[idIndex]) {
+		case "$":
+			if s != nil {
+				id = s.LastID()
+			}
+			args[idIndex] = []byte(id.String())
+		case ">":
+			return reply.MakeErrReply("ERR The > ID can be specified only when calling XREADGROUP " +
+				"using the GROUP <group> <consumer> option."), true
+		default:
+			id, errReply = parseStreamID(args[idIndex], 0)
+			if errReply != nil {
+				return errReply, true
+			}
+		}
+		starts[i] = id
+	}
+
+	results := make([]resp.Reply, 0)
+	for i, s := range streams {
+		if s == nil {
+			continue
+		}
+		start, ok := starts[i].Next()
+		if !ok {
+			continue
+		}
+		entries := s.Range(start, stream.MaxID, xargs.count)
+		if len(entries) == 0 {
+			continue
+		}
+		results = append(results, reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply(args[xargs.streams+i]),
+			makeEntriesReply(entries),
+		}))
+	}
+	if len(results) == 0 {
+		return nil, false
+	}
+	return reply.MakeMultiRawReply(results), true
+}
+
+func prepareXRead(args [][]byte) ([]string, []string) {
+	return nil, xreadKeys(args)
+}
+
+/* ---- 序列化 ---- */
+
+// execXRestore XRESTORE key last-id entries-added max-deleted-id count [id field-count field value ...]... [groups]
+// 内部指令, 由 aof.EntityToCmd 生成, 用于回滚和集群间迁移 key
+func execXRestore(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	s, errReply := parseStreamDump(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	db.PutEntity(key, &database.DataEntity{Data: s})
+	db.addAof(utils.ToCmdLine2("xrestore", args...))
+	return reply.MakeOkReply()
+}
+
+func parseStreamDump(args [][]byte) (*stream.Stream, reply.ErrorReply) {
+	errInvalidDump := reply.MakeErrReply("ERR invalid stream dump")
+	lastID, errReply := parseStreamID(args[0], 0)
+	if errReply != nil {
+		return nil, errReply
+	}
+	entriesAdded, err1 := strconv.ParseUint(string(args[1]), 10, 64)
+	maxDeletedID, errReply := parseStreamID(args[2], 0)
+	if errReply != nil {
+		return nil, errReply
+	}
+	count, err2 := strconv.ParseUint(string(args[3]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return nil, errInvalidDump
+	}
+	s := stream.Make()
+	i := 4
+	for n := uint64(0); n < count; n++ {
+		if i+1 >= len(args) {
+			return nil, errInvalidDump
+		}
+		id, errReply := parseStreamID(args[i], 0)
+		if errReply != nil {
+			return nil, errReply
+		}
+		fieldCount, err := strconv.ParseUint(string(args[i+1]), 10, 64)
+		if err != nil || fieldCount == 0 || fieldCount%2 != 0 || uint64(len(args)-i-2) < fieldCount {
+			return nil, errInvalidDump
+		}
+		if last, ok := s.Last(); ok && !last.ID.Less(id) {
+			return nil, errInvalidDump
+		}
+		fields := make([][]byte, fieldCount)
+		copy(fields, args[i+2:i+2+int(fieldCount)])
+		s.Add(id, fields)
+		i += 2 + int(fieldCount)
+	}
+	if !s.SetLastID(lastID) {
+		return nil, errInvalidDump
+	}
+	s.SetMeta(entriesAdded, maxDeletedID)
+	if i < len(args) && !parseGroupsDump(s, args[i:]) {
+		return nil, errInvalidDump
+	}
+	return s, nil
+}
+
+// parseGroupsDump 解析消费者组: group-count [name last-id entries-read consumer-count [name seen-time active-time]...
+// pending-count [id consumer delivery-time delivery-count]...]...
+func parseGroupsDump(s *stream.Stream, args [][]byte) bool {
+	i := 0
+	failed := false
+	nextString := func() string {
+		if i >= len(args) {
+			failed = true
+			return ""
+		}
+		i++
+		return string(args[i-1])
+	}
+	nextInt := func() int64 {
+		n, err := strconv.ParseInt(nextString(), 10, 64)
+		if err != nil {
+			failed = true
+		}
+		return n
+	}
+	nextID := func() stream.ID {
+		id, _, err := stream.ParseID(nextString(), 0)
+		if err != nil {
+			failed = true
+		}
+		return id
+	}
+	groupCount := nextInt()
+	for n := int64(0); n < groupCount && !failed; n++ {
+		g, created := s.CreateGroup(nextString(), nextID(), nextInt())
+		if !created {
+			return false
+		}
+		consumerCount := nextInt()
+		for m := int64(0); m < consumerCount && !failed; m++ {
+			c, _ := g.CreateConsumer(nextString(), nextInt())
+			c.ActiveTime = nextInt()
+		}
+		pendingCount := nextInt()
+		for m := int64(0); m < pendingCount && !failed; m++ {
+			id := nextID()
+			c, ok := g.Consumer(nextString())
+			if !ok {
+				return false
+			}
+			deliveryTime := nextInt()
+			g.Deliver(id, c, deliveryTime).DeliveryCount = uint64(nextInt())
+		}
+	}
+	return !failed && i == len(args)
+}
+
+// copyStream 复制 Stream 及其消费者组, 消息的内容是只读的, 可以共享
+func copyStream(s *stream.Stream) *stream.Stream {
+	copied := stream.Make()
+	s.ForEach(func(entry *stream.Entry) bool {
+		copied.Add(entry.ID, entry.Fields)
+		return true
+	})
+	copied.SetLastID(s.LastID())
+	copied.SetMeta(s.EntriesAdded(), s.MaxDeletedID())
+	for _, g := range s.Groups() {
+		copiedGroup, _ := copied.CreateGroup(g.Name, g.LastID, g.EntriesRead)
+		for _, c := range g.Consumers() {
+			copiedConsumer, _ := copiedGroup.CreateConsumer(c.Name, c.SeenTime)
+			copiedConsumer.ActiveTime = c.ActiveTime
+		}
+		g.ForEachPending(stream.MinID, func(p *stream.PendingEntry) bool {
+			c, _ := copiedGroup.Consumer(p.Consumer.Name)
+			copiedGroup.Deliver(p.ID, c, p.DeliveryTime).DeliveryCount = p.DeliveryCount
+			return true
+		})
+	}
+	return copied
+}
+
+func init() {
+	RegisterCommand("XAdd", execXAdd, writeFirstKey, rollbackFirstKey, -5).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("XTrim", execXTrim, writeFirstKey, rollbackFirstKey, -4).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("XDel", execXDel, writeFirstKey, rollbackFirstKey, -3).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("XLen", execXLen, readFirstKey, nil, 2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("XRange", execXRange, readFirstKey, nil, -4).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("XRevRange", execXRevRange, readFirstKey, nil, -4).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("XRestore", execXRestore, writeFirstKey, rollbackFirstKey, -6).
+		attachCommandExtra(FlagWrite|FlagDenyOOM|FlagInternal, 1, 1, 1)
+
+	// key 的位置不固定, 集群中单独处理
+	registerBlockingCommand("XRead", tryXRead, xreadKeys, xreadTimeout, reply.MakeNullMultiBulkBytes(), false,
+		prepareXRead, nil, -4).
+		attachCommandExtra(FlagReadOnly, 0, 0, 0)
+}
@@ -0,0 +1,1057 @@
+package database
+
+/*消费者组: XGROUP、XREADGROUP、XACK、XPENDING、XCLAIM、XAUTOCLAIM、XINFO*/
+
+import (
+	"GoRedis/datastruct/stream"
+	"GoRedis/interface/database"
+	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errXGroupNoKey = reply.MakeErrReply("ERR The XGROUP subcommand requires the key to exist. " +
+	"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+
+// pendingEntrySize 估算一条待确认消息的内存占用
+const pendingEntrySize = 16 + elementOverhead
+
+func consumerSize(c *stream.Consumer) int64 {
+	return int64(len(c.Name)) + elementOverhead
+}
+
+// groupSize 估算消费者组的内存占用, 包括消费者和待确认的消息
+func groupSize(g *stream.Group) int64 {
+	size := int64(len(g.Name)) + elementOverhead + int64(g.PendingLen())*pendingEntrySize
+	for _, c := range g.Consumers() {
+		size += consumerSize(c)
+	}
+	return size
+}
+
+func makeNoGroupErr(key string, group string) reply.ErrorReply {
+	return reply.MakeErrReply("NOGROUP No such key '" + key + "' or consumer group '" + group + "'")
+}
+
+// getGroup 返回 key 对应的 Stream 及其消费者组, 不存在时返回 nil
+func (db *DB) getGroup(key string, name string) (*database.DataEntity, *stream.Stream, *stream.Group, reply.ErrorReply) {
+	entity, s, errReply := db.getAsStream(key)
+	if errReply != nil || s == nil {
+		return nil, nil, nil, errReply
+	}
+	g, _ := s.Group(name)
+	return entity, s, g, nil
+}
+
+// getConsumer 返回消费者, 不存在时创建
+func (db *DB) getConsumer(key string, entity *database.DataEntity, g *stream.Group, name string, now int64) *stream.Consumer {
+	c, created := g.CreateConsumer(name, now)
+	if created {
+		db.growEntity(entity, consumerSize(c))
+		db.notify(notifyStream, "xgroup-createconsumer", key)
+		db.addAof(utils.ToCmdLine("xgroup", "createconsumer", key, g.Name, name))
+	}
+	return c
+}
+
+// addClaimAof 认领的结果以 XCLAIM FORCE JUSTID 的形式写入 aof, 重放时投递时间和次数都与此时相同
+func (db *DB) addClaimAof(key string, g *stream.Group, p *stream.PendingEntry) {
+	db.addAof(utils.ToCmdLine("xclaim", key, g.Name, p.Consumer.Name, "0", p.ID.String(),
+		"time", strconv.FormatInt(p.DeliveryTime, 10),
+		"retrycount", strconv.FormatUint(p.DeliveryCount, 10),
+		"force", "justid", "lastid", g.LastID.String()))
+}
+
+// ackDeleted 已经被删除的消息无法再投递, 把它们移出待确认列表
+func (db *DB) ackDeleted(key string, entity *database.DataEntity, g *stream.Group, ids []stream.ID) {
+	if len(ids) == 0 {
+		return
+	}
+	cmdLine := utils.ToCmdLine("xack", key, g.Name)
+	for _, id := range ids {
+		g.Ack(id)
+		cmdLine = append(cmdLine, []byte(id.String()))
+	}
+	db.growEntity(entity, -int64(len(ids))*pendingEntrySize)
+	db.addAof(cmdLine)
+}
+
+func parseEntriesRead(arg []byte) (int64, reply.ErrorReply) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if n < -1 {
+		return 0, reply.MakeErrReply("ERR value for ENTRIESREAD must be positive or -1")
+	}
+	return n, nil
+}
+
+/* ---- XGROUP ---- */
+
+// execXGroup XGROUP CREATE|SETID|DESTROY|CREATECONSUMER|DELCONSUMER key group ...
+func execXGroup(db *DB, args [][]byte) resp.Reply {
+	sub := strings.ToLower(string(args[0]))
+	argNum := map[string]int{"create": -4, "setid": -4, "destroy": 3, "createconsumer": 4, "delconsumer": 4}
+	arity, ok := argNum[sub]
+	if !ok {
+		return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try XGROUP HELP.")
+	}
+	if !validateArity(arity, args) {
+		return reply.MakeArgNumErrReply("xgroup|" + sub)
+	}
+	key := string(args[1])
+	if sub == "create" {
+		return execXGroupCreate(db, args[1:])
+	}
+	entity, s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return errXGroupNoKey
+	}
+	name := string(args[2])
+	g, ok := s.Group(name)
+	if sub == "destroy" {
+		if !ok {
+			return reply.MakeIntReply(0)
+		}
+		db.growEntity(entity, -groupSize(g))
+		s.DestroyGroup(name)
+		db.notify(notifyStream, "xgroup-destroy", key)
+		db.addAof(utils.ToCmdLine2("xgroup", args...))
+		// 唤醒阻塞在该组上的 XREADGROUP, 返回 NOGROUP 错误
+		db.blocking.signalAll(key)
+		return reply.MakeIntReply(1)
+	}
+	if !ok {
+		return reply.MakeErrReply("NOGROUP No such consumer group '" + name + "' for key name '" + key + "'")
+	}
+	switch sub {
+	case "setid":
+		return execXGroupSetID(db, s, g, args[1:])
+	case "createconsumer":
+		c, created := g.CreateConsumer(string(args[3]), nowMillis())
+		if !created {
+			return reply.MakeIntReply(0)
+		}
+		db.growEntity(entity, consumerSize(c))
+		db.notify(notifyStream, "xgroup-createconsumer", key)
+		db.addAof(utils.ToCmdLine2("xgroup", args...))
+		return reply.MakeIntReply(1)
+	default: // delconsumer
+		c, deleted := g.DeleteConsumer(string(args[3]))
+		if !deleted {
+			return reply.MakeIntReply(0)
+		}
+		pending := c.PendingLen()
+		db.growEntity(entity, -consumerSize(c)-int64(pending)*pendingEntrySize)
+		db.notify(notifyStream, "xgroup-delconsumer", key)
+		db.addAof(utils.ToCmdLine2("xgroup", args...))
+		return reply.MakeIntReply(int64(pending))
+	}
+}
+
+// execXGroupCreate XGROUP CREATE key group id|$ [MKSTREAM] [ENTRIESREAD entries-read]
+func execXGroupCreate(db *DB, args [][]byte) resp.Reply {
+	key, name := string(args[0]), string(args[1])
+	mkStream := false
+	var entriesRead int64 = -1
+	for i := 3; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "mkstream":
+			mkStream = true
+		case "entriesread":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			n, errReply := parseEntriesRead(args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			entriesRead = n
+			i++
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	var id stream.ID
+	if string(args[2]) != "$" {
+		var errReply reply.ErrorReply
+		id, errReply = parseStreamID(args[2], 0)
+		if errReply != nil {
+			return errReply
+		}
+	}
+	entity, s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	created := s == nil
+	if created {
+		if !mkStream {
+			return errXGroupNoKey
+		}
+		s = stream.Make()
+	}
+	if string(args[2]) == "$" {
+		id = s.LastID()
+	}
+	g, ok := s.CreateGroup(name, id, entriesRead)
+	if !ok {
+		return reply.MakeErrReply("BUSYGROUP Consumer Group name already exists")
+	}
+	if created {
+		db.PutEntity(key, &database.DataEntity{Data: s})
+	} else {
+		db.growEntity(entity, groupSize(g))
+	}
+	db.notify(notifyStream, "xgroup-create", key)
+	db.addAof(utils.ToCmdLine2("xgroup", append([][]byte{[]byte("create")}, args...)...))
+	return reply.MakeOkReply()
+}
+
+// execXGroupSetID XGROUP SETID key group id|$ [ENTRIESREAD entries-read]
+func execXGroupSetID(db *DB, s *stream.Stream, g *stream.Group, args [][]byte) resp.Reply {
+	var entriesRead int64 = -1
+	if len(args) > 3 {
+		if len(args) != 5 || strings.ToLower(string(args[3])) != "entriesread" {
+			return reply.MakeSyntaxErrReply()
+		}
+		n, errReply := parseEntriesRead(args[4])
+		if errReply != nil {
+			return errReply
+		}
+		entriesRead = n
+	}
+	id := s.LastID()
+	if string(args[2]) != "$" {
+		var errReply reply.ErrorReply
+		id, errReply = parseStreamID(args[2], 0)
+		if errReply != nil {
+			return errReply
+		}
+	}
+	g.LastID = id
+	g.EntriesRead = entriesRead
+	db.notify(notifyStream, "xgroup-setid", string(args[0]))
+	db.addAof(utils.ToCmdLine2("xgroup", append([][]byte{[]byte("setid")}, args...)...))
+	return reply.MakeOkReply()
+}
+
+func prepareXGroup(args [][]byte) ([]string, []string) {
+	return []string{string(args[1])}, nil
+}
+
+func undoXGroup(db *DB, args [][]byte) ([]CmdLine, error) {
+	return rollbackGivenKeys(db, string(args[1]))
+}
+
+/* ---- XREADGROUP ---- */
+
+// readTarget XREADGROUP 读取的一个 Stream
+type readTarget struct {
+	key     string
+	entity  *database.DataEntity
+	stream  *stream.Stream
+	group   *stream.Group
+	newOnly bool      // ID 为 >: 读取从未投递给组内消费者的消息
+	id      stream.ID // 读取消费者待确认列表中 ID 大于 id 的消息
+}
+
+// tryXReadGroup 读取新消息时把消息加入消费者的待确认列表; 读取历史消息时即使没有消息也会返回
+func tryXReadGroup(db *DB, args [][]byte) (resp.Reply, bool) {
+	xargs, errReply := parseXReadArgs(args, true)
+	if errReply != nil {
+		return errReply, true
+	}
+	// 先检查所有 key 和 ID, 全部合法后再投递消息
+	targets := make([]*readTarget, xargs.keyCount)
+	for i, key := range xargs.keys(args) {
+		entity, s, g, errReply := db.getGroup(key, xargs.group)
+		if errReply != nil {
+			return errReply, true
+		}
+		if g == nil {
+			return reply.MakeErrReply("NOGROUP No such key '" + key + "' or consumer group '" + xargs.group +
+				"' in XREADGROUP with GROUP option"), true
+		}
+		target := &readTarget{key: key, entity: entity, stream: s, group: g}
+		switch idArg := args[xargs.idIndex(i)]; string(idArg) {
+		case ">":
+			target.newOnly = true
+		case "$":
+			return reply.MakeErrReply("ERR The $ ID is meaningless in the context of XREADGROUP: " +
+				"you want to read the history of this consumer by specifying a proper ID, " +
+				"or use the > ID to get new messages. The $ ID would just return an empty result set."), true
+		default:
+			target.id, errReply = parseStreamID(idArg, 0)
+			if errReply != nil {
+				return errReply, true
+			}
+		}
+		targets[i] = target
+	}
+
+	now := nowMillis()
+	results := make([]resp.Reply, 0)
+	for _, target := range targets {
+		c := db.getConsumer(target.key, target.entity, target.group, xargs.consumer, now)
+		c.SeenTime = now
+		var entriesReply resp.Reply
+		if target.newOnly {
+			entries := db.deliverNew(target, c, xargs, now)
+			if len(entries) == 0 {
+				continue
+			}
+			entriesReply = makeEntriesReply(entries)
+		} else {
+			entriesReply = makePendingHistoryReply(target.stream, c, target.id, xargs.count)
+		}
+		results = append(results, reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte(target.key)),
+			entriesReply,
+		}))
+	}
+	if len(results) == 0 {
+		return nil, false
+	}
+	return reply.MakeMultiRawReply(results), true
+}
+
+// deliverNew 把组内尚未投递的消息投递给消费者
+func (db *DB) deliverNew(target *readTarget, c *stream.Consumer, xargs *xreadArgs, now int64) []*stream.Entry {
+	s, g := target.stream, target.group
+	start, ok := g.LastID.Next()
+	if !ok {
+		return nil
+	}
+	entries := s.Range(start, stream.MaxID, xargs.count)
+	if len(entries) == 0 {
+		return nil
+	}
+	pendingBefore := g.PendingLen()
+	for _, entry := range entries {
+		s.MarkDelivered(g, entry.ID)
+		if xargs.noAck {
+			continue
+		}
+		p := g.Deliver(entry.ID, c, now)
+		db.addClaimAof(target.key, g, p)
+	}
+	c.ActiveTime = now
+	db.growEntity(target.entity, int64(g.PendingLen()-pendingBefore)*pendingEntrySize)
+	db.addAof(utils.ToCmdLine("xgroup", "setid", target.key, g.Name, g.LastID.String(),
+		"entriesread", strconv.FormatInt(g.EntriesRead, 10)))
+	return entries
+}
+
+// makePendingHistoryReply 消费者待确认列表中 ID 大于 id 的消息; 已经被删除的消息只返回 ID
+func makePendingHistoryReply(s *stream.Stream, c *stream.Consumer, id stream.ID, count int) resp.Reply {
+	replies := make([]resp.Reply, 0)
+	start, ok := id.Next()
+	if !ok {
+		return reply.MakeMultiRawReply(replies)
+	}
+	c.ForEachPending(start, func(p *stream.PendingEntry) bool {
+		if count > 0 && len(replies) >= count {
+			return false
+		}
+		if entry, exists := s.Get(p.ID); exists {
+			replies = append(replies, makeEntryReply(entry))
+		} else {
+			replies = append(replies, reply.MakeMultiRawReply([]resp.Reply{
+				reply.MakeBulkReply([]byte(p.ID.String())),
+				reply.MakeNullMultiBulkBytes(),
+			}))
+		}
+		return true
+	})
+	return reply.MakeMultiRawReply(replies)
+}
+
+// xreadGroupTimeout 只有所有 ID 都是 > 时才会阻塞
+func xreadGroupTimeout(args [][]byte) (time.Duration, bool, reply.ErrorReply) {
+	xargs, errReply := parseXReadArgs(args, true)
+	if errReply != nil {
+		return 0, false, errReply
+	}
+	block := xargs.block
+	for i := 0; i < xargs.keyCount; i++ {
+		if string(args[xargs.idIndex(i)]) != ">" {
+			block = false
+		}
+	}
+	return xargs.timeout, block, nil
+}
+
+func xreadGroupKeys(args [][]byte) []string {
+	xargs, errReply := parseXReadArgs(args, true)
+	if errReply != nil {
+		return nil
+	}
+	return xargs.keys(args)
+}
+
+func prepareXReadGroup(args [][]byte) ([]string, []string) {
+	return xreadGroupKeys(args), nil
+}
+
+func undoXReadGroup(db *DB, args [][]byte) ([]CmdLine, error) {
+	return rollbackGivenKeys(db, xreadGroupKeys(args)...)
+}
+
+/* ---- XACK ---- */
+
+// execXAck XACK key group id [id ...]
+func execXAck(db *DB, args [][]byte) resp.Reply {
+	ids := make([]stream.ID, len(args)-2)
+	for i, arg := range args[2:] {
+		id, errReply := parseStreamID(arg, 0)
+		if errReply != nil {
+			return errReply
+		}
+		ids[i] = id
+	}
+	entity, _, g, errReply := db.getGroup(string(args[0]), string(args[1]))
+	if errReply != nil {
+		return errReply
+	}
+	if g == nil {
+		return reply.MakeIntReply(0)
+	}
+	acked := 0
+	for _, id := range ids {
+		if g.Ack(id) {
+			acked++
+		}
+	}
+	if acked > 0 {
+		db.growEntity(entity, -int64(acked)*pendingEntrySize)
+		db.addAof(utils.ToCmdLine2("xack", args...))
+	}
+	return reply.MakeIntReply(int64(acked))
+}
+
+/* ---- XPENDING ---- */
+
+// execXPending XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func execXPending(db *DB, args [][]byte) resp.Reply {
+	key, name := string(args[0]), string(args[1])
+	if len(args) == 2 {
+		_, _, g, errReply := db.getGroup(key, name)
+		if errReply != nil {
+			return errReply
+		}
+		if g == nil {
+			return makeNoGroupErr(key, name)
+		}
+		return makePendingSummaryReply(g)
+	}
+
+	var minIdle int64
+	i := 2
+	if strings.ToLower(string(args[i])) == "idle" {
+		if len(args) < 4 {
+			return reply.MakeSyntaxErrReply()
+		}
+		n, err := strconv.ParseInt(string(args[3]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		minIdle = n
+		i = 4
+	}
+	if len(args)-i != 3 && len(args)-i != 4 {
+		return reply.MakeSyntaxErrReply()
+	}
+	start, errReply := parseRangeID(args[i], true)
+	if errReply != nil {
+		return errReply
+	}
+	end, errReply := parseRangeID(args[i+1], false)
+	if errReply != nil {
+		return errReply
+	}
+	count, err := strconv.ParseInt(string(args[i+2]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	_, _, g, errReply := db.getGroup(key, name)
+	if errReply != nil {
+		return errReply
+	}
+	if g == nil {
+		return makeNoGroupErr(key, name)
+	}
+	forEach := g.ForEachPending
+	if len(args)-i == 4 {
+		c, ok := g.Consumer(string(args[i+3]))
+		if !ok {
+			return reply.MakeEmptyMultiBulkBytes()
+		}
+		forEach = c.ForEachPending
+	}
+
+	now := nowMillis()
+	replies := make([]resp.Reply, 0)
+	forEach(start, func(p *stream.PendingEntry) bool {
+		if end.Less(p.ID) || int64(len(replies)) >= count {
+			return false
+		}
+		idle := now - p.DeliveryTime
+		if idle < minIdle {
+			return true
+		}
+		replies = append(replies, reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte(p.ID.String())),
+			reply.MakeBulkReply([]byte(p.Consumer.Name)),
+			reply.MakeIntReply(idle),
+			reply.MakeIntReply(int64(p.DeliveryCount)),
+		}))
+		return true
+	})
+	return reply.MakeMultiRawReply(replies)
+}
+
+// makePendingSummaryReply [待确认的消息数量, 最小 ID, 最大 ID, [[消费者, 消息数量]...]]
+func makePendingSummaryReply(g *stream.Group) resp.Reply {
+	if g.PendingLen() == 0 {
+		return reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeIntReply(0),
+			reply.MakeNullBulkReply(),
+			reply.MakeNullBulkReply(),
+			reply.MakeNullMultiBulkBytes(),
+		})
+	}
+	var first, last stream.ID
+	g.ForEachPending(stream.MinID, func(p *stream.PendingEntry) bool {
+		if first.IsZero() {
+			first = p.ID
+		}
+		last = p.ID
+		return true
+	})
+	consumers := make([]resp.Reply, 0)
+	for _, c := range g.Consumers() {
+		if c.PendingLen() == 0 {
+			continue
+		}
+		consumers = append(consumers, reply.MakeMultiBulkReply([][]byte{
+			[]byte(c.Name),
+			[]byte(strconv.Itoa(c.PendingLen())),
+		}))
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeIntReply(int64(g.PendingLen())),
+		reply.MakeBulkReply([]byte(first.String())),
+		reply.MakeBulkReply([]byte(last.String())),
+		reply.MakeMultiRawReply(consumers),
+	})
+}
+
+/* ---- XCLAIM ---- */
+
+// claimArgs XCLAIM 的可选参数
+type claimArgs struct {
+	deliveryTime int64
+	retryCount   int64 // -1 表示未指定
+	force        bool
+	justID       bool
+	lastID       *stream.ID
+}
+
+func parseClaimOptions(args [][]byte, now int64) (*claimArgs, reply.ErrorReply) {
+	opts := &claimArgs{
+		deliveryTime: now,
+		retryCount:   -1,
+	}
+	for i := 0; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		switch option {
+		case "force":
+			opts.force = true
+			continue
+		case "justid":
+			opts.justID = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, reply.MakeErrReply("ERR Unrecognized XCLAIM option '" + string(args[i]) + "'")
+		}
+		value := args[i+1]
+		i++
+		switch option {
+		case "idle", "time", "retrycount":
+			n, err := strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR Invalid " + strings.ToUpper(option) + " option argument for XCLAIM")
+			}
+			switch option {
+			case "idle":
+				opts.deliveryTime = now - n
+			case "time":
+				opts.deliveryTime = n
+			default:
+				opts.retryCount = n
+			}
+		case "lastid":
+			id, errReply := parseStreamID(value, 0)
+			if errReply != nil {
+				return nil, errReply
+			}
+			opts.lastID = &id
+		default:
+			return nil, reply.MakeErrReply("ERR Unrecognized XCLAIM option '" + string(args[i-1]) + "'")
+		}
+	}
+	if opts.deliveryTime < 0 || opts.deliveryTime > now {
+		opts.deliveryTime = now
+	}
+	return opts, nil
+}
+
+func parseMinIdle(arg []byte, cmdName string) (int64, reply.ErrorReply) {
+	minIdle, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, reply.MakeErrReply("ERR Invalid min-idle-time argument for " + cmdName)
+	}
+	if minIdle < 0 {
+		minIdle = 0
+	}
+	return minIdle, nil
+}
+
+// makeClaimedReply JUSTID 时只返回 ID
+func makeClaimedReply(s *stream.Stream, claimed []*stream.PendingEntry, justID bool) resp.Reply {
+	if justID {
+		ids := make([][]byte, len(claimed))
+		for i, p := range claimed {
+			ids[i] = []byte(p.ID.String())
+		}
+		return reply.MakeMultiBulkReply(ids)
+	}
+	entries := make([]*stream.Entry, 0, len(claimed))
+	for _, p := range claimed {
+		if entry, ok := s.Get(p.ID); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return makeEntriesReply(entries)
+}
+
+// execXClaim XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-ms] [RETRYCOUNT count]
+// [FORCE] [JUSTID] [LASTID lastid]
+func execXClaim(db *DB, args [][]byte) resp.Reply {
+	key, name := string(args[0]), string(args[1])
+	minIdle, errReply := parseMinIdle(args[3], "XCLAIM")
+	if errReply != nil {
+		return errReply
+	}
+	// ID 之后是可选参数
+	ids := make([]stream.ID, 0)
+	i := 4
+	for ; i < len(args); i++ {
+		id, _, err := stream.ParseID(string(args[i]), 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return reply.MakeErrReply("ERR Invalid stream ID specified as stream command argument")
+	}
+	now := nowMillis()
+	opts, errReply := parseClaimOptions(args[i:], now)
+	if errReply != nil {
+		return errReply
+	}
+	entity, s, g, errReply := db.getGroup(key, name)
+	if errReply != nil {
+		return errReply
+	}
+	if g == nil {
+		return makeNoGroupErr(key, name)
+	}
+	if opts.lastID != nil && g.LastID.Less(*opts.lastID) {
+		g.LastID = *opts.lastID
+		db.addAof(utils.ToCmdLine("xgroup", "setid", key, name, g.LastID.String(),
+			"entriesread", strconv.FormatInt(g.EntriesRead, 10)))
+	}
+	c := db.getConsumer(key, entity, g, string(args[2]), now)
+	c.SeenTime = now
+
+	claimed := make([]*stream.PendingEntry, 0)
+	deleted := make([]stream.ID, 0)
+	pendingBefore := g.PendingLen()
+	for _, id := range ids {
+		p, pending := g.GetPending(id)
+		if _, exists := s.Get(id); !exists {
+			if pending {
+				deleted = append(deleted, id)
+			}
+			continue
+		}
+		if !pending {
+			if !opts.force {
+				continue
+			}
+			p = g.Deliver(id, c, now)
+		} else if minIdle > 0 && now-p.DeliveryTime < minIdle {
+			continue
+		}
+		g.Claim(p, c)
+		p.DeliveryTime = opts.deliveryTime
+		if opts.retryCount >= 0 {
+			p.DeliveryCount = uint64(opts.retryCount)
+		} else if !opts.justID {
+			p.DeliveryCount++
+		}
+		claimed = append(claimed, p)
+	}
+	db.growEntity(entity, int64(g.PendingLen()-pendingBefore)*pendingEntrySize)
+	db.ackDeleted(key, entity, g, deleted)
+	for _, p := range claimed {
+		db.addClaimAof(key, g, p)
+	}
+	if len(claimed) > 0 {
+		c.ActiveTime = now
+	}
+	return makeClaimedReply(s, claimed, opts.justID)
+}
+
+// execXAutoClaim XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+// 返回 [下一次扫描的起点, 认领的消息, 已经被删除的消息 ID]; 扫描完成时起点为 0-0
+func execXAutoClaim(db *DB, args [][]byte) resp.Reply {
+	key, name := string(args[0]), string(args[1])
+	minIdle, errReply := parseMinIdle(args[3], "XAUTOCLAIM")
+	if errReply != nil {
+		return errReply
+	}
+	start, errReply := parseRangeID(args[4], true)
+	if errReply != nil {
+		return errReply
+	}
+	count := 100
+	justID := false
+	for i := 5; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "count":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || n < 1 || n > math.MaxInt32/10 {
+				return reply.MakeErrReply("ERR COUNT must be > 0")
+			}
+			count = int(n)
+			i++
+		case "justid":
+			justID = true
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	entity, s, g, errReply := db.getGroup(key, name)
+	if errReply != nil {
+		return errReply
+	}
+	if g == nil {
+		return makeNoGroupErr(key, name)
+	}
+	now := nowMillis()
+	c := db.getConsumer(key, entity, g, string(args[2]), now)
+	c.SeenTime = now
+
+	// 最多检查 count * 10 条待确认的消息
+	attempts := count * 10
+	candidates := make([]*stream.PendingEntry, 0)
+	next := stream.MinID
+	g.ForEachPending(start, func(p *stream.PendingEntry) bool {
+		if len(candidates) >= attempts {
+			next = p.ID
+			return false
+		}
+		candidates = append(candidates, p)
+		return true
+	})
+	claimed := make([]*stream.PendingEntry, 0)
+	deleted := make([]stream.ID, 0)
+	for _, p := range candidates {
+		if len(claimed) >= count {
+			next = p.ID
+			break
+		}
+		if _, exists := s.Get(p.ID); !exists {
+			deleted = append(deleted, p.ID)
+			continue
+		}
+		if now-p.DeliveryTime < minIdle {
+			continue
+		}
+		g.Claim(p, c)
+		p.DeliveryTime = now
+		if !justID {
+			p.DeliveryCount++
+		}
+		claimed = append(claimed, p)
+	}
+	db.ackDeleted(key, entity, g, deleted)
+	for _, p := range claimed {
+		db.addClaimAof(key, g, p)
+	}
+	if len(claimed) > 0 {
+		c.ActiveTime = now
+	}
+	deletedIDs := make([][]byte, len(deleted))
+	for i, id := range deleted {
+		deletedIDs[i] = []byte(id.String())
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(next.String())),
+		makeClaimedReply(s, claimed, justID),
+		reply.MakeMultiBulkReply(deletedIDs),
+	})
+}
+
+/* ---- XINFO ---- */
+
+// execXInfo XINFO STREAM key [FULL [COUNT count]] | GROUPS key | CONSUMERS key group
+func execXInfo(db *DB, args [][]byte) resp.Reply {
+	sub := strings.ToLower(string(args[0]))
+	key := string(args[1])
+	switch sub {
+	case "stream", "groups":
+		if sub == "groups" && len(args) != 2 {
+			return reply.MakeArgNumErrReply("xinfo|groups")
+		}
+	case "consumers":
+		if len(args) != 3 {
+			return reply.MakeArgNumErrReply("xinfo|consumers")
+		}
+	default:
+		return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try XINFO HELP.")
+	}
+	_, s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeErrReply("ERR no such key")
+	}
+	now := nowMillis()
+	switch sub {
+	case "groups":
+		groups := make([]resp.Reply, 0)
+		for _, g := range s.Groups() {
+			groups = append(groups, makeGroupInfoReply(s, g))
+		}
+		return reply.MakeMultiRawReply(groups)
+	case "consumers":
+		g, ok := s.Group(string(args[2]))
+		if !ok {
+			return reply.MakeErrReply("NOGROUP No such consumer group '" + string(args[2]) +
+				"' for key name '" + key + "'")
+		}
+		consumers := make([]resp.Reply, 0)
+		for _, c := range g.Consumers() {
+			inactive := int64(-1)
+			if c.ActiveTime >= 0 {
+				inactive = now - c.ActiveTime
+			}
+			consumers = append(consumers, makeInfoReply(
+				"name", reply.MakeBulkReply([]byte(c.Name)),
+				"pending", reply.MakeIntReply(int64(c.PendingLen())),
+				"idle", reply.MakeIntReply(now-c.SeenTime),
+				"inactive", reply.MakeIntReply(inactive),
+			))
+		}
+		return reply.MakeMultiRawReply(consumers)
+	}
+
+	if len(args) == 2 {
+		return makeStreamInfoReply(s)
+	}
+	count := 10
+	if strings.ToLower(string(args[2])) != "full" {
+		return reply.MakeSyntaxErrReply()
+	}
+	if len(args) > 3 {
+		if len(args) != 5 || strings.ToLower(string(args[3])) != "count" {
+			return reply.MakeSyntaxErrReply()
+		}
+		n, err := strconv.ParseInt(string(args[4]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		if n < 0 || n > math.MaxInt32 {
+			n = 0
+		}
+		count = int(n)
+	}
+	return makeStreamFullInfoReply(s, count)
+}
+
+// makeInfoReply 以 map 返回信息, RESP2 客户端收到 key value 交替的数组
+func makeInfoReply(pairs ...interface{}) resp.Reply {
+	replies := make([]resp.Reply, len(pairs))
+	for i, v := range pairs {
+		if name, ok := v.(string); ok && i%2 == 0 {
+			replies[i] = reply.MakeBulkReply([]byte(name))
+			continue
+		}
+		replies[i] = v.(resp.Reply)
+	}
+	return reply.MakeMapReply(replies)
+}
+
+func makeIDReply(id stream.ID) resp.Reply {
+	return reply.MakeBulkReply([]byte(id.String()))
+}
+
+// streamInfoHeader XINFO STREAM 和 XINFO STREAM FULL 共有的信息
+func streamInfoHeader(s *stream.Stream) []interface{} {
+	leaves, nodes := s.TreeStats()
+	var firstID stream.ID
+	if first, ok := s.First(); ok {
+		firstID = first.ID
+	}
+	return []interface{}{
+		"length", reply.MakeIntReply(int64(s.Len())),
+		"radix-tree-keys", reply.MakeIntReply(int64(leaves)),
+		"radix-tree-nodes", reply.MakeIntReply(int64(nodes)),
+		"last-generated-id", makeIDReply(s.LastID()),
+		"max-deleted-entry-id", makeIDReply(s.MaxDeletedID()),
+		"entries-added", reply.MakeIntReply(int64(s.EntriesAdded())),
+		"recorded-first-entry-id", makeIDReply(firstID),
+	}
+}
+
+func makeStreamInfoReply(s *stream.Stream) resp.Reply {
+	var firstReply, lastReply resp.Reply = reply.MakeNullBulkReply(), reply.MakeNullBulkReply()
+	if first, ok := s.First(); ok {
+		firstReply = makeEntryReply(first)
+	}
+	if last, ok := s.Last(); ok {
+		lastReply = makeEntryReply(last)
+	}
+	pairs := append(streamInfoHeader(s),
+		"groups", reply.MakeIntReply(int64(len(s.Groups()))),
+		"first-entry", firstReply,
+		"last-entry", lastReply,
+	)
+	return makeInfoReply(pairs...)
+}
+
+// makeStreamFullInfoReply 消息、待确认列表最多返回 count 条, 0 表示全部返回
+func makeStreamFullInfoReply(s *stream.Stream, count int) resp.Reply {
+	groups := make([]resp.Reply, 0)
+	for _, g := range s.Groups() {
+		pending := make([]resp.Reply, 0)
+		g.ForEachPending(stream.MinID, func(p *stream.PendingEntry) bool {
+			if count > 0 && len(pending) >= count {
+				return false
+			}
+			pending = append(pending, reply.MakeMultiRawReply([]resp.Reply{
+				makeIDReply(p.ID),
+				reply.MakeBulkReply([]byte(p.Consumer.Name)),
+				reply.MakeIntReply(p.DeliveryTime),
+				reply.MakeIntReply(int64(p.DeliveryCount)),
+			}))
+			return true
+		})
+		consumers := make([]resp.Reply, 0)
+		for _, c := range g.Consumers() {
+			consumerPending := make([]resp.Reply, 0)
+			c.ForEachPending(stream.MinID, func(p *stream.PendingEntry) bool {
+				if count > 0 && len(consumerPending) >= count {
+					return false
+				}
+				consumerPending = append(consumerPending, reply.MakeMultiRawReply([]resp.Reply{
+					makeIDReply(p.ID),
+					reply.MakeIntReply(p.DeliveryTime),
+					reply.MakeIntReply(int64(p.DeliveryCount)),
+				}))
+				return true
+			})
+			consumers = append(consumers, makeInfoReply(
+				"name", reply.MakeBulkReply([]byte(c.Name)),
+				"seen-time", reply.MakeIntReply(c.SeenTime),
+				"active-time", reply.MakeIntReply(c.ActiveTime),
+				"pel-count", reply.MakeIntReply(int64(c.PendingLen())),
+				"pending", reply.MakeMultiRawReply(consumerPending),
+			))
+		}
+		entriesRead, lag := makeEntriesReadReply(g), makeLagReply(s, g)
+		groups = append(groups, makeInfoReply(
+			"name", reply.MakeBulkReply([]byte(g.Name)),
+			"last-delivered-id", makeIDReply(g.LastID),
+			"entries-read", entriesRead,
+			"lag", lag,
+			"pel-count", reply.MakeIntReply(int64(g.PendingLen())),
+			"pending", reply.MakeMultiRawReply(pending),
+			"consumers", reply.MakeMultiRawReply(consumers),
+		))
+	}
+	pairs := append(streamInfoHeader(s),
+		"entries", makeEntriesReply(s.Range(stream.MinID, stream.MaxID, count)),
+		"groups", reply.MakeMultiRawReply(groups),
+	)
+	return makeInfoReply(pairs...)
+}
+
+func makeGroupInfoReply(s *stream.Stream, g *stream.Group) resp.Reply {
+	return makeInfoReply(
+		"name", reply.MakeBulkReply([]byte(g.Name)),
+		"consumers", reply.MakeIntReply(int64(len(g.Consumers()))),
+		"pending", reply.MakeIntReply(int64(g.PendingLen())),
+		"last-delivered-id", makeIDReply(g.LastID),
+		"entries-read", makeEntriesReadReply(g),
+		"lag", makeLagReply(s, g),
+	)
+}
+
+// makeEntriesReadReply 未知时返回 nil
+func makeEntriesReadReply(g *stream.Group) resp.Reply {
+	if g.EntriesRead < 0 {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeIntReply(g.EntriesRead)
+}
+
+func makeLagReply(s *stream.Stream, g *stream.Group) resp.Reply {
+	lag, ok := s.Lag(g)
+	if !ok {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeIntReply(lag)
+}
+
+func readSecondKey(args [][]byte) ([]string, []string) {
+	return nil, []string{string(args[1])}
+}
+
+func init() {
+	RegisterCommand("XGroup", execXGroup, prepareXGroup, undoXGroup, -3).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 2, 2, 1)
+	RegisterCommand("XAck", execXAck, writeFirstKey, rollbackFirstKey, -4).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("XPending", execXPending, readFirstKey, nil, -3).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("XClaim", execXClaim, writeFirstKey, rollbackFirstKey, -6).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("XAutoClaim", execXAutoClaim, writeFirstKey, rollbackFirstKey, -6).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("XInfo", execXInfo, readSecondKey, nil, -3).
+		attachCommandExtra(FlagReadOnly, 2, 2, 1)
+
+	// key 的位置不固定, 集群中单独处理
+	registerBlockingCommand("XReadGroup", tryXReadGroup, xreadGroupKeys, xreadGroupTimeout,
+		reply.MakeNullMultiBulkBytes(), false, prepareXReadGroup, undoXReadGroup, -7).
+		attachCommandExtra(FlagWrite, 0, 0, 0)
+}
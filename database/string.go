@@ -41,6 +41,9 @@ func execSet(db *DB, args [][]byte) resp.Reply {
 		Data: value,
 	}
 	db.PutEntity(key, entity)
+	// SET 会清除原有的过期时间
+	db.Persist(key)
+	db.notify(notifyString, "set", key)
 	db.addAof(utils.ToCmdLine2("set", args...)) //添加到aof文件
 	return &reply.OkReply{}
 }
@@ -53,6 +56,9 @@ func execSetNX(db *DB, args [][]byte) resp.Reply {
 		Data: value,
 	}
 	result := db.PutIfAbsent(key, entity)
+	if result > 0 {
+		db.notify(notifyString, "set", key)
+	}
 	db.addAof(utils.ToCmdLine2("setnx", args...))
 	return reply.MakeIntReply(int64(result))
 }
@@ -64,6 +70,8 @@ func execGetSet(db *DB, args [][]byte) resp.Reply {
 
 	entity, exists := db.GetEntity(key)
 	db.PutEntity(key, &database.DataEntity{Data: value})
+	db.Persist(key)
+	db.notify(notifyString, "set", key)
 	db.addAof(utils.ToCmdLine2("getset", args...))
 	if !exists {
 		return reply.MakeNullBulkReply()
@@ -83,10 +91,72 @@ func execStrLen(db *DB, args [][]byte) resp.Reply {
 	return reply.MakeIntReply(int64(len(old)))
 }
 
+// execMGet MGET k1 k2...: 返回多个 key 的值, 不存在或不是 string 的 key 返回 nil
+func execMGet(db *DB, args [][]byte) resp.Reply {
+	result := make([][]byte, len(args))
+	for i, arg := range args {
+		bytes, err := db.getAsString(string(arg))
+		if err != nil {
+			result[i] = nil
+			continue
+		}
+		result[i] = bytes
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execMSet MSET k1 v1 k2 v2...: 同时设置多个 key
+func execMSet(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 0 {
+		return reply.MakeSyntaxErrReply()
+	}
+
+	size := len(args) / 2
+	keys := make([]string, size)
+	values := make([][]byte, size)
+	for i := 0; i < size; i++ {
+		keys[i] = string(args[2*i])
+		values[i] = args[2*i+1]
+	}
+
+	for i, key := range keys {
+		value := values[i]
+		db.PutEntity(key, &database.DataEntity{Data: value})
+		db.Persist(key)
+		db.notify(notifyString, "set", key)
+	}
+	db.addAof(utils.ToCmdLine2("mset", args...))
+	return &reply.OkReply{}
+}
+
+// prepareMSet MSET 的 key 位于偶数位置
+func prepareMSet(args [][]byte) ([]string, []string) {
+	size := len(args) / 2
+	keys := make([]string, size)
+	for i := 0; i < size; i++ {
+		keys[i] = string(args[2*i])
+	}
+	return keys, nil
+}
+
+func undoMSet(db *DB, args [][]byte) ([]CmdLine, error) {
+	writeKeys, _ := prepareMSet(args)
+	return rollbackGivenKeys(db, writeKeys...)
+}
+
 func init() {
-	RegisterCommand("Get", execGet, 2)
-	RegisterCommand("Set", execSet, -3)
-	RegisterCommand("SetNx", execSetNX, 3)
-	RegisterCommand("GetSet", execGetSet, 3)
-	RegisterCommand("StrLen", execStrLen, 2)
+	RegisterCommand("Get", execGet, readFirstKey, nil, 2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("Set", execSet, writeFirstKey, rollbackFirstKey, -3).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("SetNx", execSetNX, writeFirstKey, rollbackFirstKey, 3).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("GetSet", execGetSet, writeFirstKey, rollbackFirstKey, 3).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, 1, 1)
+	RegisterCommand("StrLen", execStrLen, readFirstKey, nil, 2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("MSet", execMSet, prepareMSet, undoMSet, -3).
+		attachCommandExtra(FlagWrite|FlagDenyOOM, 1, -1, 2)
+	RegisterCommand("MGet", execMGet, readAllKeys, nil, -2).
+		attachCommandExtra(FlagReadOnly, 1, -1, 1)
 }
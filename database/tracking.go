@@ -0,0 +1,559 @@
+package database
+
+/*客户端缓存: CLIENT TRACKING
+默认模式记录开启了 tracking 的连接读取过的 key, key 被修改、过期、淘汰时向这些连接发送一次失效消息, 之后不再记录;
+BCAST 模式不记录读取的 key, 任何与前缀匹配的 key 被修改时都发送失效消息
+RESP2 的连接不能在同一个连接上接收推送消息, 需要通过 REDIRECT 把失效消息转发给订阅了 __redis__:invalidate 的连接*/
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/resp/reply"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const trackingChannel = "__redis__:invalidate"
+
+// CLIENT CACHING 对下一条指令的设置
+const (
+	cachingUnset = iota
+	cachingYes
+	cachingNo
+)
+
+// trackingClient 开启了 tracking 的连接及其选项
+type trackingClient struct {
+	conn     resp.Connection
+	bcast    bool
+	optIn    bool
+	optOut   bool
+	noLoop   bool  // 不接收自己修改的 key 的失效消息
+	redirect int64 // 接收失效消息的客户端 ID, 为 0 时发送给自己
+	prefixes []string
+	caching  int // CLIENT CACHING yes/no, 只对下一条指令生效
+}
+
+// trackingTable 所有 DB 共享的 tracking 状态; 与 redis 相同, 不区分 key 所在的 DB
+type trackingTable struct {
+	mu       sync.Mutex
+	clients  map[int64]*trackingClient     // 客户端 ID -> 开启了 tracking 的连接
+	keys     map[string]map[int64]struct{} // 默认模式: key -> 读取过该 key 的客户端
+	prefixes map[string]map[int64]struct{} // BCAST 模式: 前缀 -> 客户端
+	count    int32                         // 开启了 tracking 的连接数量, 原子操作; 为 0 时跳过所有处理
+
+	conns sync.Map // 客户端 ID -> resp.Connection, 用于查找 REDIRECT 的目标
+}
+
+func makeTrackingTable() *trackingTable {
+	return &trackingTable{
+		clients:  make(map[int64]*trackingClient),
+		keys:     make(map[string]map[int64]struct{}),
+		prefixes: make(map[string]map[int64]struct{}),
+	}
+}
+
+// register 记录连接, 使其可以作为 REDIRECT 的目标
+func (table *trackingTable) register(c resp.Connection) {
+	if c == nil || c.GetID() == 0 {
+		return
+	}
+	if _, ok := table.conns.Load(c.GetID()); !ok {
+		table.conns.Store(c.GetID(), c)
+	}
+}
+
+// unregister 连接关闭后关闭它的 tracking
+func (table *trackingTable) unregister(c resp.Connection) {
+	table.conns.Delete(c.GetID())
+	table.disable(c)
+}
+
+func (table *trackingTable) enabled() bool {
+	return atomic.LoadInt32(&table.count) > 0
+}
+
+// trackingOptions CLIENT TRACKING ON 的选项
+type trackingOptions struct {
+	bcast    bool
+	optIn    bool
+	optOut   bool
+	noLoop   bool
+	redirect int64
+	prefixes []string
+}
+
+// enable 开启 tracking; 已经开启时更新选项, 但不能切换 BCAST、OPTIN、OPTOUT 模式
+func (table *trackingTable) enable(c resp.Connection, opts *trackingOptions) reply.ErrorReply {
+	if opts.redirect != 0 {
+		if _, ok := table.conns.Load(opts.redirect); !ok {
+			return reply.MakeErrReply("ERR The client ID you want redirect to does not exist")
+		}
+	}
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	client, exists := table.clients[c.GetID()]
+	if exists {
+		if client.bcast != opts.bcast {
+			return reply.MakeErrReply("ERR You can't switch BCAST mode on/off before disabling tracking for " +
+				"this client, and then re-enabling it with a different mode.")
+		}
+		if client.optIn != opts.optIn || client.optOut != opts.optOut {
+			return reply.MakeErrReply("ERR You can't switch OPTIN/OPTOUT mode before disabling tracking for " +
+				"this client, and then re-enabling it with a different mode.")
+		}
+	} else {
+		client = &trackingClient{conn: c, bcast: opts.bcast, optIn: opts.optIn, optOut: opts.optOut}
+	}
+	// 同一个客户端的前缀不能相互重叠, 否则同一个 key 会收到多条失效消息
+	prefixes := append([]string(nil), client.prefixes...)
+	for _, prefix := range opts.prefixes {
+		duplicated := false
+		for _, other := range prefixes {
+			if prefix == other {
+				duplicated = true
+			}
+			if prefix != other && (strings.HasPrefix(prefix, other) || strings.HasPrefix(other, prefix)) {
+				return reply.MakeErrReply("ERR Prefix '" + prefix + "' overlaps with an existing prefix '" + other +
+					"'. Prefixes for a single client must not overlap.")
+			}
+		}
+		if !duplicated {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if opts.bcast && len(prefixes) == 0 {
+		prefixes = append(prefixes, "") // 没有指定前缀时匹配所有的 key
+	}
+
+	client.noLoop = opts.noLoop
+	client.redirect = opts.redirect
+	for _, prefix := range prefixes[len(client.prefixes):] {
+		ids, ok := table.prefixes[prefix]
+		if !ok {
+			ids = make(map[int64]struct{})
+			table.prefixes[prefix] = ids
+		}
+		ids[c.GetID()] = struct{}{}
+	}
+	client.prefixes = prefixes
+	if !exists {
+		table.clients[c.GetID()] = client
+		atomic.AddInt32(&table.count, 1)
+	}
+	return nil
+}
+
+// disable 关闭 tracking; 默认模式下记录的 key 不立即清理, 发送失效消息时跳过已经关闭 tracking 的客户端
+func (table *trackingTable) disable(c resp.Connection) {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	client, ok := table.clients[c.GetID()]
+	if !ok {
+		return
+	}
+	for _, prefix := range client.prefixes {
+		ids := table.prefixes[prefix]
+		delete(ids, c.GetID())
+		if len(ids) == 0 {
+			delete(table.prefixes, prefix)
+		}
+	}
+	delete(table.clients, c.GetID())
+	atomic.AddInt32(&table.count, -1)
+}
+
+// setCaching CLIENT CACHING yes|no
+func (table *trackingTable) setCaching(c resp.Connection, yes bool) reply.ErrorReply {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	client, ok := table.clients[c.GetID()]
+	if !ok || !(client.optIn || client.optOut) {
+		return reply.MakeErrReply("ERR CLIENT CACHING can be called only when the client is in tracking mode " +
+			"with OPTIN or OPTOUT mode enabled")
+	}
+	if yes && !client.optIn {
+		return reply.MakeErrReply("ERR CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode.")
+	}
+	if !yes && !client.optOut {
+		return reply.MakeErrReply("ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode.")
+	}
+	if yes {
+		client.caching = cachingYes
+	} else {
+		client.caching = cachingNo
+	}
+	return nil
+}
+
+// resetCaching 执行完一条指令后清除 CLIENT CACHING 的设置
+func (table *trackingTable) resetCaching(c resp.Connection) {
+	if !table.enabled() || c == nil {
+		return
+	}
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	if client, ok := table.clients[c.GetID()]; ok {
+		client.caching = cachingUnset
+	}
+}
+
+// trackKeys 记录客户端读取的 key; 在执行读指令之前调用, 避免执行期间其它客户端的修改被遗漏
+func (table *trackingTable) trackKeys(c resp.Connection, keys []string) {
+	if !table.enabled() || c == nil || len(keys) == 0 {
+		return
+	}
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	client, ok := table.clients[c.GetID()]
+	if !ok || client.bcast {
+		return
+	}
+	if client.optIn && client.caching != cachingYes || client.optOut && client.caching == cachingNo {
+		return
+	}
+	for _, key := range keys {
+		ids, ok := table.keys[key]
+		if !ok {
+			ids = make(map[int64]struct{})
+			table.keys[key] = ids
+		}
+		ids[c.GetID()] = struct{}{}
+	}
+}
+
+// invalidate 向缓存了这些 key 的客户端发送失效消息; origin 是修改 key 的连接, 用于 NOLOOP, 过期和淘汰时为 nil
+func (table *trackingTable) invalidate(keys []string, origin resp.Connection) {
+	if !table.enabled() || len(keys) == 0 {
+		return
+	}
+	var originID int64
+	if origin != nil {
+		originID = origin.GetID()
+	}
+	table.mu.Lock()
+	pending := make(map[int64]*invalidation)
+	add := func(id int64, key string) {
+		client, ok := table.clients[id]
+		if !ok || client.noLoop && id == originID {
+			return
+		}
+		inv, ok := pending[id]
+		if !ok {
+			inv = &invalidation{conn: client.conn, redirect: client.redirect}
+			pending[id] = inv
+		}
+		inv.keys = append(inv.keys, []byte(key))
+	}
+	for _, key := range keys {
+		for id := range table.keys[key] {
+			add(id, key)
+		}
+		delete(table.keys, key)
+		for prefix, ids := range table.prefixes {
+			if strings.HasPrefix(key, prefix) {
+				for id := range ids {
+					add(id, key)
+				}
+			}
+		}
+	}
+	table.mu.Unlock()
+
+	for _, inv := range pending {
+		table.send(inv)
+	}
+}
+
+// invalidateAll FLUSHDB、FLUSHALL、SWAPDB 之后所有缓存都失效, 向所有客户端发送 key 为 nil 的失效消息
+func (table *trackingTable) invalidateAll() {
+	if !table.enabled() {
+		return
+	}
+	table.mu.Lock()
+	table.keys = make(map[string]map[int64]struct{})
+	pending := make([]*invalidation, 0, len(table.clients))
+	for _, client := range table.clients {
+		pending = append(pending, &invalidation{conn: client.conn, redirect: client.redirect})
+	}
+	table.mu.Unlock()
+
+	for _, inv := range pending {
+		table.send(inv)
+	}
+}
+
+// invalidation 待发送的失效消息, 在持有 table.mu 时从 trackingClient 复制
+type invalidation struct {
+	conn     resp.Connection
+	redirect int64
+	keys     [][]byte // 为 nil 表示所有 key 失效
+}
+
+// send 发送失效消息: RESP3 的连接收到 push 消息, RESP2 的连接只能通过 REDIRECT 转发到订阅了 __redis__:invalidate 的连接
+func (table *trackingTable) send(inv *invalidation) {
+	if inv.redirect == 0 {
+		// RESP2 的连接不能在同一个连接上接收推送消息
+		if inv.conn.GetProtocol() >= reply.Resp3 {
+			_ = inv.conn.Write(makeInvalidatePush(inv.keys))
+		}
+		return
+	}
+	raw, ok := table.conns.Load(inv.redirect)
+	if !ok {
+		// 转发目标已经断开, RESP3 的连接收到 tracking-redir-broken 消息
+		if inv.conn.GetProtocol() >= reply.Resp3 {
+			_ = inv.conn.Write(reply.MakePushReply([]resp.Reply{
+				reply.MakeBulkReply([]byte("tracking-redir-broken")),
+				reply.MakeIntReply(inv.redirect),
+			}).ToResp3Bytes())
+		}
+		return
+	}
+	target := raw.(resp.Connection)
+	if target.GetProtocol() >= reply.Resp3 {
+		_ = target.Write(makeInvalidatePush(inv.keys))
+		return
+	}
+	// 与 redis 相同, 只发送给处于订阅状态的连接
+	if target.SubsCount() == 0 {
+		return
+	}
+	_ = target.Write(makeInvalidateMessage(inv.keys))
+}
+
+// makeInvalidateMessage 发布到 __redis__:invalidate 频道的消息
+func makeInvalidateMessage(keys [][]byte) []byte {
+	var payload resp.Reply = reply.MakeNullMultiBulkBytes()
+	if keys != nil {
+		payload = reply.MakeMultiBulkReply(keys)
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("message")),
+		reply.MakeBulkReply([]byte(trackingChannel)),
+		payload,
+	}).ToBytes()
+}
+
+// makeInvalidatePush RESP3 的失效消息: [invalidate, keys], 所有 key 失效时 keys 为 null
+func makeInvalidatePush(keys [][]byte) []byte {
+	var payload resp.Reply = reply.MakeNullMultiBulkBytes()
+	if keys != nil {
+		payload = reply.MakeMultiBulkReply(keys)
+	}
+	return reply.MakePushReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("invalidate")),
+		payload,
+	}).ToResp3Bytes()
+}
+
+/* ---- 指令执行前后的处理 ---- */
+
+// trackCommand 执行指令之前记录只读指令读取的 key
+func (db *DB) trackCommand(c resp.Connection, cmdLine [][]byte) {
+	if !db.tracking.enabled() {
+		return
+	}
+	cmd, ok := cmdTable[strings.ToLower(string(cmdLine[0]))]
+	if !ok || cmd.flags&FlagReadOnly == 0 {
+		return
+	}
+	_, readKeys := GetRelatedKeys(cmdLine)
+	db.tracking.trackKeys(c, readKeys)
+}
+
+// invalidateCommand 执行写指令之后发送失效消息
+func (db *DB) invalidateCommand(c resp.Connection, cmdLine [][]byte) {
+	if !db.tracking.enabled() {
+		return
+	}
+	cmd, ok := cmdTable[strings.ToLower(string(cmdLine[0]))]
+	if !ok || cmd.flags&FlagWrite == 0 {
+		return
+	}
+	writeKeys, _ := GetRelatedKeys(cmdLine)
+	db.tracking.invalidate(writeKeys, c)
+}
+
+/* ---- CLIENT 指令 ---- */
+
+// execClient CLIENT ID|SETNAME|GETNAME|TRACKING|CACHING|GETREDIR|TRACKINGINFO
+func (mdb *StandaloneDatabase) execClient(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 1 {
+		return reply.MakeArgNumErrReply("client")
+	}
+	table := mdb.tracking
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "id":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("client|id")
+		}
+		return reply.MakeIntReply(c.GetID())
+	case "setname":
+		if len(args) != 2 {
+			return reply.MakeArgNumErrReply("client|setname")
+		}
+		if errReply := validateClientName(args[1]); errReply != nil {
+			return errReply
+		}
+		c.SetName(string(args[1]))
+		return reply.MakeOkReply()
+	case "getname":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("client|getname")
+		}
+		if c.GetName() == "" {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeBulkReply([]byte(c.GetName()))
+	case "tracking":
+		if len(args) < 2 {
+			return reply.MakeArgNumErrReply("client|tracking")
+		}
+		return execClientTracking(table, c, args[1:])
+	case "caching":
+		if len(args) != 2 {
+			return reply.MakeArgNumErrReply("client|caching")
+		}
+		var errReply reply.ErrorReply
+		switch strings.ToLower(string(args[1])) {
+		case "yes":
+			errReply = table.setCaching(c, true)
+		case "no":
+			errReply = table.setCaching(c, false)
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+		if errReply != nil {
+			return errReply
+		}
+		return reply.MakeOkReply()
+	case "getredir":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("client|getredir")
+		}
+		table.mu.Lock()
+		defer table.mu.Unlock()
+		client, ok := table.clients[c.GetID()]
+		if !ok {
+			return reply.MakeIntReply(-1)
+		}
+		return reply.MakeIntReply(client.redirect)
+	case "trackinginfo":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("client|trackinginfo")
+		}
+		return execClientTrackingInfo(table, c)
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try CLIENT HELP.")
+}
+
+// execClientTracking CLIENT TRACKING ON|OFF [REDIRECT client-id] [PREFIX prefix ...] [BCAST] [OPTIN] [OPTOUT] [NOLOOP]
+func execClientTracking(table *trackingTable, c resp.Connection, args [][]byte) resp.Reply {
+	switch strings.ToLower(string(args[0])) {
+	case "on":
+	case "off":
+		table.disable(c)
+		return reply.MakeOkReply()
+	default:
+		return reply.MakeSyntaxErrReply()
+	}
+	opts := &trackingOptions{}
+	for i := 1; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "redirect":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			i++
+			id, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			opts.redirect = id
+		case "prefix":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			i++
+			opts.prefixes = append(opts.prefixes, string(args[i]))
+		case "bcast":
+			opts.bcast = true
+		case "optin":
+			opts.optIn = true
+		case "optout":
+			opts.optOut = true
+		case "noloop":
+			opts.noLoop = true
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	if len(opts.prefixes) > 0 && !opts.bcast {
+		return reply.MakeErrReply("ERR PREFIX option requires BCAST mode to be enabled")
+	}
+	if opts.bcast && (opts.optIn || opts.optOut) {
+		return reply.MakeErrReply("ERR OPTIN and OPTOUT are not compatible with BCAST mode")
+	}
+	if opts.optIn && opts.optOut {
+		return reply.MakeErrReply("ERR You can't use both OPTIN and OPTOUT options at the same time")
+	}
+	if errReply := table.enable(c, opts); errReply != nil {
+		return errReply
+	}
+	return reply.MakeOkReply()
+}
+
+// execClientTrackingInfo CLIENT TRACKINGINFO: [flags, [...], redirect, id, prefixes, [...]]
+func execClientTrackingInfo(table *trackingTable, c resp.Connection) resp.Reply {
+	table.mu.Lock()
+	client, ok := table.clients[c.GetID()]
+	var flags, prefixes [][]byte
+	redirect := int64(-1)
+	if !ok {
+		flags = append(flags, []byte("off"))
+	} else {
+		flags = append(flags, []byte("on"))
+		if client.bcast {
+			flags = append(flags, []byte("bcast"))
+		}
+		if client.optIn {
+			flags = append(flags, []byte("optin"))
+			if client.caching == cachingYes {
+				flags = append(flags, []byte("caching-yes"))
+			}
+		}
+		if client.optOut {
+			flags = append(flags, []byte("optout"))
+			if client.caching == cachingNo {
+				flags = append(flags, []byte("caching-no"))
+			}
+		}
+		if client.noLoop {
+			flags = append(flags, []byte("noloop"))
+		}
+		redirect = client.redirect
+		if redirect != 0 {
+			if _, ok := table.conns.Load(redirect); !ok {
+				flags = append(flags, []byte("broken_redirect"))
+			}
+		}
+		for _, prefix := range client.prefixes {
+			prefixes = append(prefixes, []byte(prefix))
+		}
+	}
+	table.mu.Unlock()
+	return reply.MakeMapReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("flags")), reply.MakeBulkSetReply(flags),
+		reply.MakeBulkReply([]byte("redirect")), reply.MakeIntReply(redirect),
+		reply.MakeBulkReply([]byte("prefixes")), reply.MakeMultiBulkReply(prefixes),
+	})
+}
+
+func init() {
+	// CLIENT 修改的是客户端连接的状态, 只能在客户端连接的节点上执行
+	registerServerCommand("Client", -2).
+		attachCommandExtra(0, 0, 0, 0)
+}
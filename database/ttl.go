@@ -0,0 +1,161 @@
+package database
+
+import (
+	"GoRedis/aof"
+	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/reply"
+	"strconv"
+	"time"
+)
+
+// Expire 设置 key 的过期时间
+func (db *DB) Expire(key string, expireTime time.Time) {
+	db.ttlMap.Put(key, expireTime)
+}
+
+// Persist 移除 key 的过期时间
+func (db *DB) Persist(key string) {
+	db.ttlMap.Remove(key)
+}
+
+// getExpireTime 返回 key 的过期时间, 没有设置过期时间时返回 false
+func (db *DB) getExpireTime(key string) (time.Time, bool) {
+	raw, ok := db.ttlMap.Get(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	return raw.(time.Time), true
+}
+
+// IsExpired 检查 key 是否已经过期, 过期的 key 会被立即删除
+func (db *DB) IsExpired(key string) bool {
+	expireTime, ok := db.getExpireTime(key)
+	if !ok {
+		return false
+	}
+	expired := time.Now().After(expireTime)
+	// 读指令只持有读锁, 多个协程可能同时发现 key 过期, 只由真正删除 key 的协程发出通知
+	if expired && db.remove(key) {
+		db.notify(notifyExpired, "expired", key)
+		db.tracking.invalidate([]string{key}, nil)
+	}
+	return expired
+}
+
+// expireGeneric 为 key 设置过期时间, 已经过去的时间直接删除 key
+func (db *DB) expireGeneric(key string, expireTime time.Time) resp.Reply {
+	if _, exists := db.GetEntity(key); !exists {
+		return reply.MakeIntReply(0)
+	}
+	if !expireTime.After(time.Now()) {
+		db.Remove(key)
+		db.notify(notifyGeneric, "del", key)
+		db.addAof(utils.ToCmdLine("DEL", key))
+		return reply.MakeIntReply(1)
+	}
+	db.Expire(key, expireTime)
+	db.notify(notifyGeneric, "expire", key)
+	db.addAof(aof.MakeExpireCmd(key, expireTime).Args)
+	return reply.MakeIntReply(1)
+}
+
+func parseExpireArg(arg []byte) (int64, reply.ErrorReply) {
+	val, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	return val, nil
+}
+
+// execExpire EXPIRE key seconds
+func execExpire(db *DB, args [][]byte) resp.Reply {
+	seconds, err := parseExpireArg(args[1])
+	if err != nil {
+		return err
+	}
+	return db.expireGeneric(string(args[0]), time.Now().Add(time.Duration(seconds)*time.Second))
+}
+
+// execPExpire PEXPIRE key milliseconds
+func execPExpire(db *DB, args [][]byte) resp.Reply {
+	milliseconds, err := parseExpireArg(args[1])
+	if err != nil {
+		return err
+	}
+	return db.expireGeneric(string(args[0]), time.Now().Add(time.Duration(milliseconds)*time.Millisecond))
+}
+
+// execExpireAt EXPIREAT key timestamp
+func execExpireAt(db *DB, args [][]byte) resp.Reply {
+	timestamp, err := parseExpireArg(args[1])
+	if err != nil {
+		return err
+	}
+	return db.expireGeneric(string(args[0]), time.Unix(timestamp, 0))
+}
+
+// execPExpireAt PEXPIREAT key milliseconds-timestamp
+func execPExpireAt(db *DB, args [][]byte) resp.Reply {
+	timestamp, err := parseExpireArg(args[1])
+	if err != nil {
+		return err
+	}
+	return db.expireGeneric(string(args[0]), time.Unix(0, timestamp*int64(time.Millisecond)))
+}
+
+// ttlGeneric key 不存在返回 -2, 没有过期时间返回 -1
+func (db *DB) ttlGeneric(key string, unit time.Duration) resp.Reply {
+	if _, exists := db.GetEntity(key); !exists {
+		return reply.MakeIntReply(-2)
+	}
+	expireTime, ok := db.getExpireTime(key)
+	if !ok {
+		return reply.MakeIntReply(-1)
+	}
+	ttl := time.Until(expireTime)
+	// 与 redis 一致, 向上取整
+	return reply.MakeIntReply(int64((ttl + unit - 1) / unit))
+}
+
+// execTTL TTL key: 剩余的秒数
+func execTTL(db *DB, args [][]byte) resp.Reply {
+	return db.ttlGeneric(string(args[0]), time.Second)
+}
+
+// execPTTL PTTL key: 剩余的毫秒数
+func execPTTL(db *DB, args [][]byte) resp.Reply {
+	return db.ttlGeneric(string(args[0]), time.Millisecond)
+}
+
+// execPersist PERSIST key: 移除过期时间
+func execPersist(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	if _, exists := db.GetEntity(key); !exists {
+		return reply.MakeIntReply(0)
+	}
+	if _, ok := db.getExpireTime(key); !ok {
+		return reply.MakeIntReply(0)
+	}
+	db.Persist(key)
+	db.notify(notifyGeneric, "persist", key)
+	db.addAof(utils.ToCmdLine("PERSIST", key))
+	return reply.MakeIntReply(1)
+}
+
+func init() {
+	RegisterCommand("Expire", execExpire, writeFirstKey, rollbackFirstKey, 3).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("PExpire", execPExpire, writeFirstKey, rollbackFirstKey, 3).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("ExpireAt", execExpireAt, writeFirstKey, rollbackFirstKey, 3).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("PExpireAt", execPExpireAt, writeFirstKey, rollbackFirstKey, 3).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+	RegisterCommand("TTL", execTTL, readFirstKey, nil, 2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("PTTL", execPTTL, readFirstKey, nil, 2).
+		attachCommandExtra(FlagReadOnly, 1, 1, 1)
+	RegisterCommand("Persist", execPersist, writeFirstKey, rollbackFirstKey, 2).
+		attachCommandExtra(FlagWrite, 1, 1, 1)
+}
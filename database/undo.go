@@ -0,0 +1,81 @@
+package database
+
+import (
+	"GoRedis/aof"
+	"GoRedis/lib/utils"
+	"errors"
+)
+
+// PreFunc 在指令执行前分析出需要加写锁和读锁的 key
+type PreFunc func(args [][]byte) ([]string, []string)
+
+// UndoFunc 返回撤销该指令影响的指令序列; 多条指令的回滚需要按指令的倒序执行
+// 无法生成回滚指令时返回错误, 分布式事务在 Prepare 阶段失败
+type UndoFunc func(db *DB, args [][]byte) ([]CmdLine, error)
+
+/* ---- prepare ---- */
+
+func readFirstKey(args [][]byte) ([]string, []string) {
+	// 假设 args 不含指令名称
+	key := string(args[0])
+	return nil, []string{key}
+}
+
+func writeFirstKey(args [][]byte) ([]string, []string) {
+	key := string(args[0])
+	return []string{key}, nil
+}
+
+func writeAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return keys, nil
+}
+
+func readAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return nil, keys
+}
+
+func noPrepare(args [][]byte) ([]string, []string) {
+	return nil, nil
+}
+
+/* ---- undo ---- */
+
+// rollbackFirstKey 回滚第一个 key
+func rollbackFirstKey(db *DB, args [][]byte) ([]CmdLine, error) {
+	key := string(args[0])
+	return rollbackGivenKeys(db, key)
+}
+
+// rollbackGivenKeys 生成把给定 key 恢复到当前状态的指令
+func rollbackGivenKeys(db *DB, keys ...string) ([]CmdLine, error) {
+	var undoCmdLines [][][]byte
+	for _, key := range keys {
+		entity, ok := db.GetEntity(key)
+		if !ok {
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine("DEL", key),
+			)
+		} else {
+			cmd := aof.EntityToCmd(key, entity)
+			if cmd == nil { // 不支持序列化的类型无法回滚
+				return nil, errors.New("ERR cannot generate undo log for key " + key)
+			}
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine("DEL", key), // 先清理掉新值
+				cmd.Args,
+			)
+			if expireTime, ok := db.getExpireTime(key); ok {
+				undoCmdLines = append(undoCmdLines, aof.MakeExpireCmd(key, expireTime).Args)
+			}
+		}
+	}
+	return undoCmdLines, nil
+}
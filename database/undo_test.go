@@ -0,0 +1,35 @@
+package database
+
+import (
+	"GoRedis/interface/database"
+	"testing"
+)
+
+func TestUndoLogs(t *testing.T) {
+	mdb := NewStandaloneDatabase()
+	t.Cleanup(mdb.Close)
+	db := mdb.selectDB(0)
+	db.PutEntity("s", &database.DataEntity{Data: []byte("v")})
+	undoLog, err := mdb.GetUndoLogs(0, toArgs("set s v2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 先删除新值, 再恢复旧值
+	if len(undoLog) != 2 || string(undoLog[0][0]) != "DEL" || string(undoLog[1][2]) != "v" {
+		t.Errorf("unexpected undo log %q", undoLog)
+	}
+}
+
+func TestUndoLogsUnsupportedType(t *testing.T) {
+	// 无法序列化的值不能生成回滚指令, 不能静默地丢掉
+	mdb := NewStandaloneDatabase()
+	t.Cleanup(mdb.Close)
+	db := mdb.selectDB(0)
+	db.PutEntity("k", &database.DataEntity{Data: struct{}{}})
+	if _, err := mdb.GetUndoLogs(0, toArgs("set k v")); err == nil {
+		t.Error("expected error for unsupported type")
+	}
+	if _, err := mdb.GetUndoLogs(0, toArgs("del k missing")); err == nil {
+		t.Error("expected error for unsupported type")
+	}
+}
@@ -0,0 +1,138 @@
+// Package bitmap 位图: 把 []byte 看作位数组, 每个字节的最高位在前
+package bitmap
+
+import "math/bits"
+
+// GetBit 返回第 offset 位, 超出范围时返回 0
+func GetBit(b []byte, offset int64) byte {
+	index := offset >> 3
+	if index >= int64(len(b)) {
+		return 0
+	}
+	return (b[index] >> (7 - uint(offset&7))) & 1
+}
+
+// SetBit 设置第 offset 位, 调用方需要保证 b 足够长
+func SetBit(b []byte, offset int64, val byte) {
+	index := offset >> 3
+	mask := byte(1) << (7 - uint(offset&7))
+	if val == 0 {
+		b[index] &^= mask
+	} else {
+		b[index] |= mask
+	}
+}
+
+// Count 统计 [start, end] 位之间 1 的数量, 调用方需要保证 0 <= start <= end < len(b)*8
+func Count(b []byte, start int64, end int64) int64 {
+	first, last := start>>3, end>>3
+	// 首尾两个字节只统计范围内的位
+	headMask := byte(0xff) >> uint(start&7)
+	tailMask := byte(0xff) << uint(7-end&7)
+	if first == last {
+		return int64(bits.OnesCount8(b[first] & headMask & tailMask))
+	}
+	count := bits.OnesCount8(b[first]&headMask) + bits.OnesCount8(b[last]&tailMask)
+	for _, v := range b[first+1 : last] {
+		count += bits.OnesCount8(v)
+	}
+	return int64(count)
+}
+
+// Pos 返回 [start, end] 位之间第一个值为 bit 的位置, 不存在时返回 -1
+// 调用方需要保证 0 <= start <= end < len(b)*8
+func Pos(b []byte, bit byte, start int64, end int64) int64 {
+	// 查找 0 时把字节取反, 统一为查找 1
+	var flip byte
+	if bit == 0 {
+		flip = 0xff
+	}
+	for i := start >> 3; i <= end>>3; i++ {
+		v := b[i] ^ flip
+		if i == start>>3 {
+			v &= byte(0xff) >> uint(start&7)
+		}
+		if i == end>>3 {
+			v &= byte(0xff) << uint(7-end&7)
+		}
+		if v != 0 {
+			return i<<3 + int64(bits.LeadingZeros8(v))
+		}
+	}
+	return -1
+}
+
+// GetUnsigned 读取从 offset 开始的 width 位无符号整数, 超出范围的位视为 0
+func GetUnsigned(b []byte, offset int64, width uint) uint64 {
+	var value uint64
+	for i := uint(0); i < width; i++ {
+		value = value<<1 | uint64(GetBit(b, offset+int64(i)))
+	}
+	return value
+}
+
+// GetSigned 读取从 offset 开始的 width 位有符号整数(补码)
+func GetSigned(b []byte, offset int64, width uint) int64 {
+	value := GetUnsigned(b, offset, width)
+	if width < 64 && value&(uint64(1)<<(width-1)) != 0 {
+		// 符号扩展
+		value |= ^uint64(0) << width
+	}
+	return int64(value)
+}
+
+// SetUnsigned 把 value 的低 width 位写入从 offset 开始的位置, 调用方需要保证 b 足够长
+func SetUnsigned(b []byte, offset int64, width uint, value uint64) {
+	for i := uint(0); i < width; i++ {
+		SetBit(b, offset+int64(i), byte(value>>(width-1-i))&1)
+	}
+}
+
+// Op 位运算类型
+type Op int
+
+// 位运算
+const (
+	OpAnd Op = iota
+	OpOr
+	OpXor
+	OpNot
+)
+
+// Operate 对 srcs 做位运算, 结果长度为最长的 src 的长度, 较短的 src 缺少的部分视为 0
+func Operate(op Op, srcs [][]byte) []byte {
+	maxLen := 0
+	for _, src := range srcs {
+		if len(src) > maxLen {
+			maxLen = len(src)
+		}
+	}
+	result := make([]byte, maxLen)
+	if len(srcs) == 0 {
+		return result
+	}
+	copy(result, srcs[0])
+	if op == OpNot {
+		for i := range result {
+			result[i] = ^result[i]
+		}
+		return result
+	}
+	for _, src := range srcs[1:] {
+		for i := range result {
+			var v byte
+			if i < len(src) {
+				v = src[i]
+			}
+			switch op {
+			case OpAnd:
+				result[i] &= v
+			case OpOr:
+				result[i] |= v
+			case OpXor:
+				result[i] ^= v
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,311 @@
+package dict
+
+import (
+	"GoRedis/lib/lock"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	prime32         = uint32(16777619)
+	lockerTableSize = 1024 // 用于按 key 加锁的读写锁数量
+)
+
+// ConcurrentDict 分段加锁的哈希表: key 经过 FNV 哈希落到某个分段, 每个分段由一个读写锁保护
+type ConcurrentDict struct {
+	table  []*shard
+	count  int32       // key 的数量, 原子操作
+	locker *lock.Locks // 供复合指令按 key 加锁, 与分段内部的锁相互独立
+}
+
+type shard struct {
+	m     map[string]interface{}
+	mutex sync.RWMutex
+}
+
+// computeCapacity 返回不小于 param 的最小的2的幂
+func computeCapacity(param int) int {
+	if param <= 16 {
+		return 16
+	}
+	n := param - 1
+	n |= n >> 1
+	n |= n >> 2
+	n |= n >> 4
+	n |= n >> 8
+	n |= n >> 16
+	return n + 1
+}
+
+// MakeConcurrent 创建包含 shardCount 个分段的 ConcurrentDict, 分段数会被调整为2的幂
+func MakeConcurrent(shardCount int) *ConcurrentDict {
+	shardCount = computeCapacity(shardCount)
+	table := make([]*shard, shardCount)
+	for i := 0; i < shardCount; i++ {
+		table[i] = &shard{
+			m: make(map[string]interface{}),
+		}
+	}
+	return &ConcurrentDict{
+		table:  table,
+		locker: lock.Make(lockerTableSize),
+	}
+}
+
+// fnv32 FNV-1a 哈希
+func fnv32(key string) uint32 {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= prime32
+	}
+	return hash
+}
+
+func (dict *ConcurrentDict) getShard(key string) *shard {
+	tableSize := uint32(len(dict.table))
+	return dict.table[(tableSize-1)&fnv32(key)]
+}
+
+// Get 返回value和是否存在
+func (dict *ConcurrentDict) Get(key string) (val interface{}, exists bool) {
+	s := dict.getShard(key)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	val, exists = s.m[key]
+	return
+}
+
+// Len 返回dict的长度, O(1)
+func (dict *ConcurrentDict) Len() int {
+	return int(atomic.LoadInt32(&dict.count))
+}
+
+// Put 将键值放入 dict，并返回新插入键值的数量
+func (dict *ConcurrentDict) Put(key string, val interface{}) (result int) {
+	s := dict.getShard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.m[key]; ok {
+		s.m[key] = val
+		return 0
+	}
+	s.m[key] = val
+	atomic.AddInt32(&dict.count, 1)
+	return 1
+}
+
+// PutIfAbsent 如果键不存在，则输入值，并返回更新键值的数量
+func (dict *ConcurrentDict) PutIfAbsent(key string, val interface{}) (result int) {
+	s := dict.getShard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.m[key]; ok {
+		return 0
+	}
+	s.m[key] = val
+	atomic.AddInt32(&dict.count, 1)
+	return 1
+}
+
+// PutIfExists 如果键存在，则输入值，并返回插入的键值个数
+func (dict *ConcurrentDict) PutIfExists(key string, val interface{}) (result int) {
+	s := dict.getShard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.m[key]; ok {
+		s.m[key] = val
+		return 1
+	}
+	return 0
+}
+
+// Remove 删除键值，并返回已删除键值的个数
+func (dict *ConcurrentDict) Remove(key string) (result int) {
+	s := dict.getShard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.m[key]; ok {
+		delete(s.m, key)
+		atomic.AddInt32(&dict.count, -1)
+		return 1
+	}
+	return 0
+}
+
+// RemoveAndGet 删除键值, 并返回被删除的值; 多个协程同时删除同一个 key 时只有一个会得到该值
+func (dict *ConcurrentDict) RemoveAndGet(key string) (val interface{}, exists bool) {
+	s := dict.getShard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if val, exists = s.m[key]; exists {
+		delete(s.m, key)
+		atomic.AddInt32(&dict.count, -1)
+	}
+	return
+}
+
+// ForEach 遍历 dict; 每个分段先复制再调用 consumer, 因此 consumer 中可以修改 dict
+func (dict *ConcurrentDict) ForEach(consumer Consumer) {
+	for _, s := range dict.table {
+		s.mutex.RLock()
+		keys := make([]string, 0, len(s.m))
+		values := make([]interface{}, 0, len(s.m))
+		for key, value := range s.m {
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+		s.mutex.RUnlock()
+		for i, key := range keys {
+			if !consumer(key, values[i]) {
+				return
+			}
+		}
+	}
+}
+
+// Keys 返回所有的key
+func (dict *ConcurrentDict) Keys() []string {
+	keys := make([]string, 0, dict.Len())
+	dict.ForEach(func(key string, val interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// keyAt 返回分段中的第 offset 个 key, 分段为空时返回 false
+// 分段在采样之后可能被修改, offset 超出范围时取余
+func (s *shard) keyAt(offset int) (string, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if len(s.m) == 0 {
+		return "", false
+	}
+	offset %= len(s.m)
+	i := 0
+	for key := range s.m {
+		if i == offset {
+			return key, true
+		}
+		i++
+	}
+	return "", false
+}
+
+// sizePrefix 返回各分段 key 数量的前缀和, prefix[i] 为前 i+1 个分段的 key 数量
+func (dict *ConcurrentDict) sizePrefix() []int {
+	prefix := make([]int, len(dict.table))
+	total := 0
+	for i, s := range dict.table {
+		s.mutex.RLock()
+		total += len(s.m)
+		s.mutex.RUnlock()
+		prefix[i] = total
+	}
+	return prefix
+}
+
+// pickRandomKey 在所有 key 中随机选择第 n 个, 按前缀和找到所在分段, 使每个 key 被选中的概率相同
+// 计算前缀和之后分段可能被清空, 此时重新选择
+func (dict *ConcurrentDict) pickRandomKey(prefix []int) (string, bool) {
+	total := prefix[len(prefix)-1]
+	for attempts := 0; total > 0 && attempts < 10; attempts++ {
+		n := rand.Intn(total)
+		i := sort.SearchInts(prefix, n+1)
+		offset := n
+		if i > 0 {
+			offset -= prefix[i-1]
+		}
+		if key, ok := dict.table[i].keyAt(offset); ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// RandomKeys 随机返回key，可能包含重复key
+func (dict *ConcurrentDict) RandomKeys(limit int) []string {
+	result := make([]string, 0, limit)
+	prefix := dict.sizePrefix()
+	for i := 0; i < limit; i++ {
+		key, ok := dict.pickRandomKey(prefix)
+		if !ok {
+			break
+		}
+		result = append(result, key)
+	}
+	return result
+}
+
+// RandomDistinctKeys 随机返回key，不包含重复key
+func (dict *ConcurrentDict) RandomDistinctKeys(limit int) []string {
+	if limit >= dict.Len() {
+		return dict.Keys()
+	}
+	picked := make(map[string]struct{}, limit)
+	prefix := dict.sizePrefix()
+	for attempts := 0; len(picked) < limit && attempts < limit*10; attempts++ {
+		key, ok := dict.pickRandomKey(prefix)
+		if !ok {
+			break
+		}
+		picked[key] = struct{}{}
+	}
+	result := make([]string, 0, len(picked))
+	for key := range picked {
+		result = append(result, key)
+	}
+	return result
+}
+
+// Scan 从第 cursor 个分段开始遍历, 至少收集 count 个满足 filter 的 key 或遍历完所有分段后返回
+// 每次都完整地遍历一个分段, 分段数量固定, 因此整个遍历期间一直存在的 key 至少会被返回一次
+// 返回下一次遍历的起始分段, 遍历结束时返回 0
+func (dict *ConcurrentDict) Scan(cursor int, count int, filter func(key string, val interface{}) bool) ([]string, int) {
+	result := make([]string, 0, count)
+	for cursor < len(dict.table) && len(result) < count {
+		s := dict.table[cursor]
+		s.mutex.RLock()
+		keys := make([]string, 0, len(s.m))
+		values := make([]interface{}, 0, len(s.m))
+		for key, value := range s.m {
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+		s.mutex.RUnlock()
+		// 在锁外调用 filter, filter 中可以修改 dict
+		for i, key := range keys {
+			if filter == nil || filter(key, values[i]) {
+				result = append(result, key)
+			}
+		}
+		cursor++
+	}
+	if cursor >= len(dict.table) {
+		return result, 0
+	}
+	return result, cursor
+}
+
+// Clear 删除所有key
+func (dict *ConcurrentDict) Clear() {
+	for _, s := range dict.table {
+		s.mutex.Lock()
+		atomic.AddInt32(&dict.count, -int32(len(s.m)))
+		s.m = make(map[string]interface{})
+		s.mutex.Unlock()
+	}
+}
+
+// RWLocks 为 writeKeys 加写锁, 为 readKeys 加读锁; 按固定顺序加锁以避免死锁
+func (dict *ConcurrentDict) RWLocks(writeKeys []string, readKeys []string) {
+	dict.locker.RWLocks(writeKeys, readKeys)
+}
+
+// RWUnLocks 释放 RWLocks 加上的锁
+func (dict *ConcurrentDict) RWUnLocks(writeKeys []string, readKeys []string) {
+	dict.locker.RWUnLocks(writeKeys, readKeys)
+}
@@ -0,0 +1,163 @@
+package dict
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentPutGetRemove(t *testing.T) {
+	dict := MakeConcurrent(0)
+	if n := dict.Put("a", 1); n != 1 {
+		t.Errorf("put new: got %d", n)
+	}
+	if n := dict.Put("a", 2); n != 0 {
+		t.Errorf("put existing: got %d", n)
+	}
+	if n := dict.PutIfAbsent("a", 3); n != 0 {
+		t.Errorf("put if absent: got %d", n)
+	}
+	if n := dict.PutIfExists("b", 3); n != 0 {
+		t.Errorf("put if exists: got %d", n)
+	}
+	if n := dict.PutIfAbsent("b", 3); n != 1 {
+		t.Errorf("put if absent: got %d", n)
+	}
+	if val, ok := dict.Get("a"); !ok || val != 2 {
+		t.Errorf("get: got %v, %v", val, ok)
+	}
+	if dict.Len() != 2 {
+		t.Errorf("len: got %d", dict.Len())
+	}
+	if n := dict.Remove("a"); n != 1 {
+		t.Errorf("remove: got %d", n)
+	}
+	if n := dict.Remove("a"); n != 0 {
+		t.Errorf("remove missing: got %d", n)
+	}
+	if val, ok := dict.RemoveAndGet("b"); !ok || val != 3 {
+		t.Errorf("remove and get: got %v, %v", val, ok)
+	}
+	if _, ok := dict.Get("b"); ok || dict.Len() != 0 {
+		t.Errorf("dict not empty: %d", dict.Len())
+	}
+}
+
+func TestConcurrentPut(t *testing.T) {
+	dict := MakeConcurrent(0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				dict.Put(strconv.Itoa(i*100+j), j)
+				dict.RandomKeys(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if dict.Len() != 800 || len(dict.Keys()) != 800 {
+		t.Errorf("len: got %d", dict.Len())
+	}
+}
+
+func TestConcurrentScan(t *testing.T) {
+	dict := MakeConcurrent(16)
+	for i := 0; i < 100; i++ {
+		dict.Put(strconv.Itoa(i), i)
+	}
+	seen := make(map[string]int)
+	cursor, calls := 0, 0
+	for {
+		var keys []string
+		keys, cursor = dict.Scan(cursor, 10, func(key string, val interface{}) bool {
+			return val.(int)%2 == 0
+		})
+		calls++
+		for _, key := range keys {
+			seen[key]++
+		}
+		if cursor == 0 {
+			break
+		}
+		if calls > len(dict.table) {
+			t.Fatal("scan did not finish")
+		}
+	}
+	if len(seen) != 50 {
+		t.Errorf("scanned %d keys, want 50", len(seen))
+	}
+	for key, n := range seen {
+		if i, _ := strconv.Atoi(key); i%2 != 0 || n != 1 {
+			t.Errorf("key %s returned %d times", key, n)
+		}
+	}
+	// count 大于 key 的数量时一次遍历完成
+	if keys, cursor := dict.Scan(0, 1000, nil); len(keys) != 100 || cursor != 0 {
+		t.Errorf("full scan: got %d keys, cursor %d", len(keys), cursor)
+	}
+}
+
+func TestRandomKeys(t *testing.T) {
+	dict := MakeConcurrent(0)
+	if keys := dict.RandomKeys(3); len(keys) != 0 {
+		t.Errorf("empty dict: got %v", keys)
+	}
+	if keys := dict.RandomDistinctKeys(3); len(keys) != 0 {
+		t.Errorf("empty dict: got %v", keys)
+	}
+	for i := 0; i < 100; i++ {
+		dict.Put(strconv.Itoa(i), i)
+	}
+	keys := dict.RandomKeys(200)
+	if len(keys) != 200 {
+		t.Errorf("random keys: got %d", len(keys))
+	}
+	for _, key := range keys {
+		if _, ok := dict.Get(key); !ok {
+			t.Errorf("unknown key %s", key)
+		}
+	}
+	keys = dict.RandomDistinctKeys(50)
+	sort.Strings(keys)
+	for i := 1; i < len(keys); i++ {
+		if keys[i] == keys[i-1] {
+			t.Errorf("duplicate key %s", keys[i])
+		}
+	}
+	if len(keys) != 50 {
+		t.Errorf("random distinct keys: got %d", len(keys))
+	}
+	if keys := dict.RandomDistinctKeys(200); len(keys) != 100 {
+		t.Errorf("limit larger than dict: got %d", len(keys))
+	}
+}
+
+func TestRandomKeysUniform(t *testing.T) {
+	// 100 个 key 在同一个分段, 1 个 key 单独在另一个分段
+	// 每个 key 被选中的概率应当相同, 而不是每个分段被选中的概率相同
+	dict := MakeConcurrent(16)
+	crowded := dict.getShard("0")
+	var lonely string
+	for i := 0; len(crowded.m) < 100; i++ {
+		key := strconv.Itoa(i)
+		if dict.getShard(key) == crowded {
+			dict.Put(key, i)
+		} else if lonely == "" {
+			lonely = key
+			dict.Put(key, i)
+		}
+	}
+	hits := 0
+	for _, key := range dict.RandomKeys(10000) {
+		if key == lonely {
+			hits++
+		}
+	}
+	// 期望约 10000/101 次, 按分段均匀选择时约 5000 次
+	if hits > 300 {
+		t.Errorf("lonely key picked %d times out of 10000", hits)
+	}
+}
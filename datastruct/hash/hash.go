@@ -0,0 +1,92 @@
+// Package hash 哈希类型, 保存 field 到 value 的映射
+package hash
+
+// Hash 哈希类型
+type Hash struct {
+	dict map[string][]byte
+}
+
+// Make 创建空的哈希
+func Make() *Hash {
+	return &Hash{
+		dict: make(map[string][]byte),
+	}
+}
+
+// Get 返回 field 对应的 value
+func (h *Hash) Get(field string) ([]byte, bool) {
+	value, ok := h.dict[field]
+	return value, ok
+}
+
+// Set 设置 field 的值, 新增 field 时返回 true
+func (h *Hash) Set(field string, value []byte) bool {
+	_, ok := h.dict[field]
+	h.dict[field] = value
+	return !ok
+}
+
+// Remove 删除 field, 不存在时返回 false
+func (h *Hash) Remove(field string) bool {
+	if _, ok := h.dict[field]; !ok {
+		return false
+	}
+	delete(h.dict, field)
+	return true
+}
+
+// Len 返回 field 数量
+func (h *Hash) Len() int {
+	return len(h.dict)
+}
+
+// ForEach 遍历所有 field, consumer 返回 false 时停止
+func (h *Hash) ForEach(consumer func(field string, value []byte) bool) {
+	for field, value := range h.dict {
+		if !consumer(field, value) {
+			return
+		}
+	}
+}
+
+// scanBuckets Scan 按 field 的哈希值把 field 分成固定数量的桶, 游标为下一个桶的序号
+const scanBuckets = 64
+
+// fnv32 FNV-1a 哈希
+func fnv32(key string) uint32 {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return hash
+}
+
+// Scan 从第 cursor 个桶开始遍历, 至少收集 count 个满足 filter 的 field 或遍历完所有桶后返回
+// 游标的含义与 SortedSet.Scan 相同, 整个遍历期间一直存在的 field 至少会被返回一次
+// 返回的 fields 与 values 一一对应, 以及下一次遍历的起始桶, 遍历结束时返回 0
+func (h *Hash) Scan(cursor int, count int, filter func(field string) bool) ([]string, [][]byte, int) {
+	if cursor < 0 || cursor >= scanBuckets {
+		return nil, nil, 0
+	}
+	buckets := make([][]string, scanBuckets)
+	for field := range h.dict {
+		b := int(fnv32(field) % scanBuckets)
+		if b >= cursor && (filter == nil || filter(field)) {
+			buckets[b] = append(buckets[b], field)
+		}
+	}
+	fields := make([]string, 0, count)
+	for cursor < scanBuckets && len(fields) < count {
+		fields = append(fields, buckets[cursor]...)
+		cursor++
+	}
+	if cursor >= scanBuckets {
+		cursor = 0
+	}
+	values := make([][]byte, len(fields))
+	for i, field := range fields {
+		values[i] = h.dict[field]
+	}
+	return fields, values, cursor
+}
@@ -0,0 +1,359 @@
+// Package hll HyperLogLog, 使用与 Redis 相同的 dense/sparse 编码, 以 string 形式保存
+//
+// 头部 16 字节: "HYLL" + 编码(1 字节) + 保留(3 字节) + 缓存的基数(8 字节, 小端序, 最高位为 1 表示缓存失效)
+// dense 编码: 16384 个 6 位寄存器, 每个字节从低位开始存放
+// sparse 编码: 由 ZERO/XZERO/VAL 三种操作码组成的游程编码
+package hll
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const (
+	precision = 14
+	// Registers 寄存器数量
+	Registers = 1 << precision
+	regMask   = Registers - 1
+	q         = 64 - precision // 用于计算前导 0 的位数
+	regBits   = 6
+	regMax    = 1<<regBits - 1
+
+	headerSize = 16
+	denseSize  = headerSize + (Registers*regBits+7)/8
+
+	encodingDense  = 0
+	encodingSparse = 1
+
+	// sparse 操作码能表示的最大值和最大长度
+	sparseValMax      = 32
+	sparseValMaxLen   = 4
+	sparseZeroMaxLen  = 64
+	sparseXZeroMaxLen = 16384
+
+	alphaInf = 0.721347520444481703680 // 0.5/ln(2)
+)
+
+var magic = []byte("HYLL")
+
+// New 创建空的 HyperLogLog, 使用 sparse 编码
+func New() []byte {
+	b := make([]byte, headerSize, headerSize+2)
+	copy(b, magic)
+	b[4] = encodingSparse
+	// 一个 XZERO 覆盖全部寄存器
+	n := Registers - 1
+	return append(b, 0x40|byte(n>>8), byte(n))
+}
+
+// IsValid 检查 b 是否为合法的 HyperLogLog
+func IsValid(b []byte) bool {
+	if len(b) < headerSize || string(b[:4]) != string(magic) {
+		return false
+	}
+	switch b[4] {
+	case encodingDense:
+		return len(b) == denseSize
+	case encodingSparse:
+		return true
+	}
+	return false
+}
+
+// IsDense 是否为 dense 编码
+func IsDense(b []byte) bool {
+	return b[4] == encodingDense
+}
+
+func invalidateCache(b []byte) {
+	b[headerSize-1] |= 1 << 7
+}
+
+/* ---- 寄存器 ---- */
+
+func denseGet(regs []byte, i int) uint8 {
+	pos := i * regBits / 8
+	shift := uint(i * regBits & 7)
+	v := uint(regs[pos]) >> shift
+	if pos+1 < len(regs) {
+		v |= uint(regs[pos+1]) << (8 - shift)
+	}
+	return uint8(v & regMax)
+}
+
+func denseSet(regs []byte, i int, val uint8) {
+	pos := i * regBits / 8
+	shift := uint(i * regBits & 7)
+	regs[pos] &^= byte(regMax << shift)
+	regs[pos] |= byte(uint(val) << shift)
+	if pos+1 < len(regs) {
+		regs[pos+1] &^= byte(regMax >> (8 - shift))
+		regs[pos+1] |= byte(uint(val) >> (8 - shift))
+	}
+}
+
+// decodeSparse 把 sparse 编码展开为寄存器数组, 编码损坏时返回 false
+func decodeSparse(data []byte, regs []uint8) bool {
+	idx := 0
+	for i := 0; i < len(data); i++ {
+		op := data[i]
+		var val uint8
+		var runLen int
+		switch {
+		case op&0xc0 == 0x00: // ZERO: 00xxxxxx
+			runLen = int(op&0x3f) + 1
+		case op&0xc0 == 0x40: // XZERO: 01xxxxxx yyyyyyyy
+			if i+1 >= len(data) {
+				return false
+			}
+			runLen = (int(op&0x3f)<<8 | int(data[i+1])) + 1
+			i++
+		default: // VAL: 1vvvvvxx
+			val = (op>>2)&0x1f + 1
+			runLen = int(op&0x03) + 1
+		}
+		if idx+runLen > Registers {
+			return false
+		}
+		if val > 0 {
+			for j := idx; j < idx+runLen; j++ {
+				regs[j] = val
+			}
+		}
+		idx += runLen
+	}
+	return idx == Registers
+}
+
+// encodeSparse 把寄存器数组编码为 sparse, 有寄存器超过 sparse 的表示范围时返回 false
+func encodeSparse(regs []uint8) ([]byte, bool) {
+	data := make([]byte, 0)
+	for i := 0; i < Registers; {
+		val := regs[i]
+		runLen := 1
+		for i+runLen < Registers && regs[i+runLen] == val {
+			runLen++
+		}
+		i += runLen
+		if val > sparseValMax {
+			return nil, false
+		}
+		for runLen > 0 {
+			switch {
+			case val > 0:
+				n := runLen
+				if n > sparseValMaxLen {
+					n = sparseValMaxLen
+				}
+				data = append(data, 0x80|(val-1)<<2|byte(n-1))
+				runLen -= n
+			case runLen > sparseZeroMaxLen:
+				n := runLen
+				if n > sparseXZeroMaxLen {
+					n = sparseXZeroMaxLen
+				}
+				data = append(data, 0x40|byte((n-1)>>8), byte(n-1))
+				runLen -= n
+			default:
+				data = append(data, byte(runLen-1))
+				runLen = 0
+			}
+		}
+	}
+	return data, true
+}
+
+// Merge 把 b 的寄存器合并到 regs 中(逐个取最大值), 编码损坏时返回 false
+func Merge(regs []uint8, b []byte) bool {
+	if IsDense(b) {
+		data := b[headerSize:]
+		for i := 0; i < Registers; i++ {
+			if v := denseGet(data, i); v > regs[i] {
+				regs[i] = v
+			}
+		}
+		return true
+	}
+	tmp := make([]uint8, Registers)
+	if !decodeSparse(b[headerSize:], tmp) {
+		return false
+	}
+	for i, v := range tmp {
+		if v > regs[i] {
+			regs[i] = v
+		}
+	}
+	return true
+}
+
+// FromRegisters 根据寄存器数组生成 HyperLogLog
+// sparse 为 true 时优先使用 sparse 编码, 编码后超过 sparseMaxBytes 字节时使用 dense 编码
+func FromRegisters(regs []uint8, sparse bool, sparseMaxBytes int) []byte {
+	var b []byte
+	if sparse {
+		if data, ok := encodeSparse(regs); ok && headerSize+len(data) <= sparseMaxBytes {
+			b = make([]byte, headerSize, headerSize+len(data))
+			b[4] = encodingSparse
+			b = append(b, data...)
+		}
+	}
+	if b == nil {
+		b = make([]byte, denseSize)
+		b[4] = encodingDense
+		data := b[headerSize:]
+		for i, v := range regs {
+			if v > 0 {
+				denseSet(data, i, v)
+			}
+		}
+	}
+	copy(b, magic)
+	invalidateCache(b)
+	return b
+}
+
+/* ---- 添加与统计 ---- */
+
+// murmurHash64A MurmurHash2 的 64 位版本, 与 Redis 相同
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ (uint64(len(key)) * m)
+	n := len(key) - len(key)&7
+	for i := 0; i < n; i += 8 {
+		k := binary.LittleEndian.Uint64(key[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+	}
+	tail := key[n:]
+	if len(tail) > 0 {
+		for i := len(tail) - 1; i >= 0; i-- {
+			h ^= uint64(tail[i]) << (8 * uint(i))
+		}
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// patLen 返回元素对应的寄存器以及哈希值中第一个 1 出现的位置
+func patLen(element []byte) (int, uint8) {
+	hash := murmurHash64A(element, 0xadc83b19)
+	index := int(hash & regMask)
+	hash >>= precision
+	hash |= 1 << q // 保证循环会结束
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+// Add 添加元素, 返回新的 HyperLogLog 以及是否有寄存器被修改; 不会修改 b
+// 编码损坏时第三个返回值为 false
+func Add(b []byte, elements [][]byte, sparseMaxBytes int) ([]byte, bool, bool) {
+	if IsDense(b) {
+		var result []byte
+		for _, element := range elements {
+			index, count := patLen(element)
+			if denseGet(b[headerSize:], index) >= count {
+				continue
+			}
+			if result == nil {
+				// 第一次修改时复制一份
+				result = make([]byte, len(b))
+				copy(result, b)
+				b = result
+			}
+			denseSet(result[headerSize:], index, count)
+		}
+		if result == nil {
+			return b, false, true
+		}
+		invalidateCache(result)
+		return result, true, true
+	}
+	regs := make([]uint8, Registers)
+	if !decodeSparse(b[headerSize:], regs) {
+		return nil, false, false
+	}
+	changed := false
+	for _, element := range elements {
+		index, count := patLen(element)
+		if regs[index] < count {
+			regs[index] = count
+			changed = true
+		}
+	}
+	if !changed {
+		return b, false, true
+	}
+	return FromRegisters(regs, true, sparseMaxBytes), true, true
+}
+
+// Count 估算基数, 缓存有效时直接返回缓存的值; 编码损坏时返回 false
+func Count(b []byte) (uint64, bool) {
+	if b[headerSize-1]&(1<<7) == 0 {
+		return binary.LittleEndian.Uint64(b[8:headerSize]), true
+	}
+	regs := make([]uint8, Registers)
+	if !Merge(regs, b) {
+		return 0, false
+	}
+	return CountRegisters(regs), true
+}
+
+// CountRegisters 根据寄存器数组估算基数, 使用 Otmar Ertl 改进的估算方法, 与 Redis 相同
+func CountRegisters(regs []uint8) uint64 {
+	var histogram [64]int
+	for _, v := range regs {
+		histogram[v]++
+	}
+	m := float64(Registers)
+	z := m * tau((m-float64(histogram[q+1]))/m)
+	for j := q; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histogram[0])/m)
+	return uint64(math.Round(alphaInf * m * m / z))
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if prev == z {
+			return z / 3
+		}
+	}
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if prev == z {
+			return z
+		}
+	}
+}
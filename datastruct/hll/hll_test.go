@@ -0,0 +1,211 @@
+package hll
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestPatLen(t *testing.T) {
+	// 期望值由 redis hyperloglog.c 中的 MurmurHash64A 与 hllPatLen 计算得到
+	tests := []struct {
+		element string
+		hash    uint64
+		index   int
+		count   uint8
+	}{
+		{"", 0xd8dfea6585bc9732, 5938, 2},
+		{"a", 0x53d2470a9b43b1a7, 12711, 2},
+		{"hello", 0x0f656f01eecfe400, 9216, 1},
+		{"redis-hll", 0x1c750804d02b01d4, 468, 3},
+		{"0123456789abcdef0", 0xca1802fd45a1ff6c, 16236, 1},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Quote(tt.element), func(t *testing.T) {
+			if hash := murmurHash64A([]byte(tt.element), 0xadc83b19); hash != tt.hash {
+				t.Errorf("hash: got %#x, want %#x", hash, tt.hash)
+			}
+			index, count := patLen([]byte(tt.element))
+			if index != tt.index || count != tt.count {
+				t.Errorf("patLen: got (%d, %d), want (%d, %d)", index, count, tt.index, tt.count)
+			}
+		})
+	}
+}
+
+func TestDenseRegisters(t *testing.T) {
+	// 寄存器从每个字节的低位开始存放, 与 redis 的 HLL_DENSE_SET_REGISTER 相同
+	tests := []struct {
+		name  string
+		index int
+		val   uint8
+		pos   int
+		bytes []byte
+	}{
+		{"first", 0, 1, 0, []byte{0x01, 0x00}},
+		{"cross byte", 1, regMax, 0, []byte{0xc0, 0x0f}},
+		{"byte aligned", 4, 0x2a, 3, []byte{0x2a, 0x00}},
+		{"high bits", 3, regMax, 1, []byte{0x00, 0xfc}},
+		{"last", Registers - 1, regMax, denseSize - headerSize - 1, []byte{0xfc}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			regs := make([]byte, denseSize-headerSize)
+			denseSet(regs, tt.index, tt.val)
+			if got := regs[tt.pos : tt.pos+len(tt.bytes)]; !bytes.Equal(got, tt.bytes) {
+				t.Errorf("got % x, want % x", got, tt.bytes)
+			}
+			if got := denseGet(regs, tt.index); got != tt.val {
+				t.Errorf("get: got %d, want %d", got, tt.val)
+			}
+			// 相邻的寄存器不受影响
+			for _, i := range []int{tt.index - 1, tt.index + 1} {
+				if i >= 0 && i < Registers && denseGet(regs, i) != 0 {
+					t.Errorf("register %d changed to %d", i, denseGet(regs, i))
+				}
+			}
+		})
+	}
+}
+
+func TestSparseEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		set  map[int]uint8
+		data []byte
+	}{
+		{"empty", nil, []byte{0x7f, 0xff}},
+		// ZERO:3, VAL:2, XZERO:16380
+		{"single", map[int]uint8{3: 2}, []byte{0x02, 0x84, 0x7f, 0xfb}},
+		// VAL:1 最多表示 4 个连续的寄存器
+		{"val run", map[int]uint8{0: 1, 1: 1, 2: 1, 3: 1, 4: 1}, []byte{0x83, 0x80, 0x7f, 0xfa}},
+		// XZERO:100, VAL:32, XZERO:16283
+		{"xzero", map[int]uint8{100: 32}, []byte{0x40, 0x63, 0xfc, 0x7f, 0x9a}},
+		{"last", map[int]uint8{Registers - 1: 5}, []byte{0x7f, 0xfe, 0x90}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			regs := make([]uint8, Registers)
+			for i, v := range tt.set {
+				regs[i] = v
+			}
+			data, ok := encodeSparse(regs)
+			if !ok {
+				t.Fatal("encode failed")
+			}
+			if !bytes.Equal(data, tt.data) {
+				t.Errorf("encode: got % x, want % x", data, tt.data)
+			}
+			decoded := make([]uint8, Registers)
+			if !decodeSparse(tt.data, decoded) {
+				t.Fatal("decode failed")
+			}
+			if !bytes.Equal(decoded, regs) {
+				t.Error("decode: registers mismatch")
+			}
+		})
+	}
+}
+
+func TestSparseInvalid(t *testing.T) {
+	regs := make([]uint8, Registers)
+	if _, ok := encodeSparse(append([]uint8{sparseValMax + 1}, regs[1:]...)); ok {
+		t.Error("expected register over sparse range to fail")
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"too short", []byte{0x7f, 0xfe}},
+		{"too long", []byte{0x7f, 0xff, 0x00}},
+		{"truncated xzero", []byte{0x7f}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if decodeSparse(tt.data, make([]uint8, Registers)) {
+				t.Error("expected decode to fail")
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	// 与 redis 中 PFADD 创建的空 HyperLogLog 相同, 缓存的基数 0 有效
+	want := []byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x7f\xff")
+	b := New()
+	if !bytes.Equal(b, want) {
+		t.Errorf("got %q, want %q", b, want)
+	}
+	if count, ok := Count(b); !ok || count != 0 {
+		t.Errorf("count: got %d, %v", count, ok)
+	}
+}
+
+func TestAddAndCount(t *testing.T) {
+	tests := []struct {
+		name           string
+		n              int
+		sparseMaxBytes int
+		dense          bool
+	}{
+		{"sparse", 100, 3000, false},
+		{"promoted to dense", 10000, 3000, true},
+		{"dense only", 1000, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New()
+			for i := 0; i < tt.n; i++ {
+				next, changed, ok := Add(b, [][]byte{[]byte(strconv.Itoa(i))}, tt.sparseMaxBytes)
+				if !ok {
+					t.Fatal("add failed")
+				}
+				if !changed && !bytes.Equal(next, b) {
+					t.Fatal("unchanged add returned a different value")
+				}
+				b = next
+			}
+			if !IsValid(b) || IsDense(b) != tt.dense {
+				t.Fatalf("unexpected encoding, dense: %v", IsDense(b))
+			}
+			count, ok := Count(b)
+			if !ok {
+				t.Fatal("count failed")
+			}
+			// 标准误差为 0.81%
+			if diff := math.Abs(float64(count)-float64(tt.n)) / float64(tt.n); diff > 0.03 {
+				t.Errorf("count %d too far from %d", count, tt.n)
+			}
+			// 重复添加不会修改寄存器
+			if _, changed, _ := Add(b, [][]byte{[]byte("0")}, tt.sparseMaxBytes); changed {
+				t.Error("expected existing element not to change registers")
+			}
+		})
+	}
+}
+
+func TestMergeEncodings(t *testing.T) {
+	// sparse 与 dense 编码的同一组寄存器合并结果相同
+	regs := make([]uint8, Registers)
+	for i := 0; i < 2000; i++ {
+		index, count := patLen([]byte(strconv.Itoa(i)))
+		if count > regs[index] {
+			regs[index] = count
+		}
+	}
+	sparse := FromRegisters(regs, true, math.MaxInt32)
+	dense := FromRegisters(regs, false, 0)
+	if IsDense(sparse) || !IsDense(dense) || len(dense) != denseSize {
+		t.Fatal("unexpected encoding")
+	}
+	for _, b := range [][]byte{sparse, dense} {
+		merged := make([]uint8, Registers)
+		if !Merge(merged, b) {
+			t.Fatal("merge failed")
+		}
+		if !bytes.Equal(merged, regs) {
+			t.Errorf("registers mismatch after merging dense: %v", IsDense(b))
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package jsondoc
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Format 序列化的格式, 与 JSON.GET 的 INDENT、NEWLINE、SPACE 选项对应; 零值表示紧凑格式
+type Format struct {
+	Indent  string // 每一层缩进使用的字符串
+	Newline string // 换行使用的字符串
+	Space   string // 对象的 key 与 value 之间的字符串
+}
+
+// Marshal 序列化为紧凑格式
+func (v *Value) Marshal() []byte {
+	return v.AppendTo(nil, nil)
+}
+
+// String 序列化为紧凑格式
+func (v *Value) String() string {
+	return string(v.Marshal())
+}
+
+// AppendTo 按照 format 序列化并追加到 buf, format 为 nil 时使用紧凑格式
+func (v *Value) AppendTo(buf []byte, format *Format) []byte {
+	if format == nil {
+		format = &Format{}
+	}
+	return v.appendTo(buf, format, 0)
+}
+
+func (v *Value) appendTo(buf []byte, format *Format, depth int) []byte {
+	switch v.kind {
+	case Null:
+		return append(buf, "null"...)
+	case Boolean:
+		return strconv.AppendBool(buf, v.b)
+	case Integer:
+		return strconv.AppendInt(buf, v.i, 10)
+	case Number:
+		return append(buf, FormatFloat(v.f)...)
+	case String:
+		return appendString(buf, v.s)
+	case Array:
+		if len(v.arr) == 0 {
+			return append(buf, "[]"...)
+		}
+		buf = append(buf, '[')
+		for i, e := range v.arr {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendIndent(buf, format, depth+1)
+			buf = e.appendTo(buf, format, depth+1)
+		}
+		buf = appendIndent(buf, format, depth)
+		return append(buf, ']')
+	case Object:
+		if len(v.keys) == 0 {
+			return append(buf, "{}"...)
+		}
+		buf = append(buf, '{')
+		for i, k := range v.keys {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendIndent(buf, format, depth+1)
+			buf = appendString(buf, k)
+			buf = append(buf, ':')
+			buf = append(buf, format.Space...)
+			buf = v.props[k].appendTo(buf, format, depth+1)
+		}
+		buf = appendIndent(buf, format, depth)
+		return append(buf, '}')
+	}
+	return buf
+}
+
+func appendIndent(buf []byte, format *Format, depth int) []byte {
+	buf = append(buf, format.Newline...)
+	for i := 0; i < depth; i++ {
+		buf = append(buf, format.Indent...)
+	}
+	return buf
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendString 把 s 序列化为 JSON 字符串, 只转义必要的字符, 非 ASCII 字符原样输出; 解析时已保证 s 是合法的 UTF-8
+func appendString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"':
+			buf = append(buf, `\"`...)
+		case '\\':
+			buf = append(buf, `\\`...)
+		case '\n':
+			buf = append(buf, `\n`...)
+		case '\r':
+			buf = append(buf, `\r`...)
+		case '\t':
+			buf = append(buf, `\t`...)
+		case '\b':
+			buf = append(buf, `\b`...)
+		case '\f':
+			buf = append(buf, `\f`...)
+		default:
+			if c < 0x20 {
+				buf = append(buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			} else {
+				buf = append(buf, c)
+			}
+		}
+	}
+	return append(buf, '"')
+}
+
+// FormatFloat 格式化浮点数: 整数值保留 ".0", 很大或很小的数使用科学计数法, 如 1e20、1.5e-7
+func FormatFloat(f float64) string {
+	abs := math.Abs(f)
+	if abs == 0 || (abs >= 1e-5 && abs < 1e16) {
+		s := strconv.FormatFloat(f, 'f', -1, 64)
+		if !strings.ContainsRune(s, '.') {
+			s += ".0"
+		}
+		return s
+	}
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	mantissa, exp := s[:strings.IndexByte(s, 'e')], s[strings.IndexByte(s, 'e')+1:]
+	sign := ""
+	if exp[0] == '-' {
+		sign = "-"
+	}
+	return mantissa + "e" + sign + strings.TrimLeft(exp[1:], "0")
+}
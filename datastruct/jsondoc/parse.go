@@ -0,0 +1,310 @@
+package jsondoc
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxDepth 允许的最大嵌套层数, 避免过深的递归
+const maxDepth = 128
+
+// Parse 解析 JSON 文本
+func Parse(data []byte) (*Value, error) {
+	p := &parser{data: data}
+	if !utf8.Valid(data) {
+		return nil, p.error("invalid unicode code point")
+	}
+	p.skipSpace()
+	v, err := p.parseValue(0)
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.data) {
+		return nil, p.error("trailing characters")
+	}
+	return v, nil
+}
+
+type parser struct {
+	data []byte
+	pos  int
+}
+
+// error 生成带有行号和列号的错误信息
+func (p *parser) error(msg string) error {
+	line, column := 1, 1
+	for i := 0; i < p.pos && i < len(p.data); i++ {
+		if p.data[i] == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return fmt.Errorf("%s at line %d column %d", msg, line, column)
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) parseValue(depth int) (*Value, error) {
+	if depth > maxDepth {
+		return nil, p.error("recursion limit exceeded")
+	}
+	if p.pos >= len(p.data) {
+		return nil, p.error("EOF while parsing a value")
+	}
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		return p.parseObject(depth)
+	case c == '[':
+		return p.parseArray(depth)
+	case c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return NewString(s), nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case p.consume("true"):
+		return NewBool(true), nil
+	case p.consume("false"):
+		return NewBool(false), nil
+	case p.consume("null"):
+		return NewNull(), nil
+	}
+	return nil, p.error("expected value")
+}
+
+func (p *parser) consume(literal string) bool {
+	if len(p.data)-p.pos < len(literal) || string(p.data[p.pos:p.pos+len(literal)]) != literal {
+		return false
+	}
+	p.pos += len(literal)
+	return true
+}
+
+func (p *parser) parseObject(depth int) (*Value, error) {
+	p.pos++ // {
+	obj := NewObject()
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == '}' {
+		p.pos++
+		return obj, nil
+	}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.data) || p.data[p.pos] != '"' {
+			return nil, p.error("key must be a string")
+		}
+		key, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.data) || p.data[p.pos] != ':' {
+			return nil, p.error("expected `:`")
+		}
+		p.pos++
+		p.skipSpace()
+		e, err := p.parseValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		obj.Set(key, e)
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return nil, p.error("EOF while parsing an object")
+		}
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return obj, nil
+		default:
+			return nil, p.error("expected `,` or `}`")
+		}
+	}
+}
+
+func (p *parser) parseArray(depth int) (*Value, error) {
+	p.pos++ // [
+	arr := NewArray()
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == ']' {
+		p.pos++
+		return arr, nil
+	}
+	for {
+		p.skipSpace()
+		e, err := p.parseValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		arr.arr = append(arr.arr, e)
+		p.skipSpace()
+		if p.pos >= len(p.data) {
+			return nil, p.error("EOF while parsing a list")
+		}
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return arr, nil
+		default:
+			return nil, p.error("expected `,` or `]`")
+		}
+	}
+}
+
+func (p *parser) parseNumber() (*Value, error) {
+	start := p.pos
+	isFloat := false
+	if p.data[p.pos] == '-' {
+		p.pos++
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '0' {
+		p.pos++ // 以 0 开头时整数部分只有一位
+	} else if !p.digits() {
+		return nil, p.error("invalid number")
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '.' {
+		isFloat = true
+		p.pos++
+		if !p.digits() {
+			return nil, p.error("invalid number")
+		}
+	}
+	if p.pos < len(p.data) && (p.data[p.pos] == 'e' || p.data[p.pos] == 'E') {
+		isFloat = true
+		p.pos++
+		if p.pos < len(p.data) && (p.data[p.pos] == '+' || p.data[p.pos] == '-') {
+			p.pos++
+		}
+		if !p.digits() {
+			return nil, p.error("invalid number")
+		}
+	}
+	text := string(p.data[start:p.pos])
+	if !isFloat {
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return NewInt(i), nil
+		}
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, p.error("number out of range")
+	}
+	return NewFloat(f), nil
+}
+
+// digits 跳过连续的数字, 没有数字时返回 false
+func (p *parser) digits() bool {
+	start := p.pos
+	for p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '9' {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+func (p *parser) parseString() (string, error) {
+	p.pos++ // "
+	buf := make([]byte, 0, 16)
+	for {
+		if p.pos >= len(p.data) {
+			return "", p.error("EOF while parsing a string")
+		}
+		c := p.data[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return string(buf), nil
+		case c == '\\':
+			p.pos++
+			if p.pos >= len(p.data) {
+				return "", p.error("EOF while parsing a string")
+			}
+			esc := p.data[p.pos]
+			p.pos++
+			switch esc {
+			case '"', '\\', '/':
+				buf = append(buf, esc)
+			case 'b':
+				buf = append(buf, '\b')
+			case 'f':
+				buf = append(buf, '\f')
+			case 'n':
+				buf = append(buf, '\n')
+			case 'r':
+				buf = append(buf, '\r')
+			case 't':
+				buf = append(buf, '\t')
+			case 'u':
+				r, err := p.parseUnicode()
+				if err != nil {
+					return "", err
+				}
+				var encoded [utf8.UTFMax]byte
+				n := utf8.EncodeRune(encoded[:], r)
+				buf = append(buf, encoded[:n]...)
+			default:
+				return "", p.error("invalid escape")
+			}
+		case c < 0x20:
+			return "", p.error("control character (\\u0000-\\u001F) found while parsing a string")
+		default:
+			buf = append(buf, c)
+			p.pos++
+		}
+	}
+}
+
+// parseUnicode 解析 \u 之后的 4 位十六进制数, 处理 UTF-16 代理对
+func (p *parser) parseUnicode() (rune, error) {
+	r, err := p.hex4()
+	if err != nil {
+		return 0, err
+	}
+	if !utf16.IsSurrogate(r) {
+		return r, nil
+	}
+	if p.pos+2 > len(p.data) || p.data[p.pos] != '\\' || p.data[p.pos+1] != 'u' {
+		return 0, p.error("lone leading surrogate in hex escape")
+	}
+	p.pos += 2
+	r2, err := p.hex4()
+	if err != nil {
+		return 0, err
+	}
+	combined := utf16.DecodeRune(r, r2)
+	if combined == utf8.RuneError {
+		return 0, p.error("lone leading surrogate in hex escape")
+	}
+	return combined, nil
+}
+
+func (p *parser) hex4() (rune, error) {
+	if p.pos+4 > len(p.data) {
+		return 0, p.error("EOF while parsing a string")
+	}
+	n, err := strconv.ParseUint(string(p.data[p.pos:p.pos+4]), 16, 32)
+	if err != nil {
+		return 0, p.error("invalid escape")
+	}
+	p.pos += 4
+	return rune(n), nil
+}
@@ -0,0 +1,433 @@
+package jsondoc
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+ * JSONPath, 支持的语法:
+ *   $              根节点
+ *   .name ['name'] 对象的 key, 方括号中可以用逗号分隔多个 key
+ *   [0] [-1] [0,2] 数组下标, 负数表示从末尾开始计数
+ *   [start:end:step] 数组切片
+ *   .* [*]         所有子节点
+ *   ..name ..*     递归匹配所有后代节点
+ * 不以 $ 开头的是旧语法, 如 .a.b、a[0]、"." 表示根节点, 旧语法的指令只返回一个结果
+ */
+
+type segmentKind uint8
+
+const (
+	segName segmentKind = iota
+	segIndex
+	segWildcard
+	segSlice
+)
+
+type segment struct {
+	kind      segmentKind
+	recursive bool // 由 .. 引出, 匹配所有后代节点
+	names     []string
+	indexes   []int
+	start     int
+	end       int
+	step      int
+	hasStart  bool
+	hasEnd    bool
+}
+
+// Path 编译后的路径
+type Path struct {
+	raw      string
+	legacy   bool
+	segments []*segment
+}
+
+// String 返回原始的路径字符串
+func (p *Path) String() string {
+	return p.raw
+}
+
+// IsLegacy 是否为旧语法
+func (p *Path) IsLegacy() bool {
+	return p.legacy
+}
+
+// IsRoot 是否只匹配根节点
+func (p *Path) IsRoot() bool {
+	return len(p.segments) == 0
+}
+
+// ParsePath 编译路径
+func ParsePath(s string) (*Path, error) {
+	path := &Path{raw: s}
+	expr := s
+	if !strings.HasPrefix(s, "$") {
+		path.legacy = true
+		switch {
+		case s == ".":
+			return path, nil
+		case strings.HasPrefix(s, ".") || strings.HasPrefix(s, "["):
+			expr = "$" + s
+		default:
+			expr = "$." + s
+		}
+	}
+	p := &pathParser{expr: expr, pos: 1}
+	for p.pos < len(p.expr) {
+		seg, err := p.parseSegment()
+		if err != nil {
+			return nil, errors.New("JSON Path error: " + err.Error() + " at position " + strconv.Itoa(p.pos) + " in path '" + s + "'")
+		}
+		path.segments = append(path.segments, seg)
+	}
+	return path, nil
+}
+
+type pathParser struct {
+	expr string
+	pos  int
+}
+
+func (p *pathParser) peek() byte {
+	if p.pos >= len(p.expr) {
+		return 0
+	}
+	return p.expr[p.pos]
+}
+
+func (p *pathParser) parseSegment() (*segment, error) {
+	switch p.peek() {
+	case '.':
+		p.pos++
+		recursive := false
+		if p.peek() == '.' {
+			recursive = true
+			p.pos++
+			if p.peek() == '[' {
+				seg, err := p.parseBracket()
+				if err != nil {
+					return nil, err
+				}
+				seg.recursive = true
+				return seg, nil
+			}
+		}
+		if p.peek() == '*' {
+			p.pos++
+			return &segment{kind: segWildcard, recursive: recursive}, nil
+		}
+		start := p.pos
+		for p.pos < len(p.expr) && p.expr[p.pos] != '.' && p.expr[p.pos] != '[' {
+			p.pos++
+		}
+		if p.pos == start {
+			return nil, errors.New("expected member name")
+		}
+		return &segment{kind: segName, recursive: recursive, names: []string{p.expr[start:p.pos]}}, nil
+	case '[':
+		return p.parseBracket()
+	}
+	return nil, errors.New("expected '.' or '['")
+}
+
+// parseBracket 解析方括号中的内容: *、'name'、下标、切片
+func (p *pathParser) parseBracket() (*segment, error) {
+	p.pos++ // [
+	p.skipSpace()
+	var seg *segment
+	var err error
+	switch c := p.peek(); {
+	case c == '*':
+		p.pos++
+		seg = &segment{kind: segWildcard}
+	case c == '\'' || c == '"':
+		seg, err = p.parseNames()
+	case c == '?':
+		return nil, errors.New("filter expressions are not supported")
+	default:
+		seg, err = p.parseIndexes()
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.peek() != ']' {
+		return nil, errors.New("expected ']'")
+	}
+	p.pos++
+	return seg, nil
+}
+
+func (p *pathParser) skipSpace() {
+	for p.peek() == ' ' {
+		p.pos++
+	}
+}
+
+func (p *pathParser) parseNames() (*segment, error) {
+	seg := &segment{kind: segName}
+	for {
+		quote := p.peek()
+		if quote != '\'' && quote != '"' {
+			return nil, errors.New("expected quoted member name")
+		}
+		p.pos++
+		var name strings.Builder
+		for {
+			if p.pos >= len(p.expr) {
+				return nil, errors.New("unterminated member name")
+			}
+			c := p.expr[p.pos]
+			p.pos++
+			if c == quote {
+				break
+			}
+			if c == '\\' && p.pos < len(p.expr) {
+				c = p.expr[p.pos]
+				p.pos++
+			}
+			name.WriteByte(c)
+		}
+		seg.names = append(seg.names, name.String())
+		p.skipSpace()
+		if p.peek() != ',' {
+			return seg, nil
+		}
+		p.pos++
+		p.skipSpace()
+	}
+}
+
+// parseIndexes 解析下标列表或切片
+func (p *pathParser) parseIndexes() (*segment, error) {
+	end := strings.IndexByte(p.expr[p.pos:], ']')
+	if end < 0 {
+		return nil, errors.New("expected ']'")
+	}
+	content := p.expr[p.pos : p.pos+end]
+	if strings.Contains(content, ":") {
+		seg, err := parseSlice(content)
+		if err != nil {
+			return nil, err
+		}
+		p.pos += end
+		return seg, nil
+	}
+	seg := &segment{kind: segIndex}
+	for _, part := range strings.Split(content, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, errors.New("invalid array index")
+		}
+		seg.indexes = append(seg.indexes, i)
+	}
+	p.pos += end
+	return seg, nil
+}
+
+func parseSlice(content string) (*segment, error) {
+	parts := strings.Split(content, ":")
+	if len(parts) > 3 {
+		return nil, errors.New("invalid slice")
+	}
+	seg := &segment{kind: segSlice, step: 1}
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, errors.New("invalid slice")
+		}
+		switch i {
+		case 0:
+			seg.start, seg.hasStart = n, true
+		case 1:
+			seg.end, seg.hasEnd = n, true
+		case 2:
+			if n <= 0 {
+				return nil, errors.New("slice step must be positive")
+			}
+			seg.step = n
+		}
+	}
+	return seg, nil
+}
+
+/* ---- 求值 ---- */
+
+// Match 路径匹配到的节点
+type Match struct {
+	Value  *Value // 为 nil 时表示节点不存在, 可以通过 Set 创建
+	parent *Value // 为 nil 时表示根节点
+	key    string
+	index  int
+}
+
+// Set 把节点的值替换为 v, 节点不存在时添加到父对象中
+func (m *Match) Set(v *Value) {
+	if m.Value != nil {
+		m.Value.Assign(v)
+		return
+	}
+	m.parent.Set(m.key, v)
+	m.Value = v
+}
+
+// Find 返回所有匹配的节点
+func (p *Path) Find(root *Value) []*Match {
+	return p.find(root, false)
+}
+
+// FindOrCreate 与 Find 相同; 另外最后一级是对象的单个 key 且父节点是对象时, 不存在的 key 也作为匹配结果返回, 其 Value 为 nil
+func (p *Path) FindOrCreate(root *Value) []*Match {
+	return p.find(root, true)
+}
+
+func (p *Path) find(root *Value, create bool) []*Match {
+	matches := []*Match{{Value: root}}
+	for i, seg := range p.segments {
+		last := i == len(p.segments)-1
+		next := make([]*Match, 0, len(matches))
+		for _, m := range matches {
+			if seg.recursive {
+				for _, d := range descendants(m) {
+					next = seg.apply(d.Value, next, false)
+				}
+			} else {
+				next = seg.apply(m.Value, next, create && last)
+			}
+		}
+		matches = next
+	}
+	return matches
+}
+
+// descendants 返回 m 以及它的所有后代节点
+func descendants(m *Match) []*Match {
+	result := []*Match{m}
+	for i := 0; i < len(result); i++ {
+		v := result[i].Value
+		switch v.kind {
+		case Array:
+			for j, e := range v.arr {
+				result = append(result, &Match{Value: e, parent: v, index: j})
+			}
+		case Object:
+			for _, k := range v.keys {
+				result = append(result, &Match{Value: v.props[k], parent: v, key: k})
+			}
+		}
+	}
+	return result
+}
+
+// apply 在节点 v 上匹配一级路径, 结果追加到 out
+func (seg *segment) apply(v *Value, out []*Match, create bool) []*Match {
+	switch seg.kind {
+	case segName:
+		if v.kind != Object {
+			return out
+		}
+		for _, name := range seg.names {
+			if e, ok := v.props[name]; ok {
+				out = append(out, &Match{Value: e, parent: v, key: name})
+			} else if create && len(seg.names) == 1 {
+				out = append(out, &Match{parent: v, key: name})
+			}
+		}
+	case segWildcard:
+		switch v.kind {
+		case Array:
+			for i, e := range v.arr {
+				out = append(out, &Match{Value: e, parent: v, index: i})
+			}
+		case Object:
+			for _, k := range v.keys {
+				out = append(out, &Match{Value: v.props[k], parent: v, key: k})
+			}
+		}
+	case segIndex:
+		if v.kind != Array {
+			return out
+		}
+		for _, i := range seg.indexes {
+			if i < 0 {
+				i += len(v.arr)
+			}
+			if i >= 0 && i < len(v.arr) {
+				out = append(out, &Match{Value: v.arr[i], parent: v, index: i})
+			}
+		}
+	case segSlice:
+		if v.kind != Array {
+			return out
+		}
+		size := len(v.arr)
+		start, end := 0, size
+		if seg.hasStart {
+			start = clampIndex(seg.start, size)
+		}
+		if seg.hasEnd {
+			end = clampIndex(seg.end, size)
+		}
+		for i := start; i < end; i += seg.step {
+			out = append(out, &Match{Value: v.arr[i], parent: v, index: i})
+		}
+	}
+	return out
+}
+
+// clampIndex 把切片的边界转换为 [0, size] 之间的下标
+func clampIndex(i int, size int) int {
+	if i < 0 {
+		i += size
+		if i < 0 {
+			return 0
+		}
+	}
+	if i > size {
+		return size
+	}
+	return i
+}
+
+// Delete 删除所有匹配的节点, 返回删除的数量; 不会删除根节点
+func (p *Path) Delete(root *Value) int {
+	matches := p.Find(root)
+	// 同一数组中的元素从后向前删除, 避免下标变化
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].index > matches[j].index
+	})
+	type position struct {
+		parent *Value
+		key    string
+		index  int
+	}
+	seen := make(map[position]struct{}, len(matches))
+	deleted := 0
+	for _, m := range matches {
+		if m.parent == nil {
+			continue
+		}
+		pos := position{parent: m.parent, key: m.key, index: m.index}
+		if _, ok := seen[pos]; ok {
+			continue
+		}
+		seen[pos] = struct{}{}
+		if m.parent.kind == Object {
+			if m.parent.Delete(m.key) {
+				deleted++
+			}
+		} else {
+			m.parent.arr = append(m.parent.arr[:m.index], m.parent.arr[m.index+1:]...)
+			deleted++
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,424 @@
+// Package jsondoc JSON 文档, 对象保留 key 的插入顺序, 数字区分整数与浮点数
+package jsondoc
+
+import (
+	"errors"
+	"math"
+)
+
+// Kind JSON 值的类型
+type Kind uint8
+
+// JSON 值的类型
+const (
+	Null Kind = iota
+	Boolean
+	Integer
+	Number // 浮点数
+	String
+	Array
+	Object
+)
+
+var kindNames = [...]string{"null", "boolean", "integer", "number", "string", "array", "object"}
+
+// String 返回类型名称, 与 JSON.TYPE 相同
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+var (
+	// ErrNotNumber 对非数字执行数值运算
+	ErrNotNumber = errors.New("not a number")
+	// ErrOverflow 运算结果不是有限的数字
+	ErrOverflow = errors.New("result is not a number or infinite")
+	// ErrIndexOutOfRange 数组下标越界
+	ErrIndexOutOfRange = errors.New("index out of bounds")
+)
+
+// Value JSON 值
+type Value struct {
+	kind  Kind
+	b     bool
+	i     int64
+	f     float64
+	s     string
+	arr   []*Value
+	keys  []string // 对象的 key, 按插入顺序
+	props map[string]*Value
+}
+
+// NewNull 创建 null
+func NewNull() *Value {
+	return &Value{kind: Null}
+}
+
+// NewBool 创建布尔值
+func NewBool(b bool) *Value {
+	return &Value{kind: Boolean, b: b}
+}
+
+// NewInt 创建整数
+func NewInt(i int64) *Value {
+	return &Value{kind: Integer, i: i}
+}
+
+// NewFloat 创建浮点数
+func NewFloat(f float64) *Value {
+	return &Value{kind: Number, f: f}
+}
+
+// NewString 创建字符串
+func NewString(s string) *Value {
+	return &Value{kind: String, s: s}
+}
+
+// NewArray 创建数组
+func NewArray(elements ...*Value) *Value {
+	return &Value{kind: Array, arr: elements}
+}
+
+// NewObject 创建空对象
+func NewObject() *Value {
+	return &Value{kind: Object, props: make(map[string]*Value)}
+}
+
+// Kind 返回值的类型
+func (v *Value) Kind() Kind {
+	return v.kind
+}
+
+// IsNumber 是否为整数或浮点数
+func (v *Value) IsNumber() bool {
+	return v.kind == Integer || v.kind == Number
+}
+
+// Bool 返回布尔值
+func (v *Value) Bool() bool {
+	return v.b
+}
+
+// Str 返回字符串的内容
+func (v *Value) Str() string {
+	return v.s
+}
+
+// Float 返回数字的浮点数形式
+func (v *Value) Float() float64 {
+	if v.kind == Integer {
+		return float64(v.i)
+	}
+	return v.f
+}
+
+// Len 返回数组、对象的元素数量或字符串的字节数, 其它类型返回 1
+func (v *Value) Len() int {
+	switch v.kind {
+	case Array:
+		return len(v.arr)
+	case Object:
+		return len(v.keys)
+	case String:
+		return len(v.s)
+	}
+	return 1
+}
+
+// Assign 用 other 的内容原地替换 v, other 之后不应再被使用
+func (v *Value) Assign(other *Value) {
+	*v = *other
+}
+
+// Clone 深拷贝
+func (v *Value) Clone() *Value {
+	c := *v
+	switch v.kind {
+	case Array:
+		c.arr = make([]*Value, len(v.arr))
+		for i, e := range v.arr {
+			c.arr[i] = e.Clone()
+		}
+	case Object:
+		c.keys = make([]string, len(v.keys))
+		copy(c.keys, v.keys)
+		c.props = make(map[string]*Value, len(v.props))
+		for k, e := range v.props {
+			c.props[k] = e.Clone()
+		}
+	}
+	return &c
+}
+
+// Equal 深比较, 整数与浮点数按数值比较
+func (v *Value) Equal(other *Value) bool {
+	if v.IsNumber() && other.IsNumber() {
+		if v.kind == Integer && other.kind == Integer {
+			return v.i == other.i
+		}
+		return v.Float() == other.Float()
+	}
+	if v.kind != other.kind {
+		return false
+	}
+	switch v.kind {
+	case Boolean:
+		return v.b == other.b
+	case String:
+		return v.s == other.s
+	case Array:
+		if len(v.arr) != len(other.arr) {
+			return false
+		}
+		for i := range v.arr {
+			if !v.arr[i].Equal(other.arr[i]) {
+				return false
+			}
+		}
+	case Object:
+		if len(v.keys) != len(other.keys) {
+			return false
+		}
+		for k, e := range v.props {
+			o, ok := other.props[k]
+			if !ok || !e.Equal(o) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Walk 先序遍历 v 及其所有子节点, key 为节点在父对象中的 key, 数组元素和根节点为空字符串
+func (v *Value) Walk(fn func(key string, node *Value)) {
+	v.walk("", fn)
+}
+
+func (v *Value) walk(key string, fn func(key string, node *Value)) {
+	fn(key, v)
+	switch v.kind {
+	case Array:
+		for _, e := range v.arr {
+			e.walk("", fn)
+		}
+	case Object:
+		for _, k := range v.keys {
+			v.props[k].walk(k, fn)
+		}
+	}
+}
+
+/* ---- 数字 ---- */
+
+// IncrBy 加上 delta, 两个整数相加且不溢出时结果仍为整数
+func (v *Value) IncrBy(delta *Value) error {
+	if !v.IsNumber() || !delta.IsNumber() {
+		return ErrNotNumber
+	}
+	if v.kind == Integer && delta.kind == Integer {
+		sum := v.i + delta.i
+		if (sum > v.i) == (delta.i > 0) {
+			v.i = sum
+			return nil
+		}
+	}
+	return v.setFloat(v.Float() + delta.Float())
+}
+
+// MultBy 乘以 factor, 两个整数相乘且不溢出时结果仍为整数
+func (v *Value) MultBy(factor *Value) error {
+	if !v.IsNumber() || !factor.IsNumber() {
+		return ErrNotNumber
+	}
+	if v.kind == Integer && factor.kind == Integer {
+		product := v.i * factor.i
+		if v.i == 0 || (product/v.i == factor.i && !(v.i == -1 && factor.i == math.MinInt64)) {
+			v.i = product
+			return nil
+		}
+	}
+	return v.setFloat(v.Float() * factor.Float())
+}
+
+func (v *Value) setFloat(f float64) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return ErrOverflow
+	}
+	v.kind = Number
+	v.f = f
+	return nil
+}
+
+/* ---- 字符串与布尔值 ---- */
+
+// StrAppend 在字符串末尾追加内容, 返回新的长度
+func (v *Value) StrAppend(s string) int {
+	v.s += s
+	return len(v.s)
+}
+
+// Toggle 布尔值取反, 返回新的值
+func (v *Value) Toggle() bool {
+	v.b = !v.b
+	return v.b
+}
+
+// Clear 清空数组和对象, 数字置为 0; 其它类型不变, 返回 false
+func (v *Value) Clear() bool {
+	switch v.kind {
+	case Array:
+		v.arr = nil
+	case Object:
+		v.keys = nil
+		v.props = make(map[string]*Value)
+	case Integer:
+		v.i = 0
+	case Number:
+		v.kind = Integer
+		v.f = 0
+		v.i = 0
+	default:
+		return false
+	}
+	return true
+}
+
+/* ---- 数组 ---- */
+
+// Index 返回数组下标 i 处的元素, 越界时返回 nil
+func (v *Value) Index(i int) *Value {
+	if i < 0 || i >= len(v.arr) {
+		return nil
+	}
+	return v.arr[i]
+}
+
+// ArrAppend 在数组末尾追加元素, 返回新的长度
+func (v *Value) ArrAppend(elements ...*Value) int {
+	v.arr = append(v.arr, elements...)
+	return len(v.arr)
+}
+
+// ArrInsert 在 index 之前插入元素, 负数表示从末尾开始计数; 返回新的长度
+func (v *Value) ArrInsert(index int, elements ...*Value) (int, error) {
+	size := len(v.arr)
+	if index < 0 {
+		index += size
+	}
+	if index < 0 || index > size {
+		return 0, ErrIndexOutOfRange
+	}
+	arr := make([]*Value, 0, size+len(elements))
+	arr = append(arr, v.arr[:index]...)
+	arr = append(arr, elements...)
+	arr = append(arr, v.arr[index:]...)
+	v.arr = arr
+	return len(v.arr), nil
+}
+
+// ArrPop 删除并返回 index 处的元素, 负数表示从末尾开始计数, 越界时取最近的一端; 数组为空时返回 nil
+func (v *Value) ArrPop(index int) *Value {
+	size := len(v.arr)
+	if size == 0 {
+		return nil
+	}
+	if index < 0 {
+		index += size
+	}
+	if index < 0 {
+		index = 0
+	} else if index >= size {
+		index = size - 1
+	}
+	popped := v.arr[index]
+	v.arr = append(v.arr[:index], v.arr[index+1:]...)
+	return popped
+}
+
+// ArrTrim 只保留 [start, stop] 之间的元素, 负数表示从末尾开始计数; 返回新的长度
+func (v *Value) ArrTrim(start int, stop int) int {
+	start, stop = normalizeRange(start, stop, len(v.arr))
+	if start > stop {
+		v.arr = nil
+		return 0
+	}
+	v.arr = append(v.arr[:0:0], v.arr[start:stop+1]...)
+	return len(v.arr)
+}
+
+// ArrIndex 返回 [start, stop) 中第一个与 target 相等的元素的下标, 负数表示从末尾开始计数, stop 为 0 时表示到数组末尾; 不存在时返回 -1
+func (v *Value) ArrIndex(target *Value, start int, stop int) int {
+	size := len(v.arr)
+	if start < 0 {
+		start += size
+		if start < 0 {
+			start = 0
+		}
+	}
+	if stop == 0 {
+		stop = size
+	} else if stop < 0 {
+		stop += size
+	}
+	if stop > size {
+		stop = size
+	}
+	for i := start; i < stop; i++ {
+		if v.arr[i].Equal(target) {
+			return i
+		}
+	}
+	return -1
+}
+
+// normalizeRange 把包含两端的 [start, stop] 转换为合法的下标, start > stop 表示范围为空
+func normalizeRange(start int, stop int, size int) (int, int) {
+	if start < 0 {
+		start += size
+		if start < 0 {
+			start = 0
+		}
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	return start, stop
+}
+
+/* ---- 对象 ---- */
+
+// Keys 返回对象的 key, 按插入顺序
+func (v *Value) Keys() []string {
+	return v.keys
+}
+
+// Get 返回对象中 key 对应的值
+func (v *Value) Get(key string) (*Value, bool) {
+	e, ok := v.props[key]
+	return e, ok
+}
+
+// Set 设置对象中 key 对应的值, 新的 key 添加到末尾
+func (v *Value) Set(key string, e *Value) {
+	if _, ok := v.props[key]; !ok {
+		v.keys = append(v.keys, key)
+	}
+	v.props[key] = e
+}
+
+// Delete 删除对象中的 key, 不存在时返回 false
+func (v *Value) Delete(key string) bool {
+	if _, ok := v.props[key]; !ok {
+		return false
+	}
+	delete(v.props, key)
+	for i, k := range v.keys {
+		if k == key {
+			v.keys = append(v.keys[:i], v.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
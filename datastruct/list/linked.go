@@ -0,0 +1,218 @@
+package list
+
+// LinkedList 双向链表
+type LinkedList struct {
+	first *node
+	last  *node
+	size  int
+}
+
+type node struct {
+	val  interface{}
+	prev *node
+	next *node
+}
+
+// Make 创建链表
+func Make(vals ...interface{}) *LinkedList {
+	list := &LinkedList{}
+	for _, v := range vals {
+		list.Add(v)
+	}
+	return list
+}
+
+// Add 在末尾添加元素
+func (list *LinkedList) Add(val interface{}) {
+	n := &node{
+		val:  val,
+		prev: list.last,
+	}
+	if list.last == nil {
+		list.first = n
+	} else {
+		list.last.next = n
+	}
+	list.last = n
+	list.size++
+}
+
+// find 返回第 index 个节点, 从离 index 较近的一端开始查找
+func (list *LinkedList) find(index int) *node {
+	if index < list.size/2 {
+		n := list.first
+		for i := 0; i < index; i++ {
+			n = n.next
+		}
+		return n
+	}
+	n := list.last
+	for i := list.size - 1; i > index; i-- {
+		n = n.prev
+	}
+	return n
+}
+
+func (list *LinkedList) checkIndex(index int) {
+	if index < 0 || index >= list.size {
+		panic("index out of bound")
+	}
+}
+
+// Get 返回第 index 个元素
+func (list *LinkedList) Get(index int) (val interface{}) {
+	list.checkIndex(index)
+	return list.find(index).val
+}
+
+// Set 修改第 index 个元素
+func (list *LinkedList) Set(index int, val interface{}) {
+	list.checkIndex(index)
+	list.find(index).val = val
+}
+
+// Insert 在第 index 个位置插入元素, index 等于长度时添加到末尾
+func (list *LinkedList) Insert(index int, val interface{}) {
+	if index < 0 || index > list.size {
+		panic("index out of bound")
+	}
+	if index == list.size {
+		list.Add(val)
+		return
+	}
+	pivot := list.find(index)
+	n := &node{
+		val:  val,
+		prev: pivot.prev,
+		next: pivot,
+	}
+	if pivot.prev == nil {
+		list.first = n
+	} else {
+		pivot.prev.next = n
+	}
+	pivot.prev = n
+	list.size++
+}
+
+func (list *LinkedList) removeNode(n *node) {
+	if n.prev == nil {
+		list.first = n.next
+	} else {
+		n.prev.next = n.next
+	}
+	if n.next == nil {
+		list.last = n.prev
+	} else {
+		n.next.prev = n.prev
+	}
+	n.prev = nil
+	n.next = nil
+	list.size--
+}
+
+// Remove 删除并返回第 index 个元素
+func (list *LinkedList) Remove(index int) (val interface{}) {
+	list.checkIndex(index)
+	n := list.find(index)
+	list.removeNode(n)
+	return n.val
+}
+
+// RemoveLast 删除并返回最后一个元素, 列表为空时返回 nil
+func (list *LinkedList) RemoveLast() (val interface{}) {
+	if list.last == nil {
+		return nil
+	}
+	n := list.last
+	list.removeNode(n)
+	return n.val
+}
+
+// RemoveAllByVal 删除所有符合预期的元素, 返回删除的个数
+func (list *LinkedList) RemoveAllByVal(expected Expected) int {
+	removed := 0
+	for n := list.first; n != nil; {
+		next := n.next
+		if expected(n.val) {
+			list.removeNode(n)
+			removed++
+		}
+		n = next
+	}
+	return removed
+}
+
+// RemoveByVal 从头开始删除至多 count 个符合预期的元素
+func (list *LinkedList) RemoveByVal(expected Expected, count int) int {
+	removed := 0
+	for n := list.first; n != nil && removed < count; {
+		next := n.next
+		if expected(n.val) {
+			list.removeNode(n)
+			removed++
+		}
+		n = next
+	}
+	return removed
+}
+
+// ReverseRemoveByVal 从尾开始删除至多 count 个符合预期的元素
+func (list *LinkedList) ReverseRemoveByVal(expected Expected, count int) int {
+	removed := 0
+	for n := list.last; n != nil && removed < count; {
+		prev := n.prev
+		if expected(n.val) {
+			list.removeNode(n)
+			removed++
+		}
+		n = prev
+	}
+	return removed
+}
+
+// Len 返回元素个数
+func (list *LinkedList) Len() int {
+	return list.size
+}
+
+// ForEach 从头开始遍历
+func (list *LinkedList) ForEach(consumer Consumer) {
+	i := 0
+	for n := list.first; n != nil; n = n.next {
+		if !consumer(i, n.val) {
+			break
+		}
+		i++
+	}
+}
+
+// Contains 是否存在符合预期的元素
+func (list *LinkedList) Contains(expected Expected) bool {
+	contains := false
+	list.ForEach(func(i int, v interface{}) bool {
+		if expected(v) {
+			contains = true
+			return false
+		}
+		return true
+	})
+	return contains
+}
+
+// Range 返回 [start, stop) 之间的元素
+func (list *LinkedList) Range(start int, stop int) []interface{} {
+	if start < 0 || start > list.size || stop < start || stop > list.size {
+		panic("index out of bound")
+	}
+	result := make([]interface{}, 0, stop-start)
+	if start == stop {
+		return result
+	}
+	n := list.find(start)
+	for i := start; i < stop; i++ {
+		result = append(result, n.val)
+		n = n.next
+	}
+	return result
+}
@@ -0,0 +1,25 @@
+// Package list 列表数据结构
+package list
+
+// Expected 判断元素是否符合预期
+type Expected func(a interface{}) bool
+
+// Consumer 遍历列表, 返回 false 时停止遍历
+type Consumer func(i int, v interface{}) bool
+
+// List 列表接口
+type List interface {
+	Add(val interface{})                                 // 在末尾添加元素
+	Get(index int) (val interface{})                     // 返回第 index 个元素
+	Set(index int, val interface{})                      // 修改第 index 个元素
+	Insert(index int, val interface{})                   // 在第 index 个位置插入元素
+	Remove(index int) (val interface{})                  // 删除并返回第 index 个元素
+	RemoveLast() (val interface{})                       // 删除并返回最后一个元素
+	RemoveByVal(expected Expected, count int) int        // 从头开始删除至多 count 个符合预期的元素
+	ReverseRemoveByVal(expected Expected, count int) int // 从尾开始删除至多 count 个符合预期的元素
+	RemoveAllByVal(expected Expected) int                // 删除所有符合预期的元素
+	Len() int
+	ForEach(consumer Consumer)
+	Contains(expected Expected) bool
+	Range(start int, stop int) []interface{} // 返回 [start, stop) 之间的元素
+}
@@ -0,0 +1,103 @@
+// Package set 无序集合, 元素为字符串
+package set
+
+// Set 无序集合
+type Set struct {
+	dict map[string]struct{}
+}
+
+// Make 创建包含给定元素的集合
+func Make(members ...string) *Set {
+	s := &Set{
+		dict: make(map[string]struct{}, len(members)),
+	}
+	for _, member := range members {
+		s.dict[member] = struct{}{}
+	}
+	return s
+}
+
+// Add 添加元素, 新增元素时返回 true
+func (s *Set) Add(member string) bool {
+	if _, ok := s.dict[member]; ok {
+		return false
+	}
+	s.dict[member] = struct{}{}
+	return true
+}
+
+// Remove 删除元素, 不存在时返回 false
+func (s *Set) Remove(member string) bool {
+	if _, ok := s.dict[member]; !ok {
+		return false
+	}
+	delete(s.dict, member)
+	return true
+}
+
+// Has 判断元素是否存在
+func (s *Set) Has(member string) bool {
+	_, ok := s.dict[member]
+	return ok
+}
+
+// Len 返回元素数量
+func (s *Set) Len() int {
+	return len(s.dict)
+}
+
+// ForEach 遍历所有元素, consumer 返回 false 时停止
+func (s *Set) ForEach(consumer func(member string) bool) {
+	for member := range s.dict {
+		if !consumer(member) {
+			return
+		}
+	}
+}
+
+// Members 返回所有元素
+func (s *Set) Members() []string {
+	members := make([]string, 0, len(s.dict))
+	for member := range s.dict {
+		members = append(members, member)
+	}
+	return members
+}
+
+// scanBuckets Scan 按元素的哈希值把元素分成固定数量的桶, 游标为下一个桶的序号
+const scanBuckets = 64
+
+// fnv32 FNV-1a 哈希
+func fnv32(key string) uint32 {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return hash
+}
+
+// Scan 从第 cursor 个桶开始遍历, 至少收集 count 个满足 filter 的元素或遍历完所有桶后返回
+// 游标的含义与 SortedSet.Scan 相同, 整个遍历期间一直存在的元素至少会被返回一次
+// 返回下一次遍历的起始桶, 遍历结束时返回 0
+func (s *Set) Scan(cursor int, count int, filter func(member string) bool) ([]string, int) {
+	if cursor < 0 || cursor >= scanBuckets {
+		return nil, 0
+	}
+	buckets := make([][]string, scanBuckets)
+	for member := range s.dict {
+		b := int(fnv32(member) % scanBuckets)
+		if b >= cursor && (filter == nil || filter(member)) {
+			buckets[b] = append(buckets[b], member)
+		}
+	}
+	result := make([]string, 0, count)
+	for cursor < scanBuckets && len(result) < count {
+		result = append(result, buckets[cursor]...)
+		cursor++
+	}
+	if cursor >= scanBuckets {
+		cursor = 0
+	}
+	return result, cursor
+}
@@ -0,0 +1,78 @@
+package sortedset
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ScoreBorder score 范围的边界, Exclude 为 true 时不包含边界本身
+type ScoreBorder struct {
+	Value   float64
+	Exclude bool
+}
+
+var (
+	// NegativeInf 负无穷
+	NegativeInf = &ScoreBorder{Value: math.Inf(-1)}
+	// PositiveInf 正无穷
+	PositiveInf = &ScoreBorder{Value: math.Inf(1)}
+)
+
+var errInvalidBorder = errors.New("ERR min or max is not a float")
+
+// lessEqual 作为下界时 value 是否在范围内
+func (b *ScoreBorder) lessEqual(value float64) bool {
+	if b.Exclude {
+		return b.Value < value
+	}
+	return b.Value <= value
+}
+
+// greaterEqual 作为上界时 value 是否在范围内
+func (b *ScoreBorder) greaterEqual(value float64) bool {
+	if b.Exclude {
+		return b.Value > value
+	}
+	return b.Value >= value
+}
+
+// ParseScoreBorder 解析 score 范围的边界: 1.5、(1.5、-inf、+inf
+func ParseScoreBorder(s string) (*ScoreBorder, error) {
+	border := &ScoreBorder{}
+	if strings.HasPrefix(s, "(") {
+		border.Exclude = true
+		s = s[1:]
+	}
+	value, err := ParseScore(s)
+	if err != nil {
+		return nil, errInvalidBorder
+	}
+	border.Value = value
+	return border, nil
+}
+
+// ParseScore 解析 score, 支持 inf、+inf、-inf; 不允许 NaN
+func ParseScore(s string) (float64, error) {
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) {
+		return 0, errors.New("ERR value is not a valid float")
+	}
+	return value, nil
+}
+
+// FormatScore 把 score 转换为字符串, 格式与 Redis 相同
+func FormatScore(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	}
+	abs := math.Abs(value)
+	if abs == 0 || (abs >= 1e-4 && abs < 1e17) {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
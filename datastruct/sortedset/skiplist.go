@@ -0,0 +1,222 @@
+package sortedset
+
+import "math/rand"
+
+const (
+	maxLevel    = 32
+	levelFactor = 4 // 每个节点有 1/levelFactor 的概率增加一层
+)
+
+// Element 有序集合的元素
+type Element struct {
+	Member string
+	Score  float64
+}
+
+// less 按 score 从小到大排序, score 相同时按 member 的字典序排序
+func (e *Element) less(score float64, member string) bool {
+	return e.Score < score || (e.Score == score && e.Member < member)
+}
+
+// level 跳表节点中的一层
+type level struct {
+	forward *node
+	span    int64 // 到 forward 跨过的节点数量, 用于计算排名
+}
+
+type node struct {
+	Element
+	backward *node
+	level    []*level
+}
+
+type skiplist struct {
+	header *node
+	tail   *node
+	length int64
+	level  int16
+}
+
+func makeNode(lv int16, score float64, member string) *node {
+	n := &node{
+		Element: Element{
+			Score:  score,
+			Member: member,
+		},
+		level: make([]*level, lv),
+	}
+	for i := range n.level {
+		n.level[i] = new(level)
+	}
+	return n
+}
+
+func makeSkiplist() *skiplist {
+	return &skiplist{
+		level:  1,
+		header: makeNode(maxLevel, 0, ""),
+	}
+}
+
+func randomLevel() int16 {
+	lv := int16(1)
+	for lv < maxLevel && rand.Intn(levelFactor) == 0 {
+		lv++
+	}
+	return lv
+}
+
+// insert 插入元素, 调用方需要保证 member 不存在
+func (sl *skiplist) insert(member string, score float64) *node {
+	update := make([]*node, maxLevel) // 每一层中新节点的前驱
+	rank := make([]int64, maxLevel)   // 每一层前驱节点的排名
+
+	n := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		if i == sl.level-1 {
+			rank[i] = 0
+		} else {
+			rank[i] = rank[i+1]
+		}
+		for n.level[i].forward != nil && n.level[i].forward.less(score, member) {
+			rank[i] += n.level[i].span
+			n = n.level[i].forward
+		}
+		update[i] = n
+	}
+
+	lv := randomLevel()
+	if lv > sl.level {
+		for i := sl.level; i < lv; i++ {
+			rank[i] = 0
+			update[i] = sl.header
+			update[i].level[i].span = sl.length
+		}
+		sl.level = lv
+	}
+
+	n = makeNode(lv, score, member)
+	for i := int16(0); i < lv; i++ {
+		n.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = n
+		n.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = (rank[0] - rank[i]) + 1
+	}
+	// 更高的层跨过了新节点
+	for i := lv; i < sl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] == sl.header {
+		n.backward = nil
+	} else {
+		n.backward = update[0]
+	}
+	if n.level[0].forward != nil {
+		n.level[0].forward.backward = n
+	} else {
+		sl.tail = n
+	}
+	sl.length++
+	return n
+}
+
+func (sl *skiplist) removeNode(n *node, update []*node) {
+	for i := int16(0); i < sl.level; i++ {
+		if update[i].level[i].forward == n {
+			update[i].level[i].span += n.level[i].span - 1
+			update[i].level[i].forward = n.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if n.level[0].forward != nil {
+		n.level[0].forward.backward = n.backward
+	} else {
+		sl.tail = n.backward
+	}
+	for sl.level > 1 && sl.header.level[sl.level-1].forward == nil {
+		sl.level--
+	}
+	sl.length--
+}
+
+// remove 删除元素, 不存在时返回 false
+func (sl *skiplist) remove(member string, score float64) bool {
+	update := make([]*node, maxLevel)
+	n := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for n.level[i].forward != nil && n.level[i].forward.less(score, member) {
+			n = n.level[i].forward
+		}
+		update[i] = n
+	}
+	n = n.level[0].forward
+	if n != nil && n.Score == score && n.Member == member {
+		sl.removeNode(n, update)
+		return true
+	}
+	return false
+}
+
+// getRank 返回元素的排名, 从 1 开始; 不存在时返回 0
+func (sl *skiplist) getRank(member string, score float64) int64 {
+	var rank int64
+	n := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for n.level[i].forward != nil && !(score < n.level[i].forward.Score ||
+			(n.level[i].forward.Score == score && member < n.level[i].forward.Member)) {
+			rank += n.level[i].span
+			n = n.level[i].forward
+		}
+		if n != sl.header && n.Member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// getByRank 返回排名为 rank 的节点, rank 从 1 开始
+func (sl *skiplist) getByRank(rank int64) *node {
+	var i int64
+	n := sl.header
+	for lv := sl.level - 1; lv >= 0; lv-- {
+		for n.level[lv].forward != nil && i+n.level[lv].span <= rank {
+			i += n.level[lv].span
+			n = n.level[lv].forward
+		}
+		if i == rank {
+			return n
+		}
+	}
+	return nil
+}
+
+// firstInRange 返回第一个 score 在 [min, max] 范围内的节点
+func (sl *skiplist) firstInRange(min *ScoreBorder, max *ScoreBorder) *node {
+	n := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for n.level[i].forward != nil && !min.lessEqual(n.level[i].forward.Score) {
+			n = n.level[i].forward
+		}
+	}
+	n = n.level[0].forward
+	if n == nil || !max.greaterEqual(n.Score) {
+		return nil
+	}
+	return n
+}
+
+// lastInRange 返回最后一个 score 在 [min, max] 范围内的节点
+func (sl *skiplist) lastInRange(min *ScoreBorder, max *ScoreBorder) *node {
+	n := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for n.level[i].forward != nil && max.greaterEqual(n.level[i].forward.Score) {
+			n = n.level[i].forward
+		}
+	}
+	if n == sl.header || !min.lessEqual(n.Score) {
+		return nil
+	}
+	return n
+}
@@ -0,0 +1,195 @@
+// Package sortedset 有序集合: 哈希表保存 member 到 score 的映射, 跳表按 score 排序
+package sortedset
+
+// SortedSet 有序集合
+type SortedSet struct {
+	dict     map[string]*Element
+	skiplist *skiplist
+}
+
+// Make 创建空的有序集合
+func Make() *SortedSet {
+	return &SortedSet{
+		dict:     make(map[string]*Element),
+		skiplist: makeSkiplist(),
+	}
+}
+
+// Add 添加元素或修改已有元素的 score, 新增元素时返回 true
+func (s *SortedSet) Add(member string, score float64) bool {
+	element, ok := s.dict[member]
+	s.dict[member] = &Element{
+		Member: member,
+		Score:  score,
+	}
+	if ok {
+		if score != element.Score {
+			s.skiplist.remove(member, element.Score)
+			s.skiplist.insert(member, score)
+		}
+		return false
+	}
+	s.skiplist.insert(member, score)
+	return true
+}
+
+// Len 返回元素数量
+func (s *SortedSet) Len() int {
+	return len(s.dict)
+}
+
+// Get 返回 member 对应的元素
+func (s *SortedSet) Get(member string) (*Element, bool) {
+	element, ok := s.dict[member]
+	return element, ok
+}
+
+// Remove 删除元素, 不存在时返回 false
+func (s *SortedSet) Remove(member string) bool {
+	element, ok := s.dict[member]
+	if !ok {
+		return false
+	}
+	s.skiplist.remove(member, element.Score)
+	delete(s.dict, member)
+	return true
+}
+
+// GetRank 返回元素的排名, 从 0 开始; desc 为 true 时按 score 从大到小排名; 不存在时返回 -1
+func (s *SortedSet) GetRank(member string, desc bool) int64 {
+	element, ok := s.dict[member]
+	if !ok {
+		return -1
+	}
+	rank := s.skiplist.getRank(member, element.Score)
+	if desc {
+		return s.skiplist.length - rank
+	}
+	return rank - 1
+}
+
+// ForEachByRank 遍历排名在 [start, stop) 之间的元素, consumer 返回 false 时停止
+func (s *SortedSet) ForEachByRank(start int64, stop int64, desc bool, consumer func(element *Element) bool) {
+	size := int64(s.Len())
+	if start < 0 || start >= size || stop <= start {
+		return
+	}
+	if stop > size {
+		stop = size
+	}
+	var n *node
+	if desc {
+		n = s.skiplist.getByRank(size - start)
+	} else {
+		n = s.skiplist.getByRank(start + 1)
+	}
+	for i := start; i < stop && n != nil; i++ {
+		if !consumer(&n.Element) {
+			return
+		}
+		if desc {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+	}
+}
+
+// RangeByRank 返回排名在 [start, stop) 之间的元素
+func (s *SortedSet) RangeByRank(start int64, stop int64, desc bool) []*Element {
+	result := make([]*Element, 0)
+	s.ForEachByRank(start, stop, desc, func(element *Element) bool {
+		result = append(result, element)
+		return true
+	})
+	return result
+}
+
+// ForEachByScore 遍历 score 在 [min, max] 之间的元素, 跳过前 offset 个; consumer 返回 false 时停止
+func (s *SortedSet) ForEachByScore(min *ScoreBorder, max *ScoreBorder, offset int64, desc bool, consumer func(element *Element) bool) {
+	var n *node
+	if desc {
+		n = s.skiplist.lastInRange(min, max)
+	} else {
+		n = s.skiplist.firstInRange(min, max)
+	}
+	for n != nil && offset > 0 {
+		if desc {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+		offset--
+	}
+	for n != nil && min.lessEqual(n.Score) && max.greaterEqual(n.Score) {
+		if !consumer(&n.Element) {
+			return
+		}
+		if desc {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+	}
+}
+
+// RangeByScore 返回 score 在 [min, max] 之间的元素, 跳过前 offset 个, limit < 0 时不限制数量
+func (s *SortedSet) RangeByScore(min *ScoreBorder, max *ScoreBorder, offset int64, limit int64, desc bool) []*Element {
+	result := make([]*Element, 0)
+	if limit == 0 || offset < 0 {
+		return result
+	}
+	s.ForEachByScore(min, max, offset, desc, func(element *Element) bool {
+		result = append(result, element)
+		return limit < 0 || int64(len(result)) < limit
+	})
+	return result
+}
+
+// Count 返回 score 在 [min, max] 之间的元素数量
+func (s *SortedSet) Count(min *ScoreBorder, max *ScoreBorder) int64 {
+	first := s.skiplist.firstInRange(min, max)
+	if first == nil {
+		return 0
+	}
+	last := s.skiplist.lastInRange(min, max)
+	return s.skiplist.getRank(last.Member, last.Score) - s.skiplist.getRank(first.Member, first.Score) + 1
+}
+
+// scanBuckets Scan 按 member 的哈希值把元素分成固定数量的桶, 游标为下一个桶的序号
+const scanBuckets = 64
+
+// fnv32 FNV-1a 哈希
+func fnv32(key string) uint32 {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return hash
+}
+
+// Scan 从第 cursor 个桶开始遍历, 至少收集 count 个满足 filter 的元素或遍历完所有桶后返回
+// 与 SCAN 遍历 dict 的分段相同, 每次都返回完整的桶, 桶的数量固定, 因此整个遍历期间一直存在的元素至少会被返回一次
+// 返回下一次遍历的起始桶, 遍历结束时返回 0
+func (s *SortedSet) Scan(cursor int, count int, filter func(member string) bool) ([]*Element, int) {
+	if cursor < 0 || cursor >= scanBuckets {
+		return nil, 0
+	}
+	buckets := make([][]*Element, scanBuckets)
+	for member, element := range s.dict {
+		b := int(fnv32(member) % scanBuckets)
+		if b >= cursor && (filter == nil || filter(member)) {
+			buckets[b] = append(buckets[b], element)
+		}
+	}
+	result := make([]*Element, 0, count)
+	for cursor < scanBuckets && len(result) < count {
+		result = append(result, buckets[cursor]...)
+		cursor++
+	}
+	if cursor >= scanBuckets {
+		cursor = 0
+	}
+	return result, cursor
+}
@@ -0,0 +1,286 @@
+package stream
+
+import "sort"
+
+// maxNodeSize 每个节点最多保存的 key 数量, 超过后分裂
+const maxNodeSize = 64
+
+// item B+ 树中的条目: 消息或者待确认的消息
+type item interface {
+	itemID() ID
+}
+
+// btree 以 ID 为 key 的 B+ 树, 所有条目保存在叶子节点中, 叶子节点按顺序双向链接
+// 删除时不合并节点, 只移除变空的节点; 条目大多追加在末尾, 因此树仍然基本保持平衡
+type btree struct {
+	root  node
+	first *leaf
+	last  *leaf
+	size  int
+}
+
+type node interface {
+	// insert 插入条目, 节点分裂时返回新节点及其最小的 ID
+	insert(it item) (split node, splitKey ID, added bool)
+	// remove 删除条目, 返回是否删除以及节点是否变空
+	remove(tree *btree, id ID) (removed bool, empty bool)
+	// findLeaf 返回 id 所在的叶子节点
+	findLeaf(id ID) *leaf
+}
+
+// inner 内部节点: keys[i] 不大于 children[i+1] 中所有的 ID, 且大于 children[i] 中所有的 ID
+type inner struct {
+	keys     []ID
+	children []node
+}
+
+// leaf 叶子节点
+type leaf struct {
+	entries []item
+	prev    *leaf
+	next    *leaf
+}
+
+func newBTree() *btree {
+	l := &leaf{}
+	return &btree{
+		root:  l,
+		first: l,
+		last:  l,
+	}
+}
+
+// childIndex 返回 id 应该位于的子节点
+func (n *inner) childIndex(id ID) int {
+	return sort.Search(len(n.keys), func(i int) bool {
+		return id.Less(n.keys[i])
+	})
+}
+
+func (n *inner) insert(it item) (node, ID, bool) {
+	i := n.childIndex(it.itemID())
+	split, splitKey, added := n.children[i].insert(it)
+	if split == nil {
+		return nil, ID{}, added
+	}
+	n.keys = append(n.keys, ID{})
+	copy(n.keys[i+1:], n.keys[i:])
+	n.keys[i] = splitKey
+	n.children = append(n.children, nil)
+	copy(n.children[i+2:], n.children[i+1:])
+	n.children[i+1] = split
+	if len(n.keys) <= maxNodeSize {
+		return nil, ID{}, added
+	}
+	// 分裂: 中间的 key 上移到父节点
+	mid := len(n.keys) / 2
+	right := &inner{
+		keys:     append([]ID(nil), n.keys[mid+1:]...),
+		children: append([]node(nil), n.children[mid+1:]...),
+	}
+	upKey := n.keys[mid]
+	n.keys = n.keys[:mid]
+	n.children = n.children[:mid+1]
+	return right, upKey, added
+}
+
+func (n *inner) remove(tree *btree, id ID) (bool, bool) {
+	i := n.childIndex(id)
+	removed, empty := n.children[i].remove(tree, id)
+	if !empty {
+		return removed, false
+	}
+	// 移除变空的子节点及其对应的 key
+	n.children = append(n.children[:i], n.children[i+1:]...)
+	if len(n.keys) > 0 {
+		k := i - 1
+		if k < 0 {
+			k = 0
+		}
+		n.keys = append(n.keys[:k], n.keys[k+1:]...)
+	}
+	return removed, len(n.children) == 0
+}
+
+func (n *inner) findLeaf(id ID) *leaf {
+	return n.children[n.childIndex(id)].findLeaf(id)
+}
+
+// search 返回第一个不小于 id 的条目的位置
+func (l *leaf) search(id ID) int {
+	return sort.Search(len(l.entries), func(i int) bool {
+		return !l.entries[i].itemID().Less(id)
+	})
+}
+
+func (l *leaf) insert(it item) (node, ID, bool) {
+	id := it.itemID()
+	i := l.search(id)
+	if i < len(l.entries) && l.entries[i].itemID() == id {
+		return nil, ID{}, false
+	}
+	l.entries = append(l.entries, nil)
+	copy(l.entries[i+1:], l.entries[i:])
+	l.entries[i] = it
+	if len(l.entries) <= maxNodeSize {
+		return nil, ID{}, true
+	}
+	// 追加在末尾时前一个节点保持满载, 减少节点数量
+	mid := len(l.entries) / 2
+	if i == len(l.entries)-1 {
+		mid = len(l.entries) - 1
+	}
+	right := &leaf{
+		entries: append([]item(nil), l.entries[mid:]...),
+		prev:    l,
+		next:    l.next,
+	}
+	l.entries = l.entries[:mid]
+	if l.next != nil {
+		l.next.prev = right
+	}
+	l.next = right
+	return right, right.entries[0].itemID(), true
+}
+
+func (l *leaf) remove(tree *btree, id ID) (bool, bool) {
+	i := l.search(id)
+	if i >= len(l.entries) || l.entries[i].itemID() != id {
+		return false, false
+	}
+	l.entries = append(l.entries[:i], l.entries[i+1:]...)
+	if len(l.entries) > 0 || (l.prev == nil && l.next == nil) { // 保留唯一的叶子节点
+		return true, false
+	}
+	tree.unlinkLeaf(l)
+	return true, true
+}
+
+func (l *leaf) findLeaf(id ID) *leaf {
+	return l
+}
+
+func (tree *btree) unlinkLeaf(l *leaf) {
+	if l.prev == nil {
+		tree.first = l.next
+	} else {
+		l.prev.next = l.next
+	}
+	if l.next == nil {
+		tree.last = l.prev
+	} else {
+		l.next.prev = l.prev
+	}
+}
+
+// insert 插入条目, ID 已存在时返回 false
+func (tree *btree) insert(it item) bool {
+	split, splitKey, added := tree.root.insert(it)
+	if split != nil {
+		tree.root = &inner{
+			keys:     []ID{splitKey},
+			children: []node{tree.root, split},
+		}
+	}
+	if added {
+		tree.size++
+	}
+	return added
+}
+
+// remove 删除条目, 返回是否删除
+func (tree *btree) remove(id ID) bool {
+	removed, _ := tree.root.remove(tree, id)
+	if !removed {
+		return false
+	}
+	tree.size--
+	// 根节点只剩一个子节点时降低树的高度
+	for {
+		root, ok := tree.root.(*inner)
+		if !ok || len(root.children) != 1 {
+			break
+		}
+		tree.root = root.children[0]
+	}
+	return true
+}
+
+// get 返回 ID 对应的条目
+func (tree *btree) get(id ID) (item, bool) {
+	l := tree.root.findLeaf(id)
+	i := l.search(id)
+	if i < len(l.entries) && l.entries[i].itemID() == id {
+		return l.entries[i], true
+	}
+	return nil, false
+}
+
+// cursor 指向树中的一个条目
+type cursor struct {
+	leaf *leaf
+	pos  int
+}
+
+func (c *cursor) valid() bool {
+	return c.leaf != nil && c.pos >= 0 && c.pos < len(c.leaf.entries)
+}
+
+func (c *cursor) item() item {
+	return c.leaf.entries[c.pos]
+}
+
+func (c *cursor) next() {
+	c.pos++
+	for c.leaf != nil && c.pos >= len(c.leaf.entries) {
+		c.leaf = c.leaf.next
+		c.pos = 0
+	}
+}
+
+func (c *cursor) prev() {
+	c.pos--
+	for c.leaf != nil && c.pos < 0 {
+		c.leaf = c.leaf.prev
+		if c.leaf != nil {
+			c.pos = len(c.leaf.entries) - 1
+		}
+	}
+}
+
+// seekGE 返回指向第一个不小于 id 的条目的游标
+func (tree *btree) seekGE(id ID) *cursor {
+	l := tree.root.findLeaf(id)
+	c := &cursor{leaf: l, pos: l.search(id) - 1}
+	c.next()
+	return c
+}
+
+// seekLE 返回指向最后一个不大于 id 的条目的游标
+func (tree *btree) seekLE(id ID) *cursor {
+	l := tree.root.findLeaf(id)
+	pos := sort.Search(len(l.entries), func(i int) bool {
+		return id.Less(l.entries[i].itemID())
+	})
+	c := &cursor{leaf: l, pos: pos}
+	c.prev()
+	return c
+}
+
+// stats 返回叶子节点数量和节点总数
+func (tree *btree) stats() (leaves int, nodes int) {
+	var walk func(n node)
+	walk = func(n node) {
+		nodes++
+		switch n := n.(type) {
+		case *inner:
+			for _, child := range n.children {
+				walk(child)
+			}
+		case *leaf:
+			leaves++
+		}
+	}
+	walk(tree.root)
+	return leaves, nodes
+}
@@ -0,0 +1,277 @@
+package stream
+
+import "sort"
+
+// PendingEntry 已经投递给消费者、尚未确认的消息
+type PendingEntry struct {
+	ID            ID
+	Consumer      *Consumer
+	DeliveryTime  int64 // 最后一次投递的时间, unix 毫秒
+	DeliveryCount uint64
+}
+
+func (p *PendingEntry) itemID() ID {
+	return p.ID
+}
+
+// Consumer 消费者
+type Consumer struct {
+	Name       string
+	SeenTime   int64 // 最后一次尝试读取或认领消息的时间
+	ActiveTime int64 // 最后一次成功读取或认领消息的时间, -1 表示从未成功
+	pending    *btree
+}
+
+// PendingLen 返回消费者未确认的消息数量
+func (c *Consumer) PendingLen() int {
+	return c.pending.size
+}
+
+// ForEachPending 按 ID 从小到大遍历消费者未确认的消息
+func (c *Consumer) ForEachPending(start ID, consumer func(p *PendingEntry) bool) {
+	forEachPending(c.pending, start, consumer)
+}
+
+// Group 消费者组
+type Group struct {
+	Name        string
+	LastID      ID    // 最后投递的消息 ID
+	EntriesRead int64 // 已经读取的消息数量, 用于计算 lag; -1 表示未知
+	pending     *btree
+	consumers   map[string]*Consumer
+}
+
+func makeGroup(name string, lastID ID, entriesRead int64) *Group {
+	return &Group{
+		Name:        name,
+		LastID:      lastID,
+		EntriesRead: entriesRead,
+		pending:     newBTree(),
+		consumers:   make(map[string]*Consumer),
+	}
+}
+
+// Consumer 返回消费者
+func (g *Group) Consumer(name string) (*Consumer, bool) {
+	c, ok := g.consumers[name]
+	return c, ok
+}
+
+// CreateConsumer 创建消费者, 已经存在时返回 false
+func (g *Group) CreateConsumer(name string, now int64) (*Consumer, bool) {
+	if c, ok := g.consumers[name]; ok {
+		return c, false
+	}
+	c := &Consumer{
+		Name:       name,
+		SeenTime:   now,
+		ActiveTime: -1,
+		pending:    newBTree(),
+	}
+	g.consumers[name] = c
+	return c, true
+}
+
+// DeleteConsumer 删除消费者及其未确认的消息
+func (g *Group) DeleteConsumer(name string) (*Consumer, bool) {
+	c, ok := g.consumers[name]
+	if !ok {
+		return nil, false
+	}
+	c.ForEachPending(MinID, func(p *PendingEntry) bool {
+		g.pending.remove(p.ID)
+		return true
+	})
+	delete(g.consumers, name)
+	return c, true
+}
+
+// Consumers 返回所有消费者, 按名称排序
+func (g *Group) Consumers() []*Consumer {
+	consumers := make([]*Consumer, 0, len(g.consumers))
+	for _, c := range g.consumers {
+		consumers = append(consumers, c)
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Name < consumers[j].Name
+	})
+	return consumers
+}
+
+// PendingLen 返回组内未确认的消息数量
+func (g *Group) PendingLen() int {
+	return g.pending.size
+}
+
+// GetPending 返回未确认的消息
+func (g *Group) GetPending(id ID) (*PendingEntry, bool) {
+	it, ok := g.pending.get(id)
+	if !ok {
+		return nil, false
+	}
+	return it.(*PendingEntry), true
+}
+
+// ForEachPending 按 ID 从小到大遍历组内 ID 不小于 start 的未确认消息
+func (g *Group) ForEachPending(start ID, consumer func(p *PendingEntry) bool) {
+	forEachPending(g.pending, start, consumer)
+}
+
+func forEachPending(tree *btree, start ID, consumer func(p *PendingEntry) bool) {
+	for c := tree.seekGE(start); c.valid(); c.next() {
+		if !consumer(c.item().(*PendingEntry)) {
+			return
+		}
+	}
+}
+
+// Deliver 把消息投递给消费者; 消息已经在其它消费者的待确认列表中时转移给 c, 投递次数重新计数
+func (g *Group) Deliver(id ID, c *Consumer, now int64) *PendingEntry {
+	if p, ok := g.GetPending(id); ok {
+		g.Claim(p, c)
+		p.DeliveryTime = now
+		p.DeliveryCount = 1
+		return p
+	}
+	p := &PendingEntry{
+		ID:            id,
+		Consumer:      c,
+		DeliveryTime:  now,
+		DeliveryCount: 1,
+	}
+	g.pending.insert(p)
+	c.pending.insert(p)
+	return p
+}
+
+// Claim 把未确认的消息转移给 c
+func (g *Group) Claim(p *PendingEntry, c *Consumer) {
+	if p.Consumer == c {
+		return
+	}
+	p.Consumer.pending.remove(p.ID)
+	p.Consumer = c
+	c.pending.insert(p)
+}
+
+// Ack 确认消息, 把它移出待确认列表
+func (g *Group) Ack(id ID) bool {
+	p, ok := g.GetPending(id)
+	if !ok {
+		return false
+	}
+	g.pending.remove(id)
+	p.Consumer.pending.remove(id)
+	return true
+}
+
+/* ---- Stream 中的消费者组 ---- */
+
+// CreateGroup 创建消费者组, 已经存在时返回 false
+func (s *Stream) CreateGroup(name string, lastID ID, entriesRead int64) (*Group, bool) {
+	if g, ok := s.groups[name]; ok {
+		return g, false
+	}
+	if s.groups == nil {
+		s.groups = make(map[string]*Group)
+	}
+	g := makeGroup(name, lastID, entriesRead)
+	s.groups[name] = g
+	return g, true
+}
+
+// Group 返回消费者组
+func (s *Stream) Group(name string) (*Group, bool) {
+	g, ok := s.groups[name]
+	return g, ok
+}
+
+// DestroyGroup 删除消费者组
+func (s *Stream) DestroyGroup(name string) (*Group, bool) {
+	g, ok := s.groups[name]
+	if ok {
+		delete(s.groups, name)
+	}
+	return g, ok
+}
+
+// Groups 返回所有消费者组, 按名称排序
+func (s *Stream) Groups() []*Group {
+	groups := make([]*Group, 0, len(s.groups))
+	for _, g := range s.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
+
+// hasTombstones ID 不小于 start 的范围内是否有消息被删除过
+func (s *Stream) hasTombstones(start ID) bool {
+	if s.Len() == 0 || s.maxDeletedID.IsZero() {
+		return false
+	}
+	return !s.maxDeletedID.Less(start)
+}
+
+// EstimateEntriesRead 估算从第一条消息读到 id 时读取的消息数量, 无法确定时返回 -1
+func (s *Stream) EstimateEntriesRead(id ID) int64 {
+	if s.entriesAdded == 0 {
+		return 0
+	}
+	cmpLast := id.Compare(s.lastID)
+	if s.Len() == 0 && cmpLast <= 0 {
+		return int64(s.entriesAdded)
+	}
+	if cmpLast == 0 {
+		return int64(s.entriesAdded)
+	}
+	if cmpLast > 0 {
+		return -1
+	}
+	first, _ := s.First()
+	// 第一条消息之后没有被删除的消息, 可以根据消息总数计算
+	if s.maxDeletedID.IsZero() || s.maxDeletedID.Less(first.ID) {
+		switch id.Compare(first.ID) {
+		case -1:
+			return int64(s.entriesAdded) - int64(s.Len())
+		case 0:
+			return int64(s.entriesAdded) - int64(s.Len()) + 1
+		}
+	}
+	return -1
+}
+
+// MarkDelivered 把 id 之前的消息标记为已投递, 更新 LastID 和 EntriesRead
+func (s *Stream) MarkDelivered(g *Group, id ID) {
+	if !g.LastID.Less(id) {
+		return
+	}
+	if g.EntriesRead >= 0 && !s.hasTombstones(id) {
+		g.EntriesRead++
+	} else if s.entriesAdded > 0 {
+		g.EntriesRead = s.EstimateEntriesRead(id)
+	}
+	g.LastID = id
+}
+
+// Lag 返回消费者组尚未读取的消息数量, 无法确定时返回 false
+func (s *Stream) Lag(g *Group) (int64, bool) {
+	if s.entriesAdded == 0 {
+		return 0, true
+	}
+	if g.EntriesRead >= 0 && !s.hasTombstones(g.LastID) && !s.lastID.Less(g.LastID) {
+		return int64(s.entriesAdded) - g.EntriesRead, true
+	}
+	entriesRead := s.EstimateEntriesRead(g.LastID)
+	if entriesRead < 0 {
+		return 0, false
+	}
+	return int64(s.entriesAdded) - entriesRead, true
+}
+
+// TreeStats 返回 B+ 树的叶子节点数量和节点总数
+func (s *Stream) TreeStats() (leaves int, nodes int) {
+	return s.tree.stats()
+}
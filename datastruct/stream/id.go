@@ -0,0 +1,94 @@
+package stream
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ID 消息 ID, 格式为 毫秒时间戳-序号
+type ID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// MinID 最小的 ID
+var MinID = ID{}
+
+// MaxID 最大的 ID
+var MaxID = ID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+var errInvalidID = errors.New("ERR Invalid stream ID specified as stream command argument")
+
+// Less 按时间戳、序号的顺序比较
+func (id ID) Less(other ID) bool {
+	if id.Ms != other.Ms {
+		return id.Ms < other.Ms
+	}
+	return id.Seq < other.Seq
+}
+
+// Compare 返回 -1、0、1
+func (id ID) Compare(other ID) int {
+	switch {
+	case id.Less(other):
+		return -1
+	case other.Less(id):
+		return 1
+	}
+	return 0
+}
+
+// IsZero 是否为 0-0
+func (id ID) IsZero() bool {
+	return id.Ms == 0 && id.Seq == 0
+}
+
+// Next 返回紧跟在 id 之后的 ID, id 已经是最大值时返回 false
+func (id ID) Next() (ID, bool) {
+	if id.Seq < math.MaxUint64 {
+		return ID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	}
+	if id.Ms < math.MaxUint64 {
+		return ID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+// Prev 返回紧挨在 id 之前的 ID, id 已经是最小值时返回 false
+func (id ID) Prev() (ID, bool) {
+	if id.Seq > 0 {
+		return ID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	}
+	if id.Ms > 0 {
+		return ID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+func (id ID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// ParseID 解析 ms-seq; 省略序号时使用 defaultSeq, 返回的 bool 表示是否给出了序号
+func ParseID(str string, defaultSeq uint64) (ID, bool, error) {
+	msStr, seqStr := str, ""
+	hasSeq := false
+	if i := strings.IndexByte(str, '-'); i >= 0 {
+		msStr, seqStr = str[:i], str[i+1:]
+		hasSeq = true
+	}
+	ms, err := strconv.ParseUint(msStr, 10, 64)
+	if err != nil {
+		return ID{}, false, errInvalidID
+	}
+	seq := defaultSeq
+	if hasSeq {
+		seq, err = strconv.ParseUint(seqStr, 10, 64)
+		if err != nil {
+			return ID{}, false, errInvalidID
+		}
+	}
+	return ID{Ms: ms, Seq: seq}, hasSeq, nil
+}
@@ -0,0 +1,225 @@
+// Package stream 消息流: 以 ID 为 key 的 B+ 树保存消息
+package stream
+
+// Entry 一条消息
+type Entry struct {
+	ID     ID
+	Fields [][]byte // field1 value1 field2 value2...
+}
+
+func (e *Entry) itemID() ID {
+	return e.ID
+}
+
+// Stream 消息流
+type Stream struct {
+	tree         *btree
+	lastID       ID     // 最后一条消息的 ID, 删除消息后不会减小
+	entriesAdded uint64 // 添加过的消息总数
+	maxDeletedID ID     // 被删除的消息中最大的 ID
+	groups       map[string]*Group
+}
+
+// Make 创建空的 Stream
+func Make() *Stream {
+	return &Stream{
+		tree: newBTree(),
+	}
+}
+
+// Len 返回消息数量
+func (s *Stream) Len() int {
+	return s.tree.size
+}
+
+// LastID 返回最后添加的消息 ID
+func (s *Stream) LastID() ID {
+	return s.lastID
+}
+
+// SetLastID 修改最后添加的消息 ID, 不能小于现有消息的最大 ID
+func (s *Stream) SetLastID(id ID) bool {
+	if last, ok := s.Last(); ok && id.Less(last.ID) {
+		return false
+	}
+	s.lastID = id
+	return true
+}
+
+// EntriesAdded 添加过的消息总数
+func (s *Stream) EntriesAdded() uint64 {
+	return s.entriesAdded
+}
+
+// MaxDeletedID 被删除的消息中最大的 ID
+func (s *Stream) MaxDeletedID() ID {
+	return s.maxDeletedID
+}
+
+// SetMeta 恢复 entriesAdded 和 maxDeletedID, 用于重建 Stream
+func (s *Stream) SetMeta(entriesAdded uint64, maxDeletedID ID) {
+	s.entriesAdded = entriesAdded
+	s.maxDeletedID = maxDeletedID
+}
+
+// NextID 生成大于 lastID 的 ID: ms 大于 lastID 的时间戳时使用 ms-0, 否则在 lastID 的基础上递增序号
+func (s *Stream) NextID(ms uint64) (ID, bool) {
+	if ms > s.lastID.Ms {
+		return ID{Ms: ms}, true
+	}
+	return s.lastID.Next()
+}
+
+// Add 添加一条消息, id 必须大于 LastID
+func (s *Stream) Add(id ID, fields [][]byte) *Entry {
+	entry := &Entry{
+		ID:     id,
+		Fields: fields,
+	}
+	s.tree.insert(entry)
+	s.lastID = id
+	s.entriesAdded++
+	return entry
+}
+
+// Get 返回 ID 对应的消息
+func (s *Stream) Get(id ID) (*Entry, bool) {
+	it, ok := s.tree.get(id)
+	if !ok {
+		return nil, false
+	}
+	return it.(*Entry), true
+}
+
+// First 返回第一条消息
+func (s *Stream) First() (*Entry, bool) {
+	c := s.tree.seekGE(MinID)
+	if !c.valid() {
+		return nil, false
+	}
+	return c.item().(*Entry), true
+}
+
+// Last 返回最后一条消息
+func (s *Stream) Last() (*Entry, bool) {
+	c := s.tree.seekLE(MaxID)
+	if !c.valid() {
+		return nil, false
+	}
+	return c.item().(*Entry), true
+}
+
+// Range 按 ID 从小到大返回 [start, end] 之间的消息, count <= 0 时不限制数量
+func (s *Stream) Range(start ID, end ID, count int) []*Entry {
+	result := make([]*Entry, 0)
+	for c := s.tree.seekGE(start); c.valid(); c.next() {
+		entry := c.item().(*Entry)
+		if end.Less(entry.ID) || (count > 0 && len(result) >= count) {
+			break
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// RevRange 按 ID 从大到小返回 [start, end] 之间的消息, count <= 0 时不限制数量
+func (s *Stream) RevRange(end ID, start ID, count int) []*Entry {
+	result := make([]*Entry, 0)
+	for c := s.tree.seekLE(end); c.valid(); c.prev() {
+		entry := c.item().(*Entry)
+		if entry.ID.Less(start) || (count > 0 && len(result) >= count) {
+			break
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// ForEach 按 ID 从小到大遍历所有消息, consumer 返回 false 时停止
+func (s *Stream) ForEach(consumer func(entry *Entry) bool) {
+	for c := s.tree.seekGE(MinID); c.valid(); c.next() {
+		if !consumer(c.item().(*Entry)) {
+			return
+		}
+	}
+}
+
+// Delete 删除消息, 返回被删除的消息
+func (s *Stream) Delete(ids ...ID) []*Entry {
+	deleted := make([]*Entry, 0, len(ids))
+	for _, id := range ids {
+		entry, ok := s.Get(id)
+		if !ok {
+			continue
+		}
+		s.remove(entry)
+		deleted = append(deleted, entry)
+	}
+	return deleted
+}
+
+func (s *Stream) remove(entry *Entry) {
+	s.tree.remove(entry.ID)
+	if s.maxDeletedID.Less(entry.ID) {
+		s.maxDeletedID = entry.ID
+	}
+}
+
+// TrimOptions 裁剪条件: MaxLen 或 MinID 二选一
+type TrimOptions struct {
+	ByMinID bool
+	MaxLen  int
+	MinID   ID
+	Approx  bool // 近似裁剪: 只删除整个叶子节点, 剩余的消息可能多于要求的数量
+	Limit   int  // 近似裁剪时最多删除的消息数量, 0 表示不限制
+}
+
+// Trim 从头部删除消息, 返回被删除的消息
+func (s *Stream) Trim(opts *TrimOptions) []*Entry {
+	deleted := make([]*Entry, 0)
+	shouldTrim := func(entry *Entry, remaining int) bool {
+		if opts.ByMinID {
+			return entry.ID.Less(opts.MinID)
+		}
+		return remaining > opts.MaxLen
+	}
+	for {
+		first := s.tree.first
+		for first != nil && len(first.entries) == 0 {
+			first = first.next
+		}
+		if first == nil {
+			break
+		}
+		if opts.Approx {
+			// 整个叶子节点都满足裁剪条件时才删除
+			n := len(first.entries)
+			lastInLeaf := first.entries[n-1].(*Entry)
+			if opts.ByMinID && !shouldTrim(lastInLeaf, s.Len()) {
+				break
+			}
+			if !opts.ByMinID && s.Len()-n < opts.MaxLen {
+				break
+			}
+			if opts.Limit > 0 && len(deleted)+n > opts.Limit {
+				break
+			}
+			entries := make([]*Entry, n)
+			for i, it := range first.entries {
+				entries[i] = it.(*Entry)
+			}
+			for _, entry := range entries {
+				s.remove(entry)
+			}
+			deleted = append(deleted, entries...)
+			continue
+		}
+		entry := first.entries[0].(*Entry)
+		if !shouldTrim(entry, s.Len()) {
+			break
+		}
+		s.remove(entry)
+		deleted = append(deleted, entry)
+	}
+	return deleted
+}
@@ -2,4 +2,7 @@ module GoRedis
 
 go 1.17
 
-require github.com/jolestar/go-commons-pool/v2 v2.1.2
+require (
+	github.com/jolestar/go-commons-pool/v2 v2.1.2
+	github.com/yuin/gopher-lua v1.1.1
+)
@@ -1,6 +1,9 @@
 package database
 
-import "GoRedis/interface/resp"
+import (
+	"GoRedis/interface/resp"
+	"time"
+)
 
 // CmdLine 命令行
 type CmdLine = [][]byte
@@ -12,7 +15,23 @@ type Database interface {
 	Close()
 }
 
+// DBEngine 在 Database 的基础上提供事务需要的能力, 供集群层使用
+type DBEngine interface {
+	Database
+	ExecWithLock(conn resp.Connection, cmdLine [][]byte) resp.Reply // 执行指令但不加锁, 调用方负责加锁
+	ExecMulti(conn resp.Connection, cmdLines []CmdLine) resp.Reply  // 原子地执行一组指令
+	GetUndoLogs(dbIndex int, cmdLine [][]byte) ([]CmdLine, error)   // 生成回滚指令
+	RWLocks(dbIndex int, writeKeys []string, readKeys []string)     // 为 key 加锁
+	RWUnLocks(dbIndex int, writeKeys []string, readKeys []string)   // 释放 key 的锁
+	GetEntity(dbIndex int, key string) (*DataEntity, bool)          // 读取 key, 调用方负责加锁
+	GetExpireTime(dbIndex int, key string) (time.Time, bool)        // 读取 key 的过期时间, 调用方负责加锁
+}
+
 // DataEntity Redis数据结构，包括字符串、列表、散列、集合等
 type DataEntity struct {
 	Data interface{}
+	// 以下字段用于内存淘汰, 由 database 包维护; 读指令也会更新访问信息, 所以使用原子操作访问
+	AccessTime int64  // 最近一次访问的时间, unix 毫秒
+	Freq       uint32 // LFU 的对数访问计数
+	Size       int64  // 写入时估算的内存占用
 }
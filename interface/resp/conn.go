@@ -1,8 +1,35 @@
 package resp
 
+import "net"
+
 // Connection 接口：Connection可能会有不同的实现，和持久化有关
 type Connection interface {
 	Write([]byte) error
+	IsClosed() bool // 连接是否已经关闭
+	GetID() int64   // 客户端 ID, 内部使用的连接为 0
 	GetDBIndex() int
+	GetProtocol() int // HELLO 协商的协议版本, 2 或 3
+	SetProtocol(int)
+	GetName() string // CLIENT SETNAME 设置的名称
+	SetName(string)
+	RemoteAddr() net.Addr // 内部使用的连接为 nil
+	IsPeer() bool         // 是否是通过 PeerAuth 认证的集群节点
+	SetPeer(bool)
 	SelectDB(int)
+
+	// MULTI 事务状态
+	InMultiState() bool
+	SetMultiState(bool)
+	GetQueuedCmdLine() [][][]byte
+	EnqueueCmd([][]byte)
+	ClearQueuedCmds()
+
+	// 发布订阅: 订阅的频道和模式
+	Subscribe(channel string)
+	UnSubscribe(channel string)
+	GetChannels() []string
+	PSubscribe(pattern string)
+	PUnSubscribe(pattern string)
+	GetPatterns() []string
+	SubsCount() int
 }
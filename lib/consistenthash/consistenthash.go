@@ -3,26 +3,60 @@ package consistenthash
 import (
 	"hash/crc32"
 	"sort"
+	"strconv"
 )
 
+// DefaultReplicas 每个节点默认的虚拟节点数
+const DefaultReplicas = 100
+
 // HashFunc 定义哈希函数
 type HashFunc func(data []byte) uint32
 
 // NodeMap 存储所有节点的信息、所有节点一致性hash
+// 每个节点在哈希环上放置 replicas * weight 个虚拟节点, 使 key 分布更均匀
 type NodeMap struct {
 	hashFunc    HashFunc       // 哈希函数
-	nodeHashs   []int          // 记录node的哈希值; 为了排序
+	replicas    int            // 权重为 1 的节点拥有的虚拟节点数
+	weights     map[string]int // key: 节点地址; val: 权重
+	nodeHashs   []int          // 记录虚拟节点的哈希值; 为了排序
 	nodehashMap map[int]string // key: 哈希值; val: 地址
 }
 
-func NewNodeMap(fn HashFunc) *NodeMap {
+// KeyRange 哈希环上的一段区间 (Start, End], Start > End 时表示跨越了环的起点
+type KeyRange struct {
+	Start uint32
+	End   uint32
+}
+
+// Contains 判断哈希值是否落在区间内
+func (r KeyRange) Contains(hash uint32) bool {
+	if r.Start < r.End {
+		return hash > r.Start && hash <= r.End
+	}
+	return hash > r.Start || hash <= r.End
+}
+
+// MovedRange 成员变化后从 From 迁移到 To 的区间
+type MovedRange struct {
+	KeyRange
+	From string
+	To   string
+}
+
+// NewNodeMap replicas <= 0 时使用 DefaultReplicas
+func NewNodeMap(replicas int, fn HashFunc) *NodeMap {
 	m := &NodeMap{
 		hashFunc:    fn,
+		replicas:    replicas,
+		weights:     make(map[string]int),
 		nodehashMap: make(map[int]string),
 	}
 	if m.hashFunc == nil {
 		m.hashFunc = crc32.ChecksumIEEE
 	}
+	if m.replicas <= 0 {
+		m.replicas = DefaultReplicas
+	}
 	return m
 }
 
@@ -31,19 +65,78 @@ func (m *NodeMap) IsEmpty() bool {
 	return len(m.nodeHashs) == 0
 }
 
-// AddNode 将节点加入到一致性哈希环上
+// AddNode 将权重为 1 的节点加入到一致性哈希环上
 func (m *NodeMap) AddNode(keys ...string) { // key是唯一确定节点的东西; 可以是节点名称、ip
 	for _, key := range keys {
 		if key == "" {
 			continue
 		}
-		hash := int(m.hashFunc([]byte(key)))    //计算哈希值
-		m.nodeHashs = append(m.nodeHashs, hash) //记录哈希值
-		m.nodehashMap[hash] = key               // 记录哈希值和节点间的映射
+		m.weights[key] = 1
+	}
+	m.rebuild()
+}
+
+// AddNodeWithWeight 加入节点或修改节点的权重, 权重越大分到的 key 越多
+func (m *NodeMap) AddNodeWithWeight(key string, weight int) {
+	if key == "" || weight <= 0 {
+		return
+	}
+	m.weights[key] = weight
+	m.rebuild()
+}
+
+// RemoveNode 将节点从哈希环上移除, 其负责的 key 由环上后继的节点接管
+func (m *NodeMap) RemoveNode(keys ...string) {
+	for _, key := range keys {
+		delete(m.weights, key)
+	}
+	m.rebuild()
+}
+
+// Nodes 返回所有节点, 按地址排序
+func (m *NodeMap) Nodes() []string {
+	nodes := make([]string, 0, len(m.weights))
+	for node := range m.weights {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// rebuild 根据节点和权重重新生成哈希环
+// 按地址顺序放置虚拟节点, 哈希冲突时先放置的节点胜出, 因此相同的成员总是得到相同的哈希环
+func (m *NodeMap) rebuild() {
+	m.nodeHashs = m.nodeHashs[:0]
+	m.nodehashMap = make(map[int]string)
+	for _, node := range m.Nodes() {
+		count := m.replicas * m.weights[node]
+		for i := 0; i < count; i++ {
+			hash := int(m.hashFunc([]byte(strconv.Itoa(i) + node))) //计算虚拟节点的哈希值
+			if _, ok := m.nodehashMap[hash]; ok {
+				continue
+			}
+			m.nodeHashs = append(m.nodeHashs, hash) //记录哈希值
+			m.nodehashMap[hash] = node              // 记录哈希值和节点间的映射
+		}
 	}
 	sort.Ints(m.nodeHashs) // 哈希值排序
 }
 
+// Clone 复制哈希环, 用于在修改成员之前保留旧的哈希环
+func (m *NodeMap) Clone() *NodeMap {
+	c := NewNodeMap(m.replicas, m.hashFunc)
+	for node, weight := range m.weights {
+		c.weights[node] = weight
+	}
+	c.rebuild()
+	return c
+}
+
+// Hash 计算 key 在哈希环上的位置
+func (m *NodeMap) Hash(key string) uint32 {
+	return m.hashFunc([]byte(key))
+}
+
 // PickNode 根据当前k，返回所属的节点
 func (m *NodeMap) PickNode(key string) string {
 	// 0. 判空
@@ -52,14 +145,64 @@ func (m *NodeMap) PickNode(key string) string {
 	}
 	// 1. 对key做哈希
 	hash := int(m.hashFunc([]byte(key)))
+	return m.pickByHash(hash)
+}
 
-	// 2. 搜索哈希值落在那两个哈希之间，从而确定应该操作的节点
+// pickByHash 搜索哈希值落在那两个哈希之间，从而确定应该操作的节点
+func (m *NodeMap) pickByHash(hash int) string {
 	idx := sort.Search(len(m.nodeHashs), func(i int) bool {
 		return m.nodeHashs[i] >= hash
 	})
 	if idx == len(m.nodeHashs) { // 如果落在之后，应该去0号节点
 		idx = 0
 	}
-
 	return m.nodehashMap[m.nodeHashs[idx]]
 }
+
+// MovedRanges 对比成员变化前的哈希环 old, 返回归属发生变化的区间
+// 两个环上所有虚拟节点把哈希环切分为若干区间, 每个区间在新旧环上各自只属于一个节点
+func (m *NodeMap) MovedRanges(old *NodeMap) []MovedRange {
+	if m.IsEmpty() || old.IsEmpty() {
+		return nil
+	}
+	points := make([]int, 0, len(m.nodeHashs)+len(old.nodeHashs))
+	points = append(points, m.nodeHashs...)
+	points = append(points, old.nodeHashs...)
+	sort.Ints(points)
+	points = uniqueInts(points)
+
+	moved := make([]MovedRange, 0)
+	for i, end := range points {
+		start := points[len(points)-1] // 第一个区间从最后一个点跨过环的起点
+		if i > 0 {
+			start = points[i-1]
+		}
+		from := old.pickByHash(end)
+		to := m.pickByHash(end)
+		if from == to {
+			continue
+		}
+		// 与上一个区间的迁移方向相同时合并
+		if n := len(moved); n > 0 && moved[n-1].End == uint32(start) &&
+			moved[n-1].From == from && moved[n-1].To == to {
+			moved[n-1].End = uint32(end)
+			continue
+		}
+		moved = append(moved, MovedRange{
+			KeyRange: KeyRange{Start: uint32(start), End: uint32(end)},
+			From:     from,
+			To:       to,
+		})
+	}
+	return moved
+}
+
+func uniqueInts(sorted []int) []int {
+	result := sorted[:0]
+	for i, v := range sorted {
+		if i == 0 || v != sorted[i-1] {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,348 @@
+// Package geohash 经纬度与 52 位 geohash 之间的转换, 算法与 Redis 相同
+//
+// 纬度位于偶数位, 经度位于奇数位; 纬度范围使用 Web Mercator 的限制 ±85.05112878
+package geohash
+
+import "math"
+
+const (
+	// MaxStep geohash 的最大精度, 经纬度各 26 位
+	MaxStep = 26
+
+	MinLongitude = -180.0
+	MaxLongitude = 180.0
+	MinLatitude  = -85.05112878
+	MaxLatitude  = 85.05112878
+
+	earthRadius = 6372797.560856 // 地球半径(米)
+	mercatorMax = 20037726.37    // Web Mercator 投影的最大坐标(米)
+)
+
+// Hash geohash 值, Step 为精度(经纬度各占的位数)
+type Hash struct {
+	Bits uint64
+	Step uint
+}
+
+// Range 坐标范围
+type Range struct {
+	Min float64
+	Max float64
+}
+
+// Area geohash 对应的矩形区域
+type Area struct {
+	Hash      Hash
+	Longitude Range
+	Latitude  Range
+}
+
+var (
+	longRange = Range{Min: MinLongitude, Max: MaxLongitude}
+	latRange  = Range{Min: MinLatitude, Max: MaxLatitude}
+)
+
+// ValidCoord 经纬度是否在可以编码的范围内
+func ValidCoord(longitude float64, latitude float64) bool {
+	return longitude >= MinLongitude && longitude <= MaxLongitude &&
+		latitude >= MinLatitude && latitude <= MaxLatitude
+}
+
+// interleave 把 x 放在偶数位, y 放在奇数位
+func interleave(x uint32, y uint32) uint64 {
+	return spread(x) | spread(y)<<1
+}
+
+// spread 在每一位之间插入一个 0
+func spread(v uint32) uint64 {
+	x := uint64(v)
+	x = (x | x<<16) & 0x0000FFFF0000FFFF
+	x = (x | x<<8) & 0x00FF00FF00FF00FF
+	x = (x | x<<4) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x<<2) & 0x3333333333333333
+	x = (x | x<<1) & 0x5555555555555555
+	return x
+}
+
+// squash spread 的逆运算, 取出偶数位
+func squash(x uint64) uint32 {
+	x &= 0x5555555555555555
+	x = (x | x>>1) & 0x3333333333333333
+	x = (x | x>>2) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x>>4) & 0x00FF00FF00FF00FF
+	x = (x | x>>8) & 0x0000FFFF0000FFFF
+	x = (x | x>>16) & 0x00000000FFFFFFFF
+	return uint32(x)
+}
+
+func encode(lr Range, ar Range, longitude float64, latitude float64, step uint) Hash {
+	latOffset := (latitude - ar.Min) / (ar.Max - ar.Min)
+	longOffset := (longitude - lr.Min) / (lr.Max - lr.Min)
+	latOffset *= float64(uint64(1) << step)
+	longOffset *= float64(uint64(1) << step)
+	return Hash{
+		Bits: interleave(uint32(latOffset), uint32(longOffset)),
+		Step: step,
+	}
+}
+
+// Encode 把经纬度编码为 step 精度的 geohash, 调用方需要保证经纬度合法
+func Encode(longitude float64, latitude float64, step uint) Hash {
+	return encode(longRange, latRange, longitude, latitude, step)
+}
+
+// Decode 返回 geohash 对应的区域
+func Decode(hash Hash) Area {
+	ilat := squash(hash.Bits)
+	ilong := squash(hash.Bits >> 1)
+	scale := float64(uint64(1) << hash.Step)
+	latScale := latRange.Max - latRange.Min
+	longScale := longRange.Max - longRange.Min
+	return Area{
+		Hash: hash,
+		Latitude: Range{
+			Min: latRange.Min + float64(ilat)/scale*latScale,
+			Max: latRange.Min + float64(ilat+1)/scale*latScale,
+		},
+		Longitude: Range{
+			Min: longRange.Min + float64(ilong)/scale*longScale,
+			Max: longRange.Min + float64(ilong+1)/scale*longScale,
+		},
+	}
+}
+
+// DecodeToLongLat 返回 52 位 geohash 对应区域的中心点
+func DecodeToLongLat(bits uint64) (float64, float64) {
+	area := Decode(Hash{Bits: bits, Step: MaxStep})
+	longitude := (area.Longitude.Min + area.Longitude.Max) / 2
+	latitude := (area.Latitude.Min + area.Latitude.Max) / 2
+	longitude = math.Max(MinLongitude, math.Min(MaxLongitude, longitude))
+	latitude = math.Max(MinLatitude, math.Min(MaxLatitude, latitude))
+	return longitude, latitude
+}
+
+const base32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// ToString 返回标准的 11 位 geohash 字符串, 使用 ±90 的纬度范围
+func ToString(longitude float64, latitude float64) string {
+	hash := encode(longRange, Range{Min: -90, Max: 90}, longitude, latitude, MaxStep)
+	buf := make([]byte, 11)
+	for i := 0; i < 11; i++ {
+		var idx uint64
+		// 只有 52 位, 最后一个字符补 0
+		if i < 10 {
+			idx = (hash.Bits >> (52 - uint(i+1)*5)) & 0x1f
+		}
+		buf[i] = base32[idx]
+	}
+	return string(buf)
+}
+
+/* ---- 相邻区域 ---- */
+
+func moveX(hash Hash, d int) Hash {
+	x := hash.Bits & 0xaaaaaaaaaaaaaaaa
+	y := hash.Bits & 0x5555555555555555
+	zz := uint64(0x5555555555555555) >> (64 - hash.Step*2)
+	if d > 0 {
+		x = x + (zz + 1)
+	} else {
+		x = x | zz
+		x = x - (zz + 1)
+	}
+	x &= uint64(0xaaaaaaaaaaaaaaaa) >> (64 - hash.Step*2)
+	return Hash{Bits: x | y, Step: hash.Step}
+}
+
+func moveY(hash Hash, d int) Hash {
+	x := hash.Bits & 0xaaaaaaaaaaaaaaaa
+	y := hash.Bits & 0x5555555555555555
+	zz := uint64(0xaaaaaaaaaaaaaaaa) >> (64 - hash.Step*2)
+	if d > 0 {
+		y = y + (zz + 1)
+	} else {
+		y = y | zz
+		y = y - (zz + 1)
+	}
+	y &= uint64(0x5555555555555555) >> (64 - hash.Step*2)
+	return Hash{Bits: x | y, Step: hash.Step}
+}
+
+// neighbors 返回周围的 8 个区域: 北、南、东、西、东北、西北、东南、西南
+func neighbors(hash Hash) [8]Hash {
+	return [8]Hash{
+		moveY(hash, 1),
+		moveY(hash, -1),
+		moveX(hash, 1),
+		moveX(hash, -1),
+		moveY(moveX(hash, 1), 1),
+		moveY(moveX(hash, -1), 1),
+		moveY(moveX(hash, 1), -1),
+		moveY(moveX(hash, -1), -1),
+	}
+}
+
+/* ---- 距离 ---- */
+
+const degToRad = math.Pi / 180
+
+func degRad(deg float64) float64 {
+	return deg * degToRad
+}
+
+func radDeg(rad float64) float64 {
+	return rad / degToRad
+}
+
+func latDistance(lat1 float64, lat2 float64) float64 {
+	return earthRadius * math.Abs(degRad(lat2)-degRad(lat1))
+}
+
+// Distance 使用 haversine 公式计算两点之间的距离(米)
+func Distance(long1 float64, lat1 float64, long2 float64, lat2 float64) float64 {
+	v := math.Sin((degRad(long2) - degRad(long1)) / 2)
+	if v == 0 {
+		return latDistance(lat1, lat2)
+	}
+	lat1r, lat2r := degRad(lat1), degRad(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// Shape 搜索范围: 以 (Longitude, Latitude) 为中心的圆形或矩形, 单位为米
+type Shape struct {
+	Longitude float64
+	Latitude  float64
+	IsBox     bool
+	Radius    float64
+	Width     float64
+	Height    float64
+}
+
+// Contains 点是否在范围内, 在范围内时同时返回到中心的距离(米)
+func (s *Shape) Contains(longitude float64, latitude float64) (float64, bool) {
+	if !s.IsBox {
+		dist := Distance(s.Longitude, s.Latitude, longitude, latitude)
+		return dist, dist <= s.Radius
+	}
+	// 先检查计算量较小的纬度方向
+	if latDistance(latitude, s.Latitude) > s.Height/2 {
+		return 0, false
+	}
+	if Distance(longitude, latitude, s.Longitude, latitude) > s.Width/2 {
+		return 0, false
+	}
+	return Distance(s.Longitude, s.Latitude, longitude, latitude), true
+}
+
+// boundingBox 返回包含搜索范围的经纬度矩形: 最小经度、最小纬度、最大经度、最大纬度
+func (s *Shape) boundingBox() (float64, float64, float64, float64) {
+	height, width := s.Radius, s.Radius
+	if s.IsBox {
+		height, width = s.Height/2, s.Width/2
+	}
+	latDelta := radDeg(height / earthRadius)
+	longDeltaTop := radDeg(width / earthRadius / math.Cos(degRad(s.Latitude+latDelta)))
+	longDeltaBottom := radDeg(width / earthRadius / math.Cos(degRad(s.Latitude-latDelta)))
+	// 南北半球纬度越高经度跨度越大, 取跨度较大的一侧
+	longDelta := longDeltaTop
+	if s.Latitude < 0 {
+		longDelta = longDeltaBottom
+	}
+	return s.Longitude - longDelta, s.Latitude - latDelta, s.Longitude + longDelta, s.Latitude + latDelta
+}
+
+// estimateStep 根据搜索半径估算合适的精度, 使 3x3 个区域能覆盖搜索范围
+func estimateStep(rangeMeters float64, latitude float64) uint {
+	if rangeMeters == 0 {
+		return MaxStep
+	}
+	step := 1
+	for rangeMeters < mercatorMax {
+		rangeMeters *= 2
+		step++
+	}
+	step -= 2
+	// 靠近两极时经度方向的跨度更大
+	if latitude > 66 || latitude < -66 {
+		step--
+		if latitude > 80 || latitude < -80 {
+			step--
+		}
+	}
+	if step < 1 {
+		step = 1
+	}
+	if step > MaxStep {
+		step = MaxStep
+	}
+	return uint(step)
+}
+
+// ScoreRange 52 位 geohash 的范围 [Min, Max)
+type ScoreRange struct {
+	Min uint64
+	Max uint64
+}
+
+// SearchRanges 返回覆盖搜索范围的 geohash 区间, 区间内的点还需要用 Contains 过滤
+func (s *Shape) SearchRanges() []ScoreRange {
+	radius := s.Radius
+	if s.IsBox {
+		radius = math.Sqrt((s.Width/2)*(s.Width/2) + (s.Height/2)*(s.Height/2))
+	}
+	minLong, minLat, maxLong, maxLat := s.boundingBox()
+	step := estimateStep(radius, s.Latitude)
+	hash := Encode(s.Longitude, s.Latitude, step)
+	around := neighbors(hash)
+	area := Decode(hash)
+
+	// 搜索范围靠近区域边缘时, 相邻区域可能覆盖不到, 需要降低精度
+	north, south := Decode(around[0]), Decode(around[1])
+	east, west := Decode(around[2]), Decode(around[3])
+	if step > 1 && (north.Latitude.Max < maxLat || south.Latitude.Min > minLat ||
+		east.Longitude.Max < maxLong || west.Longitude.Min > minLong) {
+		step--
+		hash = Encode(s.Longitude, s.Latitude, step)
+		around = neighbors(hash)
+		area = Decode(hash)
+	}
+
+	// 排除不可能包含结果的相邻区域
+	var skip [8]bool
+	if step >= 2 {
+		if area.Latitude.Min < minLat {
+			skip[1], skip[6], skip[7] = true, true, true // 南、东南、西南
+		}
+		if area.Latitude.Max > maxLat {
+			skip[0], skip[4], skip[5] = true, true, true // 北、东北、西北
+		}
+		if area.Longitude.Min < minLong {
+			skip[3], skip[5], skip[7] = true, true, true // 西、西北、西南
+		}
+		if area.Longitude.Max > maxLong {
+			skip[2], skip[4], skip[6] = true, true, true // 东、东北、东南
+		}
+	}
+
+	hashes := []Hash{hash}
+	for i, h := range around {
+		if !skip[i] {
+			hashes = append(hashes, h)
+		}
+	}
+	ranges := make([]ScoreRange, 0, len(hashes))
+	for i, h := range hashes {
+		// 精度很低时相邻区域可能重复
+		if i > 0 && h == hashes[i-1] {
+			continue
+		}
+		shift := 2 * (MaxStep - h.Step)
+		ranges = append(ranges, ScoreRange{
+			Min: h.Bits << shift,
+			Max: (h.Bits + 1) << shift,
+		})
+	}
+	return ranges
+}
@@ -0,0 +1,104 @@
+package geohash
+
+import (
+	"math"
+	"testing"
+)
+
+// 期望值来自 redis 文档中 GEOADD/GEOHASH/GEOPOS/GEODIST 的例子
+var cities = []struct {
+	name      string
+	longitude float64
+	latitude  float64
+	bits      uint64  // GEOADD 保存的 score
+	str       string  // GEOHASH 的结果
+	decodedLo float64 // GEOPOS 的结果
+	decodedLa float64
+}{
+	{"Palermo", 13.361389, 38.115556, 3479099956230698, "sqc8b49rny0", 13.36138933897018433, 38.11555639549629859},
+	{"Catania", 15.087269, 37.502669, 3479447370796909, "sqdtr74hyu0", 15.08726745843887329, 37.50266842333162032},
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, city := range cities {
+		t.Run(city.name, func(t *testing.T) {
+			hash := Encode(city.longitude, city.latitude, MaxStep)
+			if hash.Bits != city.bits {
+				t.Errorf("encode: got %d, want %d", hash.Bits, city.bits)
+			}
+			if str := ToString(city.longitude, city.latitude); str != city.str {
+				t.Errorf("string: got %s, want %s", str, city.str)
+			}
+			longitude, latitude := DecodeToLongLat(city.bits)
+			if math.Abs(longitude-city.decodedLo) > 1e-12 || math.Abs(latitude-city.decodedLa) > 1e-12 {
+				t.Errorf("decode: got (%v, %v), want (%v, %v)", longitude, latitude, city.decodedLo, city.decodedLa)
+			}
+			area := Decode(hash)
+			if city.longitude < area.Longitude.Min || city.longitude > area.Longitude.Max ||
+				city.latitude < area.Latitude.Min || city.latitude > area.Latitude.Max {
+				t.Errorf("area %+v does not contain the point", area)
+			}
+		})
+	}
+}
+
+func TestEncodeBounds(t *testing.T) {
+	tests := []struct {
+		name      string
+		longitude float64
+		latitude  float64
+		step      uint
+		bits      uint64
+	}{
+		{"min corner", MinLongitude, MinLatitude, MaxStep, 0},
+		{"center", 0, 0, 1, 0x3},
+		{"south west quadrant", -90, -45, 1, 0x0},
+		{"north west quadrant", -90, 45, 1, 0x1},
+		{"south east quadrant", 90, -45, 1, 0x2},
+		{"north east quadrant", 90, 45, 1, 0x3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if hash := Encode(tt.longitude, tt.latitude, tt.step); hash.Bits != tt.bits {
+				t.Errorf("got %#x, want %#x", hash.Bits, tt.bits)
+			}
+		})
+	}
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	// 解码得到的中心点重新编码后与原来的 geohash 相同
+	points := [][2]float64{{-180, -85}, {179.999999, 85.05}, {116.397128, 39.916527}, {-122.419416, 37.774929}, {0, 0}}
+	for _, p := range points {
+		hash := Encode(p[0], p[1], MaxStep)
+		longitude, latitude := DecodeToLongLat(hash.Bits)
+		if again := Encode(longitude, latitude, MaxStep); again.Bits != hash.Bits {
+			t.Errorf("%v: got %d, want %d", p, again.Bits, hash.Bits)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	// GEODIST Sicily Palermo Catania
+	d := Distance(cities[0].decodedLo, cities[0].decodedLa, cities[1].decodedLo, cities[1].decodedLa)
+	if math.Abs(d-166274.1516) > 1e-4 {
+		t.Errorf("got %.4f, want 166274.1516", d)
+	}
+}
+
+func TestNeighbors(t *testing.T) {
+	hash := Encode(13.361389, 38.115556, 10)
+	area := Decode(hash)
+	width := area.Longitude.Max - area.Longitude.Min
+	height := area.Latitude.Max - area.Latitude.Min
+	// 北、南、东、西、东北、西北、东南、西南 相对中心区域的偏移
+	offsets := [8][2]float64{{0, 1}, {0, -1}, {1, 0}, {-1, 0}, {1, 1}, {-1, 1}, {1, -1}, {-1, -1}}
+	for i, neighbor := range neighbors(hash) {
+		got := Decode(neighbor)
+		wantLong := area.Longitude.Min + offsets[i][0]*width
+		wantLat := area.Latitude.Min + offsets[i][1]*height
+		if math.Abs(got.Longitude.Min-wantLong) > 1e-9 || math.Abs(got.Latitude.Min-wantLat) > 1e-9 {
+			t.Errorf("neighbor %d: got (%v, %v), want (%v, %v)", i, got.Longitude.Min, got.Latitude.Min, wantLong, wantLat)
+		}
+	}
+}
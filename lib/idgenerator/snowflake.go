@@ -0,0 +1,68 @@
+package idgenerator
+
+import (
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// epoch0 2022-01-01 00:00:00 UTC, 时间戳从该时刻开始计算
+	epoch0      int64 = 1640995200000
+	maxSequence int64 = -1 ^ (-1 << uint64(nodeLeft))
+	timeLeft    uint8 = 22
+	nodeLeft    uint8 = 10
+	nodeMask    int64 = -1 ^ (-1 << uint64(timeLeft-nodeLeft))
+)
+
+// IDGenerator 雪花算法 ID 生成器: 41位毫秒时间戳 + 12位节点号 + 10位序列号
+type IDGenerator struct {
+	mu        *sync.Mutex
+	lastStamp int64
+	nodeID    int64
+	sequence  int64
+	epoch     time.Time
+}
+
+// MakeGenerator 创建 ID 生成器, node 一般为节点地址
+func MakeGenerator(node string) *IDGenerator {
+	fnv64 := fnv.New64()
+	_, _ = fnv64.Write([]byte(node))
+	nodeID := int64(fnv64.Sum64()) & nodeMask
+
+	var curTime = time.Now()
+	epoch := curTime.Add(time.Unix(epoch0/1000, (epoch0%1000)*1000000).Sub(curTime))
+
+	return &IDGenerator{
+		mu:        &sync.Mutex{},
+		lastStamp: -1,
+		nodeID:    nodeID,
+		sequence:  1,
+		epoch:     epoch,
+	}
+}
+
+// NextID 返回下一个 ID, 同一生成器返回的 ID 单调递增
+func (w *IDGenerator) NextID() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	timestamp := time.Since(w.epoch).Nanoseconds() / 1000000
+	if timestamp < w.lastStamp {
+		log.Fatal("can not generate id")
+	}
+	if w.lastStamp == timestamp {
+		w.sequence = (w.sequence + 1) & maxSequence
+		if w.sequence == 0 {
+			for timestamp <= w.lastStamp {
+				timestamp = time.Since(w.epoch).Nanoseconds() / 1000000
+			}
+		}
+	} else {
+		w.sequence = 0
+	}
+	w.lastStamp = timestamp
+	id := (timestamp << timeLeft) | (w.nodeID << nodeLeft) | w.sequence
+	return id
+}
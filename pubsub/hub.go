@@ -0,0 +1,232 @@
+// Package pubsub 发布订阅: 记录频道、模式与订阅者之间的关系, 并向订阅者推送消息
+package pubsub
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/lib/wildcard"
+	"GoRedis/resp/reply"
+	"sync"
+)
+
+var (
+	messageBytes  = []byte("message")
+	pmessageBytes = []byte("pmessage")
+)
+
+// Hub 保存所有的订阅关系
+type Hub struct {
+	mu       sync.RWMutex
+	channels map[string]map[resp.Connection]struct{} // 频道 -> 订阅者
+	patterns map[string]*patternSubscribers          // 模式 -> 订阅者
+}
+
+type patternSubscribers struct {
+	pattern *wildcard.Pattern
+	subs    map[resp.Connection]struct{}
+}
+
+// MakeHub 创建 Hub
+func MakeHub() *Hub {
+	return &Hub{
+		channels: make(map[string]map[resp.Connection]struct{}),
+		patterns: make(map[string]*patternSubscribers),
+	}
+}
+
+// makeSubsReply 订阅、取消订阅的回复: [kind, channel, 订阅总数]; RESP3 客户端收到 push
+func makeSubsReply(c resp.Connection, kind string, channel string, count int) []byte {
+	return reply.ToProtocolBytes(reply.MakePushReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(kind)),
+		reply.MakeBulkReply([]byte(channel)),
+		reply.MakeIntReply(int64(count)),
+	}), c.GetProtocol())
+}
+
+// makeEmptySubsReply 没有订阅任何频道时取消订阅的回复: [kind, nil, 0]
+func makeEmptySubsReply(c resp.Connection, kind string) []byte {
+	return reply.ToProtocolBytes(reply.MakePushReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(kind)),
+		reply.MakeNullBulkReply(),
+		reply.MakeIntReply(0),
+	}), c.GetProtocol())
+}
+
+// message 推送给订阅者的消息, 按协议版本缓存序列化的结果
+type message struct {
+	push  *reply.PushReply
+	resp2 []byte
+	resp3 []byte
+}
+
+func makeMessage(args ...[]byte) *message {
+	replies := make([]resp.Reply, len(args))
+	for i, arg := range args {
+		replies[i] = reply.MakeBulkReply(arg)
+	}
+	return &message{push: reply.MakePushReply(replies)}
+}
+
+func (msg *message) sendTo(c resp.Connection) {
+	if c.GetProtocol() >= reply.Resp3 {
+		if msg.resp3 == nil {
+			msg.resp3 = msg.push.ToResp3Bytes()
+		}
+		_ = c.Write(msg.resp3)
+		return
+	}
+	if msg.resp2 == nil {
+		msg.resp2 = msg.push.ToBytes()
+	}
+	_ = c.Write(msg.resp2)
+}
+
+// Subscribe SUBSCRIBE channel [channel ...]
+func (hub *Hub) Subscribe(c resp.Connection, args [][]byte) resp.Reply {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for _, arg := range args {
+		channel := string(arg)
+		subs, ok := hub.channels[channel]
+		if !ok {
+			subs = make(map[resp.Connection]struct{})
+			hub.channels[channel] = subs
+		}
+		subs[c] = struct{}{}
+		c.Subscribe(channel)
+		_ = c.Write(makeSubsReply(c, "subscribe", channel, c.SubsCount()))
+	}
+	return reply.MakeNoBytes()
+}
+
+// UnSubscribe UNSUBSCRIBE [channel ...]: 不带参数时取消订阅所有频道
+func (hub *Hub) UnSubscribe(c resp.Connection, args [][]byte) resp.Reply {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	channels := make([]string, 0, len(args))
+	for _, arg := range args {
+		channels = append(channels, string(arg))
+	}
+	if len(channels) == 0 {
+		channels = c.GetChannels()
+		if len(channels) == 0 {
+			_ = c.Write(makeEmptySubsReply(c, "unsubscribe"))
+			return reply.MakeNoBytes()
+		}
+	}
+	for _, channel := range channels {
+		hub.unsubscribe(c, channel)
+		_ = c.Write(makeSubsReply(c, "unsubscribe", channel, c.SubsCount()))
+	}
+	return reply.MakeNoBytes()
+}
+
+func (hub *Hub) unsubscribe(c resp.Connection, channel string) {
+	c.UnSubscribe(channel)
+	subs, ok := hub.channels[channel]
+	if !ok {
+		return
+	}
+	delete(subs, c)
+	if len(subs) == 0 {
+		delete(hub.channels, channel)
+	}
+}
+
+// PSubscribe PSUBSCRIBE pattern [pattern ...]
+func (hub *Hub) PSubscribe(c resp.Connection, args [][]byte) resp.Reply {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for _, arg := range args {
+		pattern := string(arg)
+		subs, ok := hub.patterns[pattern]
+		if !ok {
+			subs = &patternSubscribers{
+				pattern: wildcard.CompilePattern(pattern),
+				subs:    make(map[resp.Connection]struct{}),
+			}
+			hub.patterns[pattern] = subs
+		}
+		subs.subs[c] = struct{}{}
+		c.PSubscribe(pattern)
+		_ = c.Write(makeSubsReply(c, "psubscribe", pattern, c.SubsCount()))
+	}
+	return reply.MakeNoBytes()
+}
+
+// PUnSubscribe PUNSUBSCRIBE [pattern ...]: 不带参数时取消订阅所有模式
+func (hub *Hub) PUnSubscribe(c resp.Connection, args [][]byte) resp.Reply {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	patterns := make([]string, 0, len(args))
+	for _, arg := range args {
+		patterns = append(patterns, string(arg))
+	}
+	if len(patterns) == 0 {
+		patterns = c.GetPatterns()
+		if len(patterns) == 0 {
+			_ = c.Write(makeEmptySubsReply(c, "punsubscribe"))
+			return reply.MakeNoBytes()
+		}
+	}
+	for _, pattern := range patterns {
+		hub.punsubscribe(c, pattern)
+		_ = c.Write(makeSubsReply(c, "punsubscribe", pattern, c.SubsCount()))
+	}
+	return reply.MakeNoBytes()
+}
+
+func (hub *Hub) punsubscribe(c resp.Connection, pattern string) {
+	c.PUnSubscribe(pattern)
+	subs, ok := hub.patterns[pattern]
+	if !ok {
+		return
+	}
+	delete(subs.subs, c)
+	if len(subs.subs) == 0 {
+		delete(hub.patterns, pattern)
+	}
+}
+
+// UnsubscribeAll 连接关闭时取消它的所有订阅
+func (hub *Hub) UnsubscribeAll(c resp.Connection) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	for _, channel := range c.GetChannels() {
+		hub.unsubscribe(c, channel)
+	}
+	for _, pattern := range c.GetPatterns() {
+		hub.punsubscribe(c, pattern)
+	}
+}
+
+// Publish 向频道发送消息, 返回收到消息的订阅者数量
+func (hub *Hub) Publish(channel string, message []byte) int {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	count := 0
+	if subs, ok := hub.channels[channel]; ok {
+		msg := makeMessage(messageBytes, []byte(channel), message)
+		for c := range subs {
+			msg.sendTo(c)
+			count++
+		}
+	}
+	for pattern, subs := range hub.patterns {
+		if !subs.pattern.IsMatch(channel) {
+			continue
+		}
+		msg := makeMessage(pmessageBytes, []byte(pattern), []byte(channel), message)
+		for c := range subs.subs {
+			msg.sendTo(c)
+			count++
+		}
+	}
+	return count
+}
+
+// HasSubscribers 是否存在订阅者, 没有订阅者时可以跳过消息的生成
+func (hub *Hub) HasSubscribers() bool {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	return len(hub.channels) > 0 || len(hub.patterns) > 0
+}
@@ -15,11 +15,15 @@ import (
 
 // Client is a pipeline mode redis client
 type Client struct {
-	conn        net.Conn
+	// mu guards conn and waitingReqs: a request is written and queued for its reply atomically,
+	// so the replies read from a connection always match the requests sent on it
+	mu          sync.Mutex
+	conn        net.Conn      // nil after the connection is broken, reconnect before next request
 	pendingReqs chan *request // wait to send
-	waitingReqs chan *request // waiting response
+	waitingReqs chan *request // waiting response on conn, each connection has its own channel
 	ticker      *time.Ticker
 	addr        string
+	handshake   [][]byte // sent before any other request on every new connection, e.g. authentication
 
 	working *sync.WaitGroup // its counter presents unfinished requests(pending and waiting)
 }
@@ -39,6 +43,8 @@ const (
 	maxWait  = 3 * time.Second
 )
 
+var errConnClosed = errors.New("connection closed")
+
 // MakeClient creates a new client
 func MakeClient(addr string) (*Client, error) {
 	conn, err := net.Dial("tcp", addr)
@@ -54,16 +60,18 @@ func MakeClient(addr string) (*Client, error) {
 	}, nil
 }
 
+// SetHandshake sets a command which is resent after every reconnection before the retried request,
+// so that states bound to the server side connection, e.g. authentication, survive reconnecting.
+// The caller sends it on the first connection itself to check the reply
+func (client *Client) SetHandshake(args [][]byte) {
+	client.handshake = args
+}
+
 // Start starts asynchronous goroutines
 func (client *Client) Start() {
 	client.ticker = time.NewTicker(10 * time.Second)
 	go client.handleWrite()
-	go func() {
-		err := client.handleRead()
-		if !errors.Is(err, nil) {
-			logger.Error(err)
-		}
-	}()
+	go client.handleRead(client.conn, client.waitingReqs)
 	go client.heartbeat()
 }
 
@@ -77,30 +85,54 @@ func (client *Client) Close() {
 	client.working.Wait()
 
 	// clean
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.closeConn()
+}
+
+// closeConn closes the connection and its waiting channel, the reader of the connection fails
+// the requests left in the channel when it exits. The caller must hold client.mu
+func (client *Client) closeConn() {
+	if client.conn == nil {
+		return
+	}
 	_ = client.conn.Close()
+	client.conn = nil
 	close(client.waitingReqs)
 }
 
-func (client *Client) handleConnectionError(err error) error {
-	err1 := client.conn.Close()
-	if !errors.Is(err1, nil) {
-		if opErr, ok := err1.(*net.OpError); ok {
-			if opErr.Err.Error() != "use of closed network connection" {
-				return err1
-			}
-		} else {
-			return err1
-		}
-	}
-	conn, err1 := net.Dial("tcp", client.addr)
-	if !errors.Is(err1, nil) {
-		logger.Error(err1)
-		return err1
+// connect dials a new connection and sends the handshake on it, the caller must hold client.mu
+func (client *Client) connect() error {
+	conn, err := net.Dial("tcp", client.addr)
+	if !errors.Is(err, nil) {
+		logger.Error(err)
+		return err
 	}
 	client.conn = conn
-	go func() {
-		_ = client.handleRead()
-	}()
+	client.waitingReqs = make(chan *request, chanSize)
+	go client.handleRead(conn, client.waitingReqs)
+	if len(client.handshake) == 0 {
+		return nil
+	}
+	// the reply of handshake is discarded
+	req := &request{
+		args:      client.handshake,
+		heartbeat: true,
+		waiting:   &wait.Wait{},
+	}
+	req.waiting.Add(1)
+	return client.write(req)
+}
+
+// write writes the request on the current connection and queues it for the reply.
+// The caller must hold client.mu
+func (client *Client) write(req *request) error {
+	_, err := client.conn.Write(reply.MakeMultiBulkReply(req.args).ToBytes())
+	if !errors.Is(err, nil) {
+		client.closeConn()
+		return err
+	}
+	client.waitingReqs <- req
 	return nil
 }
 
@@ -150,54 +182,79 @@ func (client *Client) doHeartbeat() {
 	request.waiting.WaitWithTimeout(maxWait)
 }
 
+// doRequest sends the request, reconnects and retries at most 3 times if the connection is broken
 func (client *Client) doRequest(req *request) {
 	if req == nil || len(req.args) == 0 {
 		return
 	}
-	re := reply.MakeMultiBulkReply(req.args)
-	bytes := re.ToBytes()
-	_, err := client.conn.Write(bytes)
-	i := 0
-	for !errors.Is(err, nil) && i < 3 {
-		err = client.handleConnectionError(err)
-		if errors.Is(err, nil) {
-			_, err = client.conn.Write(bytes)
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	var err error
+	for i := 0; i < 3; i++ {
+		if client.conn == nil {
+			if err = client.connect(); !errors.Is(err, nil) {
+				continue
+			}
+		}
+		if err = client.write(req); errors.Is(err, nil) {
+			return
 		}
-		i++
-	}
-	if err == nil {
-		client.waitingReqs <- req
-	} else {
-		req.err = err
-		req.waiting.Done()
 	}
+	req.err = err
+	req.waiting.Done()
 }
 
-func (client *Client) finishRequest(reply resp.Reply) {
+// finishRequest hands the reply to the earliest request sent on the connection,
+// returns false if the connection has been closed
+func (client *Client) finishRequest(waitingReqs <-chan *request, reply resp.Reply) bool {
 	defer func() {
 		if err := recover(); err != nil {
 			debug.PrintStack()
 			logger.Error(err)
 		}
 	}()
-	request := <-client.waitingReqs
-	if request == nil {
-		return
+	request, ok := <-waitingReqs
+	if !ok {
+		return false
 	}
 	request.reply = reply
 	if request.waiting != nil {
 		request.waiting.Done()
 	}
+	return true
 }
 
-func (client *Client) handleRead() error {
-	ch := parser.ParseStream(client.conn)
-	for payload := range ch {
-		if payload.Err != nil {
-			client.finishRequest(reply.MakeErrReply(payload.Err.Error()))
-			continue
+// handleRead reads replies from conn until it is broken. After a protocol error the stream can not be
+// resynchronized, so the connection is closed like the server does, and the next request reconnects.
+// It is the only consumer of waitingReqs, so replies are matched to requests in order
+func (client *Client) handleRead(conn net.Conn, waitingReqs <-chan *request) {
+	reader := parser.NewReader(conn)
+	defer reader.Release()
+	for {
+		result, err := reader.ReadReply()
+		if !errors.Is(err, nil) {
+			if parser.IsProtocolError(err) {
+				logger.Error("protocol error from " + client.addr + ": " + err.Error())
+				client.finishRequest(waitingReqs, reply.MakeErrReply(err.Error()))
+			}
+			break
+		}
+		if !client.finishRequest(waitingReqs, result) {
+			break
 		}
-		client.finishRequest(payload.Data)
 	}
-	return nil
+	// closing conn unblocks the writer blocked on it; the writer may also be blocked on a full waitingReqs,
+	// so waitingReqs is drained while another goroutine waits for the lock and closes it
+	_ = conn.Close()
+	go func() {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		if client.conn == conn {
+			client.closeConn()
+		}
+	}()
+	for req := range waitingReqs {
+		req.err = errConnClosed
+		req.waiting.Done()
+	}
 }
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"GoRedis/interface/resp"
+	"GoRedis/lib/utils"
+	"GoRedis/resp/parser"
+	"GoRedis/resp/reply"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+// startFakeServer 第一个连接上的第一条指令回复一个非法报文, 其它指令回复指令名
+func startFakeServer(t *testing.T) (string, *int32) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	var conns int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			first := atomic.AddInt32(&conns, 1) == 1
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := parser.NewReader(conn)
+				defer reader.Release()
+				for i := 0; ; i++ {
+					args, err := reader.ReadCommand()
+					if err != nil {
+						return
+					}
+					if first && i == 0 {
+						_, _ = conn.Write([]byte("?bad\r\n"))
+						continue
+					}
+					_, _ = conn.Write(reply.MakeStatusReply(string(args[0])).ToBytes())
+				}
+			}(conn)
+		}
+	}()
+	return listener.Addr().String(), &conns
+}
+
+func TestClientProtocolError(t *testing.T) {
+	addr, conns := startFakeServer(t)
+	client, err := MakeClient(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Start()
+	defer client.Close()
+
+	r := client.Send(utils.ToCmdLine("first"))
+	if !reply.IsErrorReply(r) {
+		t.Fatalf("expected protocol error reply, got %q", r.ToBytes())
+	}
+	// 协议错误之后连接被关闭, 之后的请求在新的连接上发送; 连接关闭前发出的请求会失败, 但回复不会错位
+	for i := 0; i < 3; i++ {
+		r = client.Send(utils.ToCmdLine("second"))
+		if !reply.IsErrorReply(r) {
+			break
+		}
+	}
+	if string(r.ToBytes()) != "+second\r\n" {
+		t.Fatalf("unexpected reply %q", r.ToBytes())
+	}
+	if n := atomic.LoadInt32(conns); n < 2 {
+		t.Errorf("expected client to reconnect, got %d connections", n)
+	}
+}
+
+func TestClientHandshake(t *testing.T) {
+	addr, conns := startFakeServer(t)
+	client, err := MakeClient(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 重连后首先发送 handshake, 它的回复被丢弃, 不会被当作之后请求的回复
+	client.SetHandshake(utils.ToCmdLine("auth"))
+	client.Start()
+	defer client.Close()
+
+	if r := client.Send(utils.ToCmdLine("first")); !reply.IsErrorReply(r) {
+		t.Fatalf("expected protocol error reply, got %q", r.ToBytes())
+	}
+	var r resp.Reply
+	for i := 0; i < 3; i++ {
+		r = client.Send(utils.ToCmdLine("second"))
+		if !reply.IsErrorReply(r) {
+			break
+		}
+	}
+	if string(r.ToBytes()) != "+second\r\n" {
+		t.Fatalf("unexpected reply %q", r.ToBytes())
+	}
+	if n := atomic.LoadInt32(conns); n != 2 {
+		t.Errorf("expected 2 connections, got %d", n)
+	}
+}
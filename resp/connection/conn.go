@@ -1,32 +1,55 @@
 package connection
 
 import (
+	"GoRedis/lib/sync/atomic"
 	"GoRedis/lib/sync/wait"
+	"GoRedis/resp/reply"
 	"net"
 	"sync"
+	sysatomic "sync/atomic"
 	"time"
 )
 
+var nextID int64 // 最近一次分配的客户端 ID
+
 // Connection represents a connection with a redis-cli
 type Connection struct {
 	conn         net.Conn
+	id           int64
 	waitingReply wait.Wait //防止给客户端回发结果时，服务被kill，关闭server之前把reply处理完
 	mu           sync.Mutex
 	selectedDB   int
+	closed       atomic.Boolean
+	protocol     int    // RESP 协议版本, 0 表示未协商, 按 RESP2 处理
+	name         string // 客户端名称
+	peer         bool   // 是否是通过认证的集群节点
+
+	multiState bool       // 是否处于 MULTI 状态
+	queue      [][][]byte // MULTI 状态下排队等待 EXEC 的指令
+
+	subsMu   sync.Mutex
+	subs     map[string]struct{} // 订阅的频道
+	patterns map[string]struct{} // 订阅的模式
 }
 
 func NewConn(conn net.Conn) *Connection {
 	return &Connection{
 		conn: conn,
+		id:   sysatomic.AddInt64(&nextID, 1),
 	}
 }
 
+// RemoteAddr 返回客户端地址, 内部使用的连接返回 nil
 func (c *Connection) RemoteAddr() net.Addr {
+	if c.conn == nil {
+		return nil
+	}
 	return c.conn.RemoteAddr()
 }
 
 // Close 与客户断开连接
 func (c *Connection) Close() error {
+	c.closed.Set(true)
 	c.waitingReply.WaitWithTimeout(10 * time.Second) // 等待一次通信结束之后，断开连接
 	_ = c.conn.Close()
 	return nil
@@ -48,6 +71,49 @@ func (c *Connection) Write(b []byte) error {
 	return err
 }
 
+// GetID 返回客户端 ID, 用于 CLIENT ID 和 CLIENT TRACKING 的 REDIRECT
+func (c *Connection) GetID() int64 {
+	return c.id
+}
+
+// GetProtocol 返回协议版本, 未通过 HELLO 协商时为 RESP2
+func (c *Connection) GetProtocol() int {
+	if c.protocol == 0 {
+		return reply.Resp2
+	}
+	return c.protocol
+}
+
+// SetProtocol 设置协议版本
+func (c *Connection) SetProtocol(protocol int) {
+	c.protocol = protocol
+}
+
+// GetName 返回客户端名称
+func (c *Connection) GetName() string {
+	return c.name
+}
+
+// SetName 设置客户端名称
+func (c *Connection) SetName(name string) {
+	c.name = name
+}
+
+// IsPeer 是否是集群中的其它节点
+func (c *Connection) IsPeer() bool {
+	return c.peer
+}
+
+// SetPeer 标记为集群中的其它节点, 之后可以执行节点间的内部指令
+func (c *Connection) SetPeer(peer bool) {
+	c.peer = peer
+}
+
+// IsClosed 连接是否已经关闭
+func (c *Connection) IsClosed() bool {
+	return c.closed.Get()
+}
+
 // GetDBIndex returns selected db
 func (c *Connection) GetDBIndex() int {
 	return c.selectedDB
@@ -57,3 +123,94 @@ func (c *Connection) GetDBIndex() int {
 func (c *Connection) SelectDB(dbNum int) {
 	c.selectedDB = dbNum
 }
+
+// InMultiState 是否处于 MULTI 状态
+func (c *Connection) InMultiState() bool {
+	return c.multiState
+}
+
+// SetMultiState 进入或退出 MULTI 状态, 退出时清空指令队列
+func (c *Connection) SetMultiState(state bool) {
+	if !state {
+		c.queue = nil
+	}
+	c.multiState = state
+}
+
+// GetQueuedCmdLine 返回排队中的指令
+func (c *Connection) GetQueuedCmdLine() [][][]byte {
+	return c.queue
+}
+
+// EnqueueCmd 指令入队
+func (c *Connection) EnqueueCmd(cmdLine [][]byte) {
+	c.queue = append(c.queue, cmdLine)
+}
+
+// ClearQueuedCmds 清空指令队列
+func (c *Connection) ClearQueuedCmds() {
+	c.queue = nil
+}
+
+// Subscribe 记录订阅的频道
+func (c *Connection) Subscribe(channel string) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	if c.subs == nil {
+		c.subs = make(map[string]struct{})
+	}
+	c.subs[channel] = struct{}{}
+}
+
+// UnSubscribe 取消订阅频道
+func (c *Connection) UnSubscribe(channel string) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	delete(c.subs, channel)
+}
+
+// GetChannels 返回订阅的所有频道
+func (c *Connection) GetChannels() []string {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	return setToSlice(c.subs)
+}
+
+// PSubscribe 记录订阅的模式
+func (c *Connection) PSubscribe(pattern string) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	if c.patterns == nil {
+		c.patterns = make(map[string]struct{})
+	}
+	c.patterns[pattern] = struct{}{}
+}
+
+// PUnSubscribe 取消订阅模式
+func (c *Connection) PUnSubscribe(pattern string) {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	delete(c.patterns, pattern)
+}
+
+// GetPatterns 返回订阅的所有模式
+func (c *Connection) GetPatterns() []string {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	return setToSlice(c.patterns)
+}
+
+// SubsCount 订阅的频道和模式的总数
+func (c *Connection) SubsCount() int {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+	return len(c.subs) + len(c.patterns)
+}
+
+func setToSlice(set map[string]struct{}) []string {
+	result := make([]string, 0, len(set))
+	for item := range set {
+		result = append(result, item)
+	}
+	return result
+}
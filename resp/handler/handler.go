@@ -12,9 +12,7 @@ import (
 	"GoRedis/resp/reply"
 	"context"
 	"errors"
-	"io"
 	"net"
-	"strings"
 	"sync"
 )
 
@@ -54,7 +52,7 @@ func (h *RespHandler) closeClient(client *connection.Connection) {
 	h.activeConn.Delete(client)
 }
 
-// Handle 接收并执行 redis 命令
+// Handle 接收并执行 redis 命令: 在当前协程中同步读取并执行指令, 回复之后再读取下一条
 func (h *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 	if h.closing.Get() { // 如果handler当前正处于关闭中
 		_ = conn.Close() // 关闭新的连接
@@ -63,49 +61,53 @@ func (h *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 	client := connection.NewConn(conn)
 	h.activeConn.Store(client, 1)
 
-	ch := parser.ParseStream(conn) // 解析报文
-	for payload := range ch {      //监听管道，死循环
-		// 异常处理
-		if payload.Err != nil {
-			// 用户断开连接 / 意外EOF / 使用了被关闭的链接
-			if payload.Err == io.EOF ||
-				payload.Err == io.ErrUnexpectedEOF ||
-				strings.Contains(payload.Err.Error(), "use of closed network connection") {
-				// 关闭连接
-				h.closeClient(client)
-				logger.Info("connection closed: " + client.RemoteAddr().String())
-				return
-			}
-			// 协议错误
-			errReply := reply.MakeErrReply(payload.Err.Error())
-			err := client.Write(errReply.ToBytes())
-			if !errors.Is(err, nil) {
-				h.closeClient(client)
-				logger.Info("connection closed: " + client.RemoteAddr().String())
-				return
+	reader := parser.NewReader(conn)
+	defer reader.Release()
+	for {
+		cmdLine, err := reader.ReadCommand() // 解析报文
+		if !errors.Is(err, nil) {
+			if parser.IsProtocolError(err) {
+				// 协议错误之后无法确定下一条指令的位置, 与 redis 相同, 回复错误后关闭连接
+				_ = client.Write(reply.MakeErrReply(err.Error()).ToBytes())
 			}
-			continue
+			// 用户断开连接 / 意外EOF / 使用了被关闭的链接
+			h.closeClient(client)
+			logger.Info("connection closed: " + client.RemoteAddr().String())
+			return
 		}
 
-		// 正常执行
-		if payload.Data == nil {
-			logger.Error("empty payload")
-			continue
-		}
-		r, ok := payload.Data.(*reply.MultiBulkReply)
-		if !ok {
-			logger.Error("require multi bulk reply")
-			continue
+		var disconnected <-chan error
+		if database.IsBlockingCommand(string(cmdLine[0])) {
+			disconnected = h.watchDisconnect(client, reader)
 		}
-		result := h.db.Exec(client, r.Args)
+		result := h.db.Exec(client, cmdLine)
 		if result != nil {
-			_ = client.Write(result.ToBytes())
+			_ = client.Write(reply.ToProtocolBytes(result, client.GetProtocol()))
 		} else {
 			_ = client.Write(unknownErrReplyBytes)
 		}
+		if disconnected != nil && <-disconnected != nil {
+			logger.Info("connection closed: " + client.RemoteAddr().String())
+			return
+		}
 	}
 }
 
+// watchDisconnect 阻塞指令(如 BLPOP)执行期间在另一个协程中检查连接是否断开; 断开时立即关闭客户端,
+// 通过 AfterClientClose 唤醒阻塞中的指令. 返回的管道在连接上有新的数据或连接断开后收到结果,
+// 调用方必须在读取下一条指令之前等待该结果, 避免两个协程同时读取
+func (h *RespHandler) watchDisconnect(client *connection.Connection, reader *parser.Reader) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		err := reader.Wait()
+		if !errors.Is(err, nil) {
+			h.closeClient(client)
+		}
+		result <- err
+	}()
+	return result
+}
+
 // Close 关闭所有client
 func (h *RespHandler) Close() error {
 	logger.Info("handler shutting down...")
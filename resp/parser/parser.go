@@ -1,15 +1,17 @@
 package parser
 
 import (
+	"GoRedis/config"
 	"GoRedis/interface/resp"
 	"GoRedis/lib/logger"
 	"GoRedis/resp/reply"
 	"bufio"
+	"bytes"
 	"errors"
 	"io"
+	"math/big"
 	"runtime/debug"
 	"strconv"
-	"strings"
 )
 
 // Payload stores redis.Reply or error
@@ -27,16 +29,29 @@ func ParseStream(reader io.Reader) <-chan *Payload {
 	return ch
 }
 
-type readState struct { //解析器状态
-	readingMultiLine  bool //单行还是多行数据
-	expectedArgsCount int
-	msgType           byte
-	args              [][]byte
-	bulkLen           int64
+// protocolError 协议错误, 与 io 错误区分: 协议错误之后可以继续解析
+type protocolError struct {
+	msg string
 }
 
-func (s *readState) finished() bool {
-	return s.expectedArgsCount > 0 && len(s.args) == s.expectedArgsCount
+func (e *protocolError) Error() string {
+	return "protocol error: " + e.msg
+}
+
+// maxBulkLen 单个字符串的最大长度 proto-max-bulk-len, 长度来自报文, 不检查会按照任意长度分配内存
+func maxBulkLen() int64 {
+	if config.Properties.ProtoMaxBulkLen > 0 {
+		return int64(config.Properties.ProtoMaxBulkLen)
+	}
+	return defaultMaxBulkLen
+}
+
+// preallocSize 根据报文中的元素个数预分配切片时的容量; 元素个数不可信, 只预分配有限的容量
+func preallocSize(n int64) int64 {
+	if n > maxPreallocSize {
+		return maxPreallocSize
+	}
+	return n
 }
 
 // 为了支持异步，解析的结果塞入管道
@@ -49,185 +64,205 @@ func parse0(reader io.Reader, ch chan<- *Payload) {
 		}
 	}()
 	bufReader := bufio.NewReader(reader)
-	var state readState
-	var err error
-	var msg []byte
 	for true { //用户连接之后，进入死循环，不断地读取解析用户发送的信息; 用户断开，跳出死循环
 		// *3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n
-		// 1. read line：取出一行指令, msg = *3
-		var ioErr bool
-		msg, ioErr, err = readLine(bufReader, &state)
+		result, err := readReply(bufReader)
 		if !errors.Is(err, nil) {
-			if ioErr { // 发生io错误，停止解析
+			var protoErr *protocolError
+			if errors.As(err, &protoErr) { // 协议错误，继续解析
 				ch <- &Payload{
 					Err: err,
 				}
-				close(ch)
-				return
+				continue
 			}
-			// 协议错误，清空状态，继续解析
+			// 发生io错误，停止解析
 			ch <- &Payload{
 				Err: err,
 			}
-			state = readState{}
-			continue
+			close(ch)
+			return
 		}
-
-		// 2. 判断是否是多行解析
-		if !state.readingMultiLine {
-			// 此时说明没有初始化，没有打开多行解析模式;
-			if msg[0] == '*' { //没有开始解析
-				err = parseMultiBulkHeader(msg, &state)
-				if !errors.Is(err, nil) {
-					ch <- &Payload{
-						Err: errors.New("protocol error: " + string(msg)),
-					}
-					state = readState{}
-					continue
-				}
-				if state.expectedArgsCount == 0 {
-					ch <- &Payload{
-						Data: &reply.EmptyMultiBulkReply{},
-					}
-					state = readState{}
-					continue
-				}
-			} else if msg[0] == '$' { //$3\r\nSET\r\: 单行没有开始解析
-				err = parseBulkHeader(msg, &state)
-				if !errors.Is(err, nil) {
-					ch <- &Payload{
-						Err: errors.New("protocol error: " + string(msg)),
-					}
-					state = readState{} // reset state
-					continue
-				}
-				if state.bulkLen == -1 { // null bulk reply
-					ch <- &Payload{
-						Data: &reply.NullBulkReply{},
-					}
-					state = readState{} // reset state
-					continue
-				}
-			} else { // +OK\r\n: 就是一个单行的reply
-				result, err := parseSingleLineReply(msg)
-				ch <- &Payload{
-					Data: result,
-					Err:  err,
-				}
-				state = readState{} // reset state
-				continue
-			}
-		} else {
-			// *3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n
-			// parseMultiBulkHeader、parseBulkHeader：state.readingMultiLine -> true
-			// *3\r\n：已经在上面解析了; $3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n：未解析
-			err = readBody(msg, &state) // 读取的数据放到state.args, 反复读取解析指令
-			if !errors.Is(err, nil) {
-				ch <- &Payload{
-					Err: errors.New("protocol error: " + string(msg)),
-				}
-				state = readState{} // reset state
-				continue
-			}
-			// 当前解析已完成
-			if state.finished() {
-				var result resp.Reply
-				if state.msgType == '*' {
-					result = reply.MakeMultiBulkReply(state.args)
-				} else if state.msgType == '$' {
-					result = reply.MakeBulkReply(state.args[0])
-				}
-				ch <- &Payload{
-					Data: result,
-					Err:  err,
-				}
-				state = readState{}
-			}
+		ch <- &Payload{
+			Data: result,
 		}
 	}
 }
 
-// 切割指令($3\r\n; key\r\n), 字符串中的实际内容可能含有\r\n，所以不能简单的按照\r\n切分
+// readLine 按\r\n切分出一行, 返回的内容不含\r\n
+func readLine(bufReader *bufio.Reader) ([]byte, error) {
+	msg, err := bufReader.ReadBytes('\n') //msg: $3\r\n
+	if !errors.Is(err, nil) {
+		return nil, err
+	}
+	if len(msg) < 2 || msg[len(msg)-2] != '\r' { //格式错误
+		return nil, &protocolError{msg: string(msg)}
+	}
+	return msg[:len(msg)-2], nil
+}
+
+// ParseOne 从 data 中解析一个完整的回复, 如把 Reply.ToBytes() 的结果还原为 Reply
+func ParseOne(data []byte) (resp.Reply, error) {
+	return readReply(bufio.NewReader(bytes.NewReader(data)))
+}
+
+// readReply 读取一个完整的回复; 数组的元素递归读取, 因此支持嵌套数组
 // *3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n
-func readLine(bufReader *bufio.Reader, state *readState) ([]byte, bool, error) {
-	// 1. \r\n切分
-	// 2. 之前读取了$, 严格读取字符个数
-	var msg []byte
-	var err error
-	if state.bulkLen == 0 { // 之前没有读到$数字: \r\n切分
-		msg, err = bufReader.ReadBytes('\n') //msg: $3\r\n
+func readReply(bufReader *bufio.Reader) (resp.Reply, error) {
+	line, err := readLine(bufReader)
+	if !errors.Is(err, nil) {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, &protocolError{msg: "empty line"}
+	}
+	switch line[0] {
+	case '*': // *3\r\n
+		return readArray(bufReader, line)
+	case '$': // $3\r\n
+		body, err := readBulk(bufReader, line)
 		if !errors.Is(err, nil) {
-			return nil, true, err
+			return nil, err
 		}
-		if len(msg) == 0 || msg[len(msg)-2] != '\r' { //格式错误
-			return nil, false, errors.New("protocol error: " + string(msg))
+		if body == nil { // null bulk reply
+			return &reply.NullBulkReply{}, nil
 		}
-	} else { // 2. 之前读取了$, 严格读取字符个数
-		// 如果读取到$后的数字是3, state.bulkLen = 3
-		msg = make([]byte, state.bulkLen+2)
-		_, err = io.ReadFull(bufReader, msg) //塞满msg, msg : key\r\n
+		return reply.MakeBulkReply(body), nil
+	case '%', '~', '>': // RESP3 map, set, push
+		return readAggregate(bufReader, line)
+	case '|': // RESP3 attribute: |1\r\n 之后是属性的键值对, 然后是真正的回复
+		attributes, err := readElements(bufReader, line, 2)
 		if !errors.Is(err, nil) {
-			return nil, true, err
+			return nil, err
 		}
-		if len(msg) == 0 ||
-			msg[len(msg)-2] != '\r' ||
-			msg[len(msg)-1] != '\n' { //格式错误
-			return nil, false, errors.New("protocol error: " + string(msg))
+		result, err := readReply(bufReader)
+		if !errors.Is(err, nil) {
+			return nil, err
 		}
-		state.bulkLen = 0
+		return reply.MakeAttributeReply(attributes, result), nil
+	case '!', '=': // RESP3 blob error, verbatim string
+		return readBlob(bufReader, line)
+	default: // +OK\r\n: 就是一个单行的reply
+		return parseSingleLineReply(line)
 	}
-	return msg, false, nil
 }
 
-// *3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n
-// 解析字符串头*3\r\n, 并修改解析器readState 状态
-func parseMultiBulkHeader(msg []byte, state *readState) error {
-	var err error
-	var expectedLine uint64
-	expectedLine, err = strconv.ParseUint(string(msg[1:len(msg)-2]), 10, 32)
+// readBulk 解析$3\r\n, 然后严格读取对应个数的字符; 字符串中的实际内容可能含有\r\n，所以不能简单的按照\r\n切分
+// $-1 返回 nil
+func readBulk(bufReader *bufio.Reader, header []byte) ([]byte, error) {
+	bulkLen, err := strconv.ParseInt(string(header[1:]), 10, 64)
+	if !errors.Is(err, nil) || bulkLen < -1 || bulkLen > maxBulkLen() {
+		return nil, &protocolError{msg: "invalid bulk length"}
+	}
+	if bulkLen == -1 {
+		return nil, nil
+	}
+	body := make([]byte, bulkLen+2)
+	_, err = io.ReadFull(bufReader, body) //塞满body, body : key\r\n
 	if !errors.Is(err, nil) {
-		return errors.New("protocol error: " + string(msg))
+		return nil, err
+	}
+	if body[len(body)-2] != '\r' || body[len(body)-1] != '\n' { //格式错误
+		return nil, &protocolError{msg: string(body)}
+	}
+	return body[:len(body)-2], nil
+}
+
+// readArray 解析数组; 元素全部是字符串时返回 MultiBulkReply(如客户端发送的指令), 否则返回 MultiRawReply
+func readArray(bufReader *bufio.Reader, header []byte) (resp.Reply, error) {
+	expectedLine, err := strconv.ParseInt(string(header[1:]), 10, 64)
+	if !errors.Is(err, nil) || expectedLine < -1 || expectedLine > maxMultiBulkLen {
+		return nil, &protocolError{msg: "invalid multibulk length"}
+	}
+	if expectedLine == -1 { // null array
+		return &reply.NullMultiBulkReply{}, nil
 	}
 	if expectedLine == 0 {
-		state.expectedArgsCount = 0
-		return nil
-	} else if expectedLine > 0 {
-		state.msgType = msg[0]                      //*
-		state.readingMultiLine = true               //多行状态
-		state.expectedArgsCount = int(expectedLine) //3
-		state.args = make([][]byte, 0, expectedLine)
-		return nil
-	} else {
-		return errors.New("protocol error: " + string(msg))
+		return &reply.EmptyMultiBulkReply{}, nil
+	}
+	replies := make([]resp.Reply, 0, preallocSize(expectedLine))
+	args := make([][]byte, 0, preallocSize(expectedLine))
+	allBulk := true
+	for i := int64(0); i < expectedLine; i++ {
+		element, err := readReply(bufReader)
+		if !errors.Is(err, nil) {
+			return nil, err
+		}
+		replies = append(replies, element)
+		switch r := element.(type) {
+		case *reply.BulkReply:
+			args = append(args, r.Arg)
+		case *reply.NullBulkReply:
+			args = append(args, nil)
+		default:
+			allBulk = false
+		}
+	}
+	if allBulk {
+		return reply.MakeMultiBulkReply(args), nil
+	}
+	return reply.MakeMultiRawReply(replies), nil
+}
+
+// readElements 读取聚合类型的元素, 元素个数为 header 中的数量乘以 multiple(map 和 attribute 的每一项包含键和值)
+func readElements(bufReader *bufio.Reader, header []byte, multiple int64) ([]resp.Reply, error) {
+	size, err := strconv.ParseInt(string(header[1:]), 10, 64)
+	if !errors.Is(err, nil) || size < 0 || size > maxMultiBulkLen {
+		return nil, &protocolError{msg: "invalid multibulk length"}
+	}
+	elements := make([]resp.Reply, 0, preallocSize(size*multiple))
+	for i := int64(0); i < size*multiple; i++ {
+		element, err := readReply(bufReader)
+		if !errors.Is(err, nil) {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+// readAggregate 解析 RESP3 的 map(%2\r\n), set(~2\r\n) 和 push(>2\r\n)
+func readAggregate(bufReader *bufio.Reader, header []byte) (resp.Reply, error) {
+	if header[0] == '%' {
+		pairs, err := readElements(bufReader, header, 2)
+		if !errors.Is(err, nil) {
+			return nil, err
+		}
+		return reply.MakeMapReply(pairs), nil
 	}
+	elements, err := readElements(bufReader, header, 1)
+	if !errors.Is(err, nil) {
+		return nil, err
+	}
+	if header[0] == '~' {
+		return reply.MakeSetReply(elements), nil
+	}
+	return reply.MakePushReply(elements), nil
 }
 
-// $3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n
-// 解析$3\r\n
-func parseBulkHeader(msg []byte, state *readState) error {
-	var err error
-	state.bulkLen, err = strconv.ParseInt(string(msg[1:len(msg)-2]), 10, 64)
+// readBlob 解析 RESP3 的 blob error(!21\r\nSYNTAX invalid syntax\r\n) 和 verbatim string(=15\r\ntxt:Some string\r\n)
+func readBlob(bufReader *bufio.Reader, header []byte) (resp.Reply, error) {
+	body, err := readBulk(bufReader, header)
 	if !errors.Is(err, nil) {
-		return errors.New("protocol error: " + string(msg))
+		return nil, err
+	}
+	if body == nil {
+		return nil, &protocolError{msg: string(header)}
+	}
+	if header[0] == '!' {
+		return reply.MakeErrReply(string(body)), nil
 	}
-	if state.bulkLen == -1 { // null bulk
-		return nil
-	} else if state.bulkLen > 0 {
-		state.msgType = msg[0]
-		state.readingMultiLine = true
-		state.expectedArgsCount = 1
-		state.args = make([][]byte, 0, 1)
-		return nil
-	} else {
-		return errors.New("protocol error: " + string(msg))
+	if len(body) < 4 || body[3] != ':' {
+		return nil, &protocolError{msg: string(body)}
 	}
+	return reply.MakeVerbatimReply(string(body[:3]), body[4:]), nil
 }
 
-//+OK\r\n; -err\r\n; :5\r\n
-func parseSingleLineReply(msg []byte) (resp.Reply, error) {
-	str := strings.TrimSuffix(string(msg), "\r\n")
+// +OK\r\n; -err\r\n; :5\r\n
+// RESP3: _\r\n; ,1.5\r\n; #t\r\n; (3492890328409238509324850943850943825024385\r\n
+func parseSingleLineReply(line []byte) (resp.Reply, error) {
+	str := string(line)
 	var result resp.Reply
-	switch msg[0] {
+	switch line[0] {
 	case '+': // +OK\r\n
 		result = reply.MakeStatusReply(str[1:])
 	case '-': // -err\r\n
@@ -235,31 +270,32 @@ func parseSingleLineReply(msg []byte) (resp.Reply, error) {
 	case ':': // :5\r\n
 		val, err := strconv.ParseInt(str[1:], 10, 64)
 		if err != nil {
-			return nil, errors.New("protocol error: " + string(msg))
+			return nil, &protocolError{msg: str}
 		}
 		result = reply.MakeIntReply(val)
-	}
-	return result, nil
-}
-
-// $3\r\n  SET\r\n  $3\r\n  key\r\n  $5\r\n  value\r\n
-// 解析内容
-func readBody(msg []byte, state *readState) error {
-	line := msg[0 : len(msg)-2]
-	var err error
-	if line[0] == '$' {
-		// $3\r\n 取出3，并塞入state.bulkLen
-		state.bulkLen, err = strconv.ParseInt(string(line[1:]), 10, 64)
-		if !errors.Is(err, nil) {
-			return errors.New("protocol error: " + string(msg))
+	case '_': // RESP3 null
+		if len(line) != 1 {
+			return nil, &protocolError{msg: str}
 		}
-		// $0\r\n
-		if state.bulkLen <= 0 {
-			state.args = append(state.args, []byte{})
-			state.bulkLen = 0
+		result = &reply.NullBulkReply{}
+	case ',': // RESP3 double
+		val, err := strconv.ParseFloat(str[1:], 64)
+		if err != nil {
+			return nil, &protocolError{msg: str}
+		}
+		result = reply.MakeDoubleReply(val)
+	case '#': // RESP3 boolean
+		if str != "#t" && str != "#f" {
+			return nil, &protocolError{msg: str}
 		}
-	} else { // SET\r\n
-		state.args = append(state.args, line)
+		result = reply.MakeBoolReply(str == "#t")
+	case '(': // RESP3 big number
+		if _, ok := new(big.Int).SetString(str[1:], 10); !ok {
+			return nil, &protocolError{msg: str}
+		}
+		result = reply.MakeBigNumReply(str[1:])
+	default:
+		return nil, &protocolError{msg: str}
 	}
-	return nil
+	return result, nil
 }
@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func parseAll(t *testing.T, data string) []*Payload {
+	t.Helper()
+	var payloads []*Payload
+	for payload := range ParseStream(bytes.NewReader([]byte(data))) {
+		if errors.Is(payload.Err, io.EOF) {
+			break
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads
+}
+
+func TestParseStream(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"command", "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"},
+		{"status", "+OK\r\n"},
+		{"error", "-ERR unknown\r\n"},
+		{"integer", ":-42\r\n"},
+		{"bulk", "$5\r\nhello\r\n"},
+		{"bulk with crlf", "$7\r\nhel\r\nlo\r\n"},
+		{"bulk starts with $", "$3\r\n$ab\r\n"},
+		{"empty bulk", "$0\r\n\r\n"},
+		{"null bulk", "$-1\r\n"},
+		{"empty array", "*0\r\n"},
+		{"array with null", "*2\r\n$1\r\na\r\n$-1\r\n"},
+		{"mixed array", "*3\r\n:1\r\n+OK\r\n$1\r\na\r\n"},
+		{"nested array", "*2\r\n*2\r\n$1\r\na\r\n:1\r\n*0\r\n"},
+		{"null array", "*-1\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payloads := parseAll(t, tt.input)
+			if len(payloads) != 1 {
+				t.Fatalf("expected 1 payload, got %d", len(payloads))
+			}
+			if payloads[0].Err != nil {
+				t.Fatalf("unexpected error: %v", payloads[0].Err)
+			}
+			if got := string(payloads[0].Data.ToBytes()); got != tt.input {
+				t.Errorf("round trip mismatch: got %q, want %q", got, tt.input)
+			}
+		})
+	}
+}
+
+func TestParseStreamPipeline(t *testing.T) {
+	input := "*1\r\n$4\r\nPING\r\n+OK\r\n:1\r\n"
+	payloads := parseAll(t, input)
+	if len(payloads) != 3 {
+		t.Fatalf("expected 3 payloads, got %d", len(payloads))
+	}
+	var out []byte
+	for _, payload := range payloads {
+		out = append(out, payload.Data.ToBytes()...)
+	}
+	if string(out) != input {
+		t.Errorf("got %q, want %q", out, input)
+	}
+}
+
+func TestParseStreamProtocolError(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"bad integer", ":abc\r\n"},
+		{"bad bulk length", "$x\r\n"},
+		{"bad array length", "*-2\r\n"},
+		{"unknown type", "?\r\n"},
+		{"missing cr", "+OK\n"},
+		{"too big bulk", "$536870913\r\n"},
+		{"too many elements", "*2147483648\r\n"},
+		{"too many map entries", "%2147483648\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 协议错误之后继续解析后面的报文
+			payloads := parseAll(t, tt.input+"+OK\r\n")
+			if len(payloads) != 2 {
+				t.Fatalf("expected 2 payloads, got %d", len(payloads))
+			}
+			var protoErr *protocolError
+			if !errors.As(payloads[0].Err, &protoErr) {
+				t.Errorf("expected protocol error, got %v", payloads[0].Err)
+			}
+			if payloads[1].Err != nil || string(payloads[1].Data.ToBytes()) != "+OK\r\n" {
+				t.Errorf("expected +OK after protocol error, got %+v", payloads[1])
+			}
+		})
+	}
+}
+
+func TestParseStreamIOError(t *testing.T) {
+	// 报文不完整时以 io 错误结束, 管道关闭
+	var errs []error
+	for payload := range ParseStream(bytes.NewReader([]byte("$5\r\nhel"))) {
+		errs = append(errs, payload.Err)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], io.ErrUnexpectedEOF) {
+		t.Errorf("expected a single unexpected EOF, got %v", errs)
+	}
+}
@@ -0,0 +1,250 @@
+package parser
+
+import (
+	"GoRedis/interface/resp"
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"sync"
+)
+
+const (
+	readerBufSize     = 16 * 1024
+	bigArgSize        = 32 * 1024 // 不小于该长度的参数直接读入单独分配的内存, 避免复制
+	maxScratchSize    = 64 * 1024 // 复用的缓冲区超过该长度时在指令结束后释放
+	defaultMaxBulkLen = 512 * 1024 * 1024
+	maxMultiBulkLen   = 1024 * 1024 // 数组的最大元素个数, 与 redis 相同
+	maxPreallocSize   = 1024        // 根据报文中的元素个数预分配的最大容量
+)
+
+// bufReaderPool 连接关闭后读缓冲区归还到池中, 供新的连接使用
+var bufReaderPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewReaderSize(nil, readerBufSize)
+	},
+}
+
+// Reader 在调用方的协程中同步读取 RESP 报文, 不需要 ParseStream 的解析协程和管道;
+// 读缓冲区来自 bufReaderPool, 读取参数的临时缓冲区在指令之间复用
+type Reader struct {
+	br      *bufio.Reader
+	scratch []byte    // 读取指令参数的临时缓冲区
+	spans   []argSpan // 参数在 scratch 中的位置
+}
+
+// argSpan 参数为 scratch[start:end], 或单独分配的 big
+type argSpan struct {
+	start int
+	end   int
+	big   []byte
+}
+
+// NewReader 创建 Reader, 不再使用时调用 Release 归还读缓冲区
+func NewReader(rd io.Reader) *Reader {
+	br := bufReaderPool.Get().(*bufio.Reader)
+	br.Reset(rd)
+	return &Reader{br: br}
+}
+
+// Release 归还读缓冲区, 之后不能再使用 Reader
+func (r *Reader) Release() {
+	r.br.Reset(nil)
+	bufReaderPool.Put(r.br)
+	r.br = nil
+	r.scratch = nil
+	r.spans = nil
+}
+
+// IsProtocolError 是否为协议错误; 其它错误是 io 错误, 说明连接已经断开
+func IsProtocolError(err error) bool {
+	var protoErr *protocolError
+	return errors.As(err, &protoErr)
+}
+
+// Wait 阻塞直到连接上有新的数据或连接断开, 不消耗数据
+func (r *Reader) Wait() error {
+	_, err := r.br.Peek(1)
+	return err
+}
+
+// ReadReply 读取一个完整的回复, 供集群节点间的客户端使用
+func (r *Reader) ReadReply() (resp.Reply, error) {
+	return readReply(r.br)
+}
+
+// ReadCommand 读取客户端发送的一条指令: 以 * 开头的是 RESP 数组, 其它的是 inline 指令.
+// 单个参数的长度不能超过 proto-max-bulk-len; 返回的参数归调用方所有, 可以长期持有.
+// 解析过程复用缓冲区, 不分配内存; 但返回的参数需要调用方持有, 所以并不是零分配:
+// 除了较大的参数外, 所有参数共用一块内存, 每条指令分配两次(参数的内容和参数切片)
+func (r *Reader) ReadCommand() ([][]byte, error) {
+	for {
+		first, err := r.br.Peek(1)
+		if !errors.Is(err, nil) {
+			return nil, err
+		}
+		var args [][]byte
+		if first[0] == '*' {
+			args, err = r.readMultiBulk()
+		} else {
+			args, err = r.readInline()
+		}
+		if !errors.Is(err, nil) {
+			return nil, err
+		}
+		// 与 redis 相同, 忽略空行和空数组
+		if len(args) > 0 {
+			return args, nil
+		}
+	}
+}
+
+// readLine 读取一行, 返回的内容不含\r\n, 在下一次读取之前有效
+func (r *Reader) readLine() ([]byte, error) {
+	line, err := r.br.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, &protocolError{msg: "too big header"}
+	}
+	if !errors.Is(err, nil) {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, &protocolError{msg: string(line)}
+	}
+	return line[:len(line)-2], nil
+}
+
+// readMultiBulk *3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n
+func (r *Reader) readMultiBulk() ([][]byte, error) {
+	line, err := r.readLine()
+	if !errors.Is(err, nil) {
+		return nil, err
+	}
+	count, ok := parseLength(line[1:])
+	if !ok || count > maxMultiBulkLen {
+		return nil, &protocolError{msg: "invalid multibulk length"}
+	}
+	if count <= 0 {
+		return nil, nil
+	}
+	maxBulkLen := maxBulkLen()
+	r.scratch = r.scratch[:0]
+	r.spans = r.spans[:0]
+	for i := int64(0); i < count; i++ {
+		line, err := r.readLine()
+		if !errors.Is(err, nil) {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, &protocolError{msg: "expected '$', got '" + string(line) + "'"}
+		}
+		size, ok := parseLength(line[1:])
+		if !ok || size < 0 || size > maxBulkLen {
+			return nil, &protocolError{msg: "invalid bulk length"}
+		}
+		var span argSpan
+		if size >= bigArgSize {
+			span.big = make([]byte, size)
+			if _, err := io.ReadFull(r.br, span.big); !errors.Is(err, nil) {
+				return nil, err
+			}
+		} else {
+			span.start = len(r.scratch)
+			span.end = span.start + int(size)
+			if span.end > cap(r.scratch) {
+				scratch := make([]byte, span.start, 2*span.end)
+				copy(scratch, r.scratch)
+				r.scratch = scratch
+			}
+			r.scratch = r.scratch[:span.end]
+			if _, err := io.ReadFull(r.br, r.scratch[span.start:]); !errors.Is(err, nil) {
+				return nil, err
+			}
+		}
+		if err := r.readCRLF(); !errors.Is(err, nil) {
+			return nil, err
+		}
+		r.spans = append(r.spans, span)
+	}
+
+	data := make([]byte, len(r.scratch))
+	copy(data, r.scratch)
+	args := make([][]byte, len(r.spans))
+	for i, span := range r.spans {
+		if span.big != nil {
+			args[i] = span.big
+		} else {
+			// 限制容量, 调用方 append 时不会覆盖相邻的参数
+			args[i] = data[span.start:span.end:span.end]
+		}
+	}
+	if cap(r.scratch) > maxScratchSize {
+		r.scratch = nil
+	}
+	return args, nil
+}
+
+func (r *Reader) readCRLF() error {
+	crlf, err := r.br.Peek(2)
+	if !errors.Is(err, nil) {
+		return err
+	}
+	if crlf[0] != '\r' || crlf[1] != '\n' {
+		return &protocolError{msg: "bad bulk string format"}
+	}
+	_, err = r.br.Discard(2)
+	return err
+}
+
+// readInline 读取 inline 指令, 如 telnet 中输入的 PING
+func (r *Reader) readInline() ([][]byte, error) {
+	r.scratch = r.scratch[:0]
+	for {
+		chunk, err := r.br.ReadSlice('\n')
+		r.scratch = append(r.scratch, chunk...)
+		if len(r.scratch) > maxInlineSize {
+			r.scratch = nil
+			return nil, &protocolError{msg: "too big inline request"}
+		}
+		if errors.Is(err, nil) {
+			break
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return nil, err
+		}
+	}
+	// telnet 发送 \r\n, nc 可能只发送 \n
+	line := r.scratch[:len(r.scratch)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return splitArgs(line)
+}
+
+// parseLength 解析报文头中的长度, 不分配内存
+func parseLength(b []byte) (int64, bool) {
+	if len(b) == 0 {
+		return 0, false
+	}
+	negative := b[0] == '-'
+	if negative {
+		b = b[1:]
+		if len(b) == 0 {
+			return 0, false
+		}
+	}
+	var n int64
+	for _, ch := range b {
+		if ch < '0' || ch > '9' {
+			return 0, false
+		}
+		if n > (math.MaxInt64-int64(ch-'0'))/10 {
+			return 0, false
+		}
+		n = n*10 + int64(ch-'0')
+	}
+	if negative {
+		n = -n
+	}
+	return n, true
+}
@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"GoRedis/resp/reply"
+	"bytes"
+	"io"
+	"testing"
+)
+
+// repeatReader 重复返回同一段报文 n 次, 模拟客户端持续发送指令
+type repeatReader struct {
+	data   []byte
+	remain int
+	offset int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	if r.remain == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[r.offset:])
+	r.offset += n
+	if r.offset == len(r.data) {
+		r.offset = 0
+		r.remain--
+	}
+	return n, nil
+}
+
+func TestReaderReadCommandLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"too many arguments", "*1048577\r\n"},
+		{"too big argument", "*1\r\n$536870913\r\n"},
+		{"negative argument length", "*1\r\n$-1\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := NewReader(bytes.NewReader([]byte(tt.input)))
+			defer reader.Release()
+			if _, err := reader.ReadCommand(); !IsProtocolError(err) {
+				t.Errorf("expected protocol error, got %v", err)
+			}
+		})
+	}
+
+	reader := NewReader(bytes.NewReader([]byte("*1048577\r\n")))
+	defer reader.Release()
+	if _, err := reader.ReadReply(); !IsProtocolError(err) {
+		t.Errorf("expected protocol error from ReadReply, got %v", err)
+	}
+}
+
+func makeBenchCommand() []byte {
+	return reply.MakeMultiBulkReply([][]byte{
+		[]byte("SET"),
+		[]byte("user:10086:profile"),
+		[]byte("{\"name\":\"GoRedis\",\"age\":18,\"tags\":[\"a\",\"b\",\"c\"]}"),
+	}).ToBytes()
+}
+
+func BenchmarkParseStream(b *testing.B) {
+	cmd := makeBenchCommand()
+	b.SetBytes(int64(len(cmd)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for payload := range ParseStream(&repeatReader{data: cmd, remain: b.N}) {
+		if payload.Err != nil && payload.Err != io.EOF {
+			b.Fatal(payload.Err)
+		}
+	}
+}
+
+func BenchmarkReaderReadCommand(b *testing.B) {
+	cmd := makeBenchCommand()
+	b.SetBytes(int64(len(cmd)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	reader := NewReader(&repeatReader{data: cmd, remain: b.N})
+	defer reader.Release()
+	for {
+		args, err := reader.ReadCommand()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(args) != 3 {
+			b.Fatalf("expected 3 args, got %d", len(args))
+		}
+	}
+}
+
+func BenchmarkReaderReadReply(b *testing.B) {
+	data := reply.MakeBulkReply([]byte("{\"name\":\"GoRedis\",\"age\":18}")).ToBytes()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	reader := NewReader(&repeatReader{data: data, remain: b.N})
+	defer reader.Release()
+	for {
+		if _, err := reader.ReadReply(); err != nil {
+			if err == io.EOF {
+				break
+			}
+			b.Fatal(err)
+		}
+	}
+}
@@ -47,6 +47,22 @@ func MakeNullBulkBytes() *NullBulkReply {
 	return theNullBulkBytes
 }
 
+// NullMultiBulkReply 空数组(nil), 如 BLPOP 超时
+type NullMultiBulkReply struct {
+}
+
+var nullMultiBulkBytes = []byte("*-1\r\n")
+
+func (n NullMultiBulkReply) ToBytes() []byte {
+	return nullMultiBulkBytes
+}
+
+var theNullMultiBulkBytes = new(NullMultiBulkReply)
+
+func MakeNullMultiBulkBytes() *NullMultiBulkReply {
+	return theNullMultiBulkBytes
+}
+
 // EmptyMultiBulkReply 空数组
 type EmptyMultiBulkReply struct {
 }
@@ -63,6 +79,22 @@ func MakeEmptyMultiBulkBytes() *EmptyMultiBulkReply {
 	return theEmptyMultiBulkBytes
 }
 
+// QueuedReply MULTI 状态下指令入队的回复
+type QueuedReply struct {
+}
+
+var queuedBytes = []byte("+QUEUED\r\n")
+
+func (q QueuedReply) ToBytes() []byte {
+	return queuedBytes
+}
+
+var theQueuedReply = new(QueuedReply)
+
+func MakeQueuedReply() *QueuedReply {
+	return theQueuedReply
+}
+
 // NoReply 回复空
 type NoReply struct {
 }
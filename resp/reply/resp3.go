@@ -0,0 +1,326 @@
+package reply
+
+import (
+	"GoRedis/interface/resp"
+	"bytes"
+	"math"
+	"strconv"
+)
+
+// protocol versions negotiated by HELLO
+const (
+	// Resp2 is the default protocol of new connections
+	Resp2 = 2
+	// Resp3 is enabled by HELLO 3
+	Resp3 = 3
+)
+
+var resp3NullBytes = []byte("_" + CRLF)
+
+// Resp3Reply is a reply which has a different representation in RESP3.
+// ToBytes always returns the RESP2 representation, which is used by aof, cluster relay and Lua scripts
+type Resp3Reply interface {
+	resp.Reply
+	ToResp3Bytes() []byte
+}
+
+// ToProtocolBytes marshals the reply with the given protocol version
+func ToProtocolBytes(r resp.Reply, protocol int) []byte {
+	if protocol >= Resp3 {
+		if r3, ok := r.(Resp3Reply); ok {
+			return r3.ToResp3Bytes()
+		}
+	}
+	return r.ToBytes()
+}
+
+// writeAggregate writes the header and elements of an aggregate reply
+func writeAggregate(prefix string, size int, elements []resp.Reply, protocol int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(prefix + strconv.Itoa(size) + CRLF)
+	for _, element := range elements {
+		buf.Write(ToProtocolBytes(element, protocol))
+	}
+	return buf.Bytes()
+}
+
+/* ---- RESP3 representation of RESP2 replies ---- */
+
+// ToResp3Bytes marshals null bulk string as RESP3 null
+func (r *BulkReply) ToResp3Bytes() []byte {
+	if r.Arg == nil {
+		return resp3NullBytes
+	}
+	return r.ToBytes()
+}
+
+// ToResp3Bytes marshals nil elements as RESP3 null
+func (r *MultiBulkReply) ToResp3Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("*" + strconv.Itoa(len(r.Args)) + CRLF)
+	for _, arg := range r.Args {
+		if arg == nil {
+			buf.Write(resp3NullBytes)
+		} else {
+			buf.WriteString("$" + strconv.Itoa(len(arg)) + CRLF + string(arg) + CRLF)
+		}
+	}
+	return buf.Bytes()
+}
+
+// ToResp3Bytes marshals every element in RESP3
+func (r *MultiRawReply) ToResp3Bytes() []byte {
+	return writeAggregate("*", len(r.Replies), r.Replies, Resp3)
+}
+
+// ToResp3Bytes marshals null bulk string as RESP3 null
+func (n NullBulkReply) ToResp3Bytes() []byte {
+	return resp3NullBytes
+}
+
+// ToResp3Bytes marshals null array as RESP3 null
+func (n NullMultiBulkReply) ToResp3Bytes() []byte {
+	return resp3NullBytes
+}
+
+/* ---- Map Reply ---- */
+
+// MapReply stores key-value pairs, Pairs is a flat list: key1, value1, key2, value2 ...
+// RESP2 clients receive a flat array
+type MapReply struct {
+	Pairs []resp.Reply
+}
+
+// MakeMapReply creates MapReply from a flat list of keys and values
+func MakeMapReply(pairs []resp.Reply) *MapReply {
+	return &MapReply{
+		Pairs: pairs,
+	}
+}
+
+// MakeBulkMapReply creates MapReply whose keys and values are all bulk strings
+func MakeBulkMapReply(pairs [][]byte) *MapReply {
+	replies := make([]resp.Reply, len(pairs))
+	for i, arg := range pairs {
+		replies[i] = MakeBulkReply(arg)
+	}
+	return MakeMapReply(replies)
+}
+
+// ToBytes marshal redis.Reply
+func (r *MapReply) ToBytes() []byte {
+	return writeAggregate("*", len(r.Pairs), r.Pairs, Resp2)
+}
+
+// ToResp3Bytes marshal redis.Reply
+func (r *MapReply) ToResp3Bytes() []byte {
+	return writeAggregate("%", len(r.Pairs)/2, r.Pairs, Resp3)
+}
+
+/* ---- Set Reply ---- */
+
+// SetReply stores an unordered collection of distinct elements, RESP2 clients receive an array
+type SetReply struct {
+	Members []resp.Reply
+}
+
+// MakeSetReply creates SetReply
+func MakeSetReply(members []resp.Reply) *SetReply {
+	return &SetReply{
+		Members: members,
+	}
+}
+
+// MakeBulkSetReply creates SetReply whose members are all bulk strings
+func MakeBulkSetReply(members [][]byte) *SetReply {
+	replies := make([]resp.Reply, len(members))
+	for i, member := range members {
+		replies[i] = MakeBulkReply(member)
+	}
+	return MakeSetReply(replies)
+}
+
+// ToBytes marshal redis.Reply
+func (r *SetReply) ToBytes() []byte {
+	return writeAggregate("*", len(r.Members), r.Members, Resp2)
+}
+
+// ToResp3Bytes marshal redis.Reply
+func (r *SetReply) ToResp3Bytes() []byte {
+	return writeAggregate("~", len(r.Members), r.Members, Resp3)
+}
+
+/* ---- Push Reply ---- */
+
+// PushReply stores out-of-band data such as pub/sub messages and invalidation messages,
+// RESP2 clients receive an array
+type PushReply struct {
+	Replies []resp.Reply
+}
+
+// MakePushReply creates PushReply
+func MakePushReply(replies []resp.Reply) *PushReply {
+	return &PushReply{
+		Replies: replies,
+	}
+}
+
+// ToBytes marshal redis.Reply
+func (r *PushReply) ToBytes() []byte {
+	return writeAggregate("*", len(r.Replies), r.Replies, Resp2)
+}
+
+// ToResp3Bytes marshal redis.Reply
+func (r *PushReply) ToResp3Bytes() []byte {
+	return writeAggregate(">", len(r.Replies), r.Replies, Resp3)
+}
+
+/* ---- Attribute Reply ---- */
+
+// AttributeReply attaches auxiliary key-value pairs to a reply, RESP2 clients receive the reply only
+type AttributeReply struct {
+	Attributes []resp.Reply // flat list of keys and values
+	Reply      resp.Reply
+}
+
+// MakeAttributeReply creates AttributeReply
+func MakeAttributeReply(attributes []resp.Reply, r resp.Reply) *AttributeReply {
+	return &AttributeReply{
+		Attributes: attributes,
+		Reply:      r,
+	}
+}
+
+// ToBytes marshal redis.Reply
+func (r *AttributeReply) ToBytes() []byte {
+	return r.Reply.ToBytes()
+}
+
+// ToResp3Bytes marshal redis.Reply
+func (r *AttributeReply) ToResp3Bytes() []byte {
+	buf := writeAggregate("|", len(r.Attributes)/2, r.Attributes, Resp3)
+	return append(buf, ToProtocolBytes(r.Reply, Resp3)...)
+}
+
+/* ---- Double Reply ---- */
+
+// DoubleReply stores a floating point number, RESP2 clients receive a bulk string
+type DoubleReply struct {
+	Value float64
+}
+
+// MakeDoubleReply creates DoubleReply
+func MakeDoubleReply(value float64) *DoubleReply {
+	return &DoubleReply{
+		Value: value,
+	}
+}
+
+// FormatDouble formats float the same way as redis: inf, -inf, nan,
+// scientific notation for very large or small numbers
+func FormatDouble(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	case math.IsNaN(value):
+		return "nan"
+	}
+	abs := math.Abs(value)
+	if abs == 0 || (abs >= 1e-4 && abs < 1e17) {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// ToBytes marshal redis.Reply
+func (r *DoubleReply) ToBytes() []byte {
+	str := FormatDouble(r.Value)
+	return []byte("$" + strconv.Itoa(len(str)) + CRLF + str + CRLF)
+}
+
+// ToResp3Bytes marshal redis.Reply
+func (r *DoubleReply) ToResp3Bytes() []byte {
+	return []byte("," + FormatDouble(r.Value) + CRLF)
+}
+
+/* ---- Bool Reply ---- */
+
+// BoolReply stores a boolean, RESP2 clients receive integer 1 or 0
+type BoolReply struct {
+	Value bool
+}
+
+// MakeBoolReply creates BoolReply
+func MakeBoolReply(value bool) *BoolReply {
+	return &BoolReply{
+		Value: value,
+	}
+}
+
+// ToBytes marshal redis.Reply
+func (r *BoolReply) ToBytes() []byte {
+	if r.Value {
+		return []byte(":1" + CRLF)
+	}
+	return []byte(":0" + CRLF)
+}
+
+// ToResp3Bytes marshal redis.Reply
+func (r *BoolReply) ToResp3Bytes() []byte {
+	if r.Value {
+		return []byte("#t" + CRLF)
+	}
+	return []byte("#f" + CRLF)
+}
+
+/* ---- Big Number Reply ---- */
+
+// BigNumReply stores an integer out of the range of int64, RESP2 clients receive a bulk string
+type BigNumReply struct {
+	Value string
+}
+
+// MakeBigNumReply creates BigNumReply
+func MakeBigNumReply(value string) *BigNumReply {
+	return &BigNumReply{
+		Value: value,
+	}
+}
+
+// ToBytes marshal redis.Reply
+func (r *BigNumReply) ToBytes() []byte {
+	return []byte("$" + strconv.Itoa(len(r.Value)) + CRLF + r.Value + CRLF)
+}
+
+// ToResp3Bytes marshal redis.Reply
+func (r *BigNumReply) ToResp3Bytes() []byte {
+	return []byte("(" + r.Value + CRLF)
+}
+
+/* ---- Verbatim Reply ---- */
+
+// VerbatimReply stores a text with its format, e.g. txt or mkd. RESP2 clients receive the text as a bulk string
+type VerbatimReply struct {
+	Format string // exactly 3 characters
+	Text   []byte
+}
+
+// MakeVerbatimReply creates VerbatimReply
+func MakeVerbatimReply(format string, text []byte) *VerbatimReply {
+	return &VerbatimReply{
+		Format: format,
+		Text:   text,
+	}
+}
+
+// ToBytes marshal redis.Reply
+func (r *VerbatimReply) ToBytes() []byte {
+	return MakeBulkReply(r.Text).ToBytes()
+}
+
+// ToResp3Bytes marshal redis.Reply
+func (r *VerbatimReply) ToResp3Bytes() []byte {
+	return []byte("=" + strconv.Itoa(len(r.Format)+1+len(r.Text)) + CRLF + r.Format + ":" + string(r.Text) + CRLF)
+}